@@ -1,30 +1,28 @@
 package airtel
 
 import (
+	"context"
 	"embed"
 	"encoding/csv"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/celldb"
+	"github.com/jalad-shrimali/cdr-filter/internal/enrich"
+	"github.com/jalad-shrimali/cdr-filter/internal/pseudo"
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+	"github.com/jalad-shrimali/cdr-filter/internal/summary"
 )
 
 /* ────────── canonical 26-column layout ────────── */
-var targetHeader = []string{
-	"CdrNo", "B Party", "Date", "Time", "Duration", "Call Type",
-	"First Cell ID", "First Cell ID Address", "Last Cell ID", "Last Cell ID Address",
-	"IMEI", "IMSI", "Roaming",
-	"Main City(First CellID)", "Sub City (First CellID)", "Lat-Long-Azimuth (First CellID)",
-	"Crime", "Circle", "Operator", "LRN",
-	"CallForward", "B Party Provider", "B Party Circle", "B Party Operator",
-	"Type", "IMEI Manufacturer",
-}
+var targetHeader = canon.Header()
 
 /* column synonyms */
 var synonyms = map[string]string{
@@ -40,7 +38,7 @@ var synonyms = map[string]string{
 	"imei":                      "IMEI",
 	"imsi":                      "IMSI",
 	"roam nw":                   "Roaming",
-	"roaming circle name":       "Circle",
+	"roaming circle name":       "Roaming",
 	"circle":                    "Circle",
 	"operator":                  "Operator",
 	"lrn":                       "LRN",
@@ -52,9 +50,49 @@ var synonyms = map[string]string{
 	"b party circle":            "B Party Circle",
 	"b party operator":          "B Party Operator",
 	"service type":              "Type",
+	"connection type":           "Connection Type",
+	"subscriber type":           "Connection Type",
 	"crime":                    "Crime",
+	"b party cgi":              "B Party Cell ID",
+	"b party cell id":          "B Party Cell ID",
 }
 
+/* export layouts: the current one with the "Target No" header and CGI
+   location columns, the older, narrower one keyed by "MSISDN", and the
+   enterprise (leased-line, SIP trunk) one with "A Number"/"B Number",
+   call start in UTC and no cells */
+var formats = []canon.Format{
+	{Name: "v2", Match: []string{"target no", "first cgi", "last cgi"},
+		Columns: map[string][]string{"First Cell ID": {"first cgi"}, "Last Cell ID": {"last cgi"}}},
+	{Name: "v1", Match: []string{"msisdn", "first cell id", "last cell id"},
+		Columns: map[string][]string{
+			"B Party":       {"other party no"},
+			"Duration":      {"duration"},
+			"First Cell ID": {"first cell id"},
+			"Last Cell ID":  {"last cell id"},
+		}},
+	{Name: "enterprise", Match: []string{"a number", "b number"}, Zone: time.UTC,
+		Columns: map[string][]string{
+			"B Party":   {"b number"},
+			"Call Type": {"call direction"},
+			"Date":      {"start time (utc)"},
+			"Duration":  {"duration (sec)"},
+		}},
+}
+
+/* synonyms by canonical column, shared by all layouts */
+var baseColumns = func() map[string][]string {
+	m := map[string][]string{}
+	for src, dst := range synonyms {
+		m[dst] = append(m[dst], src)
+	}
+	return m
+}()
+
+// SourceColumns lists, per canonical column, the Airtel export headers it
+// is read from, across all export layouts.
+func SourceColumns() map[string][]string { return canon.AllSources(baseColumns, formats) }
+
 /* helpers */
 var spaceRE = regexp.MustCompile(`\s+`)
 func norm(s string) string { return spaceRE.ReplaceAllString(strings.ToLower(strings.TrimSpace(s)), " ") }
@@ -72,26 +110,45 @@ type LRNInfo struct {
 }
 
 var (
-	cellDB = map[string]CellInfo{}
-	lrnDB  = map[string]LRNInfo{}
+	cellDB refdata.Table[map[string]CellInfo]
+	lrnDB  refdata.Table[map[string]LRNInfo]
 )
 
+/* a missing or unreadable table disables its enrichment instead of stopping
+   the service; refdata reports it and reloads it on request */
 func init() {
-	// Load cell DB
-	cf, err := dataFS.Open("data/airtel_cells.csv")
+	refdata.Load("airtel", "cells", func() error { return loadCells("data/airtel_cells.csv") })
+	refdata.Load("airtel", "LRN", func() error { return loadFile("data/LRN.csv", loadLRN) })
+}
+
+func loadFile(path string, load func(io.Reader)) error {
+	f, err := refdata.Open("airtel", dataFS, path)
 	if err != nil {
-		panic(fmt.Errorf("missing airtel_cells.csv: %w", err))
+		return err
 	}
-	loadCells(cf)
+	defer f.Close()
+	load(f)
+	return nil
+}
 
-	// Load LRN DB
-	lf, err := dataFS.Open("data/LRN.csv")
-	if err == nil {
-		loadLRN(lf)
+/* loadCells loads the cell DB from every copy of the CSV, merged by celldb */
+func loadCells(path string) error {
+	srcs, err := celldb.Open("airtel", dataFS, path)
+	if err != nil {
+		return err
 	}
+	m := celldb.New("airtel")
+	db := map[string]CellInfo{}
+	for _, s := range srcs {
+		readCells(s, s.Name, m, db)
+		s.Close()
+	}
+	m.Done()
+	cellDB.Set(db)
+	return nil
 }
 
-func loadCells(f io.Reader) {
+func readCells(f io.Reader, name string, m *celldb.Merge, db map[string]CellInfo) {
 	r := csv.NewReader(f)
 	header, _ := r.Read()
 	h := indexMap(header)
@@ -101,19 +158,34 @@ func loadCells(f io.Reader) {
 		if err != nil || len(rec) == 0 { continue }
 		id := strings.TrimSpace(rec[h["cell id"]])
 		if id == "" { continue }
-		cellDB[id] = CellInfo{
+		info := CellInfo{
 			Address:        rec[h["address"]],
 			SubCity:        rec[h["subcity"]],
 			MainCity:       rec[h["maincity"]],
 			LatLongAzimuth: rec[h["latitude"]] + "," + rec[h["longitude"]] + "," + rec[h["azimuth"]],
 		}
+		if m.Add(name, id, info.LatLongAzimuth, info.Address) {
+			db[id] = info
+		}
+	}
+}
+
+// Towers returns the cells of the cell DB that have a location.
+func Towers() []canon.Tower {
+	var out []canon.Tower
+	for id, info := range cellDB.Get() {
+		if t, ok := canon.NewTower(id, info.LatLongAzimuth, info.Address, info.MainCity); ok {
+			out = append(out, t)
+		}
 	}
+	return out
 }
 
 func loadLRN(f io.Reader) {
 	r := csv.NewReader(f)
 	header, _ := r.Read()
 	h := indexMap(header)
+	db := map[string]LRNInfo{}
 	for {
 		rec, err := r.Read()
 		if err == io.EOF { break }
@@ -124,12 +196,13 @@ func loadLRN(f io.Reader) {
 		if opIdx, ok := h["operator"]; ok {
 			op = rec[opIdx]
 		}
-		lrnDB[key] = LRNInfo{
+		db[key] = LRNInfo{
 			Provider: rec[h["tsp"]],
 			Circle:   rec[h["circle"]],
 			Operator: op,
 		}
 	}
+	lrnDB.Set(db)
 }
 
 func indexMap(header []string) map[string]int {
@@ -140,56 +213,22 @@ func indexMap(header []string) map[string]int {
 	return m
 }
 
-func saveUploaded(r io.Reader, dst string) error {
-	f, err := os.Create(dst)
-	if err != nil { return err }
-	defer f.Close()
-	_, err = io.Copy(f, r)
-	return err
-}
-
-/* HTTP handler */
-func UploadAndNormalizeCSV(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "POST only", 405)
-		return
-	}
-	tsp := strings.ToLower(r.FormValue("tsp_type"))
-	if tsp != "airtel" {
-		http.Error(w, "Only Airtel supported", 400)
-		return
-	}
-	crime := r.FormValue("crime_number")
+// Enrichers is the enrichment Normalize runs on each row, this TSP's
+// cell and LRN lookups among the shared steps; it is run again over
+// stored records once the tables are updated.
+var Enrichers = enrich.Pipeline("airtel", enrichCells, enrichLRN)
 
-	fh, hdr, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, err.Error(), 400)
-		return
+func enrichCells(row []string, col map[string]int) {
+	enrichWithCell(row, col, row[col["First Cell ID"]], true)
+	enrichWithCell(row, col, row[col["Last Cell ID"]], false)
+	if info, ok := cellDB.Get()[row[col["B Party Cell ID"]]]; ok {
+		row[col["B Party Cell ID Address"]] = info.Address
 	}
-	defer fh.Close()
-
-	os.MkdirAll("uploads", 0o755)
-	os.MkdirAll("filtered", 0o755)
-
-	src := filepath.Join("uploads", hdr.Filename)
-	if err := saveUploaded(fh, src); err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-
-	filtered, summary, maxCalls, maxDuration, maxStay, err := normalizeAirtel(src, crime)
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-
-	fmt.Fprintf(w, "/download/%s\n/download/%s\n/download/%s\n/download/%s\n/download/%s\n",
-		filepath.Base(filtered), filepath.Base(summary), filepath.Base(maxCalls), filepath.Base(maxDuration), filepath.Base(maxStay))
 }
 
 /* enrich cell info */
 func enrichWithCell(row []string, col map[string]int, id string, first bool) {
-	info, ok := cellDB[id]
+	info, ok := cellDB.Get()[id]
 	if !ok {
 		return
 	}
@@ -204,12 +243,12 @@ func enrichWithCell(row []string, col map[string]int, id string, first bool) {
 }
 
 /* enrich LRN info */
-func enrichWithLRN(row []string, col map[string]int) {
+func enrichLRN(row []string, col map[string]int) {
 	lrn := strings.TrimSpace(row[col["LRN"]])
 	if lrn == "" {
 		return
 	}
-	info, ok := lrnDB[lrn]
+	info, ok := lrnDB.Get()[lrn]
 	if !ok {
 		return
 	}
@@ -224,92 +263,86 @@ func enrichWithLRN(row []string, col map[string]int) {
 	}
 }
 
-func normalizeAirtel(src, crime string) (string, string, string, string, string, error) {
+// Normalize converts a Airtel CDR export at src into the canonical reports.
+// It stops with ctx's error once ctx is done.
+func Normalize(ctx context.Context, src string, opt canon.Options) (canon.Result, error) {
 	in, err := os.Open(src)
-	if err != nil { return "", "", "", "", "", err }
+	if err != nil { return canon.Result{}, err }
 	defer in.Close()
-	r := csv.NewReader(in)
+	r := canon.SkipLines("airtel", csv.NewReader(in))
 
 	// Read header and cdr number
 	var header []string
 	var cdrNumber string
+	var format canon.Format
+	cdrNumber = opt.CDR // given by hand on a retry; the banner's otherwise
 	for {
 		rec, err := r.Read()
 		if err == io.EOF {
-			return "", "", "", "", "", fmt.Errorf("no header found")
+			return canon.Result{}, fmt.Errorf("no header found")
 		}
 		if err != nil { continue }
 		if cdrNumber == "" && len(rec) > 0 {
 			cdrNumber = extractCdrNumber("airtel", rec[0])
 		}
-		if len(rec) > 0 && strings.Contains(rec[0], "Target No") {
-			header = rec
+		if f, ok := opt.Mapping.Detect(formats, rec); ok {
+			header, format = rec, f
+			r.Header(rec)
 			break
 		}
 	}
+	// older exports may lack the banner; the target column names the number
+	var firstRec []string
+	var firstLine int
 	if cdrNumber == "" {
-		return "", "", "", "", "", fmt.Errorf("could not extract CDR number")
+		firstRec, _ = r.Read()
+		firstLine = canon.Line(r, firstRec)
+		for i, h := range header {
+			if norm(h) == format.Match[0] && i < len(firstRec) {
+				cdrNumber = canon.Last10(firstRec[i])
+			}
+		}
+	}
+	if cdrNumber == "" {
+		return canon.Result{}, fmt.Errorf("could not extract CDR number")
 	}
 
 	srcToDst := map[int]int{}
 	col := map[string]int{}
 	for i, h := range targetHeader { col[h] = i }
+	var dedup canon.Dedup
+	clock := canon.ClockFor("airtel", format)
 
-	firstCGI, lastCGI := -1, -1
-	for i, h := range header {
-		hNorm := norm(h)
-		if hNorm == "first cgi" { firstCGI = i }
-		if hNorm == "last cgi" { lastCGI = i }
-		if canonical, ok := synonyms[hNorm]; ok {
-			srcToDst[i] = col[canonical]
-		}
+	canonical := map[string]string{}
+	for dst, srcs := range format.Source(baseColumns) {
+		for _, src := range srcs { canonical[src] = dst }
 	}
-	if firstCGI == -1 || lastCGI == -1 {
-		return "", "", "", "", "", fmt.Errorf("missing first/last CGI columns")
+	firstCGI, lastCGI, bCGI := -1, -1, -1
+	for i, h := range header {
+		dst, ok := canonical[norm(h)]
+		if !ok { continue }
+		srcToDst[i] = col[dst]
+		if dst == "First Cell ID" { firstCGI = i }
+		if dst == "Last Cell ID" { lastCGI = i }
+		if dst == "B Party Cell ID" { bCGI = i }
 	}
-	srcToDst[firstCGI] = col["First Cell ID"]
-	srcToDst[lastCGI] = col["Last Cell ID"]
 
-	filteredPath := filepath.Join("filtered", fmt.Sprintf("%s_reports.csv", cdrNumber))
+	filteredPath := filepath.Join(opt.Dir, fmt.Sprintf("%s_reports.csv", cdrNumber))
 	out, err := os.Create(filteredPath)
-	if err != nil { return "", "", "", "", "", err }
+	if err != nil { return canon.Result{}, err }
 	defer out.Close()
-	w := csv.NewWriter(out)
-	_ = w.Write(targetHeader)
+	w := safecsv.NewWriter(out)
+	raw := canon.RawColumns(header, format.Source(baseColumns), opt)
+	_ = w.Write(raw.Header(targetHeader))
 	blank := make([]string, len(targetHeader))
 
-	// Aggregation structs
-	type agg struct {
-		BParty, SDR, Provider, Type           string
-		TotalCalls, OutCalls, InCalls         int
-		OutSMS, InSMS, OtherCalls             int
-		RoamCalls, RoamSMS                    int
-		TotalDuration                         float64
-		Days, CellIds, Imeis, Imsis           map[string]struct{}
-		FirstCall, LastCall                   string
-	}
-	summary := map[string]*agg{}
+	sum := summary.New(cdrNumber, opt.ExcludeService)
 
-	type maxStayAgg struct {
-		CellID, Addr, Lat, Lon, Azimuth, Roaming, FirstCall, LastCall string
-		TotalCalls                                                    int
-	}
-	maxStay := map[string]*maxStayAgg{}
-
-	timeLayout := "2006-01-02 15:04:05"
-	parseDT := func(d, t string) string {
-		dt := strings.TrimSpace(d) + " " + strings.TrimSpace(t)
-		if _, e := time.Parse(timeLayout, dt); e == nil {
-			return dt
-		}
-		return dt
-	}
-
-	writeRow := func(rec []string) {
+	writeRow := func(rec []string, line int) {
 		if len(rec) == 0 { return }
 		row := append([]string(nil), blank...)
 		row[col["CdrNo"]] = cdrNumber
-		row[col["Crime"]] = crime
+		row[col["Crime"]] = opt.Crime
 
 		for s, d := range srcToDst {
 			if s < len(rec) {
@@ -317,222 +350,84 @@ func normalizeAirtel(src, crime string) (string, string, string, string, string,
 				if targetHeader[d] == "Call Type" {
 					// normalize call types
 					switch strings.ToUpper(val) {
-					case "IN", "A_IN": val = "CALL_IN"
-					case "OUT", "A_OUT": val = "CALL_OUT"
+					case "IN", "A_IN", "INCOMING": val = "CALL_IN"
+					case "OUT", "A_OUT", "OUTGOING": val = "CALL_OUT"
 					}
 				}
-				if targetHeader[d] == "Type" {
-					if strings.EqualFold(val, "pre") { val = "Prepaid" }
-					if strings.EqualFold(val, "post") { val = "Postpaid" }
-				}
 				row[d] = val
 			}
 		}
 
-		// Ensure clean CGI fields
-		if first := cleanCGI(rec[firstCGI]); first != "" {
-			row[col["First Cell ID"]] = first
-		}
-		if last := cleanCGI(rec[lastCGI]); last != "" {
-			row[col["Last Cell ID"]] = last
-		}
+		clock.Apply(row, col)
 
-		enrichWithCell(row, col, row[col["First Cell ID"]], true)
-		enrichWithCell(row, col, row[col["Last Cell ID"]], false)
-		enrichWithLRN(row, col)
-
-		w.Write(row)
-
-		bKey := row[col["B Party"]]
-		if bKey == "" { bKey = "(blank)" }
-		a, ok := summary[bKey]
-		if !ok {
-			a = &agg{
-				BParty: bKey, SDR: row[col["B Party Operator"]],
-				Provider: row[col["B Party Provider"]],
-				Type: row[col["Type"]],
-				Days: map[string]struct{}{}, CellIds: map[string]struct{}{},
-				Imeis: map[string]struct{}{}, Imsis: map[string]struct{}{},
+		// Ensure clean CGI fields; enterprise lines have none
+		if firstCGI != -1 && firstCGI < len(rec) {
+			if first := cleanCGI(rec[firstCGI]); first != "" {
+				row[col["First Cell ID"]] = first
 			}
-			summary[bKey] = a
 		}
-
-		a.TotalCalls++
-		switch row[col["Call Type"]] {
-		case "CALL_OUT": a.OutCalls++
-		case "CALL_IN": a.InCalls++
-		default:
-			if strings.Contains(row[col["Call Type"]], "SMS") {
-				if strings.HasSuffix(row[col["Call Type"]], "OUT") { a.OutSMS++ } else { a.InSMS++ }
-			} else { a.OtherCalls++ }
+		if lastCGI != -1 && lastCGI < len(rec) {
+			if last := cleanCGI(rec[lastCGI]); last != "" {
+				row[col["Last Cell ID"]] = last
+			}
 		}
-		if row[col["Roaming"]] != "" {
-			if strings.Contains(row[col["Call Type"]], "SMS") { a.RoamSMS++ } else { a.RoamCalls++ }
+		if bCGI != -1 && bCGI < len(rec) {
+			row[col["B Party Cell ID"]] = cleanCGI(rec[bCGI])
 		}
-		if dur, err := strconv.ParseFloat(row[col["Duration"]], 64); err == nil {
-			a.TotalDuration += dur
+
+		row[col["Direction"]] = canon.DirectionOf(row[col["Call Type"]])
+
+		Enrichers.Apply(row, col, opt.Skip)
+		if dedup.Seen(row, col) {
+			return
 		}
 
-		a.Days[row[col["Date"]]] = struct{}{}
-		if firstID := row[col["First Cell ID"]]; firstID != "" { a.CellIds[firstID] = struct{}{} }
-		if lastID := row[col["Last Cell ID"]]; lastID != "" { a.CellIds[lastID] = struct{}{} }
-		if v := row[col["IMEI"]]; v != "" { a.Imeis[v] = struct{}{} }
-		if v := row[col["IMSI"]]; v != "" { a.Imsis[v] = struct{}{} }
-
-		dt := parseDT(row[col["Date"]], row[col["Time"]])
-		if a.FirstCall == "" || dt < a.FirstCall { a.FirstCall = dt }
-		if a.LastCall == "" || dt > a.LastCall { a.LastCall = dt }
-
-		if firstID := row[col["First Cell ID"]]; firstID != "" {
-			ms, ok := maxStay[firstID]
-			if !ok {
-				ms = &maxStayAgg{
-					CellID:    firstID,
-					Addr:      row[col["First Cell ID Address"]],
-					Roaming:   row[col["Roaming"]],
-					FirstCall: dt,
-					LastCall:  dt,
-					TotalCalls: 1,
-				}
-				if llaz := row[col["Lat-Long-Azimuth (First CellID)"]]; llaz != "" {
-					parts := strings.Split(llaz, ",")
-					if len(parts) >= 2 {
-						ms.Lat = strings.TrimSpace(parts[0])
-						ms.Lon = strings.TrimSpace(parts[1])
-					}
-					if len(parts) == 3 {
-						ms.Azimuth = strings.TrimSpace(parts[2])
-					}
-				}
-				maxStay[firstID] = ms
-			} else {
-				ms.TotalCalls++
-				if dt < ms.FirstCall { ms.FirstCall = dt }
-				if dt > ms.LastCall { ms.LastCall = dt }
-			}
+		if !opt.SummaryOnly {
+			w.Write(raw.Append(row, rec, line))
 		}
+		sum.Add(row, col)
 	}
 
 	// Write remaining rows
+	if len(firstRec) > 0 {
+		writeRow(firstRec, firstLine)
+	}
 	for {
+		if err := ctx.Err(); err != nil { return canon.Result{}, err }
 		rec, err := r.Read()
 		if err == io.EOF { break }
 		if err != nil || len(rec) == 0 { continue }
-		writeRow(rec)
+		writeRow(rec, canon.Line(r, rec))
 	}
 	w.Flush()
 
-	// Write summary report
-	summaryPath := filepath.Join("filtered", cdrNumber+"_summary_reports.csv")
-	sout, _ := os.Create(summaryPath)
-	defer sout.Close()
-	sw := csv.NewWriter(sout)
-	sw.Write([]string{
-		"CdrNo", "B Party", "B Party SDR", "Provider", "Type",
-		"Total Calls", "Out Calls", "In Calls", "Out Sms", "In Sms",
-		"Other Calls", "Roam Calls", "Roam Sms", "Total Duration",
-		"Total Days", "Total CellIds", "Total Imei", "Total Imsi",
-		"First Call", "Last Call",
-	})
-	for _, a := range summary {
-		sw.Write([]string{
-			cdrNumber, a.BParty, a.SDR, a.Provider, a.Type,
-			strconv.Itoa(a.TotalCalls), strconv.Itoa(a.OutCalls), strconv.Itoa(a.InCalls),
-			strconv.Itoa(a.OutSMS), strconv.Itoa(a.InSMS), strconv.Itoa(a.OtherCalls),
-			strconv.Itoa(a.RoamCalls), strconv.Itoa(a.RoamSMS),
-			fmt.Sprintf("%.0f", a.TotalDuration),
-			strconv.Itoa(len(a.Days)), strconv.Itoa(len(a.CellIds)),
-			strconv.Itoa(len(a.Imeis)), strconv.Itoa(len(a.Imsis)),
-			a.FirstCall, a.LastCall,
-		})
-	}
-	sw.Flush()
-
-	// Max calls report
-	maxCallsPath := filepath.Join("filtered", cdrNumber+"_max_calls_reports.csv")
-	mcF, _ := os.Create(maxCallsPath)
-	defer mcF.Close()
-	mcw := csv.NewWriter(mcF)
-	mcw.Write([]string{"CdrNo", "B Party", "B Party SDR", "Total Calls", "Provider"})
-
-	totalCalls := 0
-	for _, a := range summary {
-		totalCalls += a.TotalCalls
+	// Tag rows matching the suspicious-pattern rules
+	findings, err := enrich.Rules(filteredPath, filepath.Join(opt.Dir, cdrNumber+"_findings_reports.csv"), cdrNumber, opt)
+	if err != nil {
+		return canon.Result{}, err
 	}
-	mcw.Write([]string{"Total", cdrNumber, "", strconv.Itoa(totalCalls), ""})
 
-	type kv struct {
-		Key string
-		Val *agg
-	}
-	var sorted []kv
-	for k, v := range summary {
-		sorted = append(sorted, kv{k, v})
+	// Summary, max calls, max duration and max stay reports
+	reports, err := sum.Write(filepath.Join(opt.Dir, cdrNumber))
+	if err != nil {
+		return canon.Result{}, err
 	}
-	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Val.TotalCalls > sorted[j].Val.TotalCalls })
 
-	for _, kvp := range sorted {
-		provider := kvp.Val.Provider
-		if provider == "" { provider = "Unknown" }
-		mcw.Write([]string{cdrNumber, kvp.Key, "", strconv.Itoa(kvp.Val.TotalCalls), provider})
-	}
-	mcw.Flush()
-
-	// Max duration report
-	maxDurationPath := filepath.Join("filtered", cdrNumber+"_max_duration_reports.csv")
-	mdF, _ := os.Create(maxDurationPath)
-	defer mdF.Close()
-	mdw := csv.NewWriter(mdF)
-	mdw.Write([]string{"CdrNo", "B Party", "B Party SDR", "Total Duration", "Provider"})
-
-	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Val.TotalDuration > sorted[j].Val.TotalDuration })
-
-	for _, kvp := range sorted {
-		provider := kvp.Val.Provider
-		if provider == "" { provider = "Unknown" }
-		mdw.Write([]string{
-			cdrNumber, kvp.Key, "", fmt.Sprintf("%.0f", kvp.Val.TotalDuration), provider,
-		})
+	res := canon.Result{
+		CDR:     cdrNumber,
+		Outputs: append(append([]string{filteredPath}, reports...), findings...),
+		Duplicates: dedup.Removed,
+		Skipped:    r.Skipped,
+		Declared:   r.Declared,
+		Format:     format.Name,
+		Clock:      clock,
 	}
-	mdw.Flush()
-
-	// Max stay report
-	maxStayPath := filepath.Join("filtered", cdrNumber+"_max_stay_reports.csv")
-	msF, _ := os.Create(maxStayPath)
-	defer msF.Close()
-	msw := csv.NewWriter(msF)
-	msw.Write([]string{
-		"CdrNo", "Cell ID", "Total Calls", "Tower Address", "Latitude", "Longitude", "Azimuth", "Roaming", "First Call", "Last Call",
-	})
-
-	for _, ms := range maxStay {
-		addr := ms.Addr
-		if addr == "" {
-			addr = "Unknown"
-		}
-		roaming := ms.Roaming
-		if roaming == "" {
-			roaming = "Unknown"
-		}
-		lat := ms.Lat
-		if lat == "" {
-			lat = "0"
-		}
-		lon := ms.Lon
-		if lon == "" {
-			lon = "0"
+	if opt.Anonymize {
+		if res.Outputs, err = pseudo.Files(res.Outputs, cdrNumber); err != nil {
+			return canon.Result{}, err
 		}
-		az := ms.Azimuth
-		if az == "" {
-			az = "0"
-		}
-		msw.Write([]string{
-			cdrNumber, ms.CellID, strconv.Itoa(ms.TotalCalls), addr, lat, lon, az, roaming, ms.FirstCall, ms.LastCall,
-		})
 	}
-	msw.Flush()
-
-	return filteredPath, summaryPath, maxCallsPath, maxDurationPath, maxStayPath, nil
+	return res, nil
 }
 
 func extractCdrNumber(tsp, content string) string {
@@ -542,6 +437,11 @@ func extractCdrNumber(tsp, content string) string {
 		if m := re.FindStringSubmatch(content); len(m) > 1 {
 			return m[1]
 		}
+		// enterprise banner: "CDR for A Number : 917314000123"
+		re = regexp.MustCompile(`A Number\s*:\s*(\d+)`)
+		if m := re.FindStringSubmatch(content); len(m) > 1 {
+			return canon.Last10(m[1])
+		}
 	case "jio":
 		re := regexp.MustCompile(`Input Value : (\d+)`)
 		if m := re.FindStringSubmatch(content); len(m) > 1 {
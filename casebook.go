@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/casebook"
+	"github.com/jalad-shrimali/cdr-filter/internal/consolidate"
+	"github.com/jalad-shrimali/cdr-filter/internal/dlink"
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+)
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// passwordHeader carries the password the sheets of a workbook download
+// are protected with: a header, to keep it out of URLs and access logs.
+const passwordHeader = "X-Workbook-Password"
+
+// GET /cases/{id}/workbook: the case summary workbook (.xlsx) of every
+// target the case has processed CDRs for: an overview, the contacts the
+// targets share and a tab per target linking to its reports. A target's
+// consolidated report is read when the case has one, otherwise the records
+// of its latest job. With an X-Workbook-Password header the sheets are
+// protected with that password.
+func workbookHandler(w http.ResponseWriter, r *http.Request) {
+	caseID, t := r.PathValue("id"), tenant.Of(r)
+	list, err := jobs.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var (
+		keys   []string
+		latest = map[string]*jobs.Job{} // tsp and number → newest done job
+	)
+	for _, j := range list {
+		if j.Tenant != t || j.Crime != caseID || j.Status != "done" || j.CDR == "" {
+			continue
+		}
+		k := j.TSP + " " + j.CDR
+		if _, ok := latest[k]; !ok {
+			keys = append(keys, k)
+		}
+		latest[k] = j
+	}
+	if len(keys) == 0 {
+		http.Error(w, "no processed CDRs for this case", http.StatusNotFound)
+		return
+	}
+
+	var targets []casebook.Target
+	for _, k := range keys {
+		j := latest[k]
+		tg := casebook.Target{CDR: j.CDR, TSP: j.TSP, Records: jobs.Records(j)}
+		if tg.Records != "" {
+			merged := consolidate.Report(outputDir(t), j.Outputs[0], caseID)
+			if _, err := os.Stat(merged); err == nil {
+				tg.Records = merged
+				tg.Reports = append(tg.Reports, merged)
+			}
+		}
+		for _, p := range j.Outputs {
+			if _, err := os.Stat(p); err == nil && filepath.Ext(p) != ".sha256" {
+				tg.Reports = append(tg.Reports, p)
+			}
+		}
+		targets = append(targets, tg)
+	}
+
+	var b bytes.Buffer
+	link := func(p string) string { return dlink.URL(dlink.Name(p)) }
+	if err := casebook.Write(&b, caseID, targets, link, r.Header.Get(passwordHeader)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := "case-" + strings.Trim(unsafeName.ReplaceAllString(caseID, "-"), "-") + "_summary.xlsx"
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/celldb"
+)
+
+// GET /cells/conflicts[?tsp=]: the CGIs whose entries in the loaded cell
+// DBs disagree on coordinates or address, across copies or within one, as
+// CSV with a row per entry and the one each cell DB kept marked Used. The
+// report follows the tables: POST /admin/reload refreshes it too.
+func cellConflictsHandler(w http.ResponseWriter, r *http.Request) {
+	tsps := celldb.TSPs()
+	if t := r.URL.Query().Get("tsp"); t != "" {
+		if _, ok := normalizers[t]; !ok {
+			http.Error(w, "unknown tsp_type", http.StatusBadRequest)
+			return
+		}
+		tsps = []string{t}
+	}
+	var b bytes.Buffer
+	if err := celldb.WriteReport(&b, tsps); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="cell_conflicts.csv"`)
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/compare"
+	"github.com/jalad-shrimali/cdr-filter/internal/consolidate"
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+)
+
+// GET /compare?a=&b=[&case=]: the two numbers' records side by side as
+// an .xlsx workbook: daily activity, shared towers and shared contacts,
+// opening with how likely one person carries both and the evidence for it;
+// with Accept: application/json just that score and evidence. Each number
+// is read from its latest processed CDR, within the case when one is
+// given, and from the case's consolidated report when it has one. The
+// workbook's sheets are protected as the case workbook's are.
+func compareHandler(w http.ResponseWriter, r *http.Request) {
+	t, crime := tenant.Of(r), r.FormValue("case")
+	var targets [2]compare.Target
+	for i, name := range []string{"a", "b"} {
+		number, err := canon.ParseCDR(r.FormValue(name))
+		if err != nil {
+			http.Error(w, name+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if number == "" {
+			http.Error(w, name+": number required", http.StatusBadRequest)
+			return
+		}
+		tg, ok := latestRecords(t, crime, number)
+		if !ok {
+			http.Error(w, name+": no processed CDR for "+number, http.StatusNotFound)
+			return
+		}
+		targets[i] = tg
+	}
+	if targets[0].CDR == targets[1].CDR {
+		http.Error(w, "a and b are the same number", http.StatusBadRequest)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		res, err := compare.Score(targets[0], targets[1])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	var b bytes.Buffer
+	if err := compare.Write(&b, targets[0], targets[1], r.Header.Get(passwordHeader)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := "compare_" + targets[0].CDR + "_" + targets[1].CDR + ".xlsx"
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Write(b.Bytes())
+}
+
+// latestRecords finds the records of number's newest finished job of
+// tenant, within crime unless that is "".
+func latestRecords(t, crime, number string) (compare.Target, bool) {
+	list, _ := jobs.List()
+	for i := len(list) - 1; i >= 0; i-- {
+		j := list[i]
+		if j.Tenant != t || j.Status != "done" || j.Summary || (crime != "" && j.Crime != crime) {
+			continue
+		}
+		if canon.Last10(j.CDR) != canon.Last10(number) {
+			continue
+		}
+		tg := compare.Target{CDR: j.CDR, TSP: j.TSP, Records: jobs.Records(j)}
+		if crime != "" {
+			merged := consolidate.Report(outputDir(t), j.Outputs[0], crime)
+			if _, err := os.Stat(merged); err == nil {
+				tg.Records = merged
+			}
+		}
+		return tg, tg.Records != ""
+	}
+	return compare.Target{}, false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/atrest"
+	"github.com/jalad-shrimali/cdr-filter/internal/audit"
+	"github.com/jalad-shrimali/cdr-filter/internal/dlink"
+	"github.com/jalad-shrimali/cdr-filter/internal/profile"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+)
+
+// profiled serves /download/<name>?profile=<name>: the report under dir cut
+// down to the columns the output profile keeps, such as the court copy,
+// named <name>_<profile>.csv. Without a profile, or with "full", files
+// serves the file as stored, the internal full copy. Only CSV reports have
+// profiled copies; each one handed out is audited.
+func profiled(dir string, files http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := profile.Parse(r.URL.Query().Get("profile"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if p == profile.Full {
+			files.ServeHTTP(w, r)
+			return
+		}
+		name := path.Clean("/" + r.URL.Path)
+		if !profile.Applies(name) {
+			http.Error(w, "only CSV reports have a "+p+" copy", http.StatusBadRequest)
+			return
+		}
+		f, err := atrest.Open(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		var b bytes.Buffer
+		if err := profile.Copy(&b, f, p); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := audit.Record(audit.Event{
+			Action: "copy", Tenant: tenant.Of(r), Outputs: []string{name[1:]}, Detail: p + " copy",
+		}); err != nil {
+			log.Printf("audit: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+profile.CopyName(path.Base(name), p)+`"`)
+		w.Write(b.Bytes())
+	})
+}
+
+// copyLinks returns the download paths of the profiled copies of the
+// output file name by profile, nil for files that have none.
+func copyLinks(name string) map[string]string {
+	if !profile.Applies(name) {
+		return nil
+	}
+	m := map[string]string{}
+	for _, p := range profile.Names()[1:] {
+		m[p] = dlink.PathAs(name, p)
+	}
+	return m
+}
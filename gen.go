@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/gen"
+)
+
+// genCommand implements "cdr-filter gen": it writes synthetic CDRs, one
+// file <tsp>_<target>.csv per TSP and target, for demos and tests.
+func genCommand(args []string) {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	tsps := fs.String("tsp", strings.Join(gen.TSPs(), ","), "comma-separated TSP layouts to write")
+	targets := fs.String("target", "", "comma-separated target numbers (default one random number)")
+	rows := fs.Int("rows", 200, "records per file")
+	contacts := fs.Int("contacts", 25, "distinct B parties")
+	towers := fs.Int("towers", 8, "distinct cells")
+	cells := fs.String("cells", "", "CSV of cell IDs (first column) to use as towers, e.g. jio/data/jio_cells.csv")
+	from := fs.String("from", "", "first day, YYYY-MM-DD (default 30 days ago)")
+	days := fs.Int("days", 30, "days covered")
+	seed := fs.Int64("seed", 0, "random seed, for repeatable output")
+	format := fs.String("format", "", "export layout version, e.g. v1 for the older Airtel and Jio layouts (default current)")
+	out := fs.String("out", ".", "output directory")
+	fs.Parse(args)
+
+	opt := gen.Options{Rows: *rows, Contacts: *contacts, Towers: *towers, Days: *days, Seed: *seed, Format: *format}
+	if *from != "" {
+		t, err := time.ParseInLocation("2006-01-02", *from, time.Local)
+		if err != nil {
+			log.Fatalf("gen: -from: %v", err)
+		}
+		opt.From = t
+	}
+	if *cells != "" {
+		ids, err := readCellIDs(*cells)
+		if err != nil {
+			log.Fatalf("gen: -cells: %v", err)
+		}
+		opt.Cells = ids
+	}
+	list := splitList(*targets)
+	if len(list) == 0 {
+		r := rand.New(rand.NewSource(*seed))
+		if *seed == 0 {
+			r.Seed(time.Now().UnixNano())
+		}
+		list = []string{gen.Number(r)}
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("gen: %v", err)
+	}
+	for _, tsp := range splitList(*tsps) {
+		for _, target := range list {
+			opt.Target = target
+			p := filepath.Join(*out, tsp+"_"+target+".csv")
+			f, err := os.Create(p)
+			if err != nil {
+				log.Fatalf("gen: %v", err)
+			}
+			err = gen.Write(f, tsp, opt)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(p)
+				log.Fatalf("gen: %s: %v", p, err)
+			}
+			fmt.Println(p)
+		}
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// readCellIDs returns the first column of a cells table, without its
+// header.
+func readCellIDs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(bufio.NewReader(f))
+	r.FieldsPerRecord = -1
+	var ids []string
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if id := strings.Trim(rec[0], "' "); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 {
+		return nil, fmt.Errorf("%s has no cell IDs", path)
+	}
+	return ids[1:], nil
+}
+
+// GET /gen?tsp=jio&target=&rows=&contacts=&towers=&from=&days=&seed=&format=
+// returns one synthetic CDR as a download, in the layout of tsp.
+func genHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opt := gen.Options{Target: q.Get("target"), Format: q.Get("format")}
+	for _, f := range []struct {
+		name string
+		v    *int
+	}{{"rows", &opt.Rows}, {"contacts", &opt.Contacts}, {"towers", &opt.Towers}, {"days", &opt.Days}} {
+		if s := q.Get(f.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				http.Error(w, f.name+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			*f.v = n
+		}
+	}
+	if s := q.Get("seed"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "seed: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		opt.Seed = n
+	}
+	if s := q.Get("from"); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		opt.From = t
+	}
+	if opt.Target == "" {
+		opt.Target = gen.Number(rand.New(rand.NewSource(time.Now().UnixNano())))
+	}
+	tsp := q.Get("tsp")
+	var b strings.Builder
+	if err := gen.Write(&b, tsp, opt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", tsp+"_"+opt.Target+".csv"))
+	io.WriteString(w, b.String())
+}
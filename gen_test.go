@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/gen"
+)
+
+// TestGenNormalizes checks that every layout the generator writes is one
+// its TSP's normalizer reads in full: a generated header the normalizer
+// does not know leaves its column blank in every row.
+func TestGenNormalizes(t *testing.T) {
+	for _, tc := range []struct{ tsp, format string }{
+		{"airtel", ""},
+		{"airtel", "v1"},
+		{"airtel", "enterprise"},
+		{"bsnl", ""},
+		{"jio", ""},
+		{"jio", "v1"},
+		{"vi", ""},
+	} {
+		name := tc.tsp
+		if tc.format != "" {
+			name += "_" + tc.format
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, name+".csv")
+			f, err := os.Create(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = gen.Write(f, tc.tsp, gen.Options{
+				Target: "9876500001", Rows: 50, Seed: 1, Format: tc.format,
+				From: time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local), Days: 7,
+			})
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := normalizers[tc.tsp](context.Background(), src, canon.Options{Dir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := filled(filepath.Join(dir, res.CDR+"_reports.csv"), "Date", "Time", "B Party", "Call Type"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
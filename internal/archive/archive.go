@@ -0,0 +1,238 @@
+// Package archive reads the bundles CDRs are shared in: ZIP, tar, and tar
+// or single files compressed with gzip or bzip2 (.tar.gz, .tgz, .csv.gz,
+// .tar.bz2, …). 7z and RAR archives are recognised but not read; their
+// compression is not in the standard library, and a bundle in either is
+// refused with a note to send it as ZIP or tar.gz instead.
+//
+// Extraction is bounded, so a small archive cannot unpack into an
+// exhausted disk or memory: at most CDR_ARCHIVE_MAX_FILES files (default
+// 200) and CDR_ARCHIVE_MAX_MB megabytes unpacked in all (default 2048).
+// ZIPs declaring more than that are refused before anything is unpacked;
+// for every format the bytes actually unpacked are counted as they are
+// read. Archives inside an archive are not opened: Walk hands them on as
+// files, and the callers refuse them with ErrNested.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupported reports an archive format that is recognised but not read.
+var ErrUnsupported = errors.New("archive format not supported; send the files as ZIP or tar.gz")
+
+// ErrLimit reports an archive past the extraction limits.
+var ErrLimit = errors.New("archive exceeds the extraction limits")
+
+// ErrNested reports an archive found inside an archive.
+var ErrNested = errors.New("archives inside an archive are not opened")
+
+// Limits bound what one archive may unpack to. Zero is no limit.
+type Limits struct {
+	Files int
+	Bytes int64
+}
+
+// LimitsFromEnv returns the limits configured as in the package comment.
+func LimitsFromEnv() Limits {
+	l := Limits{Files: 200, Bytes: 2048 << 20}
+	if v, err := strconv.Atoi(os.Getenv("CDR_ARCHIVE_MAX_FILES")); err == nil && v > 0 {
+		l.Files = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("CDR_ARCHIVE_MAX_MB"), 10, 64); err == nil && v > 0 {
+		l.Bytes = v << 20
+	}
+	return l
+}
+
+// kinds maps file name endings to formats, longest first.
+var kinds = []struct{ suffix, kind string }{
+	{".tar.gz", "tar.gz"}, {".tar.bz2", "tar.bz2"},
+	{".tgz", "tar.gz"}, {".tbz2", "tar.bz2"}, {".tbz", "tar.bz2"},
+	{".zip", "zip"}, {".tar", "tar"}, {".gz", "gz"}, {".bz2", "bz2"},
+	{".7z", "7z"}, {".rar", "rar"},
+}
+
+func kind(name string) string {
+	lower := strings.ToLower(name)
+	for _, k := range kinds {
+		if strings.HasSuffix(lower, k.suffix) {
+			return k.kind
+		}
+	}
+	return ""
+}
+
+// Is reports whether a file named name is an archive, by its extension.
+func Is(name string) bool { return kind(name) != "" }
+
+// magic is how each format's files begin, at the offset given: a tar's
+// "ustar" is in its first header block.
+var magic = map[string][]struct {
+	at  int64
+	sig string
+}{
+	"zip":     {{0, "PK\x03\x04"}, {0, "PK\x05\x06"}}, // the latter an empty ZIP
+	"tar":     {{257, "ustar"}},
+	"tar.gz":  {{0, "\x1f\x8b"}},
+	"gz":      {{0, "\x1f\x8b"}},
+	"tar.bz2": {{0, "BZh"}},
+	"bz2":     {{0, "BZh"}},
+	"7z":      {{0, "7z\xbc\xaf\x27\x1c"}},
+	"rar":     {{0, "Rar!\x1a\x07"}},
+}
+
+// Sniff reports whether r begins as an archive of the format the
+// extension of name says.
+func Sniff(name string, r io.ReaderAt) bool {
+	for _, m := range magic[kind(name)] {
+		b := make([]byte, len(m.sig))
+		if _, err := r.ReadAt(b, m.at); err == nil && string(b) == m.sig {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk calls fn with the name and contents of every file in the archive
+// r, size bytes long and named name, in the order the archive lists
+// them. Names are the files' base names; directories, links and the
+// hidden files archivers add, such as __MACOSX/ forks and .DS_Store, are
+// passed over. Walk stops at the first error fn returns, and with ErrLimit
+// once the archive goes past lim.
+func Walk(name string, r io.ReaderAt, size int64, lim Limits, fn func(name string, r io.Reader) error) error {
+	b := &budget{lim: lim}
+	switch k := kind(name); k {
+	case "zip":
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return err
+		}
+		var files []*zip.File
+		var declared uint64
+		for _, f := range zr.File {
+			if f.Mode().IsRegular() && !hidden(f.Name) {
+				files = append(files, f)
+				declared += f.UncompressedSize64
+			}
+		}
+		if lim.Files > 0 && len(files) > lim.Files {
+			return fmt.Errorf("%w: %d files, over %d", ErrLimit, len(files), lim.Files)
+		}
+		if lim.Bytes > 0 && declared > uint64(lim.Bytes) {
+			return fmt.Errorf("%w: %d MB unpacked, over %d", ErrLimit, declared>>20, lim.Bytes>>20)
+		}
+		for _, f := range files {
+			if err := b.file(); err != nil {
+				return err
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("%s: %v", f.Name, err)
+			}
+			err = fn(base(f.Name), &counted{rc, b})
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "tar", "tar.gz", "tar.bz2":
+		in, err := decompress(k, io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return err
+		}
+		tr := tar.NewReader(&counted{in, b})
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if h.Typeflag != tar.TypeReg || hidden(h.Name) {
+				continue
+			}
+			if err := b.file(); err != nil {
+				return err
+			}
+			if err := fn(base(h.Name), tr); err != nil {
+				return err
+			}
+		}
+	case "gz", "bz2":
+		in, err := decompress(k, io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return err
+		}
+		if err := b.file(); err != nil {
+			return err
+		}
+		return fn(strings.TrimSuffix(path.Base(name), path.Ext(name)), &counted{in, b})
+	case "7z", "rar":
+		return fmt.Errorf("%s: %w", k, ErrUnsupported)
+	}
+	return fmt.Errorf("%s is not an archive", name)
+}
+
+// decompress undoes the compression of a tar.gz, tar.bz2, gz or bz2.
+func decompress(kind string, r io.Reader) (io.Reader, error) {
+	switch {
+	case strings.HasSuffix(kind, "gz"):
+		return gzip.NewReader(r)
+	case strings.HasSuffix(kind, "bz2"):
+		return bzip2.NewReader(r), nil
+	}
+	return r, nil
+}
+
+// base returns the file name of an archive member, whatever directories
+// its name gives, "../" and "/" included, and with Windows archivers'
+// backslashes read as separators too.
+func base(name string) string {
+	return path.Base(strings.ReplaceAll(name, `\`, "/"))
+}
+
+// hidden reports whether an archive member is an archiver's own file
+// rather than one of the bundle's.
+func hidden(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base(name), ".")
+}
+
+// budget counts what an archive has unpacked against its limits.
+type budget struct {
+	lim   Limits
+	files int
+	bytes int64
+}
+
+func (b *budget) file() error {
+	if b.files++; b.lim.Files > 0 && b.files > b.lim.Files {
+		return fmt.Errorf("%w: over %d files", ErrLimit, b.lim.Files)
+	}
+	return nil
+}
+
+// counted reads r, charging the bytes read to a budget.
+type counted struct {
+	r io.Reader
+	b *budget
+}
+
+func (c *counted) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if c.b.bytes += int64(n); c.b.lim.Bytes > 0 && c.b.bytes > c.b.lim.Bytes {
+		return n, fmt.Errorf("%w: over %d MB unpacked", ErrLimit, c.b.lim.Bytes>>20)
+	}
+	return n, err
+}
@@ -0,0 +1,184 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type member struct{ name, data string }
+
+func mkZip(t *testing.T, files ...member) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, f.data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func mkTarGz(t *testing.T, files ...member) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	gw := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		h := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(tw, f.data)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func mkGz(t *testing.T, data string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	gw := gzip.NewWriter(&b)
+	io.WriteString(gw, data)
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// TestWalk checks what Walk hands on from archives of each format: base
+// names only, whatever path a member claims, archives inside unopened,
+// and ErrLimit once a limit on files or unpacked bytes is passed.
+func TestWalk(t *testing.T) {
+	csv := strings.Repeat("9876500001,9876500002\n", 10) // 220 bytes
+	inner := mkZip(t, member{"a.csv", csv})
+	for _, tc := range []struct {
+		name    string
+		archive string
+		data    []byte
+		lim     Limits
+		want    []string // names handed on, in order
+		err     error
+	}{
+		{
+			name: "zip", archive: "cdrs.zip",
+			data: mkZip(t, member{"jio/a.csv", csv}, member{"b.csv", csv}, member{"__MACOSX/._a.csv", "x"}, member{".DS_Store", "x"}),
+			want: []string{"a.csv", "b.csv"},
+		},
+		{
+			name: "tar.gz", archive: "cdrs.tar.gz",
+			data: mkTarGz(t, member{"jio/a.csv", csv}, member{"b.csv", csv}),
+			want: []string{"a.csv", "b.csv"},
+		},
+		{
+			name: "gz", archive: "a.csv.gz",
+			data: mkGz(t, csv),
+			want: []string{"a.csv"},
+		},
+		{
+			name: "zip slip", archive: "cdrs.zip",
+			data: mkZip(t, member{"../../etc/a.csv", csv}, member{"/tmp/b.csv", csv}, member{`..\..\c.csv`, csv}),
+			want: []string{"a.csv", "b.csv", "c.csv"},
+		},
+		{
+			name: "tar slip", archive: "cdrs.tgz",
+			data: mkTarGz(t, member{"../../etc/a.csv", csv}, member{"/tmp/b.csv", csv}),
+			want: []string{"a.csv", "b.csv"},
+		},
+		{
+			name: "nested", archive: "outer.zip",
+			data: mkZip(t, member{"inner.zip", string(inner)}, member{"b.csv", csv}),
+			want: []string{"inner.zip", "b.csv"},
+		},
+		{
+			name: "zip files", archive: "cdrs.zip",
+			data: mkZip(t, member{"a.csv", csv}, member{"b.csv", csv}, member{"c.csv", csv}),
+			lim:  Limits{Files: 2}, err: ErrLimit,
+		},
+		{
+			name: "zip files at the limit", archive: "cdrs.zip",
+			data: mkZip(t, member{"a.csv", csv}, member{"b.csv", csv}),
+			lim:  Limits{Files: 2}, want: []string{"a.csv", "b.csv"},
+		},
+		{
+			name: "tar.gz files", archive: "cdrs.tar.gz",
+			data: mkTarGz(t, member{"a.csv", csv}, member{"b.csv", csv}, member{"c.csv", csv}),
+			lim:  Limits{Files: 2}, want: []string{"a.csv", "b.csv"}, err: ErrLimit,
+		},
+		{
+			name: "zip bytes", archive: "cdrs.zip",
+			data: mkZip(t, member{"a.csv", csv}, member{"b.csv", csv}),
+			lim:  Limits{Bytes: 300}, err: ErrLimit,
+		},
+		{
+			name: "tar.gz bytes", archive: "cdrs.tar.gz",
+			data: mkTarGz(t, member{"a.csv", csv}, member{"b.csv", csv}),
+			lim:  Limits{Bytes: 300}, want: []string{"a.csv"}, err: ErrLimit,
+		},
+		{
+			name: "gz bytes", archive: "a.csv.gz",
+			data: mkGz(t, csv),
+			lim:  Limits{Bytes: 100}, want: []string{"a.csv"}, err: ErrLimit,
+		},
+		{
+			name: "7z", archive: "cdrs.7z",
+			data: []byte("7z\xbc\xaf\x27\x1c"), err: ErrUnsupported,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			err := Walk(tc.archive, bytes.NewReader(tc.data), int64(len(tc.data)), tc.lim, func(name string, r io.Reader) error {
+				got = append(got, name)
+				_, err := io.ReadAll(r)
+				return err
+			})
+			if !errors.Is(err, tc.err) || (tc.err == nil) != (err == nil) {
+				t.Errorf("err = %v, want %v", err, tc.err)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("files = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestSniff checks that archives are told by their first bytes, so a file
+// renamed to .zip or .gz is not taken for one.
+func TestSniff(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"cdrs.zip", mkZip(t, member{"a.csv", "x"}), true},
+		{"empty.zip", mkZip(t), true},
+		{"cdrs.tar.gz", mkTarGz(t, member{"a.csv", "x"}), true},
+		{"a.csv.gz", mkGz(t, "x"), true},
+		{"cdrs.7z", []byte("7z\xbc\xaf\x27\x1c\x00\x04"), true},
+		{"cdrs.zip", []byte("CdrNo,B Party\n"), false},
+		{"a.csv.gz", mkZip(t, member{"a.csv", "x"}), false},
+		{"cdrs.tar", []byte("MZ\x90\x00"), false},
+		{"a.csv", []byte("CdrNo,B Party\n"), false},
+	} {
+		if got := Sniff(tc.name, bytes.NewReader(tc.data)); got != tc.want {
+			t.Errorf("Sniff(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Package atrest optionally encrypts stored uploads and generated reports
+// with AES-GCM. It is enabled by setting CDR_STORAGE_KEY to a hex or base64
+// encoded 32-byte key.
+//
+// A job's outputs are sealed in its workspace before they are published,
+// so plaintext only exists on disk while the upload is being normalized;
+// a kept upload is sealed once the job is done.
+package atrest
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var magic = []byte("CDRENC1\n")
+
+var aead cipher.AEAD
+
+func init() {
+	k := strings.TrimSpace(os.Getenv("CDR_STORAGE_KEY"))
+	if k == "" {
+		return
+	}
+	key, err := hex.DecodeString(k)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(k)
+	}
+	if err != nil || len(key) != 32 {
+		log.Fatalf("CDR_STORAGE_KEY must be a 32-byte hex or base64 key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if aead, err = cipher.NewGCM(block); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Enabled reports whether at-rest encryption is configured.
+func Enabled() bool { return aead != nil }
+
+// Seal encrypts each file in place. It is a no-op when disabled and skips
+// files that are already sealed.
+func Seal(paths ...string) error {
+	if !Enabled() {
+		return nil
+	}
+	for _, p := range paths {
+		plain, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(plain, magic) {
+			continue
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		out := append(append(append([]byte{}, magic...), nonce...), aead.Seal(nil, nonce, plain, []byte(filepath.Base(p)))...)
+		if err := os.WriteFile(p, out, 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadFile returns the plaintext of p, decrypting it if it is sealed.
+func ReadFile(p string) ([]byte, error) {
+	data, err := os.ReadFile(p)
+	if err != nil || !bytes.HasPrefix(data, magic) {
+		return data, err
+	}
+	if !Enabled() {
+		return nil, errors.New("file is encrypted but CDR_STORAGE_KEY is not set")
+	}
+	data = data[len(magic):]
+	ns := aead.NonceSize()
+	if len(data) < ns {
+		return nil, fmt.Errorf("%s: truncated", p)
+	}
+	return aead.Open(nil, data[:ns], data[ns:], []byte(filepath.Base(p)))
+}
+
+// Open returns a reader over the plaintext of p. Unsealed files are streamed
+// from disk; sealed ones are decrypted into memory first.
+func Open(p string) (io.ReadCloser, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, len(magic))
+	n, _ := io.ReadFull(f, head)
+	if !bytes.Equal(head[:n], magic) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+	f.Close()
+	data, err := ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// FileServer serves the files in dir like http.FileServer, decrypting
+// sealed files on the way out when encryption is enabled. Directories are
+// never listed.
+func FileServer(dir string) http.Handler {
+	plain := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if name == "/" {
+			http.Error(w, "directory listing disabled", http.StatusForbidden)
+			return
+		}
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		st, err := os.Stat(p)
+		if err != nil || st.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		if !Enabled() {
+			plain.ServeHTTP(w, r)
+			return
+		}
+		data, err := ReadFile(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, filepath.Base(p), st.ModTime().Truncate(time.Second), bytes.NewReader(data))
+	})
+}
@@ -0,0 +1,80 @@
+// Package audit keeps an append-only JSON-lines log of processing and purge
+// actions. The log also serves as the index of which uploads and outputs
+// belong to which CDR number and case.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event is one audit log line.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"` // process, purge, …
+	Tenant  string    `json:"tenant,omitempty"`
+	TSP     string    `json:"tsp,omitempty"`
+	CDR     string    `json:"cdr,omitempty"`
+	Crime   string    `json:"crime,omitempty"`
+	Upload  string    `json:"upload,omitempty"`
+	Outputs []string  `json:"outputs,omitempty"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+var mu sync.Mutex
+
+// Path returns the log location (CDR_AUDIT_LOG, default audit.log).
+func Path() string {
+	if p := os.Getenv("CDR_AUDIT_LOG"); p != "" {
+		return p
+	}
+	return "audit.log"
+}
+
+// Record appends e to the log, stamping the time if unset.
+func Record(e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	f, err := os.OpenFile(Path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Events returns every logged event in order.
+func Events() ([]Event, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	f, err := os.Open(Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []Event
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var e Event
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			out = append(out, e)
+		}
+	}
+	return out, sc.Err()
+}
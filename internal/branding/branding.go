@@ -0,0 +1,168 @@
+// Package branding renders the departmental header block stamped above
+// each report and the optional cover page, both driven by a template
+// file so units can match their own formats.
+package branding
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"encoding/csv"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+/* embedded default template; CDR_REPORT_TEMPLATE overrides it */
+//go:embed data/template.csv
+var dataFS embed.FS
+
+// Fields are the case values a template row can refer to.
+type Fields struct {
+	Crime, FIR, Officer, Unit, Remarks string
+	CDR, TSP                           string
+	Generated                          string
+}
+
+type line struct {
+	label string
+	value *texttemplate.Template
+}
+
+var (
+	header, cover []line
+	logo          template.URL // data: URI of CDR_REPORT_LOGO, if set
+)
+
+func init() {
+	var (
+		f   io.ReadCloser
+		err error
+	)
+	if p := os.Getenv("CDR_REPORT_TEMPLATE"); p != "" {
+		f, err = os.Open(p)
+	} else {
+		f, err = dataFS.Open("data/template.csv")
+	}
+	if err != nil {
+		log.Printf("warning: report template not loaded: %v", err)
+	} else {
+		load(f)
+		f.Close()
+	}
+	if p := os.Getenv("CDR_REPORT_LOGO"); p != "" {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			log.Printf("warning: report logo not loaded: %v", err)
+			return
+		}
+		typ := mime.TypeByExtension(strings.ToLower(filepath.Ext(p)))
+		if !strings.HasPrefix(typ, "image/") {
+			log.Printf("warning: report logo %s: not an image", p)
+			return
+		}
+		logo = template.URL("data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(b))
+	}
+}
+
+func load(f io.Reader) {
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	_, _ = r.Read() // header
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(rec) < 3 {
+			continue
+		}
+		label := strings.TrimSpace(rec[1])
+		t, err := texttemplate.New(label).Parse(strings.TrimSpace(rec[2]))
+		if err == nil {
+			err = t.Execute(io.Discard, Fields{}) // catches unknown fields up front
+		}
+		if err != nil {
+			log.Printf("warning: report template %q: %v", label, err)
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(rec[0])) {
+		case "header":
+			header = append(header, line{label, t})
+		case "cover":
+			cover = append(cover, line{label, t})
+		}
+	}
+}
+
+func render(lines []line, f Fields) [][2]string {
+	var out [][2]string
+	for _, l := range lines {
+		var buf bytes.Buffer
+		if err := l.value.Execute(&buf, f); err != nil {
+			log.Printf("report template %q: %v", l.label, err)
+			continue
+		}
+		if v := strings.TrimSpace(buf.String()); v != "" {
+			out = append(out, [2]string{l.label, v})
+		}
+	}
+	return out
+}
+
+// Header returns the header rows (label, value) that render non-empty.
+func Header(f Fields) [][2]string { return render(header, f) }
+
+// HasCover reports whether the template defines a cover page.
+func HasCover() bool { return len(cover) > 0 }
+
+var coverPage = template.Must(template.New("cover").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Target}}</title>
+<style>
+body { font-family: sans-serif; margin: 3em; }
+img { max-height: 120px; }
+table { border-collapse: collapse; margin: 2em 0; }
+th, td { text-align: left; padding: .4em 1em; border-bottom: 1px solid #ccc; }
+</style>
+</head>
+<body>
+{{with .Logo}}<img src="{{.}}" alt="logo">{{end}}
+<table>
+{{range .Rows}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+{{with .Reports}}<h3>Reports</h3>
+<ul>
+{{range .}}<li>{{.}}</li>
+{{end}}</ul>{{end}}
+</body>
+</html>
+`))
+
+// WriteCover writes the cover page to path, listing the reports (file
+// names) it accompanies.
+func WriteCover(path string, f Fields, reports []string) error {
+	var names []string
+	for _, r := range reports {
+		names = append(names, filepath.Base(r))
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = coverPage.Execute(out, map[string]any{
+		"Target": f.CDR, "Logo": logo, "Rows": render(cover, f), "Reports": names,
+	})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
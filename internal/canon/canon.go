@@ -0,0 +1,394 @@
+// Package canon holds helpers shared by the per-TSP normalizers for working
+// with rows in the canonical output layout.
+package canon
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/atrest"
+	"github.com/jalad-shrimali/cdr-filter/internal/mailer"
+)
+
+/* date/time layouts seen across operator exports */
+var dateLayouts = []string{
+	"02/01/2006", "2/1/2006", "01/02/2006", "1/2/2006",
+	"2006-01-02", "02-01-2006", "02-Jan-2006", "02/Jan/2006", "02-Jan-06",
+}
+var timeLayouts = []string{"15:04:05", "3:04:05 PM", "15:04"}
+
+// ParseDateTime parses the canonical Date and Time columns of a row. Day-first
+// layouts are tried before month-first ones, matching most Indian exports.
+func ParseDateTime(d, t string) (time.Time, bool) {
+	d = strings.Trim(d, "'\" ")
+	t = strings.Trim(t, "'\" ")
+	for _, dl := range dateLayouts {
+		day, err := time.Parse(dl, d)
+		if err != nil {
+			continue
+		}
+		if t == "" {
+			return day, true
+		}
+		for _, tl := range timeLayouts {
+			if tod, err := time.Parse(tl, t); err == nil {
+				return day.Add(time.Duration(tod.Hour())*time.Hour +
+					time.Duration(tod.Minute())*time.Minute +
+					time.Duration(tod.Second())*time.Second), true
+			}
+		}
+		return day, true
+	}
+	return time.Time{}, false
+}
+
+// HasClock reports whether t is a time of day ParseDateTime reads; without
+// one ParseDateTime gives midnight of the date.
+func HasClock(t string) bool {
+	t = strings.Trim(t, "'\" ")
+	for _, tl := range timeLayouts {
+		if _, err := time.Parse(tl, t); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLatLong reads a "lat, long[, azimuth]" cell such as the
+// Lat-Long-Azimuth (First CellID) column. Out-of-range values and 0, 0 count
+// as missing.
+func ParseLatLong(s string) (lat, lon float64, ok bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lon, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 || (lat == 0 && lon == 0) {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// earthRadius is the mean radius of the earth in km.
+const earthRadius = 6371.0
+
+// Distance is the great-circle distance in km between two points given in
+// decimal degrees.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat, dLon := rad(lat2-lat1), rad(lon2-lon1)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Index maps every header name to its position.
+func Index(header []string) map[string]int {
+	m := make(map[string]int, len(header))
+	for i, h := range header {
+		m[h] = i
+	}
+	return m
+}
+
+// Get returns row[col[name]] or "" when the column is absent.
+func Get(row []string, col map[string]int, name string) string {
+	if i, ok := col[name]; ok && i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// Options carries the per-upload settings read from the form.
+type Options struct {
+	Crime          string
+	Officer        string // investigating officer
+	FIR            string // FIR / GD number
+	Unit           string
+	Remarks        string
+	ExcludeService bool     // keep service numbers out of the summary reports
+	Anonymize      bool     // pseudonymize MSISDN/IMEI/IMSI in every output
+	Parquet        bool     // also write the records as Parquet
+	Heatmap        bool     // also write the tower heatmap as a Leaflet page
+	Append         bool     // merge into the target's consolidated case report
+	Strict         bool     // reject the upload when mandatory columns fail validation
+	SummaryOnly    bool     // deliver the summary reports only, without the full report
+	KeepRaw        bool     // append the export's unmapped columns as raw_<header>
+	SourceRow      bool     // append the line of the export each row was read from
+	Columns        []string // subset/order of canonical columns to deliver; nil for all
+	Skip           []string // enrichers not to run, from Enrichers
+	Locale         string   // report header language; "" for English
+	Home           Home     // the target's home operator and circle, stamped in the header; not from the form
+	Warnings       []string // reference tables missing for this run, stamped in the header
+	Coverage       []string // share of rows each table enriched, stamped likewise
+	Versions       []string // "what: version" of the tool, mapping and tables used, stamped likewise
+	Sheet          string   // worksheet to read from a workbook upload; "" for the first
+	CDR            string   // target number when the export's own cannot be found
+	Mapping        Mapping  // export headers of columns the layouts do not find
+	Dir            string   // directory the normalizer writes its reports to
+	Email          []string // addresses the finished reports are mailed to
+	Priority       string   // "urgent", "normal" or "bulk" in the worker queue; "" for normal
+	Scene          string   // "lat,long" of the scene of crime, to measure records from; "" for none
+	SceneRadius    float64  // km around Scene of the near-scene report; 0 for the default
+	Tenant         string   // unit the job belongs to; set by the handler, not the form
+	Ingested       bool     // delivered by a watch folder, SFTP or mailbox, not uploaded; not from the form
+}
+
+// OptionsFromRequest reads Options from the upload form.
+func OptionsFromRequest(r *http.Request) Options {
+	r.ParseMultipartForm(32 << 20) // as FormValue does; errors leave Form partial
+	return OptionsFromValues(r.Form)
+}
+
+// OptionsFromValues reads the same fields from already decoded values,
+// e.g. resumable-upload metadata.
+func OptionsFromValues(v url.Values) Options {
+	return Options{
+		Crime:          v.Get("crime_number"),
+		Officer:        strings.TrimSpace(v.Get("officer")),
+		FIR:            strings.TrimSpace(v.Get("fir_number")),
+		Unit:           strings.TrimSpace(v.Get("unit")),
+		Remarks:        strings.TrimSpace(v.Get("remarks")),
+		Sheet:          strings.TrimSpace(v.Get("sheet")),
+		ExcludeService: formBool(v, "exclude_service"),
+		Anonymize:      formBool(v, "anonymize"),
+		Parquet:        formBool(v, "parquet"),
+		Heatmap:        formBool(v, "heatmap"),
+		Append:         formBool(v, "append_case"),
+		Strict:         formBool(v, "strict"),
+		SummaryOnly:    formBool(v, "summary_only"),
+		KeepRaw:        formBool(v, "keep_raw"),
+		SourceRow:      formBool(v, "source_row"),
+		Columns:        formColumns(v),
+		Skip:           formSkip(v),
+		Locale:         formLocale(v),
+		Email:          formEmail(v),
+		CDR:            formCDR(v),
+		Mapping:        formMapping(v),
+		Priority:       strings.ToLower(strings.TrimSpace(v.Get("priority"))),
+		Scene:          formScene(v),
+		SceneRadius:    formRadius(v),
+	}
+}
+
+/* invalid selections are rejected by the handlers before processing */
+func formColumns(v url.Values) []string {
+	c, _ := ParseColumns(v.Get("columns"))
+	return c
+}
+
+func formSkip(v url.Values) []string {
+	s, _ := ParseSkip(v.Get("skip"))
+	return s
+}
+
+func formCDR(v url.Values) string {
+	n, _ := ParseCDR(v.Get("cdr"))
+	return n
+}
+
+func formMapping(v url.Values) Mapping {
+	m, _ := ParseMapping(v["map"])
+	return m
+}
+
+func formScene(v url.Values) string {
+	s, _ := ParseScene(v.Get("scene"))
+	return s
+}
+
+func formRadius(v url.Values) float64 {
+	r, _ := ParseRadius(v.Get("scene_radius"))
+	return r
+}
+
+func formLocale(v url.Values) string {
+	l, _ := ParseLocale(v.Get("locale"))
+	return l
+}
+
+func formEmail(v url.Values) []string {
+	e, _ := mailer.ParseAddresses(v.Get("email"))
+	return e
+}
+
+func formBool(v url.Values, key string) bool {
+	b, _ := strconv.ParseBool(v.Get(key))
+	return b
+}
+
+// Result describes what a normalizer produced for one upload.
+type Result struct {
+	CDR        string   // target number found in the export
+	Outputs    []string // generated report paths, main report first
+	Duplicates int      // rows dropped as exact repeats
+	Skipped    int      // export lines dropped by the skip-line patterns or as repeated headers
+	Declared   int      // record count the export states; 0 if it does not
+	Format     string   // export layout detected, e.g. "v2", for TSPs with more than one
+	Clock      Clock    // zone conversion applied to Date and Time
+}
+
+/* columns that identify one call record for deduplication */
+var dedupCols = []string{"Date", "Time", "B Party", "Call Type", "Duration", "First Cell ID"}
+
+// Dedup drops rows repeated by overlapping operator date ranges. A row is a
+// repeat when date, time, B party, call type, duration and first cell all
+// match an earlier one.
+type Dedup struct {
+	seen    map[string]struct{}
+	Removed int
+}
+
+// Seen records row and reports whether an identical record came before.
+func (d *Dedup) Seen(row []string, col map[string]int) bool {
+	if d.seen == nil {
+		d.seen = map[string]struct{}{}
+	}
+	k := make([]string, len(dedupCols))
+	for i, c := range dedupCols {
+		k[i] = Get(row, col, c)
+	}
+	key := strings.Join(k, "\x00")
+	if _, ok := d.seen[key]; ok {
+		d.Removed++
+		return true
+	}
+	d.seen[key] = struct{}{}
+	return false
+}
+
+// ScanReport streams a generated CSV report row by row, decrypting it if
+// sealed and skipping the '#' header block.
+func ScanReport(path string, fn func(header, row []string) error) error {
+	f, err := atrest.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err == io.EOF {
+		return fmt.Errorf("%s: empty report", path)
+	}
+	if err != nil {
+		return err
+	}
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(header, row); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadReport loads a whole generated CSV report (see ScanReport) and
+// returns the header and data rows.
+func ReadReport(path string) ([]string, [][]string, error) {
+	var header []string
+	var rows [][]string
+	err := ScanReport(path, func(h, row []string) error {
+		header = h
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if header == nil { // header only
+		header, err = ReadHeader(path)
+	}
+	return header, rows, err
+}
+
+// ReadHeader returns the column header of a generated CSV report.
+func ReadHeader(path string) ([]string, error) {
+	f, err := atrest.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	return r.Read()
+}
+
+var nonDigit = regexp.MustCompile(`\D`)
+
+// Last10 returns the digits of a number without a 91, 0091 or 0 prefix,
+// for comparing MSISDNs written with or without one. It goes by length,
+// so short codes (121, 1909) and 11-digit toll-free and premium numbers
+// (1800…, 1900…) come back whole rather than cut to ten digits.
+func Last10(s string) string {
+	d := nonDigit.ReplaceAllString(s, "")
+	switch {
+	case len(d) == 12 && strings.HasPrefix(d, "91"):
+		return d[2:]
+	case len(d) == 14 && strings.HasPrefix(d, "0091"):
+		return d[4:]
+	case len(d) == 11 && strings.HasPrefix(d, "0"):
+		return d[1:]
+	}
+	return d
+}
+
+var dialled = regexp.MustCompile(`^\+?[0-9][0-9 -]*$`)
+
+// Party returns the B party as summaries group it: a number by Last10, so
+// 919876543210, 09876543210 and 9876543210 are one party, and anything
+// else, such as a sender ID, as written.
+func Party(s string) string {
+	s = strings.Trim(s, "'\" ")
+	if dialled.MatchString(s) {
+		return Last10(s)
+	}
+	return s
+}
+
+// Values of the Direction column: the target's role in a record.
+const (
+	Caller = "Caller" // the target made the call or sent the SMS
+	Callee = "Callee" // the target received it
+)
+
+// DirectionOf returns the target's role as far as an operator call type
+// (CALL_OUT, Incoming, A2P_SMSIN, SMT, …) tells it, or "" when it does
+// not. Outgoing markers are checked first, "OUTGOING" containing "IN".
+func DirectionOf(callType string) string {
+	ct := strings.ToUpper(strings.TrimSpace(callType))
+	switch {
+	case ct == "":
+		return ""
+	case ct == "MO" || strings.Contains(ct, "OUT") || strings.Contains(ct, "SMO") ||
+		strings.Contains(ct, "ORIG") || strings.Contains(ct, "MOC"):
+		return Caller
+	case ct == "MT" || strings.Contains(ct, "IN") || strings.Contains(ct, "SMT") ||
+		strings.Contains(ct, "TERM") || strings.Contains(ct, "MTC"):
+		return Callee
+	}
+	return ""
+}
+
+var fieldChar = regexp.MustCompile(`[^a-z0-9]+`)
+
+// FieldName turns a canonical header such as "Lat-Long-Azimuth (First CellID)"
+// into a machine-friendly name, "lat_long_azimuth_first_cellid".
+func FieldName(h string) string {
+	return strings.Trim(fieldChar.ReplaceAllString(strings.ToLower(h), "_"), "_")
+}
@@ -0,0 +1,158 @@
+package canon
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+)
+
+/* embedded record class rules; CDR_RECORD_CLASSES_FILE overrides them */
+//go:embed data/record_classes.csv
+var classFS embed.FS
+
+// classRule is one row of the record class rules.
+type classRule struct {
+	column string // Call Type, Type, Roaming or Circle
+	re     *regexp.Regexp
+	class  string // sms, home, roaming or circle=XX
+}
+
+var classRules refdata.Table[[]classRule]
+
+func init() { refdata.Load("", "record classes", loadRecordClasses) }
+
+// loadRecordClasses reads the record class rules; on error the current
+// ones stay.
+func loadRecordClasses() error {
+	var (
+		f      fs.File
+		err    error
+		source = "embedded"
+	)
+	if p := os.Getenv("CDR_RECORD_CLASSES_FILE"); p != "" {
+		f, err = os.Open(p)
+		source = p
+	} else {
+		f, err = classFS.Open("data/record_classes.csv")
+	}
+	if err != nil {
+		return err
+	}
+	f = refdata.Track(f, source)
+	defer f.Close()
+	rules, err := readClassRules(f)
+	if err != nil {
+		return err
+	}
+	classRules.Set(rules)
+	return nil
+}
+
+func readClassRules(f io.Reader) ([]classRule, error) {
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	_, _ = r.Read() // header
+	var out []classRule
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) < 3 {
+			continue
+		}
+		line, _ := r.FieldPos(0)
+		ru := classRule{column: strings.TrimSpace(rec[0]), class: strings.ToLower(strings.TrimSpace(rec[2]))}
+		var ok bool
+		switch ru.column {
+		case "Call Type", "Type":
+			ok = ru.class == "sms"
+		case "Roaming":
+			ok = ru.class == "home" || ru.class == "roaming"
+		case "Circle":
+			ok = strings.HasPrefix(ru.class, "circle=") && len(ru.class) > len("circle=")
+		default:
+			return nil, fmt.Errorf("line %d: unknown column %q", line, ru.column)
+		}
+		if !ok {
+			return nil, fmt.Errorf("line %d: class %q does not apply to %s", line, rec[2], ru.column)
+		}
+		if ru.re, err = regexp.Compile("(?i)" + rec[1]); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		out = append(out, ru)
+	}
+}
+
+// Class is how the summary reports count a record.
+type Class struct {
+	SMS       bool   // an SMS rather than a call
+	Direction string // Caller, Callee or "" when unknown
+	Roaming   bool   // served outside the subscriber's home network or circle
+}
+
+// Classify classes a row of the canonical layout by the record class
+// rules. Its direction is the Direction column's, else what the call type
+// tells.
+func Classify(row []string, col map[string]int) Class {
+	rules := classRules.Get()
+	ct := strings.TrimSpace(Get(row, col, "Call Type"))
+	c := Class{Direction: Get(row, col, "Direction")}
+	if c.Direction == "" {
+		c.Direction = DirectionOf(ct)
+	}
+	c.SMS = classOf(rules, "Call Type", ct) == "sms" ||
+		classOf(rules, "Type", strings.TrimSpace(Get(row, col, "Type"))) == "sms"
+	c.Roaming = roaming(rules, strings.TrimSpace(Get(row, col, "Roaming")), strings.TrimSpace(Get(row, col, "Circle")))
+	return c
+}
+
+// classOf returns the class of the first rule for column matching v, or
+// "" when none does.
+func classOf(rules []classRule, column, v string) string {
+	if v == "" {
+		return ""
+	}
+	for _, ru := range rules {
+		if ru.column == column && ru.re.MatchString(v) {
+			return ru.class
+		}
+	}
+	return ""
+}
+
+// roaming tells whether a record whose Roaming column reads served was
+// roaming for a subscriber of circle home. Without a home circle to go by,
+// any network named is taken as roaming.
+func roaming(rules []classRule, served, home string) bool {
+	if served == "" {
+		return false
+	}
+	switch classOf(rules, "Roaming", served) {
+	case "home":
+		return false
+	case "roaming":
+		return true
+	}
+	if home == "" {
+		return true
+	}
+	circle := func(v string) string {
+		if c := classOf(rules, "Circle", v); c != "" {
+			return c
+		}
+		return strings.ToUpper(v)
+	}
+	return circle(served) != circle(home)
+}
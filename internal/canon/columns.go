@@ -0,0 +1,85 @@
+package canon
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+// ParseColumns reads a comma-separated column selection. Each entry may be
+// a canonical name ("B Party") or its field name ("b_party"); the result
+// holds canonical names in the requested order. An empty spec selects
+// nothing (all columns).
+func ParseColumns(spec string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		name := ""
+		for _, c := range Schema {
+			if strings.EqualFold(c.Name, s) || c.Field == FieldName(s) {
+				name = c.Name
+				break
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("unknown column %q", s)
+		}
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+// Select returns row reduced to columns (layout of row described by col).
+func Select(row []string, col map[string]int, columns []string) []string {
+	out := make([]string, len(columns))
+	for i, c := range columns {
+		out[i] = Get(row, col, c)
+	}
+	return out
+}
+
+// Project rewrites the plain CSV report at path keeping only columns, in
+// that order, and any columns carried from the export (RawHeaders) after
+// them. It is a no-op when columns is empty.
+func Project(path string, columns []string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	all, err := csv.NewReader(in).ReadAll()
+	in.Close()
+	if err != nil {
+		return err
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	col := Index(all[0])
+	columns = append(columns[:len(columns):len(columns)], RawHeaders(all[0])...)
+	out := [][]string{columns}
+	for _, row := range all[1:] {
+		out = append(out, Select(row, col, columns))
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := safecsv.NewWriter(f).WriteAll(out); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
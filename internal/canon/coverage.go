@@ -0,0 +1,64 @@
+package canon
+
+import "fmt"
+
+// Coverage counts the rows of a report that the reference tables could
+// enrich: cell IDs placed on the map, B party LRNs resolved to a circle,
+// and IMEIs whose TAC named a manufacturer. Analysts read it to judge how
+// far the location and provider columns can be trusted.
+type Coverage struct {
+	Rows              int
+	Cells, CellsFound int
+	LRNs, LRNsFound   int
+	IMEIs, IMEIsFound int
+}
+
+// CoverageOf counts the enrichment of the canonical report at path.
+func CoverageOf(path string) (Coverage, error) {
+	var (
+		c   Coverage
+		col map[string]int
+	)
+	err := ScanReport(path, func(header, row []string) error {
+		if col == nil {
+			col = Index(header)
+		}
+		c.Rows++
+		if Get(row, col, "First Cell ID") != "" {
+			c.Cells++
+			if Get(row, col, "Lat-Long-Azimuth (First CellID)") != "" {
+				c.CellsFound++
+			}
+		}
+		if Get(row, col, "LRN") != "" {
+			c.LRNs++
+			if Get(row, col, "B Party Circle") != "" {
+				c.LRNsFound++
+			}
+		}
+		if Get(row, col, "IMEI") != "" {
+			c.IMEIs++
+			if Get(row, col, "IMEI Manufacturer") != "" {
+				c.IMEIsFound++
+			}
+		}
+		return nil
+	})
+	return c, err
+}
+
+// Lines describes c one lookup per line, e.g.
+// "cell lookups: 38 of 40 rows (95%)".
+func (c Coverage) Lines() []string {
+	line := func(what string, found, total int) string {
+		if total == 0 {
+			return what + ": no rows to look up"
+		}
+		return fmt.Sprintf("%s: %d of %d rows (%.0f%%)", what, found, total, 100*float64(found)/float64(total))
+	}
+	return []string{
+		line("cell lookups", c.CellsFound, c.Cells),
+		line("LRN matches", c.LRNsFound, c.LRNs),
+		line("TAC matches", c.IMEIsFound, c.IMEIs),
+	}
+}
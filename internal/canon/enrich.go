@@ -0,0 +1,51 @@
+package canon
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Enrichers names the enrichment steps in the order they run: on each row
+// the roaming network, the cell addresses, the B party's LRN, the SMS
+// sender class and the service-number tag, then the suspicious-pattern
+// rules over the finished report. A request may skip any of them, e.g.
+// the rules and cell lookups for a quick look at a large CDR.
+var Enrichers = []string{"roaming", "cell", "lrn", "sms", "service", "rules"}
+
+// Enricher is one named step filling columns of a canonical row.
+type Enricher struct {
+	Name string
+	Fill func(row []string, col map[string]int)
+}
+
+// Pipeline is the enrichers a normalizer runs on each row, in order.
+type Pipeline []Enricher
+
+// Apply runs the steps of p not named in skip on row.
+func (p Pipeline) Apply(row []string, col map[string]int, skip []string) {
+	for _, e := range p {
+		if !slices.Contains(skip, e.Name) {
+			e.Fill(row, col)
+		}
+	}
+}
+
+// ParseSkip reads a comma-separated list of enrichers to skip.
+func ParseSkip(spec string) ([]string, error) {
+	var out []string
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" || slices.Contains(out, s) {
+			continue
+		}
+		if !slices.Contains(Enrichers, s) {
+			return nil, fmt.Errorf("unknown enricher %q (have %s)", s, strings.Join(Enrichers, ", "))
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// Skips reports whether the request skips the enricher name.
+func (o Options) Skips(name string) bool { return slices.Contains(o.Skip, name) }
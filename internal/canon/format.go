@@ -0,0 +1,87 @@
+package canon
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is one generation of a TSP's export layout. Operators rename
+// headers and add columns every few years while exports in the old layout
+// keep turning up in case files, so a normalizer keeps a profile per
+// layout and picks the one whose headers the export has.
+type Format struct {
+	Name    string              // label stamped into reports, e.g. "v2"
+	Match   []string            // headers, normalized, all present in the layout's header row
+	Columns map[string][]string // canonical column -> source headers where the layout differs
+	Zone    *time.Location      // zone of the layout's timestamps when not IST, e.g. time.UTC; see ClockFor
+}
+
+// IST is India Standard Time, the zone of most exports and, unless
+// CDR_OUTPUT_TZ says otherwise, of the reports.
+var IST = time.FixedZone("IST", 5*3600+30*60)
+
+var headerSpace = regexp.MustCompile(`\s+`)
+
+// NormHeader lowercases a header and collapses its spacing, the form
+// Format headers are written in.
+func NormHeader(s string) string {
+	return headerSpace.ReplaceAllString(strings.ToLower(strings.TrimSpace(s)), " ")
+}
+
+// DetectFormat returns the first of formats whose Match headers all
+// appear in rec.
+func DetectFormat(formats []Format, rec []string) (Format, bool) {
+	have := make([]string, len(rec))
+	for i, h := range rec {
+		have[i] = NormHeader(h)
+	}
+	for _, f := range formats {
+		ok := len(f.Match) > 0
+		for _, m := range f.Match {
+			ok = ok && slices.Contains(have, m)
+		}
+		if ok {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// Source returns base, the headers shared by all layouts, with the
+// columns f reads from elsewhere replaced by its own.
+func (f Format) Source(base map[string][]string) map[string][]string {
+	m := make(map[string][]string, len(base)+len(f.Columns))
+	for c, v := range base {
+		m[c] = v
+	}
+	for c, v := range f.Columns {
+		m[c] = v
+	}
+	return m
+}
+
+// AllSources merges base with the columns of every format, for a
+// normalizer's SourceColumns.
+func AllSources(base map[string][]string, formats []Format) map[string][]string {
+	m := map[string][]string{}
+	add := func(src map[string][]string) {
+		for c, v := range src {
+			for _, h := range v {
+				if !slices.Contains(m[c], h) {
+					m[c] = append(m[c], h)
+				}
+			}
+		}
+	}
+	add(base)
+	for _, f := range formats {
+		add(f.Columns)
+	}
+	for _, v := range m {
+		sort.Strings(v)
+	}
+	return m
+}
@@ -0,0 +1,157 @@
+package canon
+
+import (
+	"embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+)
+
+/* embedded number series; CDR_NUMBER_SERIES_FILE overrides them */
+//go:embed data/number_series.csv
+var seriesFS embed.FS
+
+// series is the operator and circle a number series was allotted to.
+type series struct{ operator, circle string }
+
+var numberSeries refdata.Table[map[string]series]
+
+func init() { refdata.Load("", "number series", loadNumberSeries) }
+
+// loadNumberSeries reads the number series; on error the current ones
+// stay.
+func loadNumberSeries() error {
+	var (
+		f      fs.File
+		err    error
+		source = "embedded"
+	)
+	if p := os.Getenv("CDR_NUMBER_SERIES_FILE"); p != "" {
+		f, err = os.Open(p)
+		source = p
+	} else {
+		f, err = seriesFS.Open("data/number_series.csv")
+	}
+	if err != nil {
+		return err
+	}
+	f = refdata.Track(f, source)
+	defer f.Close()
+	m, err := readSeries(f)
+	if err != nil {
+		return err
+	}
+	numberSeries.Set(m)
+	return nil
+}
+
+func readSeries(f io.Reader) (map[string]series, error) {
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	_, _ = r.Read() // header
+	m := map[string]series{}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) < 3 {
+			continue
+		}
+		prefix := strings.TrimSpace(rec[0])
+		if prefix == "" || strings.Trim(prefix, "0123456789") != "" {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("line %d: series %q is not digits", line, rec[0])
+		}
+		m[prefix] = series{strings.TrimSpace(rec[1]), strings.TrimSpace(rec[2])}
+	}
+}
+
+// operators names the operator of each TSP processed, as the LRN tables
+// do.
+var operators = map[string]string{
+	"airtel": "AIRTEL",
+	"jio":    "RELIANCE JIO",
+	"vi":     "VI",
+	"bsnl":   "BSNL",
+}
+
+// Home is the target's own operator and home circle.
+type Home struct {
+	Operator   string // the TSP that delivered the CDR
+	Circle     string // from the number series; "" when not in it
+	PortedFrom string // the series' operator when it is not Operator
+}
+
+// HomeOf derives the home operator and circle of cdr, a CDR processed as
+// tsp's.
+func HomeOf(cdr, tsp string) Home {
+	h := Home{Operator: operators[strings.ToLower(tsp)]}
+	n := Last10(cdr)
+	m := numberSeries.Get()
+	for i := len(n); i > 0; i-- {
+		s, ok := m[n[:i]]
+		if !ok {
+			continue
+		}
+		h.Circle = s.circle
+		if h.Operator == "" {
+			h.Operator = s.operator
+		} else if s.operator != "" && !strings.EqualFold(s.operator, h.Operator) {
+			h.PortedFrom = s.operator
+		}
+		break
+	}
+	return h
+}
+
+// Lines returns the header lines of h, label and value, for those known.
+func (h Home) Lines() [][2]string {
+	var out [][2]string
+	if h.Operator != "" {
+		op := h.Operator
+		if h.PortedFrom != "" {
+			op += " (ported from " + h.PortedFrom + ")"
+		}
+		out = append(out, [2]string{"Home Operator", op})
+	}
+	if h.Circle != "" {
+		out = append(out, [2]string{"Home Circle", h.Circle})
+	}
+	return out
+}
+
+// errFound stops a scan once what it looks for is found.
+var errFound = errors.New("found")
+
+// CircleOf returns the first Circle the report at path gives its rows:
+// the export's own, else the number series', "" when none does.
+func CircleOf(path string) (string, error) {
+	var (
+		circle string
+		col    map[string]int
+	)
+	err := ScanReport(path, func(header, row []string) error {
+		if col == nil {
+			col = Index(header)
+		}
+		if circle = Get(row, col, "Circle"); circle != "" {
+			return errFound
+		}
+		return nil
+	})
+	if err == errFound {
+		err = nil
+	}
+	return circle, err
+}
@@ -0,0 +1,132 @@
+package canon
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+/* embedded header translations; CDR_LOCALE_FILE overrides them */
+//go:embed data/headers.csv
+var dataFS embed.FS
+
+// translations maps locale → English text → translated text.
+var translations = map[string]map[string]string{}
+
+func init() {
+	var (
+		f   io.ReadCloser
+		err error
+	)
+	if p := os.Getenv("CDR_LOCALE_FILE"); p != "" {
+		f, err = os.Open(p)
+	} else {
+		f, err = dataFS.Open("data/headers.csv")
+	}
+	if err != nil {
+		log.Printf("warning: header translations not loaded: %v", err)
+		return
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	_, _ = r.Read() // header
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(rec) < 3 {
+			continue
+		}
+		loc := strings.ToLower(strings.TrimSpace(rec[0]))
+		if translations[loc] == nil {
+			translations[loc] = map[string]string{}
+		}
+		translations[loc][strings.TrimSpace(rec[1])] = strings.TrimSpace(rec[2])
+	}
+}
+
+// Locales returns the report languages available: "en" plus every locale
+// in the translation table.
+func Locales() []string {
+	out := []string{"en"}
+	for l := range translations {
+		if l != "en" {
+			out = append(out, l)
+		}
+	}
+	sort.Strings(out[1:])
+	return out
+}
+
+// ParseLocale normalizes a locale parameter. Empty means English.
+func ParseLocale(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "en" {
+		return "", nil
+	}
+	if translations[s] == nil {
+		return "", fmt.Errorf("unsupported locale %q (have %s)", s, strings.Join(Locales(), ", "))
+	}
+	return s, nil
+}
+
+// Translate returns text in locale, or text itself when the table has no
+// entry for it.
+func Translate(locale, text string) string {
+	if t, ok := translations[locale][text]; ok && t != "" {
+		return t
+	}
+	return text
+}
+
+// Localize rewrites the header row of each CSV file in paths into locale.
+// Files must not be stamped yet; other files and English are left alone.
+func Localize(locale string, paths ...string) error {
+	if translations[locale] == nil {
+		return nil
+	}
+	for _, p := range paths {
+		if !strings.HasSuffix(p, ".csv") {
+			continue
+		}
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		cr := csv.NewReader(in)
+		cr.FieldsPerRecord = -1
+		all, err := cr.ReadAll()
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		if len(all) == 0 {
+			continue
+		}
+		for i, h := range all[0] {
+			all[0][i] = Translate(locale, h)
+		}
+		f, err := os.Create(p)
+		if err != nil {
+			return err
+		}
+		if err := safecsv.NewWriter(f).WriteAll(all); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package canon
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Mapping is an analyst's reading of an export whose headers the layouts
+// do not know: canonical column → the export's header for it. It is given
+// with the cdr number when a job that failed on its export is retried.
+type Mapping map[string]string
+
+// ParseMapping reads "Column=Export header" pairs, one per value. Columns
+// are named as in ParseColumns.
+func ParseMapping(pairs []string) (Mapping, error) {
+	var m Mapping
+	for _, p := range pairs {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		name, header, ok := strings.Cut(p, "=")
+		header = strings.TrimSpace(header)
+		if !ok || header == "" {
+			return nil, fmt.Errorf("%q is not column=header", p)
+		}
+		c, err := ParseColumns(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(c) != 1 {
+			return nil, fmt.Errorf("%q is not column=header", p)
+		}
+		if m == nil {
+			m = Mapping{}
+		}
+		m[c[0]] = header
+	}
+	return m, nil
+}
+
+// ReadMapping reads a mapping file: CSV rows of an export header and the
+// canonical column it fills, named as in ParseColumns. A first row naming
+// no column is taken for the file's own header; blank rows and rows
+// starting with # are skipped.
+func ReadMapping(r io.Reader) (Mapping, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+	m := Mapping{}
+	var skipped error
+	for n := 1; ; n++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(rec) < 2 || strings.TrimSpace(rec[0]) == "" {
+			return nil, fmt.Errorf("line %d: want export header, column", line)
+		}
+		c, err := ParseColumns(rec[1])
+		if err == nil && len(c) != 1 {
+			err = errors.New("no column given")
+		}
+		if err != nil {
+			if n == 1 {
+				skipped = fmt.Errorf("line %d: %v", line, err)
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if _, ok := m[c[0]]; ok {
+			return nil, fmt.Errorf("line %d: %s is mapped twice", line, c[0])
+		}
+		m[c[0]] = strings.TrimSpace(rec[0])
+	}
+	if len(m) == 0 {
+		if skipped != nil {
+			return nil, skipped
+		}
+		return nil, errors.New("no columns mapped")
+	}
+	return m, nil
+}
+
+// Merge returns m with the columns of over replacing its own.
+func (m Mapping) Merge(over Mapping) Mapping {
+	if len(m) == 0 {
+		return over
+	}
+	out := maps.Clone(m)
+	maps.Copy(out, over)
+	return out
+}
+
+// Header reports whether rec holds every header of m.
+func (m Mapping) Header(rec []string) bool {
+	have := make([]string, len(rec))
+	for i, h := range rec {
+		have[i] = NormHeader(h)
+	}
+	for _, h := range m {
+		if !slices.Contains(have, NormHeader(h)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Source returns base with m's columns read from their mapped headers.
+func (m Mapping) Source(base map[string][]string) map[string][]string {
+	if len(m) == 0 {
+		return base
+	}
+	out := make(map[string][]string, len(base)+len(m))
+	maps.Copy(out, base)
+	for c, h := range m {
+		out[c] = []string{NormHeader(h)}
+	}
+	return out
+}
+
+// Detect is DetectFormat for an export read with m: the layout found reads
+// m's columns from their mapped headers. A row holding all of m's headers
+// but matching no layout is read as the first, newest, layout.
+func (m Mapping) Detect(formats []Format, rec []string) (Format, bool) {
+	if !m.Header(rec) {
+		return Format{}, false
+	}
+	f, ok := DetectFormat(formats, rec)
+	if !ok {
+		if len(m) == 0 || len(formats) == 0 {
+			return Format{}, false
+		}
+		f = formats[0]
+		f.Name = "mapped"
+	}
+	f.Columns = m.Source(f.Columns)
+	return f, true
+}
+
+// Strings lists m as sorted "Column=header" pairs, for the job record.
+func (m Mapping) Strings() []string {
+	var out []string
+	for _, c := range slices.Sorted(maps.Keys(m)) {
+		out = append(out, c+"="+m[c])
+	}
+	return out
+}
+
+// Overrides lists the cdr number and mapping of o, if given, for the job
+// record.
+func (o Options) Overrides() []string {
+	var out []string
+	if o.CDR != "" {
+		out = append(out, "cdr="+o.CDR)
+	}
+	for _, p := range o.Mapping.Strings() {
+		out = append(out, "map="+p)
+	}
+	return out
+}
+
+// Settings lists the form fields of o that shape its reports, as
+// field=value, for the job record: enough to run an upload again as it
+// was. Fields left at their defaults are not listed.
+func (o Options) Settings() []string {
+	var out []string
+	flag := func(name string, on bool) {
+		if on {
+			out = append(out, name+"=true")
+		}
+	}
+	text := func(name, v string) {
+		if v != "" {
+			out = append(out, name+"="+v)
+		}
+	}
+	text("sheet", o.Sheet)
+	text("columns", strings.Join(o.Columns, ","))
+	text("skip", strings.Join(o.Skip, ","))
+	text("locale", o.Locale)
+	flag("exclude_service", o.ExcludeService)
+	flag("anonymize", o.Anonymize)
+	flag("summary_only", o.SummaryOnly)
+	flag("keep_raw", o.KeepRaw)
+	flag("source_row", o.SourceRow)
+	flag("strict", o.Strict)
+	flag("append_case", o.Append)
+	flag("parquet", o.Parquet)
+	flag("heatmap", o.Heatmap)
+	text("scene", o.Scene)
+	if o.SceneRadius > 0 {
+		text("scene_radius", strconv.FormatFloat(o.SceneRadius, 'f', -1, 64))
+	}
+	return out
+}
+
+var cdrNumber = regexp.MustCompile(`^\d{8,15}$`)
+
+// ParseCDR reads a target number given by hand: 8 to 15 digits, spaces,
+// dashes and a leading + aside. An empty number is none given.
+func ParseCDR(s string) (string, error) {
+	n := strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimPrefix(strings.TrimSpace(s), "+"))
+	if n != "" && !cdrNumber.MatchString(n) {
+		return "", fmt.Errorf("%q is not a phone number", s)
+	}
+	return n, nil
+}
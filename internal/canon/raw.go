@@ -0,0 +1,102 @@
+package canon
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A report can carry some of the export as it was, after the canonical
+// columns: the line each row was read from, so it can be traced back to
+// the operator's file (Options.SourceRow), and the source columns the
+// schema has no column for (Options.KeepRaw).
+const (
+	SourceRow = "Source Row"
+	RawPrefix = "raw_" // starts a raw column's header, as in "raw_Service Provider"
+)
+
+// Raw is what a report carries of the export as it was. The zero Raw
+// carries nothing.
+type Raw struct {
+	line  bool
+	names []string
+	idx   []int
+}
+
+// RawColumns returns what opt asks a report to carry of the export with
+// the given header: the source row, and the columns that none of the
+// source headers of the canonical columns names.
+func RawColumns(header []string, source map[string][]string, opt Options) Raw {
+	r := Raw{line: opt.SourceRow}
+	if !opt.KeepRaw {
+		return r
+	}
+	mapped := map[string]bool{}
+	for _, hs := range source {
+		for _, h := range hs {
+			mapped[NormHeader(h)] = true
+		}
+	}
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		if h == "" || mapped[NormHeader(h)] {
+			continue
+		}
+		r.names = append(r.names, RawPrefix+h)
+		r.idx = append(r.idx, i)
+	}
+	return r
+}
+
+// Header returns the report header: base followed by the carried columns.
+func (r Raw) Header(base []string) []string {
+	h := base[:len(base):len(base)]
+	if r.line {
+		h = append(h, SourceRow)
+	}
+	return append(h, r.names...)
+}
+
+// Append returns row followed by the carried columns of rec, which was
+// read from the given line of the export.
+func (r Raw) Append(row, rec []string, line int) []string {
+	if r.line {
+		row = append(row, lineText(line))
+	}
+	for _, i := range r.idx {
+		v := ""
+		if i < len(rec) {
+			v = strings.Trim(rec[i], "'\" ")
+		}
+		row = append(row, v)
+	}
+	return row
+}
+
+func lineText(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// Line returns the line of the export r last read rec from, or 0 when r
+// cannot tell. csv.Reader and workbook.Reader both can.
+func Line(r any, rec []string) int {
+	p, ok := r.(interface{ FieldPos(int) (int, int) })
+	if !ok || len(rec) == 0 {
+		return 0
+	}
+	line, _ := p.FieldPos(0)
+	return line
+}
+
+// RawHeaders returns the carried columns of a report header, in order.
+func RawHeaders(header []string) []string {
+	var out []string
+	for _, h := range header {
+		if h == SourceRow || strings.HasPrefix(h, RawPrefix) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
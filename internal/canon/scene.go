@@ -0,0 +1,36 @@
+package canon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseScene reads the scene-of-crime coordinates given with an upload,
+// "lat,long" in decimal degrees, as "lat,long" again. An empty scene is
+// none given.
+func ParseScene(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	lat, lon, ok := ParseLatLong(s)
+	if !ok || len(strings.Split(s, ",")) != 2 {
+		return "", fmt.Errorf("%q is not lat,long in decimal degrees", s)
+	}
+	return strconv.FormatFloat(lat, 'f', -1, 64) + "," + strconv.FormatFloat(lon, 'f', -1, 64), nil
+}
+
+// ParseRadius reads the radius around the scene, in km, of the records
+// reported as near it. An empty radius is 0, the default.
+func ParseRadius(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil || r <= 0 || r > 1000 {
+		return 0, fmt.Errorf("%q is not a radius in km (above 0, at most 1000)", s)
+	}
+	return r, nil
+}
@@ -0,0 +1,62 @@
+package canon
+
+// Column describes one column of the canonical report.
+type Column struct {
+	Name        string `json:"name"`
+	Field       string `json:"field"` // snake_case key used in JSON exports
+	Type        string `json:"type"`  // string, number, date, time, integer, cell_id, lat_long_azimuth
+	Description string `json:"description"`
+}
+
+// Schema is the canonical report layout, in column order. Every
+// normalizer writes exactly these columns.
+var Schema = []Column{
+	{"CdrNo", "", "number", "target number the CDR was requested for"},
+	{"B Party", "", "number", "other party (number or sender ID)"},
+	{"Date", "", "date", "call date as given by the operator"},
+	{"Time", "", "time", "call start time"},
+	{"Duration", "", "integer", "duration in seconds"},
+	{"Call Type", "", "string", "CALL_IN, CALL_OUT, SMS variants, …"},
+	{"First Cell ID", "", "cell_id", "CGI at call start, digits only"},
+	{"First Cell ID Address", "", "string", "tower address at call start"},
+	{"Last Cell ID", "", "cell_id", "CGI at call end, digits only"},
+	{"Last Cell ID Address", "", "string", "tower address at call end"},
+	{"IMEI", "", "string", "handset IMEI"},
+	{"IMSI", "", "string", "SIM IMSI"},
+	{"Roaming", "", "string", "roaming network or circle"},
+	{"Main City(First CellID)", "", "string", "city of the first cell"},
+	{"Sub City (First CellID)", "", "string", "locality of the first cell"},
+	{"Lat-Long-Azimuth (First CellID)", "", "lat_long_azimuth", `"lat, long, azimuth" of the first cell`},
+	{"Crime", "", "string", "crime / case number supplied with the upload"},
+	{"Circle", "", "string", "target's home circle: the export's, else from the number series"},
+	{"Operator", "", "string", "target's operator: the export's, else the TSP processed"},
+	{"LRN", "", "string", "location routing number of the B party"},
+	{"CallForward", "", "number", "forwarded-to number"},
+	{"B Party Provider", "", "string", "B party TSP, from the LRN table"},
+	{"B Party Circle", "", "string", "B party circle, from the LRN table"},
+	{"B Party Operator", "", "string", "B party operator, from the LRN table"},
+	{"Type", "", "string", "service: Voice, SMS or Data"},
+	{"IMEI Manufacturer", "", "string", "handset make from the IMEI TAC"},
+	{"Direction", "", "string", "target's role: Caller or Callee, blank when unknown"},
+	{"SMS Category", "", "string", "class of the sender of A2P SMS (Bank, OTP, Promo, Government, …), blank otherwise"},
+	{"Flags", "", "string", "names of the suspicious-pattern rules the row matched"},
+	{"B Party Cell ID", "", "cell_id", "CGI of the B party at call start, where the export gives it"},
+	{"B Party Cell ID Address", "", "string", "tower address of the B party's cell"},
+	{"Connection Type", "", "string", "Prepaid or Postpaid, where the export tells"},
+	{"Service Number", "", "string", "Yes when the B party is a telemarketer, OTP or customer-care number"},
+}
+
+func init() {
+	for i := range Schema {
+		Schema[i].Field = FieldName(Schema[i].Name)
+	}
+}
+
+// Header returns a fresh copy of the canonical column names.
+func Header() []string {
+	h := make([]string, len(Schema))
+	for i, c := range Schema {
+		h[i] = c.Name
+	}
+	return h
+}
@@ -0,0 +1,168 @@
+package canon
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+)
+
+/* embedded skip-line patterns; CDR_SKIP_LINES_FILE overrides them */
+//go:embed data/skip_lines.csv
+var skipFS embed.FS
+
+// skipPatterns maps a TSP, or "*" for every TSP, to its skip-line patterns.
+var skipPatterns refdata.Table[map[string][]*regexp.Regexp]
+
+func init() { refdata.Load("", "skip lines", loadSkipLines) }
+
+// loadSkipLines reads the skip-line patterns; on error the current ones
+// stay.
+func loadSkipLines() error {
+	var (
+		f      fs.File
+		err    error
+		source = "embedded"
+	)
+	if p := os.Getenv("CDR_SKIP_LINES_FILE"); p != "" {
+		f, err = os.Open(p)
+		source = p
+	} else {
+		f, err = skipFS.Open("data/skip_lines.csv")
+	}
+	if err != nil {
+		return err
+	}
+	f = refdata.Track(f, source)
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	_, _ = r.Read() // header
+	out := map[string][]*regexp.Regexp{}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(rec) < 2 {
+			continue
+		}
+		re, err := regexp.Compile(rec[1])
+		if err != nil {
+			line, _ := r.FieldPos(1)
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		tsp := strings.ToLower(strings.TrimSpace(rec[0]))
+		out[tsp] = append(out[tsp], re)
+	}
+	skipPatterns.Set(out)
+	return nil
+}
+
+// Rows is the row source of an export: a csv.Reader, or the workbook and
+// fixed-width readers that stand in for one.
+type Rows interface {
+	Read() ([]string, error)
+}
+
+// Skipper reads the rows of an export leaving out the lines the skip-line
+// patterns of its TSP match, and, once told the header, the repeats of it
+// that files concatenated from several exports carry.
+type Skipper struct {
+	r        Rows
+	res      []*regexp.Regexp
+	header   string // as sameHeader compares it; "" until Header
+	Skipped  int    // lines left out so far
+	Declared int    // record counts the export states, as in "Total Records : 40", summed over concatenated exports; 0 if none
+}
+
+// declaredRE matches a line stating the export's record count.
+var declaredRE = regexp.MustCompile(`(?i)^\s*(?:total\s+(?:no\.?\s*of\s+|number\s+of\s+)?(?:records|rows|cdrs?|calls)|(?:no\.?|number)\s*of\s+(?:records|rows|cdrs?|calls)|records\s+found)\s*[:=-]?[\s,:]*(\d+)\s*$`)
+
+// SkipLines wraps the rows of a tsp export in a Skipper.
+func SkipLines(tsp string, r Rows) *Skipper {
+	all := skipPatterns.Get()
+	res := append(append([]*regexp.Regexp(nil), all["*"]...), all[tsp]...)
+	return &Skipper{r: r, res: res}
+}
+
+// Read returns the next row no pattern matches. Errors are passed on as
+// the rows are. A line stating the record count sets Declared, whether
+// it is skipped or not; so do the lines a fixed-width reader drops.
+func (s *Skipper) Read() ([]string, error) {
+	for {
+		rec, err := s.r.Read()
+		if err == io.EOF {
+			if d, ok := s.r.(interface{ Dropped() []string }); ok {
+				for _, line := range d.Dropped() {
+					s.declared(line)
+				}
+			}
+		}
+		if err != nil {
+			return rec, err
+		}
+		line := joinLine(rec)
+		s.declared(line)
+		if !s.skip(line) && (s.header == "" || headerKey(rec) != s.header) {
+			return rec, nil
+		}
+		s.Skipped++
+	}
+}
+
+// Header tells s the export's header row, so later rows repeating it are
+// left out too.
+func (s *Skipper) Header(rec []string) { s.header = headerKey(rec) }
+
+// headerKey is rec compared as a header: case and surrounding space
+// ignored.
+func headerKey(rec []string) string {
+	key := make([]string, len(rec))
+	for i, f := range rec {
+		key[i] = strings.ToLower(strings.TrimSpace(f))
+	}
+	return joinLine(key)
+}
+
+func (s *Skipper) declared(line string) {
+	if m := declaredRE.FindStringSubmatch(line); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		s.Declared += n
+	}
+}
+
+// FieldPos passes on the position of the underlying reader, for Line.
+func (s *Skipper) FieldPos(field int) (line, column int) {
+	if p, ok := s.r.(interface{ FieldPos(int) (int, int) }); ok {
+		return p.FieldPos(field)
+	}
+	return 0, 0
+}
+
+// joinLine is rec as the patterns see it: its fields joined by commas,
+// trailing empty ones left off.
+func joinLine(rec []string) string {
+	n := len(rec)
+	for n > 0 && strings.TrimSpace(rec[n-1]) == "" {
+		n--
+	}
+	return strings.Join(rec[:n], ",")
+}
+
+func (s *Skipper) skip(line string) bool {
+	for _, re := range s.res {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package canon
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/branding"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+// Fields returns the case values the report template can refer to.
+func (o Options) Fields(cdr, tsp string) branding.Fields {
+	return branding.Fields{
+		Crime: o.Crime, FIR: o.FIR, Officer: o.Officer, Unit: o.Unit, Remarks: o.Remarks,
+		CDR: cdr, TSP: tsp, Generated: time.Now().Format("02-Jan-2006 15:04:05"),
+	}
+}
+
+// HeaderBlock returns the header lines of the report template stamped
+// above each report, followed by the target's home operator and circle and
+// one line per warning, coverage figure and version, or nil when there is
+// nothing to stamp.
+func (o Options) HeaderBlock(cdr, tsp string) [][]string {
+	f := o.Fields(cdr, tsp)
+	var rows [][]string
+	for _, l := range branding.Header(f) {
+		rows = append(rows, []string{"# " + Translate(o.Locale, l[0]), l[1]})
+	}
+	for _, l := range o.Home.Lines() {
+		rows = append(rows, []string{"# " + Translate(o.Locale, l[0]), l[1]})
+	}
+	for _, w := range o.Warnings {
+		rows = append(rows, []string{"# " + Translate(o.Locale, "Warning"), w})
+	}
+	for _, c := range o.Coverage {
+		rows = append(rows, []string{"# " + Translate(o.Locale, "Coverage"), c})
+	}
+	for _, v := range o.Versions {
+		rows = append(rows, []string{"# " + Translate(o.Locale, "Version"), v})
+	}
+	if rows == nil {
+		return nil
+	}
+	rows = append(rows, []string{"# " + Translate(o.Locale, "Generated"), f.Generated})
+	return rows
+}
+
+// Stamp prepends the header block to each CSV file (other files are left
+// alone). Lines start with '#'
+// so readers can skip them with csv.Reader.Comment.
+func Stamp(opt Options, cdr, tsp string, paths ...string) error {
+	block := opt.HeaderBlock(cdr, tsp)
+	if block == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	w := safecsv.NewWriter(&buf)
+	w.WriteAll(block)
+	for _, p := range paths {
+		if filepath.Ext(p) != ".csv" {
+			continue
+		}
+		body, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, append(append([]byte{}, buf.Bytes()...), body...), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package canon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tower is a cell of a TSP's cell DB with a usable location.
+type Tower struct {
+	Cell    string  `json:"cell"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	Azimuth string  `json:"azimuth,omitempty"`
+	Address string  `json:"address,omitempty"`
+	City    string  `json:"city,omitempty"`
+}
+
+// NewTower makes the tower of a cell DB entry from its "lat, long[,
+// azimuth]" location; ok is false when the entry has no usable location.
+func NewTower(cell, latLonAz, address, city string) (t Tower, ok bool) {
+	lat, lon, ok := ParseLatLong(latLonAz)
+	if !ok {
+		return Tower{}, false
+	}
+	t = Tower{Cell: cell, Lat: lat, Lon: lon, Address: address, City: city}
+	if parts := strings.Split(latLonAz, ","); len(parts) > 2 {
+		if az := strings.TrimSpace(parts[2]); az != "" && !strings.EqualFold(az, "null") {
+			t.Azimuth = az
+		}
+	}
+	return t, true
+}
+
+// BBox is an area given by its south-west and north-east corners in
+// decimal degrees.
+type BBox struct {
+	MinLon float64 `json:"min_lon"`
+	MinLat float64 `json:"min_lat"`
+	MaxLon float64 `json:"max_lon"`
+	MaxLat float64 `json:"max_lat"`
+}
+
+// ParseBBox reads a "minLon,minLat,maxLon,maxLat" box, the order web maps
+// use.
+func ParseBBox(s string) (BBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return BBox{}, fmt.Errorf("bbox %q: want minLon,minLat,maxLon,maxLat", s)
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return BBox{}, fmt.Errorf("bbox %q: %w", s, err)
+		}
+		v[i] = f
+	}
+	b := BBox{v[0], v[1], v[2], v[3]}
+	if b.MinLat > b.MaxLat || b.MinLat < -90 || b.MaxLat > 90 || b.MinLon < -180 || b.MaxLon > 180 || b.MinLon > b.MaxLon {
+		return BBox{}, fmt.Errorf("bbox %q: corners out of range or out of order", s)
+	}
+	return b, nil
+}
+
+// Contains reports whether the tower t lies in b.
+func (b BBox) Contains(t Tower) bool {
+	return t.Lat >= b.MinLat && t.Lat <= b.MaxLat && t.Lon >= b.MinLon && t.Lon <= b.MaxLon
+}
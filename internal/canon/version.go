@@ -0,0 +1,62 @@
+package canon
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ToolVersion identifies the build that produces the reports: the module
+// version, which for a build from a git checkout carries the commit and a
+// "+dirty" mark for uncommitted changes, else the commit alone, else
+// "devel".
+func ToolVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	if v := bi.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	var rev, dirty string
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				dirty = "+dirty"
+			}
+		}
+	}
+	if rev == "" {
+		return "devel"
+	}
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	return rev + dirty
+}
+
+// MappingVersion identifies a TSP's column mapping, source columns as
+// returned by its SourceColumns, together with the canonical layout. It
+// changes only when either does, so reports from different builds with
+// the same mapping version were mapped alike.
+func MappingVersion(source map[string][]string) string {
+	h := sha256.New()
+	fmt.Fprintln(h, strings.Join(Header(), ","))
+	names := make([]string, 0, len(source))
+	for n := range source {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		cols := slices.Clone(source[n])
+		sort.Strings(cols)
+		fmt.Fprintf(h, "%s=%s\n", n, strings.Join(cols, ","))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)[:6])
+}
@@ -0,0 +1,131 @@
+package canon
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // zone names resolve on hosts without a zoneinfo database
+)
+
+// Operators stamp most exports in IST and a few, such as Airtel's
+// enterprise CDRs, in UTC. The reports are written in one zone whatever
+// the export's:
+//
+//	CDR_OUTPUT_TZ  zone of the reports' Date and Time, IST by default
+//	CDR_SOURCE_TZ  zones of exports where the built-in ones are wrong, as
+//	               comma-separated tsp=zone or tsp/format=zone entries,
+//	               e.g. vi=UTC,airtel/enterprise=IST
+//
+// A zone is IST, UTC, an IANA name such as Asia/Dubai, or an offset such
+// as +04:00.
+var (
+	outputZone  = IST
+	sourceZones = map[string]*time.Location{}
+)
+
+func init() {
+	if s := os.Getenv("CDR_OUTPUT_TZ"); s != "" {
+		z, err := ParseZone(s)
+		if err != nil {
+			log.Fatalf("CDR_OUTPUT_TZ: %v", err)
+		}
+		outputZone = z
+	}
+	for _, kv := range strings.Split(os.Getenv("CDR_SOURCE_TZ"), ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			log.Fatalf("CDR_SOURCE_TZ: %q is not tsp=zone or tsp/format=zone", kv)
+		}
+		z, err := ParseZone(v)
+		if err != nil {
+			log.Fatalf("CDR_SOURCE_TZ: %s: %v", strings.TrimSpace(k), err)
+		}
+		sourceZones[strings.ToLower(strings.TrimSpace(k))] = z
+	}
+}
+
+// ParseZone reads a zone as CDR_OUTPUT_TZ and CDR_SOURCE_TZ take it.
+// India's own names all give IST.
+func ParseZone(s string) (*time.Location, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToUpper(s) {
+	case "IST", "ASIA/KOLKATA", "ASIA/CALCUTTA", "+05:30", "+0530":
+		return IST, nil
+	case "UTC", "GMT", "Z", "+00:00":
+		return time.UTC, nil
+	}
+	if t, err := time.Parse("-07:00", s); err == nil {
+		_, off := t.Zone()
+		return time.FixedZone(s, off), nil
+	}
+	z, err := time.LoadLocation(s)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", s)
+	}
+	return z, nil
+}
+
+// OutputZone returns the zone the reports' Date and Time are written in.
+func OutputZone() *time.Location { return outputZone }
+
+// Clock converts the Date and Time of an export's rows from the zone the
+// export is stamped in to the output zone.
+type Clock struct{ From, To *time.Location }
+
+// ClockFor returns the conversion for tsp's exports in layout f: from the
+// zone CDR_SOURCE_TZ gives tsp/format or tsp, else f's own, else IST.
+func ClockFor(tsp string, f Format) Clock {
+	from := f.Zone
+	if from == nil {
+		from = IST
+	}
+	if z, ok := sourceZones[tsp]; ok {
+		from = z
+	}
+	if z, ok := sourceZones[tsp+"/"+strings.ToLower(f.Name)]; ok && f.Name != "" {
+		from = z
+	}
+	return Clock{From: from, To: outputZone}
+}
+
+// Converts reports whether c changes the times at all.
+func (c Clock) Converts() bool {
+	return c.From != nil && c.To != nil && c.From.String() != c.To.String()
+}
+
+// String names the output zone, and the export's when converted from it,
+// as in "IST (from UTC)".
+func (c Clock) String() string {
+	switch {
+	case c.To == nil:
+		return ""
+	case c.Converts():
+		return c.To.String() + " (from " + c.From.String() + ")"
+	}
+	return c.To.String()
+}
+
+// Apply rewrites row's Date and Time in the output zone. A Date that
+// carries the time too, as in "2025-03-01 05:41:39", is split between
+// the two. Rows whose date cannot be read are left as they are.
+func (c Clock) Apply(row []string, col map[string]int) {
+	if !c.Converts() {
+		return
+	}
+	d, t := strings.TrimSpace(Get(row, col, "Date")), Get(row, col, "Time")
+	if i := strings.IndexAny(d, " T"); t == "" && i > 0 {
+		d, t = d[:i], strings.TrimSuffix(d[i+1:], "Z")
+	}
+	at, ok := ParseDateTime(d, t)
+	if !ok {
+		return
+	}
+	at = time.Date(at.Year(), at.Month(), at.Day(), at.Hour(), at.Minute(), at.Second(), 0, c.From).In(c.To)
+	row[col["Date"]] = at.Format("02/01/2006")
+	row[col["Time"]] = at.Format("15:04:05")
+}
@@ -0,0 +1,260 @@
+// Package casebook builds the summary workbook of a case with several
+// targets: an overview sheet of the targets, the period their records
+// cover and how many there are; a sheet of the contacts two or more
+// targets share, which is where co-accused turn up; and a tab per target
+// of its contacts, linking to its detail reports.
+package casebook
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/workbook"
+)
+
+// Target is one target of the case.
+type Target struct {
+	CDR     string
+	TSP     string
+	Records string   // its normalized records; "" when only summaries were made
+	Reports []string // paths of its detail reports, linked from its tab
+}
+
+// contact is what one target exchanged with one party.
+type contact struct {
+	calls, sms  int
+	duration    int // seconds
+	first, last time.Time
+}
+
+// target is a Target with its records read.
+type target struct {
+	Target
+	sheet      string
+	records    int
+	from, to   time.Time
+	contacts   map[string]*contact
+	byActivity []string // parties, most calls and SMS first
+}
+
+// Write writes the workbook of case crime to w, its sheets protected with
+// password unless it is "". link returns the URL a report path is
+// downloaded from.
+func Write(w io.Writer, crime string, targets []Target, link func(path string) string, password string) error {
+	var ts []*target
+	used := map[string]bool{"Overview": true, "Common contacts": true}
+	for _, t := range targets {
+		rt, err := read(t)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.CDR, err)
+		}
+		rt.sheet = unique(workbook.SheetName(t.CDR+" "+t.TSP), used)
+		ts = append(ts, rt)
+	}
+	sheets := []workbook.Sheet{overview(crime, ts), common(ts)}
+	for _, t := range ts {
+		sheets = append(sheets, tab(t, link))
+	}
+	return workbook.Write(w, sheets, password)
+}
+
+// unique returns name, or name with a number, not yet in used.
+func unique(name string, used map[string]bool) string {
+	try := name
+	for n := 2; used[try]; n++ {
+		suffix := " " + strconv.Itoa(n)
+		r := []rune(name)
+		try = string(r[:min(len(r), workbook.MaxName-len(suffix))]) + suffix
+	}
+	used[try] = true
+	return try
+}
+
+func read(t Target) (*target, error) {
+	rt := &target{Target: t, contacts: map[string]*contact{}}
+	if t.Records == "" {
+		return rt, nil
+	}
+	var col map[string]int
+	err := canon.ScanReport(t.Records, func(header, row []string) error {
+		if col == nil {
+			col = canon.Index(header)
+		}
+		rt.records++
+		when, ok := canon.ParseDateTime(canon.Get(row, col, "Date"), canon.Get(row, col, "Time"))
+		if ok {
+			if rt.from.IsZero() || when.Before(rt.from) {
+				rt.from = when
+			}
+			if when.After(rt.to) {
+				rt.to = when
+			}
+		}
+		party := canon.Party(canon.Get(row, col, "B Party"))
+		if party == "" {
+			return nil
+		}
+		c := rt.contacts[party]
+		if c == nil {
+			c = &contact{}
+			rt.contacts[party] = c
+		}
+		if isSMS(canon.Get(row, col, "Call Type")) {
+			c.sms++
+		} else {
+			c.calls++
+		}
+		d, _ := strconv.Atoi(canon.Get(row, col, "Duration"))
+		c.duration += d
+		if ok {
+			if c.first.IsZero() || when.Before(c.first) {
+				c.first = when
+			}
+			if when.After(c.last) {
+				c.last = when
+			}
+		}
+		return nil
+	})
+	for p := range rt.contacts {
+		rt.byActivity = append(rt.byActivity, p)
+	}
+	sort.Slice(rt.byActivity, func(i, j int) bool {
+		a, b := rt.contacts[rt.byActivity[i]], rt.contacts[rt.byActivity[j]]
+		if a.calls+a.sms != b.calls+b.sms {
+			return a.calls+a.sms > b.calls+b.sms
+		}
+		return rt.byActivity[i] < rt.byActivity[j]
+	})
+	return rt, err
+}
+
+// isSMS reports whether a call type is a message rather than a call, as
+// the summary reports tell them apart.
+func isSMS(callType string) bool {
+	return strings.Contains(strings.ToUpper(callType), "SMS")
+}
+
+func stamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func overview(crime string, ts []*target) workbook.Sheet {
+	rows := [][]workbook.Cell{{
+		workbook.Text("Target"), workbook.Text("TSP"), workbook.Text("From"), workbook.Text("To"),
+		workbook.Text("Records"), workbook.Text("Contacts"), workbook.Text("Details"),
+	}}
+	total := 0
+	for _, t := range ts {
+		total += t.records
+		rows = append(rows, []workbook.Cell{
+			workbook.Text(t.CDR), workbook.Text(t.TSP), workbook.Text(stamp(t.from)), workbook.Text(stamp(t.to)),
+			workbook.Int(t.records), workbook.Int(len(t.contacts)), workbook.Link(t.sheet, "#"+t.sheet),
+		})
+	}
+	rows = append(rows, nil,
+		[]workbook.Cell{workbook.Text("Case"), workbook.Text(crime)},
+		[]workbook.Cell{workbook.Text("Targets"), workbook.Int(len(ts))},
+		[]workbook.Cell{workbook.Text("Records"), workbook.Int(total)},
+		[]workbook.Cell{workbook.Text("Generated"), workbook.Text(stamp(time.Now()))},
+	)
+	return workbook.Sheet{Name: "Overview", Rows: rows}
+}
+
+// common lists the parties two or more targets were in contact with, the
+// most widely shared first, with each target's calls and SMS.
+func common(ts []*target) workbook.Sheet {
+	header := []workbook.Cell{workbook.Text("B Party"), workbook.Text("Targets")}
+	for _, t := range ts {
+		header = append(header, workbook.Text(t.CDR))
+	}
+	header = append(header, workbook.Text("Total calls and SMS"), workbook.Text("Total duration"),
+		workbook.Text("First contact"), workbook.Text("Last contact"))
+	rows := [][]workbook.Cell{header}
+
+	shared := map[string]int{}
+	for _, t := range ts {
+		for p := range t.contacts {
+			shared[p]++
+		}
+	}
+	type line struct {
+		party           string
+		targets, events int
+	}
+	var lines []line
+	for p, n := range shared {
+		if n < 2 {
+			continue
+		}
+		l := line{party: p, targets: n}
+		for _, t := range ts {
+			if c := t.contacts[p]; c != nil {
+				l.events += c.calls + c.sms
+			}
+		}
+		lines = append(lines, l)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].targets != lines[j].targets {
+			return lines[i].targets > lines[j].targets
+		}
+		if lines[i].events != lines[j].events {
+			return lines[i].events > lines[j].events
+		}
+		return lines[i].party < lines[j].party
+	})
+	for _, l := range lines {
+		row := []workbook.Cell{workbook.Text(l.party), workbook.Int(l.targets)}
+		var duration int
+		var first, last time.Time
+		for _, t := range ts {
+			c := t.contacts[l.party]
+			if c == nil {
+				row = append(row, workbook.Text(""))
+				continue
+			}
+			row = append(row, workbook.Int(c.calls+c.sms))
+			duration += c.duration
+			if !c.first.IsZero() && (first.IsZero() || c.first.Before(first)) {
+				first = c.first
+			}
+			if c.last.After(last) {
+				last = c.last
+			}
+		}
+		row = append(row, workbook.Int(l.events), workbook.Int(duration), workbook.Text(stamp(first)), workbook.Text(stamp(last)))
+		rows = append(rows, row)
+	}
+	return workbook.Sheet{Name: "Common contacts", Rows: rows}
+}
+
+// tab lists one target's contacts, most active first, followed by links
+// back to the overview and to its reports.
+func tab(t *target, link func(string) string) workbook.Sheet {
+	rows := [][]workbook.Cell{{
+		workbook.Text("B Party"), workbook.Text("Calls"), workbook.Text("SMS"), workbook.Text("Duration"),
+		workbook.Text("First contact"), workbook.Text("Last contact"),
+	}}
+	for _, p := range t.byActivity {
+		c := t.contacts[p]
+		rows = append(rows, []workbook.Cell{
+			workbook.Text(p), workbook.Int(c.calls), workbook.Int(c.sms), workbook.Int(c.duration),
+			workbook.Text(stamp(c.first)), workbook.Text(stamp(c.last)),
+		})
+	}
+	rows = append(rows, nil, []workbook.Cell{workbook.Link("Back to overview", "#Overview")})
+	for _, r := range t.Reports {
+		rows = append(rows, []workbook.Cell{workbook.Link(filepath.Base(r), link(r))})
+	}
+	return workbook.Sheet{Name: t.sheet, Rows: rows}
+}
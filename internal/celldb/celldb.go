@@ -0,0 +1,269 @@
+// Package celldb reads a TSP's cell DB from every copy available and
+// merges them. With CDR_DATA_DIR set, a cell DB may be found under
+// <dir>/<tsp>/, directly under <dir> and embedded in the binary; each
+// copy is read, in the order of CDR_CELL_PRECEDENCE ("tsp,shared,embedded"
+// by default), and a CGI takes its entry from the first copy that has it.
+// Within one copy a later row for a CGI replaces an earlier one. Entries
+// for the same CGI whose coordinates or addresses disagree are kept as
+// conflicts for the report GET /cells/conflicts serves, since a location
+// column filled from one of them is only as good as that choice.
+package celldb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+// The kinds of copy of a cell DB, named in CDR_CELL_PRECEDENCE.
+const (
+	TSPDir    = "tsp"      // <CDR_DATA_DIR>/<tsp>/<file>
+	SharedDir = "shared"   // <CDR_DATA_DIR>/<file>
+	Embedded  = "embedded" // the copy built into the binary
+)
+
+// Precedence returns the kinds of copy to read, highest precedence
+// first. Kinds left out of CDR_CELL_PRECEDENCE are not read.
+func Precedence() ([]string, error) {
+	v := os.Getenv("CDR_CELL_PRECEDENCE")
+	if v == "" {
+		return []string{TSPDir, SharedDir, Embedded}, nil
+	}
+	var out []string
+	for _, k := range strings.Split(v, ",") {
+		k = strings.ToLower(strings.TrimSpace(k))
+		switch k {
+		case TSPDir, SharedDir, Embedded:
+		default:
+			return nil, fmt.Errorf("CDR_CELL_PRECEDENCE: unknown source %q (want %s, %s or %s)", k, TSPDir, SharedDir, Embedded)
+		}
+		if !slices.Contains(out, k) {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+// Source is one copy of a cell DB: the path it was read from, or
+// "embedded".
+type Source struct {
+	Name string
+	fs.File
+}
+
+// Open returns every copy of tsp's cell DB, highest precedence first,
+// versioned through refdata. embedded holds the built-in copy at path;
+// the external copies share its file name.
+func Open(tsp string, embedded fs.FS, path string) ([]Source, error) {
+	order, err := Precedence()
+	if err != nil {
+		return nil, err
+	}
+	var out []Source
+	closeAll := func() {
+		for _, s := range out {
+			s.Close()
+		}
+	}
+	for _, kind := range order {
+		if kind == Embedded {
+			f, err := embedded.Open(path)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			out = append(out, Source{Embedded, refdata.Track(f, Embedded)})
+			continue
+		}
+		dir := refdata.Dir()
+		if dir == "" {
+			continue
+		}
+		if kind == TSPDir {
+			dir = filepath.Join(dir, tsp)
+		}
+		p := filepath.Join(dir, filepath.Base(path))
+		f, err := os.Open(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		log.Printf("%s: loading %s", tsp, p)
+		out = append(out, Source{p, refdata.Track(f, p)})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no cell DB among the sources of CDR_CELL_PRECEDENCE (%s)", strings.Join(order, ", "))
+	}
+	return out, nil
+}
+
+// Entry is what one source says about a CGI.
+type Entry struct {
+	Source  string
+	LatLong string
+	Address string
+	Used    bool // the entry the cell DB keeps
+}
+
+// Conflict is a CGI whose sources disagree on where it is.
+type Conflict struct {
+	CGI     string
+	Entries []Entry
+}
+
+// Merge decides which entry each CGI of a cell DB keeps while the copies
+// are read, and collects the conflicts.
+type Merge struct {
+	tsp       string
+	kept      map[string]Entry
+	conflicts map[string][]Entry
+	order     []string // CGIs in conflict, as first found
+	sources   []string
+}
+
+// New starts the merge of tsp's cell DB.
+func New(tsp string) *Merge {
+	return &Merge{tsp: tsp, kept: map[string]Entry{}, conflicts: map[string][]Entry{}}
+}
+
+// Add offers source's entry for cgi, its "lat, long[, azimuth]" location
+// and address, and reports whether the cell DB should take it: the first
+// entry for a CGI, or a later one from the same source.
+func (m *Merge) Add(source, cgi, latLong, address string) bool {
+	if !slices.Contains(m.sources, source) {
+		m.sources = append(m.sources, source)
+	}
+	e := Entry{Source: source, LatLong: latLong, Address: address}
+	cur, ok := m.kept[cgi]
+	if !ok {
+		m.kept[cgi] = e
+		return true
+	}
+	take := source == cur.Source
+	if disagree(cur, e) {
+		if m.conflicts[cgi] == nil {
+			m.conflicts[cgi] = []Entry{cur}
+			m.order = append(m.order, cgi)
+		}
+		m.conflicts[cgi] = append(m.conflicts[cgi], e)
+	}
+	if take {
+		m.kept[cgi] = e
+	}
+	return take
+}
+
+// Done publishes the conflicts found, replacing tsp's earlier ones with
+// the cell DB's next load.
+func (m *Merge) Done() {
+	out := make([]Conflict, 0, len(m.order))
+	for _, cgi := range m.order {
+		c := Conflict{CGI: cgi, Entries: m.conflicts[cgi]}
+		// a later row of the kept entry's source that agreed with it
+		// replaced it without being listed
+		i := slices.Index(c.Entries, m.kept[cgi])
+		if i < 0 {
+			c.Entries, i = append(c.Entries, m.kept[cgi]), len(c.Entries)
+		}
+		c.Entries[i].Used = true
+		out = append(out, c)
+	}
+	if len(out) > 0 {
+		log.Printf("%s cells: %d CGIs have conflicting entries in %s; see GET /cells/conflicts",
+			m.tsp, len(out), strings.Join(m.sources, ", "))
+	}
+	table(m.tsp).Set(out)
+}
+
+// disagree reports whether two entries put a CGI in different places:
+// coordinates more than about a metre apart, or different addresses.
+// What one entry leaves blank does not count.
+func disagree(a, b Entry) bool {
+	lat1, lon1, ok1 := canon.ParseLatLong(a.LatLong)
+	lat2, lon2, ok2 := canon.ParseLatLong(b.LatLong)
+	if ok1 && ok2 && (math.Abs(lat1-lat2) > 1e-5 || math.Abs(lon1-lon2) > 1e-5) {
+		return true
+	}
+	x, y := squash(a.Address), squash(b.Address)
+	return x != "" && y != "" && x != y
+}
+
+// squash keeps an address's letters and digits, lower-cased, so spacing
+// and punctuation do not count as a difference.
+func squash(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+var (
+	tablesMu sync.Mutex
+	tables   = map[string]*refdata.Table[[]Conflict]{} // tsp → conflicts
+)
+
+// table returns tsp's conflicts; one table per TSP, so each is replaced
+// with its own cell DB within a reload.
+func table(tsp string) *refdata.Table[[]Conflict] {
+	tablesMu.Lock()
+	defer tablesMu.Unlock()
+	t := tables[tsp]
+	if t == nil {
+		t = &refdata.Table[[]Conflict]{}
+		tables[tsp] = t
+	}
+	return t
+}
+
+// Conflicts returns the conflicts of tsp's loaded cell DB.
+func Conflicts(tsp string) []Conflict { return table(tsp).Get() }
+
+// TSPs returns the TSPs whose cell DBs were merged, sorted.
+func TSPs() []string {
+	tablesMu.Lock()
+	defer tablesMu.Unlock()
+	var out []string
+	for tsp := range tables {
+		out = append(out, tsp)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// WriteReport writes the conflicts of the cell DBs of tsps as CSV, a row
+// per entry, with Used marking the entry the cell DB keeps.
+func WriteReport(w io.Writer, tsps []string) error {
+	cw := safecsv.NewWriter(w)
+	cw.Write([]string{"TSP", "CGI", "Source", "Lat-Long-Azimuth", "Address", "Used"})
+	for _, tsp := range tsps {
+		for _, c := range Conflicts(tsp) {
+			for _, e := range c.Entries {
+				used := "no"
+				if e.Used {
+					used = "yes"
+				}
+				cw.Write([]string{tsp, c.CGI, e.Source, e.LatLong, e.Address, used})
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
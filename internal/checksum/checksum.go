@@ -0,0 +1,51 @@
+// Package checksum publishes a SHA-256 digest beside each CSV report so a
+// recipient can verify it after it has passed between systems. The digest
+// file <report>.sha256 uses the sha256sum format, so `sha256sum -c` checks
+// it directly.
+package checksum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Write hashes every CSV among paths and writes its digest file beside
+// it. It returns the digest files written and the digests by file name.
+func Write(paths []string) ([]string, map[string]string, error) {
+	var files []string
+	sums := map[string]string{}
+	for _, p := range paths {
+		if filepath.Ext(p) != ".csv" {
+			continue
+		}
+		sum, err := file(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := filepath.Base(p)
+		line := fmt.Sprintf("%s  %s\n", sum, name)
+		if err := os.WriteFile(p+".sha256", []byte(line), 0o644); err != nil {
+			return nil, nil, err
+		}
+		files = append(files, p+".sha256")
+		sums[name] = sum
+	}
+	return files, sums, nil
+}
+
+func file(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,88 @@
+// Package clamav has a ClamAV daemon scan uploads before they are
+// processed. It is enabled by CDR_CLAMAV_ADDR, the daemon's socket: a
+// unix socket path such as /run/clamav/clamd.ctl, or host:port for one
+// listening on TCP.
+//
+// Files are streamed to the daemon with its INSTREAM command, so it needs
+// no access to the uploads directory. Its StreamMaxLength (25 MB by
+// default) must be at least the upload size cap, or larger files fail to
+// scan and are refused.
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Addr returns the configured daemon socket, or "" when scanning is off.
+func Addr() string { return os.Getenv("CDR_CLAMAV_ADDR") }
+
+// Infected reports a file the daemon found malware in.
+type Infected struct {
+	Signature string
+}
+
+func (e *Infected) Error() string { return "malware found: " + e.Signature }
+
+// chunk is the size of the INSTREAM chunks sent.
+const chunk = 64 << 10
+
+// Scan streams r to the daemon at addr. It returns an *Infected for a file
+// the daemon flags, and another error if the file could not be scanned.
+func Scan(addr string, r io.Reader) error {
+	network := "tcp"
+	if strings.Contains(addr, "/") {
+		network = "unix"
+	}
+	conn, err := net.DialTimeout(network, addr, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("clamav: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Minute))
+
+	w := bufio.NewWriterSize(conn, chunk+4)
+	w.WriteString("zINSTREAM\x00")
+	buf := make([]byte, chunk)
+	for {
+		n, rerr := io.ReadFull(r, buf)
+		if n > 0 {
+			binary.Write(w, binary.BigEndian, uint32(n))
+			if _, err := w.Write(buf[:n]); err != nil {
+				return fmt.Errorf("clamav: %v", err)
+			}
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+	binary.Write(w, binary.BigEndian, uint32(0))
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("clamav: %v", err)
+	}
+
+	// "stream: OK", "stream: <signature> FOUND" or "<reason> ERROR"
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && len(reply) == 0 {
+		return fmt.Errorf("clamav: %v", err)
+	}
+	res := string(bytes.TrimSpace(bytes.TrimRight(reply, "\x00")))
+	res = strings.TrimPrefix(res, "stream: ")
+	switch {
+	case res == "OK":
+		return nil
+	case strings.HasSuffix(res, " FOUND"):
+		return &Infected{Signature: strings.TrimSuffix(res, " FOUND")}
+	}
+	return fmt.Errorf("clamav: %s", res)
+}
@@ -0,0 +1,299 @@
+// Package compare sets the records of two targets side by side, for
+// judging whether two numbers are one person's: their activity day by
+// day, the towers both were seen on and the contacts both kept. Two
+// numbers carried by one person tend to share handsets (IMEIs), towers and
+// contacts, to be active on the same days and to rarely call each other;
+// Score weighs those signs into a likelihood, and the workbook opens with
+// the evidence it rests on.
+package compare
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/workbook"
+)
+
+// Target is one of the two numbers compared.
+type Target struct {
+	CDR     string
+	TSP     string
+	Records string // its normalized records
+}
+
+// tally counts the records of one target on a day, at a tower or with a
+// contact.
+type tally struct {
+	calls, sms  int
+	duration    int // seconds
+	first, last time.Time
+}
+
+func (t *tally) add(sms bool, duration int, when time.Time, ok bool) {
+	if sms {
+		t.sms++
+	} else {
+		t.calls++
+	}
+	t.duration += duration
+	if ok {
+		if t.first.IsZero() || when.Before(t.first) {
+			t.first = when
+		}
+		if when.After(t.last) {
+			t.last = when
+		}
+	}
+}
+
+func (t *tally) events() int { return t.calls + t.sms }
+
+// side is a Target with its records read.
+type side struct {
+	Target
+	records   int
+	from, to  time.Time
+	days      map[string]*tally
+	dayTowers map[string]map[string]bool // day → towers seen
+	towers    map[string]*tally
+	addresses map[string]string // tower → address
+	contacts  map[string]*tally
+	imeis     map[string]*tally
+	hours     map[time.Time]map[string]bool // hour active → towers seen in it
+}
+
+func read(t Target) (*side, error) {
+	s := &side{
+		Target: t, days: map[string]*tally{}, dayTowers: map[string]map[string]bool{},
+		towers: map[string]*tally{}, addresses: map[string]string{},
+		contacts: map[string]*tally{}, imeis: map[string]*tally{},
+		hours: map[time.Time]map[string]bool{},
+	}
+	var col map[string]int
+	err := canon.ScanReport(t.Records, func(header, row []string) error {
+		if col == nil {
+			col = canon.Index(header)
+		}
+		s.records++
+		when, ok := canon.ParseDateTime(canon.Get(row, col, "Date"), canon.Get(row, col, "Time"))
+		sms := strings.Contains(strings.ToUpper(canon.Get(row, col, "Call Type")), "SMS")
+		duration, _ := strconv.Atoi(canon.Get(row, col, "Duration"))
+		if ok {
+			if s.from.IsZero() || when.Before(s.from) {
+				s.from = when
+			}
+			if when.After(s.to) {
+				s.to = when
+			}
+		}
+		day := ""
+		var hour time.Time
+		if ok {
+			day, hour = when.Format("2006-01-02"), when.Truncate(time.Hour)
+			add(s.days, day, sms, duration, when, ok)
+			if s.hours[hour] == nil {
+				s.hours[hour] = map[string]bool{}
+			}
+		}
+		if cell := canon.Get(row, col, "First Cell ID"); cell != "" {
+			add(s.towers, cell, sms, duration, when, ok)
+			if a := canon.Get(row, col, "First Cell ID Address"); a != "" {
+				s.addresses[cell] = a
+			}
+			if day != "" {
+				if s.dayTowers[day] == nil {
+					s.dayTowers[day] = map[string]bool{}
+				}
+				s.dayTowers[day][cell] = true
+				s.hours[hour][cell] = true
+			}
+		}
+		if p := canon.Party(canon.Get(row, col, "B Party")); p != "" {
+			add(s.contacts, p, sms, duration, when, ok)
+		}
+		if imei := strings.Trim(canon.Get(row, col, "IMEI"), "'\" "); imei != "" {
+			add(s.imeis, imei, sms, duration, when, ok)
+		}
+		return nil
+	})
+	return s, err
+}
+
+func add(m map[string]*tally, k string, sms bool, duration int, when time.Time, ok bool) {
+	t := m[k]
+	if t == nil {
+		t = &tally{}
+		m[k] = t
+	}
+	t.add(sms, duration, when, ok)
+}
+
+// Write writes the comparison of a and b to w as an .xlsx workbook,
+// starting with the same-person score and its evidence, its sheets
+// protected with password unless it is "".
+func Write(w io.Writer, a, b Target, password string) error {
+	sa, err := read(a)
+	if err != nil {
+		return err
+	}
+	sb, err := read(b)
+	if err != nil {
+		return err
+	}
+	return workbook.Write(w, []workbook.Sheet{
+		evidence(score(sa, sb)), overview(sa, sb), daily(sa, sb), towers(sa, sb), contacts(sa, sb),
+	}, password)
+}
+
+// Score reads a and b and scores them as in the workbook Write writes.
+func Score(a, b Target) (*Result, error) {
+	sa, err := read(a)
+	if err != nil {
+		return nil, err
+	}
+	sb, err := read(b)
+	if err != nil {
+		return nil, err
+	}
+	return score(sa, sb), nil
+}
+
+func stamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// shared returns the keys of both maps, in order.
+func shared[V any](a, b map[string]V) []string {
+	var out []string
+	for k := range a {
+		if _, ok := b[k]; ok {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func overview(a, b *side) workbook.Sheet {
+	both := 0
+	for _, d := range shared(a.days, b.days) {
+		if a.days[d].events() > 0 && b.days[d].events() > 0 {
+			both++
+		}
+	}
+	between := func(from, to *side) int {
+		if t := from.contacts[canon.Party(to.CDR)]; t != nil {
+			return t.events()
+		}
+		return 0
+	}
+	imeis := shared(a.imeis, b.imeis)
+	row := func(what string, va, vb workbook.Cell) []workbook.Cell {
+		return []workbook.Cell{workbook.Text(what), va, vb}
+	}
+	rows := [][]workbook.Cell{
+		{workbook.Text(""), workbook.Text(a.CDR), workbook.Text(b.CDR)},
+		row("TSP", workbook.Text(a.TSP), workbook.Text(b.TSP)),
+		row("From", workbook.Text(stamp(a.from)), workbook.Text(stamp(b.from))),
+		row("To", workbook.Text(stamp(a.to)), workbook.Text(stamp(b.to))),
+		row("Records", workbook.Int(a.records), workbook.Int(b.records)),
+		row("Active days", workbook.Int(len(a.days)), workbook.Int(len(b.days))),
+		row("Towers", workbook.Int(len(a.towers)), workbook.Int(len(b.towers))),
+		row("Contacts", workbook.Int(len(a.contacts)), workbook.Int(len(b.contacts))),
+		row("Calls and SMS to the other", workbook.Int(between(a, b)), workbook.Int(between(b, a))),
+		nil,
+		{workbook.Text("Days both active"), workbook.Int(both)},
+		{workbook.Text("Shared towers"), workbook.Link(strconv.Itoa(len(shared(a.towers, b.towers))), "#Shared towers")},
+		{workbook.Text("Shared contacts"), workbook.Link(strconv.Itoa(len(shared(a.contacts, b.contacts))), "#Shared contacts")},
+		{workbook.Text("Shared IMEIs"), workbook.Text(strings.Join(imeis, ", "))},
+		{workbook.Text("Generated"), workbook.Text(stamp(time.Now()))},
+	}
+	return workbook.Sheet{Name: "Overview", Rows: rows}
+}
+
+// daily lines up the two targets' activity on every day either was
+// active, with the towers both used that day.
+func daily(a, b *side) workbook.Sheet {
+	rows := [][]workbook.Cell{{
+		workbook.Text("Date"),
+		workbook.Text(a.CDR + " calls"), workbook.Text(a.CDR + " SMS"), workbook.Text(a.CDR + " duration"), workbook.Text(a.CDR + " towers"),
+		workbook.Text(b.CDR + " calls"), workbook.Text(b.CDR + " SMS"), workbook.Text(b.CDR + " duration"), workbook.Text(b.CDR + " towers"),
+		workbook.Text("Shared towers"),
+	}}
+	days := map[string]bool{}
+	for d := range a.days {
+		days[d] = true
+	}
+	for d := range b.days {
+		days[d] = true
+	}
+	var order []string
+	for d := range days {
+		order = append(order, d)
+	}
+	sort.Strings(order)
+	cells := func(s *side, d string) []workbook.Cell {
+		t := s.days[d]
+		if t == nil {
+			return []workbook.Cell{workbook.Int(0), workbook.Int(0), workbook.Int(0), workbook.Int(0)}
+		}
+		return []workbook.Cell{workbook.Int(t.calls), workbook.Int(t.sms), workbook.Int(t.duration), workbook.Int(len(s.dayTowers[d]))}
+	}
+	for _, d := range order {
+		row := append([]workbook.Cell{workbook.Text(d)}, cells(a, d)...)
+		row = append(row, cells(b, d)...)
+		row = append(row, workbook.Text(strings.Join(shared(a.dayTowers[d], b.dayTowers[d]), ", ")))
+		rows = append(rows, row)
+	}
+	return workbook.Sheet{Name: "Daily activity", Rows: rows}
+}
+
+// sideBySide returns the header and rows of the keys both a and b have,
+// most records across both first.
+func sideBySide(key string, a, b *side, ma, mb map[string]*tally, extra func(k string) []workbook.Cell, extraHeader ...string) [][]workbook.Cell {
+	header := []workbook.Cell{workbook.Text(key)}
+	for _, h := range extraHeader {
+		header = append(header, workbook.Text(h))
+	}
+	for _, s := range []*side{a, b} {
+		header = append(header, workbook.Text(s.CDR+" calls"), workbook.Text(s.CDR+" SMS"), workbook.Text(s.CDR+" duration"),
+			workbook.Text(s.CDR+" first"), workbook.Text(s.CDR+" last"))
+	}
+	keys := shared(ma, mb)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return ma[keys[i]].events()+mb[keys[i]].events() > ma[keys[j]].events()+mb[keys[j]].events()
+	})
+	rows := [][]workbook.Cell{header}
+	for _, k := range keys {
+		row := append([]workbook.Cell{workbook.Text(k)}, extra(k)...)
+		for _, t := range []*tally{ma[k], mb[k]} {
+			row = append(row, workbook.Int(t.calls), workbook.Int(t.sms), workbook.Int(t.duration),
+				workbook.Text(stamp(t.first)), workbook.Text(stamp(t.last)))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func towers(a, b *side) workbook.Sheet {
+	address := func(k string) []workbook.Cell {
+		addr := a.addresses[k]
+		if addr == "" {
+			addr = b.addresses[k]
+		}
+		return []workbook.Cell{workbook.Text(addr)}
+	}
+	return workbook.Sheet{Name: "Shared towers", Rows: sideBySide("Cell ID", a, b, a.towers, b.towers, address, "Address")}
+}
+
+func contacts(a, b *side) workbook.Sheet {
+	none := func(string) []workbook.Cell { return nil }
+	return workbook.Sheet{Name: "Shared contacts", Rows: sideBySide("B Party", a, b, a.contacts, b.contacts, none)}
+}
@@ -0,0 +1,345 @@
+package compare
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/workbook"
+)
+
+// Evidence is what one heuristic found.
+type Evidence struct {
+	Heuristic string  `json:"heuristic"`
+	Finding   string  `json:"finding"`
+	Weight    float64 `json:"weight"` // 0 to 1 for the same person, negative against
+}
+
+// Result is the likelihood that two numbers are used by one person, with
+// the evidence it rests on. It is a lead to follow up, not proof.
+type Result struct {
+	A        string     `json:"a"`
+	B        string     `json:"b"`
+	Score    float64    `json:"score"` // 0 to 1
+	Verdict  string     `json:"verdict"`
+	Evidence []Evidence `json:"evidence"`
+}
+
+// Heuristic weights: the most a heuristic adds to the score.
+const (
+	imeiWeight      = 0.6
+	colocateWeight  = 0.4
+	routeWeight     = 0.25
+	alternateWeight = 0.35
+	contactsWeight  = 0.25
+	callsWeight     = 0.5 // the most calls between the two take off
+)
+
+// minHours is how many hours of activity a pattern needs to count.
+const minHours = 5
+
+// score weighs the heuristics. Supporting evidence is combined as
+// independent chances, 1-(1-w1)(1-w2)…, and calls between the two
+// numbers then take their share off.
+func score(a, b *side) *Result {
+	res := &Result{A: a.CDR, B: b.CDR}
+	res.Evidence = []Evidence{
+		sharedIMEI(a, b), colocation(a, b), route(a, b), alternation(a, b), sharedContacts(a, b), callsBetween(a, b),
+	}
+	against := 1.0
+	p := 1.0
+	for _, e := range res.Evidence {
+		switch {
+		case e.Weight > 0:
+			p *= 1 - e.Weight
+		case e.Weight < 0:
+			against *= 1 + e.Weight
+		}
+	}
+	res.Score = math.Round((1-p)*against*100) / 100
+	switch {
+	case res.Score >= 0.7:
+		res.Verdict = "likely the same person"
+	case res.Score >= 0.4:
+		res.Verdict = "possibly the same person"
+	default:
+		res.Verdict = "no strong sign of the same person"
+	}
+	return res
+}
+
+// handset is an IMEI without its last digit: the check digit, which some
+// operators write as 0 and others leave off.
+func handset(imei string) string {
+	if len(imei) >= 14 {
+		return imei[:14]
+	}
+	return imei
+}
+
+func sharedIMEI(a, b *side) Evidence {
+	e := Evidence{Heuristic: "Shared handset (IMEI)"}
+	seen := map[string]string{} // handset → an IMEI it was recorded as
+	byHandset := func(s *side) map[string]*tally {
+		m := map[string]*tally{}
+		for imei, t := range s.imeis {
+			h := handset(imei)
+			if m[h] == nil {
+				m[h] = &tally{}
+			}
+			merge(m[h], t)
+			if len(imei) > len(seen[h]) {
+				seen[h] = imei
+			}
+		}
+		return m
+	}
+	ha, hb := byHandset(a), byHandset(b)
+	var found []string
+	for _, h := range shared(ha, hb) {
+		ta, tb := ha[h], hb[h]
+		how := "in turn, as when one SIM replaces the other"
+		if !ta.last.Before(tb.first) && !tb.last.Before(ta.first) {
+			how = "over the same period, as a dual-SIM phone is"
+		}
+		found = append(found, fmt.Sprintf("%s used by both %s", seen[h], how))
+	}
+	if len(found) == 0 {
+		e.Finding = "no handset in common"
+		return e
+	}
+	e.Finding = strings.Join(found, "; ")
+	e.Weight = imeiWeight
+	return e
+}
+
+func merge(t, o *tally) {
+	t.calls += o.calls
+	t.sms += o.sms
+	t.duration += o.duration
+	if !o.first.IsZero() && (t.first.IsZero() || o.first.Before(t.first)) {
+		t.first = o.first
+	}
+	if o.last.After(t.last) {
+		t.last = o.last
+	}
+}
+
+// colocation looks at the hours both numbers were active with a tower
+// recorded: one person's two phones are on the same tower.
+func colocation(a, b *side) Evidence {
+	e := Evidence{Heuristic: "Same towers at the same time"}
+	both, same := 0, 0
+	for h, ta := range a.hours {
+		tb, ok := b.hours[h]
+		if !ok || len(ta) == 0 || len(tb) == 0 {
+			continue
+		}
+		both++
+		for cell := range ta {
+			if tb[cell] {
+				same++
+				break
+			}
+		}
+	}
+	if both < minHours {
+		e.Finding = fmt.Sprintf("too few hours with both on record (%d)", both)
+		return e
+	}
+	ratio := float64(same) / float64(both)
+	e.Finding = fmt.Sprintf("on a common tower in %d of the %d hours both were active (%.0f%%)", same, both, 100*ratio)
+	if ratio >= 0.5 {
+		e.Weight = round(colocateWeight * ratio)
+	}
+	return e
+}
+
+// route compares the towers each number used on the days both were
+// active: one person's phones follow one route.
+func route(a, b *side) Evidence {
+	e := Evidence{Heuristic: "Same daily movement"}
+	var sum float64
+	days := 0
+	for _, d := range shared(a.dayTowers, b.dayTowers) {
+		sum += jaccard(a.dayTowers[d], b.dayTowers[d])
+		days++
+	}
+	if days == 0 {
+		e.Finding = "no day with towers on record for both"
+		return e
+	}
+	mean := sum / float64(days)
+	e.Finding = fmt.Sprintf("the towers of a day overlap %.0f%% on average over %d days", 100*mean, days)
+	if mean >= 0.5 {
+		e.Weight = round(routeWeight * mean)
+	}
+	return e
+}
+
+// alternation looks for two numbers taking turns: while both are in use
+// over the same weeks, one is active when the other is not, as with two
+// SIMs swapped in one single-SIM phone.
+func alternation(a, b *side) Evidence {
+	e := Evidence{Heuristic: "Alternating activity"}
+	from, to := a.from, a.to
+	if b.from.After(from) {
+		from = b.from
+	}
+	if b.to.Before(to) {
+		to = b.to
+	}
+	if !from.Before(to) {
+		e.Finding = "the records do not cover a common period"
+		return e
+	}
+	type slot struct {
+		at   time.Time
+		a, b bool
+	}
+	slots := map[time.Time]*slot{}
+	for _, s := range []*side{a, b} {
+		for h := range s.hours {
+			if h.Before(from.Truncate(time.Hour)) || h.After(to) {
+				continue
+			}
+			sl := slots[h]
+			if sl == nil {
+				sl = &slot{at: h}
+				slots[h] = sl
+			}
+			if s == a {
+				sl.a = true
+			} else {
+				sl.b = true
+			}
+		}
+	}
+	var order []*slot
+	na, nb, both := 0, 0, 0
+	for _, sl := range slots {
+		order = append(order, sl)
+		if sl.a {
+			na++
+		}
+		if sl.b {
+			nb++
+		}
+		if sl.a && sl.b {
+			both++
+		}
+	}
+	if na < minHours || nb < minHours {
+		e.Finding = fmt.Sprintf("too few active hours in the common period (%d and %d)", na, nb)
+		return e
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].at.Before(order[j].at) })
+	switches, last := 0, ""
+	for _, sl := range order {
+		who := ""
+		switch {
+		case sl.a && !sl.b:
+			who = "a"
+		case sl.b && !sl.a:
+			who = "b"
+		default:
+			continue
+		}
+		if last != "" && who != last {
+			switches++
+		}
+		last = who
+	}
+	overlap := float64(both) / float64(min(na, nb))
+	e.Finding = fmt.Sprintf("active together in %d of %d and %d hours (%.0f%%), taking turns %d times",
+		both, na, nb, 100*overlap, switches)
+	if overlap <= 0.1 && switches >= 4 {
+		e.Weight = round(alternateWeight * (1 - overlap/0.1*0.5))
+	}
+	return e
+}
+
+// sharedContacts compares the numbers each called or messaged; sender
+// IDs, which everyone gets messages from, are left out.
+func sharedContacts(a, b *side) Evidence {
+	e := Evidence{Heuristic: "Shared contacts"}
+	numbers := func(s *side) map[string]bool {
+		m := map[string]bool{}
+		for p := range s.contacts {
+			if p != canon.Party(a.CDR) && p != canon.Party(b.CDR) && strings.Trim(p, "0123456789") == "" {
+				m[p] = true
+			}
+		}
+		return m
+	}
+	na, nb := numbers(a), numbers(b)
+	common := len(shared(na, nb))
+	if len(na) == 0 || len(nb) == 0 {
+		e.Finding = "no numbers called on record"
+		return e
+	}
+	j := jaccard(na, nb)
+	e.Finding = fmt.Sprintf("%d numbers in common, %.0f%% of those either called", common, 100*j)
+	if common >= 3 && j >= 0.2 {
+		e.Weight = round(contactsWeight * math.Min(1, j*2))
+	}
+	return e
+}
+
+// callsBetween counts against: people rarely call their own other
+// number.
+func callsBetween(a, b *side) Evidence {
+	e := Evidence{Heuristic: "Calls between the two"}
+	n := 0
+	for _, p := range [][2]*side{{a, b}, {b, a}} {
+		if t := p[0].contacts[canon.Party(p[1].CDR)]; t != nil {
+			n += t.events()
+		}
+	}
+	if n == 0 {
+		e.Finding = "never called or messaged each other"
+		return e
+	}
+	e.Finding = fmt.Sprintf("called or messaged each other %d times", n)
+	e.Weight = -round(callsWeight * math.Min(1, float64(n)/10))
+	return e
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	common := 0
+	for k := range a {
+		if b[k] {
+			common++
+		}
+	}
+	union := len(a) + len(b) - common
+	if union == 0 {
+		return 0
+	}
+	return float64(common) / float64(union)
+}
+
+func round(f float64) float64 { return math.Round(f*100) / 100 }
+
+// evidence is the sheet explaining res.
+func evidence(res *Result) workbook.Sheet {
+	rows := [][]workbook.Cell{
+		{workbook.Text("Same person"), workbook.Text(res.A + " and " + res.B)},
+		{workbook.Text("Score"), workbook.Text(fmt.Sprintf("%.2f", res.Score))},
+		{workbook.Text("Verdict"), workbook.Text(res.Verdict)},
+		nil,
+		{workbook.Text("Heuristic"), workbook.Text("Finding"), workbook.Text("Weight")},
+	}
+	for _, e := range res.Evidence {
+		rows = append(rows, []workbook.Cell{
+			workbook.Text(e.Heuristic), workbook.Text(e.Finding), workbook.Text(fmt.Sprintf("%+.2f", e.Weight)),
+		})
+	}
+	rows = append(rows, nil, []workbook.Cell{workbook.Text(
+		"Supporting weights combine as independent chances; calls between the numbers take their share off. " +
+			"The score points to where to look, it does not prove who carries a phone.")})
+	return workbook.Sheet{Name: "Same person", Rows: rows}
+}
@@ -0,0 +1,153 @@
+// Package consolidate keeps a running report per target (and case) so a
+// new month's CDR can be appended without re-uploading earlier drops.
+//
+// Each append merges the new main report into <cdr>[_case-<crime>]
+// _consolidated_reports.csv, drops repeated records, re-runs the rules over
+// the merged rows and regenerates the summary reports from them.
+package consolidate
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/evidence"
+	"github.com/jalad-shrimali/cdr-filter/internal/rules"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+	"github.com/jalad-shrimali/cdr-filter/internal/summary"
+)
+
+var unsafe = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// Prefix returns the path prefix, in dir, of the consolidated files for the
+// target of reportPath, of any version, within crime.
+func Prefix(dir, reportPath, crime string) string {
+	name, _ := evidence.Unversioned(filepath.Base(reportPath))
+	p := filepath.Join(dir, strings.TrimSuffix(name, "_reports.csv"))
+	if c := strings.Trim(unsafe.ReplaceAllString(crime, "-"), "-"); c != "" {
+		p += "_case-" + c
+	}
+	return p + "_consolidated"
+}
+
+// Report returns the path of the consolidated report in dir for the
+// target of reportPath within crime: its latest version, which need not
+// exist.
+func Report(dir, reportPath, crime string) string {
+	return evidence.Latest(Prefix(dir, reportPath, crime) + "_reports.csv")
+}
+
+// Append merges reportPath into the consolidated report kept in dir,
+// writes the merged report, findings and summaries to ws, from where they
+// are published over (or, in evidence mode, beside) the ones in dir, and
+// returns their paths.
+func Append(reportPath, dir, ws, crime string, excludeService bool) ([]string, error) {
+	prefix := Prefix(ws, reportPath, crime)
+	dst := prefix + "_reports.csv"
+	kept := Report(dir, reportPath, crime)
+
+	header, rows, err := canon.ReadReport(reportPath)
+	if err != nil {
+		return nil, err
+	}
+	col := canon.Index(header)
+	if _, err := os.Stat(kept); err == nil {
+		oldHeader, old, err := canon.ReadReport(kept)
+		if err != nil {
+			return nil, err
+		}
+		// raw columns of earlier uploads are kept, blank for this one's rows
+		own := header
+		for _, h := range canon.RawHeaders(oldHeader) {
+			if _, ok := col[h]; !ok {
+				header = append(header[:len(header):len(header)], h)
+			}
+		}
+		col = canon.Index(header)
+		rows = append(realign(oldHeader, header, old), realign(own, header, rows)...)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// chronological order; rows whose date does not parse go last
+	type keyed struct {
+		at  int64
+		row []string
+	}
+	ks := make([]keyed, len(rows))
+	for i, r := range rows {
+		ks[i] = keyed{math.MaxInt64, r}
+		if t, ok := canon.ParseDateTime(canon.Get(r, col, "Date"), canon.Get(r, col, "Time")); ok {
+			ks[i].at = t.Unix()
+		}
+	}
+	sort.SliceStable(ks, func(a, b int) bool { return ks[a].at < ks[b].at })
+
+	var dedup canon.Dedup
+	merged := [][]string{header}
+	fi, hasFlags := col["Flags"]
+	for _, k := range ks {
+		row := k.row
+		if dedup.Seen(row, col) {
+			continue
+		}
+		if hasFlags && fi < len(row) {
+			row[fi] = "" // rules are re-run over the merged rows
+		}
+		merged = append(merged, row)
+	}
+	if err := writeCSV(dst, merged); err != nil {
+		return nil, err
+	}
+
+	cdr := filepath.Base(strings.TrimSuffix(reportPath, "_reports.csv"))
+	findings := prefix + "_findings_reports.csv"
+	if err := rules.AnnotateFile(dst, findings, cdr); err != nil {
+		return nil, err
+	}
+
+	b := summary.New(cdr, excludeService)
+	for _, row := range merged[1:] {
+		b.Add(row, col)
+	}
+	sums, err := b.Write(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{dst, findings}, sums...), nil
+}
+
+/* realign maps rows written under an older header onto header */
+func realign(from, to []string, rows [][]string) [][]string {
+	if strings.Join(from, "\x00") == strings.Join(to, "\x00") {
+		return rows
+	}
+	src := canon.Index(from)
+	out := make([][]string, len(rows))
+	for i, r := range rows {
+		n := make([]string, len(to))
+		for j, h := range to {
+			n[j] = canon.Get(r, src, h)
+		}
+		out[i] = n
+	}
+	return out
+}
+
+func writeCSV(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := safecsv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
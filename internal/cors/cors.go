@@ -0,0 +1,105 @@
+// Package cors lets browser frontends served from another origin, such as
+// a lab's own portal, call the API directly instead of through a proxy:
+//
+//	CDR_CORS_ORIGINS      comma-separated origins allowed (https://portal.example:3000), or * for any
+//	CDR_CORS_HEADERS      request headers allowed beyond the API's own
+//	CDR_CORS_CREDENTIALS  1 to let browsers send cookies and HTTP auth
+//
+// Without CDR_CORS_ORIGINS no CORS headers are sent and browsers keep to
+// the same-origin policy.
+package cors
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// request headers the API reads, including the resumable upload ones
+var allowHeaders = []string{
+	"Accept", "Authorization", "Content-Type", "Idempotency-Key", "X-API-Key",
+	"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset",
+}
+
+// response headers scripts may read
+const exposeHeaders = "Content-Disposition, Deprecation, Idempotent-Replayed, Link, Location, " +
+	"Tus-Resumable, Upload-Length, Upload-Offset, X-Job-ID, X-Storage-Quota, X-Storage-Used"
+
+const allowMethods = "GET, HEAD, POST, PATCH, DELETE, OPTIONS"
+
+var (
+	origins     []string
+	anyOrigin   bool
+	credentials = os.Getenv("CDR_CORS_CREDENTIALS") == "1"
+)
+
+func init() {
+	for _, o := range strings.Split(os.Getenv("CDR_CORS_ORIGINS"), ",") {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		switch {
+		case o == "":
+		case o == "*":
+			anyOrigin = true
+		default:
+			u, err := url.Parse(o)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+				log.Fatalf("CDR_CORS_ORIGINS: %q is not an origin such as https://portal.example", o)
+			}
+			origins = append(origins, strings.ToLower(o))
+		}
+	}
+	for _, h := range strings.Split(os.Getenv("CDR_CORS_HEADERS"), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			allowHeaders = append(allowHeaders, h)
+		}
+	}
+	// a proxy-set tenant header may be set by a frontend in development
+	if h := os.Getenv("CDR_TENANT_HEADER"); h != "" {
+		allowHeaders = append(allowHeaders, h)
+	}
+}
+
+// Enabled reports whether any origin is allowed.
+func Enabled() bool { return anyOrigin || len(origins) > 0 }
+
+func allowed(origin string) bool {
+	return origin != "" && (anyOrigin || slices.Contains(origins, strings.ToLower(origin)))
+}
+
+// Middleware adds CORS headers to responses for allowed origins and
+// answers their preflight requests itself, before authentication, since
+// browsers send preflights without credentials.
+func Middleware(next http.Handler) http.Handler {
+	if !Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if !allowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		if anyOrigin && !credentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			h.Set("Access-Control-Allow-Headers", strings.Join(allowHeaders, ", "))
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", exposeHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,126 @@
+// Package diff compares two versions of a normalized CDR, typically an
+// operator's corrected re-issue against the file processed before it.
+package diff
+
+import (
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+)
+
+// A record is identified by when it happened, with whom and how; every
+// other column is compared as content.
+var keyCols = []string{"Date", "Time", "B Party", "Call Type"}
+
+/* columns added by processing rather than taken from the operator file */
+var ignored = map[string]bool{"Crime": true, "Flags": true}
+
+// Change is one difference. Field, Old and New are set for "changed".
+type Change struct {
+	Kind            string // added, removed, changed
+	Key             []string
+	Field, Old, New string
+}
+
+// Result lists the differences and how many records matched exactly.
+type Result struct {
+	Changes                          []Change
+	Added, Removed, Changed, Matched int
+}
+
+// KeyColumns returns the names of the identifying columns, in Change.Key
+// order.
+func KeyColumns() []string { return keyCols }
+
+// Reports compares the normalized reports at oldPath and newPath.
+func Reports(oldPath, newPath string) (*Result, error) {
+	oh, orows, err := canon.ReadReport(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	nh, nrows, err := canon.ReadReport(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return Rows(oh, orows, nh, nrows), nil
+}
+
+// Rows compares two sets of canonical rows. Records sharing a key are
+// matched exactly where possible, the rest paired in file order.
+func Rows(oldHeader []string, oldRows [][]string, newHeader []string, newRows [][]string) *Result {
+	oc, nc := canon.Index(oldHeader), canon.Index(newHeader)
+	key := func(row []string, col map[string]int) []string {
+		k := make([]string, len(keyCols))
+		for i, c := range keyCols {
+			k[i] = canon.Get(row, col, c)
+		}
+		return k
+	}
+
+	pending := map[string][][]string{}
+	var order []string // old keys in first-seen order
+	for _, r := range oldRows {
+		k := strings.Join(key(r, oc), "\x00")
+		if _, ok := pending[k]; !ok {
+			order = append(order, k)
+		}
+		pending[k] = append(pending[k], r)
+	}
+
+	fields := func(or, nr []string, kk []string) []Change {
+		var out []Change
+		for _, h := range newHeader {
+			if ignored[h] {
+				continue
+			}
+			if _, ok := oc[h]; !ok {
+				continue
+			}
+			if o, n := canon.Get(or, oc, h), canon.Get(nr, nc, h); o != n {
+				out = append(out, Change{Kind: "changed", Key: kk, Field: h, Old: o, New: n})
+			}
+		}
+		return out
+	}
+
+	// identical records first, so one removed row among several sharing a
+	// key does not make all the following ones look changed
+	res := &Result{}
+	var unmatched [][]string
+	for _, nr := range newRows {
+		k := strings.Join(key(nr, nc), "\x00")
+		found := false
+		for i, or := range pending[k] {
+			if len(fields(or, nr, nil)) == 0 {
+				pending[k] = append(pending[k][:i:i], pending[k][i+1:]...)
+				found = true
+				break
+			}
+		}
+		if found {
+			res.Matched++
+		} else {
+			unmatched = append(unmatched, nr)
+		}
+	}
+	for _, nr := range unmatched {
+		kk := key(nr, nc)
+		k := strings.Join(kk, "\x00")
+		if len(pending[k]) == 0 {
+			res.Added++
+			res.Changes = append(res.Changes, Change{Kind: "added", Key: kk})
+			continue
+		}
+		or := pending[k][0]
+		pending[k] = pending[k][1:]
+		res.Changed++
+		res.Changes = append(res.Changes, fields(or, nr, kk)...)
+	}
+	for _, k := range order {
+		for _, r := range pending[k] {
+			res.Removed++
+			res.Changes = append(res.Changes, Change{Kind: "removed", Key: key(r, oc)})
+		}
+	}
+	return res
+}
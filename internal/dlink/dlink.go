@@ -0,0 +1,142 @@
+// Package dlink builds the /download/ links handed out for reports and,
+// when CDR_LINK_TTL is set (e.g. "72h"), signs them so a link forwarded by
+// mail or chat stops working once that period has passed.
+//
+// Links carry ?exp=<unix time>&sig=<HMAC-SHA256 of name and exp>, and of
+// the output profile of a link to a cut-down copy (&profile=). The key
+// is CDR_LINK_KEY; without it a random key is used, so links then also
+// expire on restart.
+package dlink
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ttl time.Duration
+	key []byte
+)
+
+func init() {
+	v := strings.TrimSpace(os.Getenv("CDR_LINK_TTL"))
+	if v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Fatalf("CDR_LINK_TTL must be a positive duration such as 72h")
+	}
+	ttl = d
+	if k := os.Getenv("CDR_LINK_KEY"); k != "" {
+		key = []byte(k)
+		return
+	}
+	key = make([]byte, 32)
+	rand.Read(key)
+	log.Printf("CDR_LINK_KEY not set: download links will not survive a restart")
+}
+
+// Enabled reports whether links are signed and checked.
+func Enabled() bool { return ttl > 0 }
+
+// TTL returns how long a new link stays valid, 0 when links do not expire.
+func TTL() time.Duration { return ttl }
+
+// sign signs a link to name until exp, under profile when that is not ""
+// so a link to a cut-down copy cannot be turned into one to the full file.
+func sign(name string, exp int64, profile string) string {
+	m := hmac.New(sha256.New, key)
+	msg := name + "\n" + strconv.FormatInt(exp, 10)
+	if profile != "" {
+		msg += "\n" + profile
+	}
+	m.Write([]byte(msg))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// Name returns the download name of an output path: its path under
+// filtered/, slash-separated.
+func Name(p string) string {
+	rel, err := filepath.Rel("filtered", p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.Base(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Path returns the download path of the output file name, signed and
+// valid for TTL when enabled.
+func Path(name string) string { return PathAs(name, "") }
+
+// PathAs is Path for the copy of name under an output profile, "" for the
+// file as stored.
+func PathAs(name, profile string) string {
+	segs := strings.Split(name, "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	p := "/download/" + strings.Join(segs, "/")
+	q := url.Values{}
+	if profile != "" {
+		q.Set("profile", profile)
+	}
+	if Enabled() {
+		exp := time.Now().Add(ttl).Unix()
+		q.Set("exp", strconv.FormatInt(exp, 10))
+		q.Set("sig", sign(name, exp, profile))
+	}
+	if len(q) == 0 {
+		return p
+	}
+	return p + "?" + q.Encode()
+}
+
+// URL returns Path(name) on the public base URL of the service
+// (CDR_PUBLIC_URL, default http://localhost:8080), for links sent out of
+// band.
+func URL(name string) string {
+	base := strings.TrimRight(os.Getenv("CDR_PUBLIC_URL"), "/")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return base + Path(name)
+}
+
+var (
+	ErrInvalid = errors.New("invalid download link")
+	ErrExpired = errors.New("download link expired")
+)
+
+// Check verifies the signature and expiry of the link r requests for
+// name, and the profile it asks for.
+func Check(r *http.Request, name string) error {
+	q := r.URL.Query()
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil || !hmac.Equal([]byte(q.Get("sig")), []byte(sign(name, exp, q.Get("profile")))) {
+		return ErrInvalid
+	}
+	if time.Now().Unix() > exp {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Status maps a Check error to an HTTP status code.
+func Status(err error) int {
+	if errors.Is(err, ErrExpired) {
+		return http.StatusGone
+	}
+	return http.StatusForbidden
+}
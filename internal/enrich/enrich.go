@@ -0,0 +1,120 @@
+// Package enrich assembles the enrichment pipeline the normalizers run:
+// the steps shared by every TSP around the TSP's own cell and LRN
+// lookups, each of which but the home and Type ones a request may skip
+// (see canon.Enrichers).
+package enrich
+
+import (
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/plmn"
+	"github.com/jalad-shrimali/cdr-filter/internal/rules"
+	"github.com/jalad-shrimali/cdr-filter/internal/servicenum"
+	"github.com/jalad-shrimali/cdr-filter/internal/smsclass"
+)
+
+// Pipeline returns the per-row enrichers of tsp, whose cell and LRN
+// tables are looked up by cell and lrn.
+func Pipeline(tsp string, cell, lrn func(row []string, col map[string]int)) canon.Pipeline {
+	return canon.Pipeline{
+		{Name: "home", Fill: home(tsp)},
+		{Name: "roaming", Fill: roaming},
+		{Name: "cell", Fill: cell},
+		{Name: "lrn", Fill: lrn},
+		{Name: "sms", Fill: sms},
+		{Name: "type", Fill: kind},
+		{Name: "service", Fill: service},
+	}
+}
+
+// home fills the target's operator and circle an export leaves blank
+// with those of its number: the TSP's and the number series' circle, not
+// the circle a record was served in. Like kind it is not among
+// canon.Enrichers.
+func home(tsp string) func(row []string, col map[string]int) {
+	return func(row []string, col map[string]int) {
+		op, circle := &row[col["Operator"]], &row[col["Circle"]]
+		if *op != "" && *circle != "" {
+			return
+		}
+		h := canon.HomeOf(row[col["CdrNo"]], tsp)
+		if *op == "" {
+			*op = h.Operator
+		}
+		if *circle == "" {
+			*circle = h.Circle
+		}
+	}
+}
+
+// roaming spells out a network code in the Roaming column
+func roaming(row []string, col map[string]int) {
+	row[col["Roaming"]] = plmn.Decode(row[col["Roaming"]])
+}
+
+// sms classes A2P SMS by sender
+func sms(row []string, col map[string]int) {
+	row[col["SMS Category"]] = smsclass.Of(row[col["Call Type"]], row[col["B Party"]])
+}
+
+// kind fills Type with the service alike for every TSP, Voice, SMS or
+// Data, and Connection Type with Prepaid or Postpaid, which some exports
+// give in their service column. It is not among canon.Enrichers: the
+// columns mean the same whatever a request skips.
+func kind(row []string, col map[string]int) {
+	typ, conn := &row[col["Type"]], &row[col["Connection Type"]]
+	if c := connection(*typ); c != "" {
+		*conn, *typ = c, ""
+	} else if c := connection(*conn); c != "" {
+		*conn = c
+	}
+	switch strings.ToLower(strings.TrimSpace(*typ)) {
+	case "voice", "phone", "call", "calls":
+		*typ = "Voice"
+	case "sms", "mms":
+		*typ = strings.ToUpper(strings.TrimSpace(*typ))
+	case "data", "gprs", "internet":
+		*typ = "Data"
+	case "", "service": // a service number is told in Service Number
+		*typ = ""
+		if canon.Classify(row, col).SMS {
+			*typ = "SMS"
+		} else if row[col["Call Type"]] != "" {
+			*typ = "Voice"
+		}
+	}
+}
+
+// connection spells out a prepaid or postpaid marker, "" for other values
+func connection(v string) string {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "pre", "prepaid", "prepaid subscriber":
+		return "Prepaid"
+	case "post", "postpaid", "postpaid subscriber":
+		return "Postpaid"
+	}
+	return ""
+}
+
+// service tags telemarketer / OTP / customer-care numbers in Service
+// Number, leaving Type the call's service
+func service(row []string, col map[string]int) {
+	if servicenum.IsService(row[col["B Party"]]) {
+		row[col["Service Number"]] = "Yes"
+	}
+}
+
+// Rules tags the report at path with the suspicious-pattern rules and
+// writes the findings report to findings, unless opt skips the rules or
+// wants the summaries only. It returns the findings report's path, or
+// none when skipped.
+func Rules(path, findings, cdr string, opt canon.Options) ([]string, error) {
+	if opt.Skips("rules") || opt.SummaryOnly {
+		return nil, nil
+	}
+	if err := rules.AnnotateFile(path, findings, cdr); err != nil {
+		return nil, err
+	}
+	return []string{findings}, nil
+}
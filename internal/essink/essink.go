@@ -0,0 +1,161 @@
+// Package essink optionally bulk-indexes normalized records into
+// Elasticsearch/OpenSearch. It is enabled by CDR_ES_URL; CDR_ES_USER and
+// CDR_ES_PASSWORD supply basic auth.
+//
+// Records go to one index per case, cdr-records-v1-<case>, governed by a
+// versioned index template installed on first use.
+package essink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+)
+
+const (
+	templateName = "cdr-records-v1"
+	indexPrefix  = "cdr-records-v1-"
+	batchSize    = 1000
+)
+
+var template = map[string]any{
+	"index_patterns": []string{indexPrefix + "*"},
+	"version":        1,
+	"template": map[string]any{
+		"mappings": map[string]any{
+			"dynamic_templates": []any{map[string]any{
+				"strings": map[string]any{
+					"match_mapping_type": "string",
+					"mapping":            map[string]any{"type": "keyword"},
+				},
+			}},
+			"properties": map[string]any{
+				"@timestamp": map[string]any{"type": "date"},
+				"duration":   map[string]any{"type": "long"},
+				"location":   map[string]any{"type": "geo_point"},
+				"first_cell_id_address": map[string]any{"type": "text",
+					"fields": map[string]any{"raw": map[string]any{"type": "keyword", "ignore_above": 512}}},
+			},
+		},
+	},
+}
+
+var (
+	client       = &http.Client{Timeout: 60 * time.Second}
+	templateOnce sync.Once
+	templateErr  error
+	badIndexChar = regexp.MustCompile(`[^a-z0-9_-]+`)
+)
+
+// Enabled reports whether a cluster URL is configured.
+func Enabled() bool { return os.Getenv("CDR_ES_URL") != "" }
+
+func do(method, path, ctype string, body []byte) error {
+	req, err := http.NewRequest(method, strings.TrimRight(os.Getenv("CDR_ES_URL"), "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ctype)
+	if u := os.Getenv("CDR_ES_USER"); u != "" {
+		req.SetBasicAuth(u, os.Getenv("CDR_ES_PASSWORD"))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, msg)
+	}
+	if bytes.Contains(msg, []byte(`"errors":true`)) {
+		return fmt.Errorf("%s %s: bulk request reported item errors", method, path)
+	}
+	return nil
+}
+
+// IndexName returns the per-case index for crime.
+func IndexName(crime string) string {
+	c := strings.Trim(badIndexChar.ReplaceAllString(strings.ToLower(crime), "-"), "-_")
+	if c == "" {
+		c = "nocase"
+	}
+	return indexPrefix + c
+}
+
+// Index bulk-indexes the rows of the job's main report. Document IDs are
+// <jobID>-<row> so re-indexing a job overwrites instead of duplicating.
+func Index(jobID, tsp, crime, reportPath string) error {
+	templateOnce.Do(func() {
+		b, _ := json.Marshal(template)
+		templateErr = do(http.MethodPut, "/_index_template/"+templateName, "application/json", b)
+	})
+	if templateErr != nil {
+		return templateErr
+	}
+	header, rows, err := canon.ReadReport(reportPath)
+	if err != nil {
+		return err
+	}
+	col := canon.Index(header)
+	index := IndexName(crime)
+
+	var buf bytes.Buffer
+	flush := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		err := do(http.MethodPost, "/_bulk", "application/x-ndjson", buf.Bytes())
+		buf.Reset()
+		return err
+	}
+	for i, row := range rows {
+		doc := map[string]any{"job_id": jobID, "tsp": tsp, "case": crime}
+		for c, h := range header {
+			if c < len(row) && row[c] != "" {
+				doc[canon.FieldName(h)] = row[c]
+			}
+		}
+		if at, ok := canon.ParseDateTime(canon.Get(row, col, "Date"), canon.Get(row, col, "Time")); ok {
+			doc["@timestamp"] = at.Format(time.RFC3339)
+		}
+		var d int64
+		if _, err := fmt.Sscan(canon.Get(row, col, "Duration"), &d); err == nil {
+			doc["duration"] = d
+		} else {
+			delete(doc, "duration")
+		}
+		if parts := strings.Split(canon.Get(row, col, "Lat-Long-Azimuth (First CellID)"), ","); len(parts) >= 2 {
+			var lat, lon float64
+			_, e1 := fmt.Sscan(strings.TrimSpace(parts[0]), &lat)
+			_, e2 := fmt.Sscan(strings.TrimSpace(parts[1]), &lon)
+			if e1 == nil && e2 == nil {
+				doc["location"] = map[string]float64{"lat": lat, "lon": lon}
+			}
+		}
+		meta, _ := json.Marshal(map[string]any{"index": map[string]string{"_index": index, "_id": fmt.Sprintf("%s-%d", jobID, i+1)}})
+		src, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		buf.Write(meta)
+		buf.WriteByte('\n')
+		buf.Write(src)
+		buf.WriteByte('\n')
+		if (i+1)%batchSize == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
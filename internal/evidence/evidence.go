@@ -0,0 +1,157 @@
+// Package evidence keeps the reports write-once when CDR_EVIDENCE_MODE=1:
+// a file once delivered is never replaced, changed or removed. Processing
+// a number again, or extending a case's consolidated report, delivers a
+// new version of the files beside the old, named with a _v<n> suffix
+// (9876500001_reports_v2.csv), and every version delivered is entered in
+// the output directory's version index with its SHA-256 digest.
+package evidence
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+// Index is the name of the version index kept in each output directory.
+const Index = "version_index.csv"
+
+// ErrWriteOnce is returned for an attempt to replace or remove a
+// delivered file in evidence mode.
+var ErrWriteOnce = errors.New("evidence mode: delivered files are write-once")
+
+// Enabled reports whether evidence mode is on.
+func Enabled() bool { return os.Getenv("CDR_EVIDENCE_MODE") == "1" }
+
+// split cuts a file name at its first dot: "x_reports" and ".csv.sha256".
+func split(name string) (stem, ext string) {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[:i], name[i:]
+	}
+	return name, ""
+}
+
+var suffix = regexp.MustCompile(`_v([0-9]+)$`)
+
+// Versioned returns the name of version v of the file name; version 1 is
+// name itself.
+func Versioned(name string, v int) string {
+	if v <= 1 {
+		return name
+	}
+	stem, ext := split(name)
+	return stem + "_v" + strconv.Itoa(v) + ext
+}
+
+// Unversioned returns the file name a version was made of, and its
+// version.
+func Unversioned(name string) (string, int) {
+	stem, ext := split(name)
+	m := suffix.FindStringSubmatch(stem)
+	if m == nil {
+		return name, 1
+	}
+	v, _ := strconv.Atoi(m[1])
+	return strings.TrimSuffix(stem, m[0]) + ext, v
+}
+
+// latest returns the highest version of the file p names that exists, 0
+// when none does.
+func latest(p string) int {
+	stem, ext := split(filepath.Base(p))
+	found := 0
+	if _, err := os.Stat(p); err == nil {
+		found = 1
+	}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(p), stem+"_v*"+ext))
+	for _, m := range matches {
+		if _, v := Unversioned(filepath.Base(m)); filepath.Base(m) == Versioned(filepath.Base(p), v) {
+			found = max(found, v)
+		}
+	}
+	return found
+}
+
+// Latest returns the path of the newest version of the file p names, p
+// itself when it has no later one.
+func Latest(p string) string {
+	if v := latest(p); v > 1 {
+		return filepath.Join(filepath.Dir(p), Versioned(filepath.Base(p), v))
+	}
+	return p
+}
+
+// Version renames the files of paths, written together, to the version
+// they take in dir: one past the newest version there of any of them, so
+// the set shares one number, or 1 when dir has none of them. Files are
+// renamed where they are, before anything that names them is written.
+func Version(dir string, paths []string) ([]string, error) {
+	v := 0
+	for _, p := range paths {
+		v = max(v, latest(filepath.Join(dir, filepath.Base(p))))
+	}
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = p
+		if v == 0 {
+			continue
+		}
+		to := filepath.Join(filepath.Dir(p), Versioned(filepath.Base(p), v+1))
+		if err := os.Rename(p, to); err != nil {
+			return nil, err
+		}
+		out[i] = to
+	}
+	return out, nil
+}
+
+// Lock makes the delivered files of paths read-only and enters them in
+// the version index of the directory they are in, with their digests from
+// sums (by file name) and the CDR and job that produced them.
+func Lock(cdr, job string, paths []string, sums map[string]string) error {
+	byDir := map[string][][]string{}
+	var dirs []string
+	now := time.Now().Format("2006-01-02 15:04:05")
+	for _, p := range paths {
+		if err := os.Chmod(p, 0o444); err != nil {
+			return err
+		}
+		name := filepath.Base(p)
+		of, v := Unversioned(name)
+		dir := filepath.Dir(p)
+		if byDir[dir] == nil {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], []string{name, strconv.Itoa(v), of, sums[name], cdr, job, now})
+	}
+	for _, dir := range dirs {
+		if err := record(filepath.Join(dir, Index), byDir[dir]); err != nil {
+			return fmt.Errorf("version index: %w", err)
+		}
+	}
+	return nil
+}
+
+// record appends rows to the version index at p, which is only ever
+// appended to.
+func record(p string, rows [][]string) error {
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w := safecsv.NewWriter(f)
+	if st, err := f.Stat(); err == nil && st.Size() == 0 {
+		w.Write([]string{"File", "Version", "Version Of", "SHA-256", "CdrNo", "Job", "Delivered"})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,165 @@
+// Package fixedwidth reads fixed-width text exports, whose columns sit at
+// set character positions rather than between delimiters, as rows of
+// fields, the way csv.Reader reads a delimited export. Older BSNL and MTNL
+// systems still write CDRs this way.
+//
+// The positions come from a spec, one line per column:
+//
+//	name,start,width
+//	call_date,47,11
+//
+// with start counted from 1, in characters. A column's name is the header
+// a delimited export of the same layout would give it, so a normalizer
+// finds it the same way.
+package fixedwidth
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Field is one column of a layout.
+type Field struct {
+	Name         string
+	Start, Width int // 1-based first character and length
+}
+
+// Spec is the columns of a layout, in the order rows list them.
+type Spec []Field
+
+// ParseSpec reads a spec as in the package comment. A first row whose
+// start is not a number is taken for the spec's own header; blank rows
+// and rows starting with # are skipped.
+func ParseSpec(r io.Reader) (Spec, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+	var s Spec
+	for n := 1; ; n++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("line %d: want name, start, width", line)
+		}
+		start, err := strconv.Atoi(strings.TrimSpace(rec[1]))
+		if err != nil && n == 1 {
+			continue
+		}
+		width, werr := strconv.Atoi(strings.TrimSpace(rec[2]))
+		if err != nil || werr != nil || start < 1 || width < 1 {
+			return nil, fmt.Errorf("line %d: start and width must be positive numbers", line)
+		}
+		s = append(s, Field{Name: strings.TrimSpace(rec[0]), Start: start, Width: width})
+	}
+	if len(s) == 0 {
+		return nil, errors.New("no columns")
+	}
+	return s, nil
+}
+
+// Names returns the column names, the header row a Reader gives.
+func (s Spec) Names() []string {
+	names := make([]string, len(s))
+	for i, f := range s {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// reach is how far a line must run to hold the last column at all.
+func (s Spec) reach() int {
+	n := 0
+	for _, f := range s {
+		n = max(n, f.Start)
+	}
+	return n
+}
+
+// Reader returns the rows of a fixed-width export one at a time.
+//
+// Lines before the first one long enough to reach the last column, the
+// banner, are returned whole as one-field rows, so a target number given
+// there is still found. That first line is the export's own header and is
+// returned as the spec's names. After it every line reaching the last
+// column is cut into the spec's fields, trimmed; shorter lines, such as a
+// closing record count, and rules of dashes or equals signs are skipped.
+type Reader struct {
+	spec    Spec
+	reach   int
+	lines   *bufio.Scanner
+	line    int      // of the row last read
+	header  bool     // the header line has been read
+	title   string   // the header line, skipped where it is repeated
+	dropped []string // short lines after the header
+}
+
+// NewReader returns a Reader of r laid out as spec.
+func NewReader(r io.Reader, spec Spec) *Reader {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(nil, 1<<20)
+	return &Reader{spec: spec, reach: spec.reach(), lines: lines}
+}
+
+// Read returns the next row, or io.EOF after the last.
+func (r *Reader) Read() ([]string, error) {
+	for r.lines.Scan() {
+		r.line++
+		text := []rune(strings.TrimRight(r.lines.Text(), "\r"))
+		long := len(text) >= r.reach
+		if !r.header {
+			if !long || rule(string(text)) {
+				return []string{string(text)}, nil
+			}
+			r.header, r.title = true, strings.TrimSpace(string(text))
+			return r.spec.Names(), nil
+		}
+		if strings.TrimSpace(string(text)) == r.title {
+			continue // files concatenated from several exports repeat it
+		}
+		if !long || rule(string(text)) {
+			if !long && strings.TrimSpace(string(text)) != "" {
+				r.dropped = append(r.dropped, string(text))
+			}
+			continue
+		}
+		row := make([]string, len(r.spec))
+		for i, f := range r.spec {
+			from, to := min(f.Start-1, len(text)), min(f.Start-1+f.Width, len(text))
+			row[i] = strings.TrimSpace(string(text[from:to]))
+		}
+		return row, nil
+	}
+	if err := r.lines.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Dropped returns the lines after the header Read left out as too short
+// for a row, such as a closing record count.
+func (r *Reader) Dropped() []string { return r.dropped }
+
+// FieldPos returns the line of the row last read and the character field
+// starts at, as csv.Reader's FieldPos does.
+func (r *Reader) FieldPos(field int) (line, column int) {
+	if !r.header || field >= len(r.spec) {
+		return r.line, 1
+	}
+	return r.line, r.spec[field].Start
+}
+
+// rule reports whether line only draws a rule under the header.
+func rule(line string) bool {
+	return strings.Trim(line, "-=_ \t") == ""
+}
@@ -0,0 +1,458 @@
+// Package gen produces synthetic CDR exports in the layouts the TSPs send,
+// for training sessions and integration tests that must not use real
+// subscriber data. The records follow a plausible pattern – a few frequent
+// contacts, calls mostly by day, SMS from service senders, the target
+// moving between home, work and a handful of other towers – but every
+// number, identity and tower is made up unless cell IDs are supplied.
+package gen
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options shape the generated CDR. Zero values take the defaults noted.
+type Options struct {
+	Target   string    // A party, 10 digits; random when empty
+	Rows     int       // records, default 200
+	Contacts int       // distinct B parties, default 25
+	Towers   int       // distinct cells, default 8
+	Cells    []string  // cell IDs to use as towers instead of made-up ones
+	From     time.Time // first day, default 30 days before today
+	Days     int       // days covered, default 30
+	Seed     int64     // 0 picks one at random
+	Format   string    // export layout: "" for the current one, "v1" for Airtel's and Jio's older one, "enterprise" for Airtel's leased lines
+}
+
+// MaxRows bounds Options.Rows.
+const MaxRows = 100_000
+
+// TSPs lists the layouts Write can produce.
+func TSPs() []string { return []string{"airtel", "bsnl", "jio", "vi"} }
+
+var tenDigits = regexp.MustCompile(`^[6-9]\d{9}$`)
+
+// Number returns a random mobile number.
+func Number(r *rand.Rand) string {
+	return strconv.Itoa(6+r.Intn(4)) + fmt.Sprintf("%09d", r.Intn(1e9))
+}
+
+// an LRN the TSP tables know, as each layout spells it
+type lrn struct{ code, short, desc, lsa string }
+
+var lrns = []lrn{
+	{"3094", "RJIL-MP", "Reliance Jio - Madhya Pradesh", "MP"},
+	{"3005", "AIR-MP", "AIRTEL MP", "MP"},
+	{"3095", "RJIL-MH", "Reliance Jio - Maharashtra", "MH"},
+	{"4100", "VODA-MH", "Vodafone Idea - Maharashtra", "MH"},
+	{"2727", "AIR-DL", "Bharti - Mobile-Delhi & NCR", "DL"},
+	{"4104", "VODA-UE", "Vodafone Idea - UP (East)", "UE"},
+}
+
+var senders = []string{"AX-ARTLTV", "JY-JioPay", "VM-HDFCBK", "AD-SBIINB", "VZ-ViCARE", "BP-BSNLIN"}
+
+type tower struct {
+	id, name string
+	lat, lon float64
+}
+
+type event struct {
+	at          time.Time
+	out, sms    bool
+	service     bool // SMS from a sender ID rather than a number
+	other       string
+	lrn         lrn
+	dur         int
+	first, last tower
+}
+
+type cdr struct {
+	tsp, target, imei, imsi, msc string
+	from, to                     time.Time
+	events                       []event
+	r                            *rand.Rand
+}
+
+// Write writes a CDR in the layout of tsp to w.
+func Write(w io.Writer, tsp string, o Options) error {
+	write, ok := layouts[tsp]
+	if !ok {
+		return fmt.Errorf("unknown TSP %q (want one of %s)", tsp, strings.Join(TSPs(), ", "))
+	}
+	if o.Format != "" {
+		if write, ok = layouts[tsp+" "+o.Format]; !ok {
+			return fmt.Errorf("no %s layout %q", tsp, o.Format)
+		}
+	}
+	if o.Rows < 0 || o.Rows > MaxRows || o.Contacts < 0 || o.Towers < 0 || o.Days < 0 {
+		return errors.New("rows, contacts, towers and days must be positive, rows at most " + strconv.Itoa(MaxRows))
+	}
+	if o.Target != "" && !tenDigits.MatchString(o.Target) {
+		return fmt.Errorf("target %q is not a 10-digit mobile number", o.Target)
+	}
+	if o.Rows == 0 {
+		o.Rows = 200
+	}
+	if o.Contacts == 0 {
+		o.Contacts = 25
+	}
+	if o.Towers == 0 {
+		o.Towers = 8
+	}
+	if o.Days == 0 {
+		o.Days = 30
+	}
+	if o.From.IsZero() {
+		y, m, d := time.Now().AddDate(0, 0, -o.Days).Date()
+		o.From = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	}
+	if o.Seed == 0 {
+		o.Seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(o.Seed))
+	if o.Target == "" {
+		o.Target = Number(r)
+	}
+
+	c := &cdr{
+		tsp:    tsp,
+		target: o.Target,
+		imei:   "86" + digits(r, 13),
+		imsi:   imsiPrefix[tsp] + digits(r, 15-len(imsiPrefix[tsp])),
+		msc:    "9" + digits(r, 9),
+		from:   o.From,
+		to:     o.From.AddDate(0, 0, o.Days).Add(-time.Second),
+		r:      r,
+	}
+	c.events = c.generate(o, c.towers(o))
+	cw := csv.NewWriter(w)
+	write(c, cw)
+	cw.Flush()
+	return cw.Error()
+}
+
+var imsiPrefix = map[string]string{"airtel": "40554", "bsnl": "40458", "jio": "405863", "vi": "40422"}
+
+func digits(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('0' + r.Intn(10))
+	}
+	return string(b)
+}
+
+func (c *cdr) towers(o Options) []tower {
+	n := o.Towers
+	if len(o.Cells) > 0 && len(o.Cells) < n {
+		n = len(o.Cells)
+	}
+	out := make([]tower, n)
+	for i := range out {
+		t := &out[i]
+		// around Indore, close enough for a map of one district
+		t.lat = 22.72 + (c.r.Float64()-0.5)*0.3
+		t.lon = 75.86 + (c.r.Float64()-0.5)*0.3
+		if len(o.Cells) > 0 {
+			t.id = o.Cells[c.r.Intn(len(o.Cells))]
+		} else {
+			t.id = c.cellID()
+		}
+		t.name = fmt.Sprintf("Synthetic Site %d, Indore, Madhya Pradesh", i+1)
+		if c.tsp == "bsnl" {
+			t.name = fmt.Sprintf("MP_IND_%03dA_SYN_1G", i+1)
+		}
+	}
+	return out
+}
+
+func (c *cdr) cellID() string {
+	switch c.tsp {
+	case "airtel":
+		return fmt.Sprintf("404-93-%d-%d", 1000+c.r.Intn(9000), 150000000+c.r.Intn(1e8))
+	case "bsnl":
+		return "40458" + digits(c.r, 9)
+	case "jio":
+		return "405863" + digits(c.r, 7)
+	default:
+		return "40478" + digits(c.r, 10)
+	}
+}
+
+// busy hours come up more often
+var hours = []int{0, 1, 6, 7, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 14, 15, 16, 17, 17, 18, 18, 19, 19, 20, 20, 21, 21, 22, 23}
+
+func (c *cdr) generate(o Options, towers []tower) []event {
+	r := c.r
+	contacts := make([]string, o.Contacts)
+	lrnOf := make([]lrn, o.Contacts)
+	for i := range contacts {
+		contacts[i] = Number(r)
+		lrnOf[i] = lrns[r.Intn(len(lrns))]
+	}
+	evs := make([]event, o.Rows)
+	for i := range evs {
+		e := &evs[i]
+		h := hours[r.Intn(len(hours))]
+		e.at = o.From.AddDate(0, 0, r.Intn(o.Days)).Add(time.Duration(h)*time.Hour + time.Duration(r.Intn(3600))*time.Second)
+
+		// home tower at night, work tower by day, elsewhere now and then
+		t := 0
+		switch {
+		case len(towers) > 2 && r.Intn(5) == 0:
+			t = 2 + r.Intn(len(towers)-2)
+		case len(towers) > 1 && h >= 10 && h < 18:
+			t = 1
+		}
+		e.first, e.last = towers[t], towers[t]
+		if r.Intn(6) == 0 {
+			e.last = towers[r.Intn(len(towers))]
+		}
+
+		// a few contacts take most of the traffic
+		k := r.Intn(r.Intn(len(contacts)) + 1)
+		e.other, e.lrn = contacts[k], lrnOf[k]
+		switch n := r.Intn(100); {
+		case n < 15:
+			e.sms, e.service = true, true
+			e.other = senders[r.Intn(len(senders))]
+		case n < 25:
+			e.sms = true
+		default:
+			e.out = r.Intn(2) == 0
+			e.dur = 3 + int(r.ExpFloat64()*90)
+			if e.dur > 3600 {
+				e.dur = 3600
+			}
+		}
+	}
+	sort.Slice(evs, func(i, j int) bool { return evs[i].at.Before(evs[j].at) })
+	return evs
+}
+
+var layouts = map[string]func(*cdr, *csv.Writer){
+	"airtel":            writeAirtel,
+	"airtel v1":         writeAirtelV1,
+	"airtel enterprise": writeAirtelEnterprise,
+	"bsnl":              writeBSNL,
+	"jio":               writeJio,
+	"jio v1":            writeJioV1,
+	"vi":                writeVI,
+}
+
+// pad returns rec widened to n columns, as spreadsheet exports are
+func pad(n int, rec ...string) []string {
+	for len(rec) < n {
+		rec = append(rec, "")
+	}
+	return rec
+}
+
+func latLon(t tower) string { return fmt.Sprintf("%.5f/%.5f", t.lat, t.lon) }
+
+func hms(t time.Time) string { return fmt.Sprintf("%d:%02d:%02d", t.Hour(), t.Minute(), t.Second()) }
+
+func writeAirtel(c *cdr, w *csv.Writer) {
+	const n = 26
+	w.Write(pad(n, "BAL"))
+	w.Write(pad(n))
+	w.Write(pad(n, "PAN India"))
+	w.Write(pad(n))
+	w.Write(pad(n, fmt.Sprintf("Call Details of Mobile No '%s' from '%s' to '%s'", c.target, c.from.Format("02-Jan-2006"), c.to.Format("02-Jan-2006"))))
+	w.Write(pad(n))
+	w.Write([]string{"Target No", "Call Type", "TOC", "B Party No", "LRN No", "LRN TSP-LSA", "Date", "Time", "Dur(s)", "First CGI Lat/Long", "First CGI", "Last CGI Lat/Long", "Last CGI", "SMSC No", "Service Type", "IMEI", "IMSI", "Call Fow No", "Roam Nw", "SW & MSC ID", "IN TG", "OUT TG", "Vowifi First UE IP", "Port1", "Vowifi Last UE IP", "Port2"})
+	for _, e := range c.events {
+		ct, lrnNo, lrnName, svc, smsc := "IN", e.lrn.code, e.lrn.short, "Voice", "'-'"
+		lastLL, last := latLon(e.last), e.last.id
+		switch {
+		case e.sms:
+			ct, svc, smsc = "SMT", "SMS", "'91"+c.msc+"'"
+			lastLL, last = "", "---"
+			if e.service {
+				lrnNo, lrnName = "", "-"
+			}
+		case e.out:
+			ct = "OUT"
+		}
+		w.Write(pad(n, c.target, ct, "Pre", e.other, lrnNo, lrnName, "'"+e.at.Format("02/01/2006")+"'", hms(e.at), strconv.Itoa(e.dur),
+			latLon(e.first), e.first.id, lastLL, last, smsc, svc, "'"+c.imei+"'", "'"+c.imsi+"'", "-", "AIR MP", "'"+c.msc+"'"))
+	}
+	w.Write(pad(n))
+	w.Write(pad(n, "This is System generated report and needs no signature. Report generated on: "+c.to.Format("02-Jan-2006 15:04 PM")))
+}
+
+func writeJio(c *cdr, w *csv.Writer) {
+	const n = 15
+	w.Write(pad(n, "Ticket Number :", "LEA"+digits(c.r, 20)))
+	w.Write(pad(n, "Input Value (MSISDN/B PARTY/IMEI/IMSI/CELL ID) :", c.target))
+	w.Write(pad(n, "Date Range :", c.from.Format("2006-01-02 15:04:05")+" to "+c.to.Format("2006-01-02 15:04:05")))
+	w.Write(pad(n, "Total Records :", strconv.Itoa(len(c.events))))
+	w.Write(pad(n, "Report Generated At :", "'"+c.to.Format("2006-01-02 15:04:05")+"'"))
+	w.Write(pad(n))
+	w.Write(pad(n, "MSISDN/IMSI:", c.imsi+"'"))
+	w.Write(pad(n, "Subscriber Name:", "SYNTHETIC SUBSCRIBER'"))
+	w.Write(pad(n, "Father/Husband Name:", "-'"))
+	w.Write(pad(n, "Local Address:", "-'"))
+	w.Write(pad(n, "Circle:", "'MADHYA PRADESH'"))
+	w.Write(pad(n, "Connection Type:", "Prepaid'"))
+	w.Write(pad(n, "SIM Activation Date:", "'"+c.from.AddDate(-2, 0, 0).Format("02-01-2006")+"'"))
+	w.Write(pad(n, "Port in/out:", "'-'"))
+	for range 4 {
+		w.Write(pad(n))
+	}
+	w.Write([]string{"Calling Party Telephone Number", "Called Party Telephone Number", "Call Forwarding", "LRN Called No", "Call Date", "Call Time", "Call Termination Time", "Call Duration", "First Cell ID", "Last Cell ID", "Call Type", "IMEI", "", "IMSI", "Roaming Circle Name"})
+	for _, e := range c.events {
+		a, b, ct, dur := "91"+e.other+"'", "91"+c.target+"'", "a_in", strconv.Itoa(e.dur)
+		switch {
+		case e.service:
+			a, ct, dur = "'"+e.other+"'", "A2P_SMSIN", ""
+		case e.sms:
+			ct, dur = "P2P_SMSIN", ""
+		case e.out:
+			a, b, ct = b, a, "a_out"
+		}
+		w.Write([]string{a, b, "", e.lrn.code, e.at.Format("1/2/2006"), hms(e.at), hms(e.at.Add(time.Duration(e.dur) * time.Second)), dur,
+			"'" + e.first.id + "'", "'" + e.last.id + "'", ct, "'" + c.imei + "'", "", "'" + c.imsi + "'", "MP"})
+	}
+	w.Write(pad(n))
+	w.Write(pad(n))
+	w.Write(pad(n, "Disclaimer : This is system generated data. Signature is not required."))
+}
+
+// the older Airtel layout: keyed by MSISDN, without CGI locations, and
+// without the "Mobile No" banner
+func writeAirtelV1(c *cdr, w *csv.Writer) {
+	const n = 15
+	w.Write(pad(n, "BAL"))
+	w.Write(pad(n))
+	w.Write([]string{"MSISDN", "Call Type", "Other Party No", "LRN", "LRN TSP-LSA", "Date", "Time", "Duration", "First Cell ID", "Last Cell ID", "Service Type", "IMEI", "IMSI", "Call Fow No", "Roam Nw"})
+	for _, e := range c.events {
+		ct, lrnNo, lrnName, svc, last := "IN", e.lrn.code, e.lrn.short, "Voice", e.last.id
+		switch {
+		case e.sms:
+			ct, svc, last = "SMT", "SMS", ""
+			if e.service {
+				lrnNo, lrnName = "", "-"
+			}
+		case e.out:
+			ct = "OUT"
+		}
+		w.Write([]string{"91" + c.target, ct, e.other, lrnNo, lrnName, e.at.Format("02/01/2006"), hms(e.at), strconv.Itoa(e.dur),
+			e.first.id, last, svc, c.imei, c.imsi, "-", "AIR MP"})
+	}
+}
+
+// Airtel's enterprise layout for leased lines and SIP trunks: voice only,
+// stamped in UTC, a circuit instead of cells
+func writeAirtelEnterprise(c *cdr, w *csv.Writer) {
+	const n = 12
+	utc := func(t time.Time) string {
+		return t.Add(-330 * time.Minute).Format("2006-01-02 15:04:05")
+	}
+	w.Write(pad(n, "Bharti Airtel Limited - Airtel Business"))
+	w.Write(pad(n, fmt.Sprintf("CDR for A Number : 91%s Period : %s to %s (UTC)", c.target, c.from.Format("02-Jan-2006"), c.to.Format("02-Jan-2006"))))
+	w.Write(pad(n))
+	w.Write([]string{"A Number", "B Number", "Call Direction", "Start Time (UTC)", "End Time (UTC)", "Duration (sec)", "Circuit ID", "Trunk Group", "Service Type", "Circle", "LRN", "LRN TSP-LSA"})
+	circuit := "MP-IND-ILL-" + c.msc[:6]
+	for _, e := range c.events {
+		if e.sms {
+			continue
+		}
+		dir := "Incoming"
+		if e.out {
+			dir = "Outgoing"
+		}
+		w.Write([]string{"91" + c.target, "91" + e.other, dir, utc(e.at), utc(e.at.Add(time.Duration(e.dur) * time.Second)), strconv.Itoa(e.dur),
+			circuit, "TG" + c.msc[6:], "Voice", "MP", e.lrn.code, e.lrn.short})
+	}
+}
+
+// the older Jio layout, with short party headers and CGIs
+func writeJioV1(c *cdr, w *csv.Writer) {
+	const n = 13
+	w.Write(pad(n, "Input Value :", c.target))
+	w.Write(pad(n, "Date Range :", c.from.Format("2006-01-02")+" to "+c.to.Format("2006-01-02")))
+	w.Write(pad(n))
+	w.Write([]string{"Calling Number", "Called Number", "Call Date", "Call Time", "Duration(sec)", "First CGI", "Last CGI", "Call Type", "IMEI", "IMSI", "Roaming Circle", "LRN No", "Call Fwd No"})
+	for _, e := range c.events {
+		a, b, ct, dur := "91"+e.other, "91"+c.target, "A_IN", strconv.Itoa(e.dur)
+		switch {
+		case e.service:
+			a, ct, dur = e.other, "A2P_SMSIN", "0"
+		case e.sms:
+			ct, dur = "P2P_SMSIN", "0"
+		case e.out:
+			a, b, ct = b, a, "A_OUT"
+		}
+		w.Write([]string{a, b, e.at.Format("02/01/2006"), hms(e.at), dur, e.first.id, e.last.id, ct, c.imei, c.imsi, "MP", e.lrn.code, ""})
+	}
+}
+
+func writeVI(c *cdr, w *csv.Writer) {
+	const n = 22
+	rule := strings.Repeat("-", 120)
+	w.Write(pad(n, rule))
+	w.Write(pad(n, strings.Repeat(" ", 60)+"Call Data Records"))
+	w.Write(pad(n, rule))
+	w.Write(pad(n, "MSISDN : - "+c.target))
+	w.Write(pad(n, "Report Type :- ALLINDIA Report"))
+	w.Write(pad(n, "From Date :- "+c.from.Format("02/01/2006 15:04:05")))
+	w.Write(pad(n, "Till Date :- "+c.to.Format("02/01/2006 15:04:05")))
+	w.Write(pad(n, "Report Index :- MP_"+digits(c.r, 9)))
+	w.Write(pad(n, "Report Date :- "+c.to.Format("02-Jan-2006 03:04:05 PM")))
+	w.Write(pad(n, rule))
+	w.Write([]string{"Target /A PARTY NUMBER", "CALL_TYPE", "Type of Connection", "B PARTY NUMBER", "LRN- B Party Number", "Translation of LRN", "Call date", "Call Initiation Time", "Call Duration", "First BTS Location", "First Cell Global Id", "Last BTS Location", "Last Cell Global Id", "SMS Centre Number", "Service Type", "IMEI", "IMSI", "Call Forwarding Number", "Roaming Network/Circle", "MSC ID", "In TG ", "Out TG"})
+	w.Write(pad(n, rule))
+	for _, e := range c.events {
+		ct, b, lrnNo, lrnName, smsc, svc := "Incoming", "91"+e.other, "-", "-", "-", "Voice"
+		switch {
+		case e.service:
+			b, smsc, svc = e.other, "91"+c.msc, "SMS"
+		case e.sms:
+			smsc, svc = "91"+c.msc, "SMS"
+		case e.out:
+			ct, b, lrnNo, lrnName = "Outgoing", e.other, e.lrn.code, e.lrn.desc
+		}
+		w.Write([]string{"91" + c.target, ct, "PREPAID", b, lrnNo, lrnName, e.at.Format("1/2/2006"), hms(e.at), strconv.Itoa(e.dur),
+			e.first.name, e.first.id, e.last.name, e.last.id, smsc, svc, c.imei, c.imsi, "-", "MAG-Vodafone - India", "91" + c.msc, "-", "-"})
+	}
+	w.Write(pad(n))
+	w.Write(pad(n))
+	w.Write(pad(n, "Note :- This is a System generated Report."))
+}
+
+func writeBSNL(c *cdr, w *csv.Writer) {
+	const n = 26
+	w.Write(pad(n, "Search Criteria : MSISDN"))
+	w.Write(pad(n, "Search Value : "+c.target))
+	w.Write(pad(n, "Start Date & Time : "+c.from.Format("02-01-2006 15:04:05")))
+	w.Write(pad(n, "End Date & Time : "+c.to.Format("02-01-2006 15:04:05")))
+	w.Write(pad(n, "Enquirer Name : training"))
+	w.Write(pad(n, "Enquirer Org : SYNTHETIC"))
+	w.Write(pad(n))
+	w.Write(pad(n, "Name:SYNTHETIC SUBSCRIBER", "Address:-", "", "Indore", "Madhya Pradesh", "PIN-000000", "CONN_TYPE:PREPAID"))
+	w.Write(pad(n))
+	w.Write(pad(n))
+	w.Write([]string{"SL_NO", "Mobile_No", "Call_Type", "Type_Of_Connec", "Other_Party_No", "LRN_B_Party_No", "LRN_DESCRIPTION", "Call_Date", "Call_Initiation_Time(CIT)", "Call_Duration", "First_Cell_Desc", "First_Cell_id", "Last_Cell_Desc", "Last_Cell_ID", "SMSC_No", "Service_Type", "IMEI", "IMSI", "Original_Originated_Party", "Roaming Circle", "MSC_ID", "IN_TG", "OUT_TG", "First_LAT", "First_Long", "LRN_LSA"})
+	for i, e := range c.events {
+		ct, lrnNo, lrnName, lsa, smsc, svc := "IN", e.lrn.code, e.lrn.desc, e.lrn.code+"_"+e.lrn.lsa, "", "VOICE"
+		switch {
+		case e.service:
+			lrnNo, lrnName, lsa, smsc, svc = "", "", "", c.msc, "SMS"
+		case e.sms:
+			smsc, svc = c.msc, "SMS"
+		case e.out:
+			ct = "OUT"
+		}
+		w.Write([]string{strconv.Itoa(i + 1), c.target, ct, "PREPAID", e.other, lrnNo, lrnName, e.at.Format("02/01/2006"), e.at.Format("15:04:05"), strconv.Itoa(e.dur),
+			e.first.name, e.first.id, e.last.name, e.last.id, smsc, svc, c.imei, c.imsi, "", "MP", c.msc, "", "",
+			strconv.FormatFloat(e.first.lat, 'f', 6, 64), strconv.FormatFloat(e.first.lon, 'f', 6, 64), lsa})
+	}
+}
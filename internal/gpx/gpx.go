@@ -0,0 +1,96 @@
+// Package gpx writes the target's tower sequence as a GPX track so the
+// movement can be replayed in GPS tools next to other location evidence.
+package gpx
+
+import (
+	"encoding/xml"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+)
+
+type gpxDoc struct {
+	XMLName xml.Name `xml:"gpx"`
+	Version string   `xml:"version,attr"`
+	Creator string   `xml:"creator,attr"`
+	NS      string   `xml:"xmlns,attr"`
+	Trk     trk      `xml:"trk"`
+}
+
+type trk struct {
+	Name string `xml:"name"`
+	Seg  trkseg `xml:"trkseg"`
+}
+
+type trkseg struct {
+	Pts []trkpt `xml:"trkpt"`
+}
+
+type trkpt struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Time string  `xml:"time"`
+	Name string  `xml:"name"`
+	Desc string  `xml:"desc,omitempty"`
+}
+
+// Write reads the report at reportPath and writes <prefix>_movement.gpx
+// beside it: one track point per record whose first cell has coordinates
+// and whose date and time parse, in chronological order.
+func Write(reportPath string) (string, error) {
+	header, rows, err := canon.ReadReport(reportPath)
+	if err != nil {
+		return "", err
+	}
+	col := canon.Index(header)
+
+	type stop struct {
+		at time.Time
+		pt trkpt
+	}
+	var stops []stop
+	cdr := ""
+	for _, row := range rows {
+		if cdr == "" {
+			cdr = canon.Get(row, col, "CdrNo")
+		}
+		lat, lon, ok := canon.ParseLatLong(canon.Get(row, col, "Lat-Long-Azimuth (First CellID)"))
+		if !ok {
+			continue
+		}
+		local, ok := canon.ParseDateTime(canon.Get(row, col, "Date"), canon.Get(row, col, "Time"))
+		if !ok {
+			continue
+		}
+		// the reports' times are in the output zone; GPX wants UTC
+		at := time.Date(local.Year(), local.Month(), local.Day(),
+			local.Hour(), local.Minute(), local.Second(), 0, canon.OutputZone())
+		desc := strings.TrimSpace(canon.Get(row, col, "Call Type") + " " + canon.Get(row, col, "B Party"))
+		if addr := canon.Get(row, col, "First Cell ID Address"); addr != "" {
+			desc += " @ " + addr
+		}
+		stops = append(stops, stop{at, trkpt{
+			Lat: lat, Lon: lon, Time: at.UTC().Format(time.RFC3339),
+			Name: canon.Get(row, col, "First Cell ID"), Desc: desc,
+		}})
+	}
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].at.Before(stops[j].at) })
+
+	doc := gpxDoc{
+		Version: "1.1", Creator: "cdr-filter", NS: "http://www.topografix.com/GPX/1/1",
+		Trk: trk{Name: cdr},
+	}
+	for _, s := range stops {
+		doc.Trk.Seg.Pts = append(doc.Trk.Seg.Pts, s.pt)
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSuffix(reportPath, "_reports.csv") + "_movement.gpx"
+	return path, os.WriteFile(path, append([]byte(xml.Header), out...), 0o644)
+}
@@ -0,0 +1,173 @@
+// Package heatmap exports the towers a target used, weighted by call
+// count, as CSV and JSON for heatmap tools, and optionally as a standalone
+// Leaflet page.
+package heatmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+// Point is one tower and the share of the target's records it served.
+type Point struct {
+	CellID  string  `json:"cell_id"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	Calls   int     `json:"calls"`
+	Weight  float64 `json:"weight"` // calls relative to the busiest tower, 0–1
+	Address string  `json:"address,omitempty"`
+}
+
+// Points aggregates the report rows by first cell ID. Rows whose cell has
+// no usable coordinates are skipped.
+func Points(header []string, rows [][]string) []Point {
+	col := canon.Index(header)
+	byCell := map[string]*Point{}
+	var order []string
+	for _, row := range rows {
+		id := canon.Get(row, col, "First Cell ID")
+		if id == "" {
+			continue
+		}
+		p, ok := byCell[id]
+		if !ok {
+			lat, lon, ok := canon.ParseLatLong(canon.Get(row, col, "Lat-Long-Azimuth (First CellID)"))
+			if !ok {
+				continue
+			}
+			p = &Point{CellID: id, Lat: lat, Lon: lon, Address: canon.Get(row, col, "First Cell ID Address")}
+			byCell[id] = p
+			order = append(order, id)
+		}
+		p.Calls++
+	}
+	out := make([]Point, 0, len(order))
+	max := 0
+	for _, id := range order {
+		out = append(out, *byCell[id])
+		if c := byCell[id].Calls; c > max {
+			max = c
+		}
+	}
+	for i := range out {
+		out[i].Weight = float64(out[i].Calls) / float64(max)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Calls > out[j].Calls })
+	return out
+}
+
+// Write reads the report at reportPath and writes <prefix>_heatmap.csv and
+// <prefix>_heatmap.json beside it, plus <prefix>_heatmap.html when page is
+// set, returning the paths written.
+func Write(reportPath string, page bool) ([]string, error) {
+	header, rows, err := canon.ReadReport(reportPath)
+	if err != nil {
+		return nil, err
+	}
+	points := Points(header, rows)
+	cdr := ""
+	if len(rows) > 0 {
+		cdr = canon.Get(rows[0], canon.Index(header), "CdrNo")
+	}
+
+	prefix := strings.TrimSuffix(reportPath, "_reports.csv")
+	out := []string{prefix + "_heatmap.csv", prefix + "_heatmap.json"}
+	if err := writeCSV(out[0], points); err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(points, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(out[1], b, 0o644); err != nil {
+		return nil, err
+	}
+	if page {
+		p := prefix + "_heatmap.html"
+		if err := writePage(p, cdr, points); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func writeCSV(path string, points []Point) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := safecsv.NewWriter(f)
+	w.Write([]string{"Cell ID", "Latitude", "Longitude", "Total Calls", "Weight", "Tower Address"})
+	for _, p := range points {
+		w.Write([]string{
+			p.CellID, strconv.FormatFloat(p.Lat, 'f', -1, 64), strconv.FormatFloat(p.Lon, 'f', -1, 64),
+			strconv.Itoa(p.Calls), fmt.Sprintf("%.3f", p.Weight), p.Address,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// page embeds the points, so it opens from disk without the server.
+// Leaflet, the heat plugin and the map tiles are still fetched from their
+// CDNs; without a connection the heat layer draws on a blank background.
+var page = template.Must(template.New("heatmap").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Tower heatmap {{.CDR}}</title>
+<link rel="stylesheet" href="https://unpkg.com/leaflet@1.9.4/dist/leaflet.css">
+<script src="https://unpkg.com/leaflet@1.9.4/dist/leaflet.js"></script>
+<script src="https://unpkg.com/leaflet.heat@0.2.0/dist/leaflet-heat.js"></script>
+<style>html, body, #map { height: 100%; margin: 0; }</style>
+</head>
+<body>
+<div id="map"></div>
+<script>
+var points = {{.Points}};
+function esc(s) {
+  return String(s).replace(/[&<>"]/g, function (c) {
+    return {"&": "&amp;", "<": "&lt;", ">": "&gt;", "\"": "&quot;"}[c];
+  });
+}
+var map = L.map("map");
+L.tileLayer("https://tile.openstreetmap.org/{z}/{x}/{y}.png", {
+  maxZoom: 19, attribution: "&copy; OpenStreetMap contributors"
+}).addTo(map);
+if (points.length) {
+  L.heatLayer(points.map(function (p) { return [p.lat, p.lon, p.weight]; }), {radius: 25}).addTo(map);
+  points.slice(0, 10).forEach(function (p) {
+    L.circleMarker([p.lat, p.lon], {radius: 5})
+      .bindPopup(esc(p.cell_id) + "<br>" + p.calls + " calls<br>" + esc(p.address || ""))
+      .addTo(map);
+  });
+  map.fitBounds(points.map(function (p) { return [p.lat, p.lon]; }), {padding: [20, 20]});
+} else {
+  map.setView([22.5, 79], 5);
+}
+</script>
+</body>
+</html>
+`))
+
+func writePage(path, cdr string, points []Point) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = page.Execute(f, map[string]any{"CDR": cdr, "Points": points})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
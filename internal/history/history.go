@@ -0,0 +1,70 @@
+// Package history keeps the earlier versions of reports that processing a
+// number or extending a case again replaces. Before a job's files are
+// published over ones of the same name, those are moved to
+// <output dir>/.versions/<job>/, <job> being the job that made them, and
+// that job's record is pointed at them there, so each job keeps the
+// reports it delivered and an earlier analysis can be reproduced.
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+)
+
+// Dir is the sub-directory of an output directory the replaced versions
+// are kept in.
+const Dir = ".versions"
+
+// Archive moves the files of dst that the files of paths are about to
+// replace to dst/.versions/<job>/, <job> being the newest job listing
+// them among its outputs, and updates that job's record. Files no job
+// lists are kept under their modification time instead.
+func Archive(dst string, paths []string) error {
+	list, _ := jobs.List()
+	changed := map[*jobs.Job]bool{}
+	for _, p := range paths {
+		cur := filepath.Join(dst, filepath.Base(p))
+		if p == cur {
+			continue
+		}
+		st, err := os.Stat(cur)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var owner *jobs.Job
+		for i := len(list) - 1; i >= 0 && owner == nil; i-- {
+			if slices.Contains(list[i].Outputs, cur) {
+				owner = list[i]
+			}
+		}
+		sub := st.ModTime().Format("20060102-150405")
+		if owner != nil {
+			sub = owner.ID
+		}
+		dir := filepath.Join(dst, Dir, sub)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		to := filepath.Join(dir, filepath.Base(cur))
+		if err := os.Rename(cur, to); err != nil {
+			return err
+		}
+		if owner != nil {
+			owner.Outputs[slices.Index(owner.Outputs, cur)] = to
+			changed[owner] = true
+		}
+	}
+	for j := range changed {
+		if err := jobs.Save(j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
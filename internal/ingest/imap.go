@@ -0,0 +1,503 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/archive"
+	"github.com/jalad-shrimali/cdr-filter/internal/dlink"
+)
+
+// MailDir stages attachments taken from the mailbox while they are
+// processed.
+const MailDir = "mail"
+
+// MailRule is one row of the mail rules table (sender,subject,tsp). Sender
+// and Subject are case-insensitive substrings; empty matches anything.
+// The first matching rule decides the TSP of a message's attachments.
+type MailRule struct {
+	Sender, Subject, TSP string
+}
+
+// MailConfig is read from the environment:
+//
+//	CDR_IMAP_URL       imaps://host:993/INBOX (imap:// for a plain local relay)
+//	CDR_IMAP_USER      mailbox login
+//	CDR_IMAP_PASSWORD  mailbox password
+//	CDR_IMAP_RULES     mail rules table
+//	CDR_IMAP_INTERVAL  poll interval (default 5m)
+//	CDR_SMTP_ADDR      host:port for replies; no replies when empty
+//	CDR_SMTP_FROM      reply sender (default CDR_IMAP_USER)
+//	CDR_PUBLIC_URL     base of the download links (default http://localhost:8080)
+type MailConfig struct {
+	URL, User, Password  string
+	Rules                []MailRule
+	Every                time.Duration
+	SMTPAddr, From, Base string
+}
+
+// MailFromEnv returns the mail configuration, or nil when CDR_IMAP_URL is
+// unset.
+func MailFromEnv() (*MailConfig, error) {
+	u := os.Getenv("CDR_IMAP_URL")
+	if u == "" {
+		return nil, nil
+	}
+	c := &MailConfig{
+		URL: u, User: os.Getenv("CDR_IMAP_USER"), Password: os.Getenv("CDR_IMAP_PASSWORD"),
+		Every: 5 * time.Minute, SMTPAddr: os.Getenv("CDR_SMTP_ADDR"),
+		From: os.Getenv("CDR_SMTP_FROM"), Base: os.Getenv("CDR_PUBLIC_URL"),
+	}
+	if d, err := time.ParseDuration(os.Getenv("CDR_IMAP_INTERVAL")); err == nil && d > 0 {
+		c.Every = d
+	}
+	if c.From == "" {
+		c.From = c.User
+	}
+	if c.Base == "" {
+		c.Base = "http://localhost:8080"
+	}
+	p := os.Getenv("CDR_IMAP_RULES")
+	if p == "" {
+		return nil, fmt.Errorf("CDR_IMAP_RULES is required with CDR_IMAP_URL")
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if c.Rules, err = LoadMailRules(f); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadMailRules parses a mail rules table.
+func LoadMailRules(f io.Reader) ([]MailRule, error) {
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	get := func(rec []string, k string) string {
+		if i, ok := col[k]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+	var out []MailRule
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ru := MailRule{
+			Sender:  strings.ToLower(get(rec, "sender")),
+			Subject: strings.ToLower(get(rec, "subject")),
+			TSP:     strings.ToLower(get(rec, "tsp")),
+		}
+		if ru.TSP == "" {
+			return nil, fmt.Errorf("mail rules line %d: tsp is required", line)
+		}
+		out = append(out, ru)
+	}
+	return out, nil
+}
+
+func (c *MailConfig) match(from, subject string) (string, bool) {
+	from, subject = strings.ToLower(from), strings.ToLower(subject)
+	for _, r := range c.Rules {
+		if strings.Contains(from, r.Sender) && strings.Contains(subject, r.Subject) {
+			return r.TSP, true
+		}
+	}
+	return "", false
+}
+
+// Poll checks the mailbox for unseen messages matching the rules once per
+// interval until the process exits. Processed messages are marked seen;
+// others are left untouched.
+func (c *MailConfig) Poll(handle Handler) {
+	skip := map[string]bool{} // unseen UIDs that matched no rule
+	for {
+		if err := c.pollOnce(handle, skip); err != nil {
+			log.Printf("ingest: imap: %v", err)
+		}
+		time.Sleep(c.Every)
+	}
+}
+
+func (c *MailConfig) pollOnce(handle Handler, skip map[string]bool) error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+	box := strings.TrimPrefix(u.Path, "/")
+	if box == "" {
+		box = "INBOX"
+	}
+	ic, err := dialIMAP(u)
+	if err != nil {
+		return err
+	}
+	defer ic.close()
+	if _, err := ic.cmd("LOGIN %s %s", quote(c.User), quote(c.Password)); err != nil {
+		return err
+	}
+	if _, err := ic.cmd("SELECT %s", quote(box)); err != nil {
+		return err
+	}
+	resps, err := ic.cmd("UID SEARCH UNSEEN")
+	if err != nil {
+		return err
+	}
+	var uids []string
+	for _, r := range resps {
+		if rest, ok := strings.CutPrefix(r.line, "* SEARCH"); ok {
+			uids = append(uids, strings.Fields(rest)...)
+		}
+	}
+	for _, uid := range uids {
+		if skip[uid] {
+			continue
+		}
+		resps, err := ic.cmd("UID FETCH %s BODY.PEEK[]", uid)
+		if err != nil {
+			return err
+		}
+		var raw []byte
+		for _, r := range resps {
+			if len(r.lits) > 0 {
+				raw = r.lits[0]
+			}
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			log.Printf("ingest: imap: message %s: %v", uid, err)
+			skip[uid] = true
+			continue
+		}
+		dec := new(mime.WordDecoder)
+		subject, _ := dec.DecodeHeader(msg.Header.Get("Subject"))
+		from := msg.Header.Get("From")
+		tsp, ok := c.match(from, subject)
+		if !ok {
+			skip[uid] = true
+			continue
+		}
+		report := c.processMessage(uid, tsp, msg, handle)
+		if _, err := ic.cmd(`UID STORE %s +FLAGS (\Seen)`, uid); err != nil {
+			return err
+		}
+		if err := c.reply(msg, subject, report); err != nil {
+			log.Printf("ingest: imap: reply to message %s: %v", uid, err)
+		}
+	}
+	_, err = ic.cmd("LOGOUT")
+	return err
+}
+
+// processMessage runs every attachment (including files inside archives)
+// through handle and returns the lines of the reply body.
+func (c *MailConfig) processMessage(uid, tsp string, msg *mail.Message, handle Handler) []string {
+	dir := filepath.Join(MailDir, uid)
+	defer os.RemoveAll(dir)
+	var report []string
+	note := func(format string, a ...any) {
+		line := fmt.Sprintf(format, a...)
+		log.Printf("ingest: imap: message %s: %s", uid, line)
+		report = append(report, line)
+	}
+
+	files, err := attachments(msg)
+	if err != nil {
+		note("cannot read attachments: %v", err)
+		return report
+	}
+	if len(files) == 0 {
+		note("no attachments found")
+	}
+	for _, a := range files {
+		if !archive.Is(a.name) {
+			report = append(report, c.run(dir, tsp, a.name, a.data, handle, note)...)
+			continue
+		}
+		err := archive.Walk(a.name, bytes.NewReader(a.data), int64(len(a.data)), archive.LimitsFromEnv(),
+			func(name string, r io.Reader) error {
+				if archive.Is(name) {
+					note("%s: %s: %v", a.name, name, archive.ErrNested)
+					return nil
+				}
+				data, err := io.ReadAll(r)
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				report = append(report, c.run(dir, tsp, name, data, handle, note)...)
+				return nil
+			})
+		if err != nil {
+			note("%s: %v", a.name, err)
+		}
+	}
+	return report
+}
+
+func (c *MailConfig) run(dir, tsp, name string, data []byte, handle Handler, note func(string, ...any)) []string {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		note("%s: %v", name, err)
+		return nil
+	}
+	p := filepath.Join(dir, filepath.Base(name))
+	if err := os.WriteFile(p, data, 0o600); err != nil {
+		note("%s: %v", name, err)
+		return nil
+	}
+	outs, err := handle(tsp, p)
+	if err != nil {
+		note("%s: %v", name, err)
+		return nil
+	}
+	links := []string{name + ":"}
+	for _, o := range outs {
+		links = append(links, "  "+strings.TrimRight(c.Base, "/")+dlink.Path(dlink.Name(o)))
+	}
+	return links
+}
+
+func (c *MailConfig) reply(msg *mail.Message, subject string, body []string) error {
+	if c.SMTPAddr == "" {
+		return nil
+	}
+	to, err := mail.ParseAddress(msg.Header.Get("Reply-To"))
+	if err != nil {
+		if to, err = mail.ParseAddress(msg.Header.Get("From")); err != nil {
+			return err
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", c.From)
+	fmt.Fprintf(&b, "To: %s\r\n", to.String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "Re: "+subject))
+	if id := msg.Header.Get("Message-ID"); id != "" {
+		fmt.Fprintf(&b, "In-Reply-To: %s\r\n", id)
+	}
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString("CDR processing results:\r\n\r\n")
+	for _, l := range body {
+		b.WriteString(l + "\r\n")
+	}
+	if dlink.Enabled() {
+		fmt.Fprintf(&b, "\r\nThe links expire after %s.\r\n", dlink.TTL())
+	}
+	var auth smtp.Auth
+	if c.Password != "" {
+		host, _, _ := net.SplitHostPort(c.SMTPAddr)
+		auth = smtp.PlainAuth("", c.User, c.Password, host)
+	}
+	return smtp.SendMail(c.SMTPAddr, auth, c.From, []string{to.Address}, []byte(b.String()))
+}
+
+/* ---------- MIME ---------- */
+
+type attachment struct {
+	name string
+	data []byte
+}
+
+func attachments(msg *mail.Message) ([]attachment, error) {
+	var out []attachment
+	err := walkPart(msg.Header, msg.Body, &out)
+	return out, err
+}
+
+type header interface{ Get(string) string }
+
+func walkPart(h header, body io.Reader, out *[]attachment) error {
+	mt, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mt = "text/plain"
+	}
+	if strings.HasPrefix(mt, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkPart(p.Header, p, out); err != nil {
+				return err
+			}
+		}
+	}
+	name := params["name"]
+	if _, dp, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil && dp["filename"] != "" {
+		name = dp["filename"]
+	}
+	if name == "" {
+		return nil
+	}
+	if d, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = d
+	}
+	switch strings.ToLower(h.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &stripNewlines{r: body})
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*out = append(*out, attachment{name: path.Base(name), data: data})
+	return nil
+}
+
+/* stripNewlines drops CR/LF so base64 bodies wrapped at 76 columns decode */
+type stripNewlines struct{ r io.Reader }
+
+func (s *stripNewlines) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	j := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[j] = b
+			j++
+		}
+	}
+	return j, err
+}
+
+/* ---------- minimal IMAP4rev1 client ---------- */
+
+type imapConn struct {
+	c   net.Conn
+	r   *bufio.Reader
+	tag int
+}
+
+type imapResp struct {
+	line string
+	lits [][]byte
+}
+
+func dialIMAP(u *url.URL) (*imapConn, error) {
+	var (
+		c   net.Conn
+		err error
+	)
+	d := &net.Dialer{Timeout: 30 * time.Second}
+	switch u.Scheme {
+	case "imaps":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "993")
+		}
+		c, err = tls.DialWithDialer(d, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	case "imap":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "143")
+		}
+		c, err = d.Dial("tcp", host)
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ic := &imapConn{c: c, r: bufio.NewReader(c)}
+	if _, err := ic.read(); err != nil { // server greeting
+		c.Close()
+		return nil, err
+	}
+	return ic, nil
+}
+
+func (ic *imapConn) close() { ic.c.Close() }
+
+// cmd sends one tagged command and collects the untagged responses.
+func (ic *imapConn) cmd(format string, a ...any) ([]imapResp, error) {
+	ic.tag++
+	tag := "a" + strconv.Itoa(ic.tag)
+	ic.c.SetDeadline(time.Now().Add(2 * time.Minute))
+	if _, err := fmt.Fprintf(ic.c, "%s %s\r\n", tag, fmt.Sprintf(format, a...)); err != nil {
+		return nil, err
+	}
+	var out []imapResp
+	for {
+		r, err := ic.read()
+		if err != nil {
+			return nil, err
+		}
+		if rest, ok := strings.CutPrefix(r.line, tag+" "); ok {
+			if !strings.HasPrefix(rest, "OK") {
+				verb, _, _ := strings.Cut(format, " ")
+				return nil, fmt.Errorf("%s: %s", verb, rest)
+			}
+			return out, nil
+		}
+		out = append(out, r)
+	}
+}
+
+// read returns one response line with any {n} literals split out.
+func (ic *imapConn) read() (imapResp, error) {
+	var r imapResp
+	for {
+		line, err := ic.r.ReadString('\n')
+		if err != nil {
+			return r, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		r.line += line
+		i := strings.LastIndexByte(line, '{')
+		if i < 0 || !strings.HasSuffix(line, "}") {
+			return r, nil
+		}
+		n, err := strconv.Atoi(line[i+1 : len(line)-1])
+		if err != nil {
+			return r, nil
+		}
+		lit := make([]byte, n)
+		if _, err := io.ReadFull(ic.r, lit); err != nil {
+			return r, err
+		}
+		r.lits = append(r.lits, lit)
+	}
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,189 @@
+// Package ingest watches a drop folder and feeds new CDR files to the
+// normal processing pipeline. It is enabled by CDR_WATCH_DIR; the TSP is
+// taken from the subdirectory a file is dropped into (<dir>/jio/x.csv).
+//
+// The folder is polled every CDR_WATCH_INTERVAL (default 10s). A file is
+// picked up once its size has stopped changing between two polls, then
+// moved to <dir>/done or <dir>/failed, the latter with a .err note.
+//
+// Files may come bundled in an archive (see package archive): wrapped in
+// Unpacking, a handler takes each file of one in turn.
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/archive"
+)
+
+const (
+	DoneDir   = "done"
+	FailedDir = "failed"
+)
+
+// Handler processes one fetched file for the given TSP and returns the
+// generated outputs.
+type Handler func(tsp, path string) ([]string, error)
+
+// Unpacking returns handle made to take archives as well: each file in
+// one is unpacked beside it and handled on its own, and the archive fails
+// if any of them does. An archive inside one is not handled.
+func Unpacking(handle Handler) Handler {
+	return func(tsp, p string) ([]string, error) {
+		if !archive.Is(p) {
+			return handle(tsp, p)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		// hidden, so the watch folder does not pick it up itself
+		dir, err := os.MkdirTemp(filepath.Dir(p), ".unpack-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		var (
+			outs  []string
+			errs  []error
+			files int
+		)
+		err = archive.Walk(p, f, st.Size(), archive.LimitsFromEnv(), func(name string, r io.Reader) error {
+			files++
+			if archive.Is(name) {
+				errs = append(errs, fmt.Errorf("%s: %w", name, archive.ErrNested))
+				return nil
+			}
+			dst := filepath.Join(dir, name)
+			if err := writeFile(dst, r); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			defer os.Remove(dst)
+			out, err := handle(tsp, dst)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			outs = append(outs, out...)
+			return nil
+		})
+		if err == nil && files == 0 {
+			err = errors.New("the archive holds no files")
+		}
+		return outs, errors.Join(append(errs, err)...)
+	}
+}
+
+func writeFile(p string, r io.Reader) error {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return errors.Join(err, f.Close())
+}
+
+// Dir returns the configured watch folder, or "" when disabled.
+func Dir() string { return os.Getenv("CDR_WATCH_DIR") }
+
+// Interval returns the configured poll interval.
+func Interval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CDR_WATCH_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Second
+}
+
+// Watch polls dir until the process exits, handing every settled file in
+// a <dir>/<tsp>/ subdirectory to handle. tsps lists the accepted names.
+func Watch(dir string, every time.Duration, tsps []string, handle Handler) {
+	for _, d := range append([]string{DoneDir, FailedDir}, tsps...) {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			log.Printf("ingest: %v", err)
+		}
+	}
+	sizes := map[string]int64{}
+	var (
+		mu       sync.Mutex
+		inflight = map[string]bool{} // handed off, not yet settled
+	)
+	for {
+		seen := map[string]int64{}
+		for _, tsp := range tsps {
+			entries, err := os.ReadDir(filepath.Join(dir, tsp))
+			if err != nil {
+				log.Printf("ingest: %v", err)
+				continue
+			}
+			for _, e := range entries {
+				if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+					continue
+				}
+				p := filepath.Join(dir, tsp, e.Name())
+				mu.Lock()
+				busy := inflight[p]
+				mu.Unlock()
+				if busy {
+					continue
+				}
+				fi, err := e.Info()
+				if err != nil {
+					continue
+				}
+				seen[p] = fi.Size()
+				if prev, ok := sizes[p]; !ok || prev != fi.Size() {
+					continue // still being written, or first sighting
+				}
+				delete(seen, p)
+				mu.Lock()
+				inflight[p] = true
+				mu.Unlock()
+				// concurrency is bounded by the processing pool
+				go func(tsp, p string) {
+					_, err := handle(tsp, p)
+					settle(dir, tsp, p, err)
+					mu.Lock()
+					delete(inflight, p)
+					mu.Unlock()
+				}(tsp, p)
+			}
+		}
+		sizes = seen
+		time.Sleep(every)
+	}
+}
+
+// settle moves a handled file out of the drop folder.
+func settle(dir, tsp, p string, err error) {
+	stamp := time.Now().Format("20060102T150405")
+	name := tsp + "_" + stamp + "_" + filepath.Base(p)
+	if err == nil {
+		log.Printf("ingest: processed %s", p)
+		if err := os.Rename(p, filepath.Join(dir, DoneDir, name)); err != nil {
+			log.Printf("ingest: %v", err)
+		}
+		return
+	}
+	log.Printf("ingest: %s: %v", p, err)
+	dst := filepath.Join(dir, FailedDir, name)
+	if rerr := os.Rename(p, dst); rerr != nil {
+		log.Printf("ingest: %v", rerr)
+		return
+	}
+	note := fmt.Sprintf("%s\n", err)
+	if werr := os.WriteFile(dst+".err", []byte(note), 0o644); werr != nil {
+		log.Printf("ingest: %v", werr)
+	}
+}
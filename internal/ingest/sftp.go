@@ -0,0 +1,218 @@
+package ingest
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StageDir holds files pulled from SFTP sources and the hash ledger used
+// to skip files that were already processed.
+const StageDir = "sftp"
+
+// Source is one row of the SFTP sources table
+// (name,tsp,host,port,user,identity,pattern). Authentication is by key
+// file only; the system sftp client runs in batch mode, so passwords
+// cannot be supplied. Pattern is a remote glob such as /out/CDR_*.csv.
+type Source struct {
+	Name, TSP, Host, Port, User, Identity, Pattern string
+}
+
+// SFTPFile returns the configured sources table, or "" when disabled.
+func SFTPFile() string { return os.Getenv("CDR_SFTP_SOURCES") }
+
+// SFTPInterval returns the configured pull interval (default 15m).
+func SFTPInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CDR_SFTP_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return 15 * time.Minute
+}
+
+// LoadSources parses a sources table.
+func LoadSources(f io.Reader) ([]Source, error) {
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	get := func(rec []string, k string) string {
+		if i, ok := col[k]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+	var out []Source
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		s := Source{
+			Name: get(rec, "name"), TSP: strings.ToLower(get(rec, "tsp")),
+			Host: get(rec, "host"), Port: get(rec, "port"), User: get(rec, "user"),
+			Identity: get(rec, "identity"), Pattern: get(rec, "pattern"),
+		}
+		if s.Name == "" || strings.HasPrefix(s.Name, "#") {
+			continue
+		}
+		if s.TSP == "" || s.Host == "" || s.Pattern == "" {
+			return nil, fmt.Errorf("sftp sources line %d: tsp, host and pattern are required", line)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// Pull fetches every source once per interval until the process exits.
+func Pull(sources []Source, every time.Duration, handle Handler) {
+	seen := &ledger{path: filepath.Join(StageDir, "seen.txt")}
+	if err := seen.load(); err != nil {
+		log.Printf("ingest: sftp: %v", err)
+	}
+	for {
+		for _, s := range sources {
+			if err := pullOnce(s, seen, handle); err != nil {
+				log.Printf("ingest: sftp %s: %v", s.Name, err)
+			}
+		}
+		time.Sleep(every)
+	}
+}
+
+func pullOnce(s Source, seen *ledger, handle Handler) error {
+	dir := filepath.Join(StageDir, s.Name)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if s.Port != "" {
+		args = append(args, "-P", s.Port)
+	}
+	if s.Identity != "" {
+		args = append(args, "-i", s.Identity)
+	}
+	target := s.Host
+	if s.User != "" {
+		target = s.User + "@" + s.Host
+	}
+	cmd := exec.Command("sftp", append(args, target)...)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("-get %q %q\n", s.Pattern, dir+"/"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		sum, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		if seen.has(sum) {
+			continue
+		}
+		if _, err := handle(s.TSP, p); err != nil {
+			log.Printf("ingest: sftp %s: %s: %v", s.Name, e.Name(), err)
+		} else {
+			log.Printf("ingest: sftp %s: processed %s", s.Name, e.Name())
+		}
+		// failures are recorded too so a broken file is not retried forever
+		if err := seen.add(sum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+/* ledger is the append-only list of processed file hashes */
+type ledger struct {
+	mu   sync.Mutex
+	path string
+	sums map[string]bool
+}
+
+func (l *ledger) load() error {
+	l.sums = map[string]bool{}
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if s := strings.TrimSpace(sc.Text()); s != "" {
+			l.sums[s] = true
+		}
+	}
+	return sc.Err()
+}
+
+func (l *ledger) has(sum string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sums[sum]
+}
+
+func (l *ledger) add(sum string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, sum); err != nil {
+		return err
+	}
+	l.sums[sum] = true
+	return nil
+}
@@ -0,0 +1,202 @@
+// Package jobs persists one JSON record per processed upload.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dir holds <id>.json job records.
+const Dir = "jobs"
+
+// Job is the persisted record of one upload.
+type Job struct {
+	ID        string            `json:"id"`
+	TSP       string            `json:"tsp"`
+	Tenant    string            `json:"tenant,omitempty"`
+	CDR       string            `json:"cdr,omitempty"`
+	Crime     string            `json:"crime,omitempty"`
+	Officer   string            `json:"officer,omitempty"`
+	FIR       string            `json:"fir,omitempty"`
+	Unit      string            `json:"unit,omitempty"`
+	Remarks   string            `json:"remarks,omitempty"`
+	Key       string            `json:"idempotency_key,omitempty"`
+	Upload    string            `json:"upload"`
+	Outputs   []string          `json:"outputs,omitempty"`
+	SHA256    map[string]string `json:"sha256,omitempty"` // output file name → digest
+	Columns   []string          `json:"columns,omitempty"`
+	Locale    string            `json:"locale,omitempty"`
+	Summary   bool              `json:"summary_only,omitempty"` // only the summary reports were written
+	Priority  string            `json:"priority,omitempty"`     // in the worker queue
+	Dupes     int               `json:"duplicates_removed,omitempty"`
+	Warnings  []string          `json:"warnings,omitempty"`
+	Coverage  []string          `json:"coverage,omitempty"` // share of rows the reference tables enriched
+	Rows      int               `json:"rows,omitempty"`     // records in the main report
+	Lookups   map[string]Lookup `json:"lookups,omitempty"`  // "cell", "lrn", "tac" → rows looked up and found
+	Versions  []string          `json:"versions,omitempty"`
+	From      string            `json:"reprocessed_from,omitempty"` // job whose stored records this one re-ran
+	Retried   string            `json:"retried_from,omitempty"`     // failed job whose upload this one ran again
+	Overrides []string          `json:"overrides,omitempty"`        // cdr number and column mapping given by hand
+	Settings  []string          `json:"settings,omitempty"`         // form fields that shaped the reports, field=value
+	Status    string            `json:"status"`                     // done, failed, cancelled
+	Error     string            `json:"error,omitempty"`
+	Created   time.Time         `json:"created"`
+	Started   time.Time         `json:"started,omitempty"` // when a worker took it up
+	Finished  time.Time         `json:"finished,omitempty"`
+}
+
+// Lookup counts the rows of a report a reference table was consulted for,
+// and those it enriched.
+type Lookup struct {
+	Total int `json:"total"`
+	Found int `json:"found"`
+}
+
+// RecordsPath is where the job's own copy of its normalized records is
+// kept; the report under filtered/ is replaced when the same number is
+// processed again.
+func RecordsPath(id string) string { return filepath.Join(Dir, id+".records.csv") }
+
+// Snapshot copies the job's main report to RecordsPath.
+func Snapshot(id, reportPath string) (string, error) {
+	if err := os.MkdirAll(Dir, 0o755); err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(reportPath)
+	if err != nil {
+		return "", err
+	}
+	dst := RecordsPath(id)
+	return dst, os.WriteFile(dst, b, 0o600)
+}
+
+// Records returns the path of j's normalized records: its snapshot when
+// one exists, otherwise the main report; "" for a summary-only job.
+func Records(j *Job) string {
+	if j.Summary {
+		return ""
+	}
+	if _, err := os.Stat(RecordsPath(j.ID)); err == nil {
+		return RecordsPath(j.ID)
+	}
+	if len(j.Outputs) == 0 {
+		return ""
+	}
+	return j.Outputs[0]
+}
+
+// ErrNotFound is returned by Load for unknown IDs.
+var ErrNotFound = errors.New("job not found")
+
+// Save writes j to jobs/<id>.json.
+func Save(j *Job) error {
+	if err := os.MkdirAll(Dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(Dir, j.ID+".json.tmp")
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(Dir, j.ID+".json"))
+}
+
+// Load reads the record for id.
+func Load(id string) (*Job, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, ErrNotFound
+	}
+	b, err := os.ReadFile(filepath.Join(Dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	j := &Job{}
+	return j, json.Unmarshal(b, j)
+}
+
+// List returns all records, oldest first.
+func List() ([]*Job, error) {
+	paths, err := filepath.Glob(filepath.Join(Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []*Job
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		j := &Job{}
+		if json.Unmarshal(b, j) == nil {
+			out = append(out, j)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Created.Before(out[b].Created) })
+	return out, nil
+}
+
+// ByKey returns the newest record created with the given Idempotency-Key.
+func ByKey(key string) (*Job, error) {
+	list, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].Key == key {
+			return list[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+var keyLocks sync.Map // Idempotency-Key → *sync.Mutex
+
+// LockKey serializes requests carrying the same Idempotency-Key so a
+// retry that races the original waits for its record instead of starting
+// a second job. Call the returned func to release.
+func LockKey(key string) func() {
+	m, _ := keyLocks.LoadOrStore(key, new(sync.Mutex))
+	mu := m.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// ErrCancelled is why a job stopped by Cancel stopped.
+var ErrCancelled = errors.New("cancelled on request")
+
+type runningJob struct {
+	tenant string
+	cancel context.CancelCauseFunc
+}
+
+var running sync.Map // job ID → runningJob
+
+// Start registers a running job of tenant so Cancel can stop it through
+// cancel. Call the returned func when the job ends.
+func Start(id, tenant string, cancel context.CancelCauseFunc) func() {
+	running.Store(id, runningJob{tenant, cancel})
+	return func() { running.Delete(id) }
+}
+
+// Cancel stops job id when it is running for tenant, and reports whether
+// it was.
+func Cancel(id, tenant string) bool {
+	v, ok := running.Load(id)
+	if !ok || v.(runningJob).tenant != tenant {
+		return false
+	}
+	v.(runningJob).cancel(ErrCancelled)
+	return true
+}
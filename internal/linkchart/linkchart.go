@@ -0,0 +1,183 @@
+// Package linkchart exports target ↔ B party relationships from a
+// normalized report as an edge list (importable into i2 Analyst's Notebook
+// via an import specification) and as GraphML.
+package linkchart
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+type edge struct {
+	Target, BParty, Provider string
+	Calls, Out, In, SMS      int
+	Duration                 float64
+	First, Last              time.Time
+}
+
+// Write reads the report at reportPath and writes <prefix>_links.csv and
+// <prefix>_links.graphml beside it, returning both paths.
+func Write(reportPath string) ([]string, error) {
+	header, rows, err := canon.ReadReport(reportPath)
+	if err != nil {
+		return nil, err
+	}
+	col := canon.Index(header)
+
+	edges := map[string]*edge{}
+	var order []string
+	for _, row := range rows {
+		b := canon.Get(row, col, "B Party")
+		if b == "" {
+			continue
+		}
+		e, ok := edges[b]
+		if !ok {
+			e = &edge{Target: canon.Get(row, col, "CdrNo"), BParty: b}
+			edges[b] = e
+			order = append(order, b)
+		}
+		if p := canon.Get(row, col, "B Party Provider"); p != "" && e.Provider == "" {
+			e.Provider = p
+		}
+		e.Calls++
+		ct := strings.ToUpper(canon.Get(row, col, "Call Type"))
+		switch {
+		case strings.Contains(ct, "SMS"):
+			e.SMS++
+		case strings.HasSuffix(ct, "OUT"):
+			e.Out++
+		case strings.HasSuffix(ct, "IN"):
+			e.In++
+		}
+		if d, err := strconv.ParseFloat(canon.Get(row, col, "Duration"), 64); err == nil {
+			e.Duration += d
+		}
+		if at, ok := canon.ParseDateTime(canon.Get(row, col, "Date"), canon.Get(row, col, "Time")); ok {
+			if e.First.IsZero() || at.Before(e.First) {
+				e.First = at
+			}
+			if at.After(e.Last) {
+				e.Last = at
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return edges[order[i]].Calls > edges[order[j]].Calls })
+
+	prefix := strings.TrimSuffix(reportPath, "_reports.csv")
+	csvPath, gmlPath := prefix+"_links.csv", prefix+"_links.graphml"
+	if err := writeEdges(csvPath, edges, order); err != nil {
+		return nil, err
+	}
+	if err := writeGraphML(gmlPath, edges, order); err != nil {
+		return nil, err
+	}
+	return []string{csvPath, gmlPath}, nil
+}
+
+func stamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("02-01-2006 15:04:05")
+}
+
+func writeEdges(path string, edges map[string]*edge, order []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := safecsv.NewWriter(f)
+	w.Write([]string{
+		"Entity1", "Entity1 Type", "Entity2", "Entity2 Type", "Entity2 Provider", "Link Type",
+		"Total Calls", "Out Calls", "In Calls", "Sms", "Total Duration", "First Contact", "Last Contact",
+	})
+	for _, b := range order {
+		e := edges[b]
+		w.Write([]string{
+			e.Target, "Target", e.BParty, "Telephone", e.Provider, "Call",
+			strconv.Itoa(e.Calls), strconv.Itoa(e.Out), strconv.Itoa(e.In), strconv.Itoa(e.SMS),
+			fmt.Sprintf("%.0f", e.Duration), stamp(e.First), stamp(e.Last),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+/* GraphML document model */
+type gmlKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+type gmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+type gmlNode struct {
+	ID   string    `xml:"id,attr"`
+	Data []gmlData `xml:"data"`
+}
+type gmlEdge struct {
+	Source string    `xml:"source,attr"`
+	Target string    `xml:"target,attr"`
+	Data   []gmlData `xml:"data"`
+}
+type graphML struct {
+	XMLName xml.Name `xml:"graphml"`
+	NS      string   `xml:"xmlns,attr"`
+	Keys    []gmlKey `xml:"key"`
+	Graph   struct {
+		ID          string    `xml:"id,attr"`
+		EdgeDefault string    `xml:"edgedefault,attr"`
+		Nodes       []gmlNode `xml:"node"`
+		Edges       []gmlEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+func writeGraphML(path string, edges map[string]*edge, order []string) error {
+	g := graphML{NS: "http://graphml.graphdrawing.org/xmlns"}
+	g.Keys = []gmlKey{
+		{"role", "node", "role", "string"},
+		{"provider", "node", "provider", "string"},
+		{"calls", "edge", "calls", "int"},
+		{"duration", "edge", "duration", "double"},
+		{"first", "edge", "first_contact", "string"},
+		{"last", "edge", "last_contact", "string"},
+	}
+	g.Graph.ID = "cdr"
+	g.Graph.EdgeDefault = "undirected"
+	seen := map[string]bool{}
+	for _, b := range order {
+		e := edges[b]
+		if !seen[e.Target] {
+			seen[e.Target] = true
+			g.Graph.Nodes = append(g.Graph.Nodes, gmlNode{ID: e.Target, Data: []gmlData{{"role", "target"}}})
+		}
+		if !seen[b] {
+			seen[b] = true
+			g.Graph.Nodes = append(g.Graph.Nodes, gmlNode{ID: b, Data: []gmlData{{"role", "b_party"}, {"provider", e.Provider}}})
+		}
+		g.Graph.Edges = append(g.Graph.Edges, gmlEdge{Source: e.Target, Target: b, Data: []gmlData{
+			{"calls", strconv.Itoa(e.Calls)},
+			{"duration", fmt.Sprintf("%.0f", e.Duration)},
+			{"first", stamp(e.First)},
+			{"last", stamp(e.Last)},
+		}})
+	}
+	out, err := xml.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), out...), 0o644)
+}
@@ -0,0 +1,141 @@
+// Package live keeps the cases flagged live: open investigations whose
+// targets' CDRs keep arriving through the ingest sources (watch folder,
+// SFTP, mailbox) rather than being uploaded one by one. A file ingested
+// for a target of a live case extends the case's consolidated reports, as
+// an upload with append_case does, and the case's subscribers are sent
+// the regenerated reports.
+//
+// The flags are kept in cases/live.json.
+package live
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Dir holds the live case flags.
+const Dir = "cases"
+
+// ErrNotFound reports a case that is not flagged live.
+var ErrNotFound = errors.New("case is not live")
+
+// Case is a case flagged live.
+type Case struct {
+	Tenant      string    `json:"tenant,omitempty"`
+	Crime       string    `json:"crime"`
+	Targets     []string  `json:"targets,omitempty"`     // numbers followed; none for every number the case has jobs for
+	Subscribers []string  `json:"subscribers,omitempty"` // addresses the regenerated reports are mailed to
+	Since       time.Time `json:"since"`
+}
+
+// Follows reports whether c follows number. A case naming no targets
+// follows the numbers of its jobs, which numbers lists.
+func (c Case) Follows(number string, numbers func() []string) bool {
+	targets := c.Targets
+	if len(targets) == 0 {
+		targets = numbers()
+	}
+	return slices.ContainsFunc(targets, func(t string) bool { return sameNumber(t, number) })
+}
+
+// sameNumber compares two numbers without their country or trunk prefix,
+// as exports write a target either way.
+func sameNumber(a, b string) bool {
+	if len(a) < 10 || len(b) < 10 {
+		return a == b
+	}
+	return a[len(a)-10:] == b[len(b)-10:]
+}
+
+var mu sync.Mutex
+
+func path() string { return filepath.Join(Dir, "live.json") }
+
+func load() ([]Case, error) {
+	b, err := os.ReadFile(path())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	return cases, json.Unmarshal(b, &cases)
+}
+
+func save(cases []Case) error {
+	if err := os.MkdirAll(Dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(cases, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path())
+}
+
+// List returns every live case of tenant.
+func List(tenant string) ([]Case, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	cases, err := load()
+	return slices.DeleteFunc(cases, func(c Case) bool { return c.Tenant != tenant }), err
+}
+
+// Get returns the case crime of tenant, or ErrNotFound if it is not live.
+func Get(tenant, crime string) (*Case, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	cases, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if i := index(cases, tenant, crime); i >= 0 {
+		return &cases[i], nil
+	}
+	return nil, ErrNotFound
+}
+
+// Set flags c live, replacing what was kept for the same case.
+func Set(c Case) error {
+	mu.Lock()
+	defer mu.Unlock()
+	cases, err := load()
+	if err != nil {
+		return err
+	}
+	if i := index(cases, c.Tenant, c.Crime); i >= 0 {
+		cases[i] = c
+	} else {
+		cases = append(cases, c)
+	}
+	return save(cases)
+}
+
+// Remove takes the live flag off a case; ErrNotFound if it had none.
+func Remove(tenant, crime string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	cases, err := load()
+	if err != nil {
+		return err
+	}
+	i := index(cases, tenant, crime)
+	if i < 0 {
+		return ErrNotFound
+	}
+	return save(slices.Delete(cases, i, i+1))
+}
+
+func index(cases []Case, tenant, crime string) int {
+	return slices.IndexFunc(cases, func(c Case) bool { return c.Tenant == tenant && c.Crime == crime })
+}
@@ -0,0 +1,130 @@
+// Package mailer emails a finished job's reports to the addresses given
+// with the upload, so officers get results without returning to the
+// portal. It uses the same relay as mail-ingestion replies:
+//
+//	CDR_SMTP_ADDR      host:port of the relay; mailing is off when empty
+//	CDR_SMTP_FROM      sender (default CDR_SMTP_USER)
+//	CDR_SMTP_USER      relay login, if it requires one
+//	CDR_SMTP_PASSWORD  password for CDR_SMTP_USER
+//	CDR_PUBLIC_URL     base of the download links (default http://localhost:8080)
+//	CDR_MAIL_ATTACH    1 to attach the CSV reports as well, up to 10 MB in all
+//
+// Links are signed when download links expire (see dlink).
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/atrest"
+	"github.com/jalad-shrimali/cdr-filter/internal/dlink"
+)
+
+// maxAttach bounds the attachments of one mail; reports beyond it are
+// only linked.
+const maxAttach = 10 << 20
+
+// Enabled reports whether a relay is configured.
+func Enabled() bool { return os.Getenv("CDR_SMTP_ADDR") != "" }
+
+// ParseAddresses splits a comma-separated recipient list, e.g. the
+// upload's email field. An empty list is valid.
+func ParseAddresses(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	list, err := mail.ParseAddressList(s)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(list))
+	for i, a := range list {
+		out[i] = a.Address
+	}
+	return out, nil
+}
+
+// Send mails the links to outputs, and the CSV reports themselves when
+// CDR_MAIL_ATTACH=1, to each address in to.
+func Send(to []string, subject string, outputs []string) error {
+	addr := os.Getenv("CDR_SMTP_ADDR")
+	if addr == "" {
+		return errors.New("CDR_SMTP_ADDR is not set")
+	}
+	user := os.Getenv("CDR_SMTP_USER")
+	from := os.Getenv("CDR_SMTP_FROM")
+	if from == "" {
+		from = user
+	}
+	if from == "" {
+		return errors.New("CDR_SMTP_FROM is not set")
+	}
+
+	var text strings.Builder
+	text.WriteString("The CDR reports are ready:\r\n\r\n")
+	for _, p := range outputs {
+		fmt.Fprintf(&text, "  %s\r\n", dlink.URL(dlink.Name(p)))
+	}
+	if dlink.Enabled() {
+		fmt.Fprintf(&text, "\r\nThe links expire after %s.\r\n", dlink.TTL())
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	part.Write([]byte(text.String()))
+	if os.Getenv("CDR_MAIL_ATTACH") == "1" {
+		total := 0
+		for _, p := range outputs {
+			if filepath.Ext(p) != ".csv" {
+				continue
+			}
+			data, err := atrest.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			if total += len(data); total > maxAttach {
+				break
+			}
+			name := filepath.Base(p)
+			part, _ := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {mime.FormatMediaType("text/csv", map[string]string{"name": name})},
+				"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+				"Content-Transfer-Encoding": {"base64"},
+			})
+			enc := base64.StdEncoding.EncodeToString(data)
+			for len(enc) > 76 {
+				part.Write([]byte(enc[:76] + "\r\n"))
+				enc = enc[76:]
+			}
+			part.Write([]byte(enc + "\r\n"))
+		}
+	}
+	mw.Close()
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+
+	var auth smtp.Auth
+	if pw := os.Getenv("CDR_SMTP_PASSWORD"); user != "" && pw != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", user, pw, host)
+	}
+	return smtp.SendMail(addr, auth, from, to, msg.Bytes())
+}
@@ -0,0 +1,162 @@
+// Package maltego serves Maltego TRX-compatible transforms over the reports
+// of stored jobs, so analysts can pivot on processed CDR data.
+//
+//	POST /maltego/contacts  phone number → numbers it exchanged calls with
+//	POST /maltego/towers    phone number → towers it was seen on
+package maltego
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+)
+
+/* request / response envelopes (subset of the TRX schema) */
+type field struct {
+	Name        string `xml:"Name,attr"`
+	DisplayName string `xml:"DisplayName,attr,omitempty"`
+	Value       string `xml:",chardata"`
+}
+type entity struct {
+	Type   string  `xml:"Type,attr"`
+	Value  string  `xml:"Value"`
+	Weight int     `xml:"Weight,omitempty"`
+	Fields []field `xml:"AdditionalFields>Field,omitempty"`
+}
+type request struct {
+	Entities []entity `xml:"MaltegoTransformRequestMessage>Entities>Entity"`
+}
+type response struct {
+	XMLName  xml.Name `xml:"MaltegoMessage"`
+	Entities []entity `xml:"MaltegoTransformResponseMessage>Entities>Entity"`
+	Messages []field  `xml:"MaltegoTransformResponseMessage>UIMessages>UIMessage"`
+}
+
+// Register adds the transform routes to mux.
+func Register(mux *http.ServeMux) {
+	mux.HandleFunc("/maltego/contacts", transform(contacts))
+	mux.HandleFunc("/maltego/towers", transform(towers))
+}
+
+func transform(run func(tenant, number string) ([]entity, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		number := r.URL.Query().Get("number")
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			var req request
+			if xml.Unmarshal(body, &req) == nil && len(req.Entities) > 0 {
+				number = req.Entities[0].Value
+			}
+		}
+		var resp response
+		if canon.Last10(number) == "" {
+			resp.Messages = []field{{Name: "FatalError", Value: "no phone number supplied"}}
+		} else if ents, err := run(tenant.Of(r), number); err != nil {
+			resp.Messages = []field{{Name: "PartialError", Value: err.Error()}}
+		} else {
+			resp.Entities = ents
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		io.WriteString(w, xml.Header)
+		xml.NewEncoder(w).Encode(resp)
+	}
+}
+
+// eachRow calls fn for every row of every stored main report of tenant.
+func eachRow(tenant string, fn func(col map[string]int, row []string)) error {
+	list, err := jobs.List()
+	if err != nil {
+		return err
+	}
+	for _, j := range list {
+		if j.Status != "done" || len(j.Outputs) == 0 || j.Tenant != tenant {
+			continue
+		}
+		header, rows, err := canon.ReadReport(jobs.Records(j))
+		if err != nil {
+			continue // purged or unreadable
+		}
+		col := canon.Index(header)
+		for _, row := range rows {
+			fn(col, row)
+		}
+	}
+	return nil
+}
+
+func contacts(tenant, number string) ([]entity, error) {
+	want := canon.Last10(number)
+	counts := map[string]int{}
+	err := eachRow(tenant, func(col map[string]int, row []string) {
+		a, b := canon.Get(row, col, "CdrNo"), canon.Get(row, col, "B Party")
+		switch {
+		case canon.Last10(a) == want && b != "":
+			counts[b]++
+		case canon.Last10(b) == want && a != "":
+			counts[a]++
+		}
+	})
+	var out []entity
+	for n, c := range counts {
+		out = append(out, entity{
+			Type: "maltego.PhoneNumber", Value: n, Weight: c,
+			Fields: []field{{Name: "calls", DisplayName: "Calls", Value: strconv.Itoa(c)}},
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Weight > out[j].Weight })
+	return out, err
+}
+
+func towers(tenant, number string) ([]entity, error) {
+	want := canon.Last10(number)
+	type tower struct {
+		addr, lat, lon string
+		calls          int
+	}
+	seen := map[string]*tower{}
+	err := eachRow(tenant, func(col map[string]int, row []string) {
+		if canon.Last10(canon.Get(row, col, "CdrNo")) != want {
+			return
+		}
+		id := canon.Get(row, col, "First Cell ID")
+		if id == "" {
+			return
+		}
+		t, ok := seen[id]
+		if !ok {
+			t = &tower{addr: canon.Get(row, col, "First Cell ID Address")}
+			parts := strings.Split(canon.Get(row, col, "Lat-Long-Azimuth (First CellID)"), ",")
+			if len(parts) >= 2 {
+				t.lat, t.lon = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			}
+			seen[id] = t
+		}
+		t.calls++
+	})
+	var out []entity
+	for id, t := range seen {
+		name := t.addr
+		if name == "" {
+			name = id
+		}
+		out = append(out, entity{
+			Type: "maltego.Location", Value: name, Weight: t.calls,
+			Fields: []field{
+				{Name: "location.name", DisplayName: "Name", Value: name},
+				{Name: "cell_id", DisplayName: "Cell ID", Value: id},
+				{Name: "latitude", DisplayName: "Latitude", Value: t.lat},
+				{Name: "longitude", DisplayName: "Longitude", Value: t.lon},
+				{Name: "calls", DisplayName: "Calls", Value: strconv.Itoa(t.calls)},
+			},
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Weight > out[j].Weight })
+	return out, err
+}
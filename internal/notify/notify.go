@@ -0,0 +1,76 @@
+// Package notify posts a short message to a chat channel when a job
+// finishes or fails, for labs that process many CDRs unattended:
+//
+//	CDR_SLACK_WEBHOOK  Slack incoming-webhook URL
+//	CDR_TELEGRAM_TOKEN Telegram bot token
+//	CDR_TELEGRAM_CHAT  chat or channel ID the bot posts to
+//
+// Either or both may be configured; with neither, nothing is sent.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+type channel struct {
+	name string
+	url  string
+	body func(text string) any
+}
+
+func channels() []channel {
+	var out []channel
+	if u := os.Getenv("CDR_SLACK_WEBHOOK"); u != "" {
+		out = append(out, channel{"slack", u, func(text string) any {
+			return map[string]string{"text": text}
+		}})
+	}
+	token, chat := os.Getenv("CDR_TELEGRAM_TOKEN"), os.Getenv("CDR_TELEGRAM_CHAT")
+	if token != "" && chat != "" {
+		out = append(out, channel{"telegram", "https://api.telegram.org/bot" + token + "/sendMessage", func(text string) any {
+			return map[string]any{"chat_id": chat, "text": text, "disable_web_page_preview": true}
+		}})
+	}
+	return out
+}
+
+// Enabled reports whether any channel is configured.
+func Enabled() bool { return len(channels()) > 0 }
+
+// Send posts text to every configured channel. A channel that fails does
+// not stop the others; their errors are returned together.
+func Send(text string) error {
+	var errs []error
+	for _, c := range channels() {
+		if err := post(c.url, c.body(text)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func post(url string, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
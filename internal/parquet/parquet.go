@@ -0,0 +1,228 @@
+// Package parquet writes the normalized record set as an uncompressed
+// Parquet file so analytics tools (Spark, DuckDB, pandas) get typed columns
+// instead of guessing types from CSV.
+//
+// Every canonical column is a required UTF8 string except Duration, which is
+// an optional INT64, and a derived optional Timestamp (TIMESTAMP_MILLIS)
+// built from Date and Time.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+)
+
+/* parquet enums used here */
+const (
+	typeInt64     = 2
+	typeByteArray = 6
+
+	repRequired = 0
+	repOptional = 1
+
+	convUTF8            = 0
+	convTimestampMillis = 9
+
+	encPlain = 0
+	encRLE   = 3
+
+	pageData = 0
+
+	rowGroupSize = 100_000
+)
+
+type column struct {
+	name     string
+	typ      int32
+	rep      int32
+	conv     int32 // -1 when none
+	strs     []string
+	ints     []int64
+	present  []bool
+	optional bool
+}
+
+// WriteReport converts the main report at reportPath to
+// <prefix>_records.parquet and returns its path.
+func WriteReport(reportPath string) (string, error) {
+	header, rows, err := canon.ReadReport(reportPath)
+	if err != nil {
+		return "", err
+	}
+	col := canon.Index(header)
+	dst := strings.TrimSuffix(reportPath, "_reports.csv") + "_records.parquet"
+	return dst, Write(dst, header, rows, col)
+}
+
+// Write writes rows (canonical layout) to path.
+func Write(path string, header []string, rows [][]string, col map[string]int) error {
+	var buf bytes.Buffer
+	buf.WriteString("PAR1")
+
+	type chunkMeta struct {
+		c            *column
+		offset, size int64
+		n            int
+	}
+	var groups [][]chunkMeta
+	var groupRows []int
+	for start := 0; start < len(rows) || start == 0; start += rowGroupSize {
+		end := min(start+rowGroupSize, len(rows))
+		cols := buildColumns(header, rows[start:end], col)
+		var metas []chunkMeta
+		for _, c := range cols {
+			off := int64(buf.Len())
+			writePage(&buf, c, end-start)
+			metas = append(metas, chunkMeta{c, off, int64(buf.Len()) - off, end - start})
+		}
+		groups = append(groups, metas)
+		groupRows = append(groupRows, end-start)
+		if end == len(rows) {
+			break
+		}
+	}
+
+	// FileMetaData
+	schema := groups[0]
+	w := &tw{}
+	w.begin()
+	w.i32(1, 1)
+	w.structElems(2, len(schema)+1, func(i int) {
+		if i == 0 {
+			w.str(4, "schema")
+			w.i32(5, int32(len(schema)))
+			return
+		}
+		c := schema[i-1].c
+		w.i32(1, c.typ)
+		w.i32(3, c.rep)
+		w.str(4, c.name)
+		if c.conv >= 0 {
+			w.i32(6, c.conv)
+		}
+	})
+	w.i64(3, int64(len(rows)))
+	w.structElems(4, len(groups), func(g int) {
+		var total int64
+		for _, m := range groups[g] {
+			total += m.size
+		}
+		w.structElems(1, len(groups[g]), func(i int) {
+			m := groups[g][i]
+			w.i64(2, m.offset)
+			w.structField(3, func() {
+				w.i32(1, m.c.typ)
+				w.i32List(2, encPlain, encRLE)
+				w.strList(3, m.c.name)
+				w.i32(4, 0) // UNCOMPRESSED
+				w.i64(5, int64(m.n))
+				w.i64(6, m.size)
+				w.i64(7, m.size)
+				w.i64(9, m.offset)
+			})
+		})
+		w.i64(2, total)
+		w.i64(3, int64(groupRows[g]))
+	})
+	w.str(6, "cdr-filter")
+	w.end()
+
+	footer := w.buf.Bytes()
+	buf.Write(footer)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(footer)))
+	buf.WriteString("PAR1")
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+func buildColumns(header []string, rows [][]string, col map[string]int) []*column {
+	var cols []*column
+	for _, h := range header {
+		c := &column{name: canon.FieldName(h), typ: typeByteArray, rep: repRequired, conv: convUTF8}
+		if h == "Duration" {
+			c.typ, c.rep, c.conv, c.optional = typeInt64, repOptional, -1, true
+		}
+		i := col[h]
+		for _, row := range rows {
+			v := ""
+			if i < len(row) {
+				v = row[i]
+			}
+			if c.optional {
+				n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+				c.present = append(c.present, err == nil)
+				if err == nil {
+					c.ints = append(c.ints, n)
+				}
+			} else {
+				c.strs = append(c.strs, v)
+			}
+		}
+		cols = append(cols, c)
+	}
+	ts := &column{name: "timestamp", typ: typeInt64, rep: repOptional, conv: convTimestampMillis, optional: true}
+	for _, row := range rows {
+		at, ok := canon.ParseDateTime(canon.Get(row, col, "Date"), canon.Get(row, col, "Time"))
+		ts.present = append(ts.present, ok)
+		if ok {
+			ts.ints = append(ts.ints, at.UnixMilli())
+		}
+	}
+	return append(cols, ts)
+}
+
+// writePage writes one v1 data page (header + body) for c.
+func writePage(buf *bytes.Buffer, c *column, n int) {
+	var body bytes.Buffer
+	if c.optional {
+		levels := bitPackedLevels(c.present)
+		binary.Write(&body, binary.LittleEndian, uint32(len(levels)))
+		body.Write(levels)
+	}
+	if c.typ == typeByteArray {
+		for _, s := range c.strs {
+			binary.Write(&body, binary.LittleEndian, uint32(len(s)))
+			body.WriteString(s)
+		}
+	} else {
+		for _, v := range c.ints {
+			binary.Write(&body, binary.LittleEndian, v)
+		}
+	}
+
+	h := &tw{}
+	h.begin()
+	h.i32(1, pageData)
+	h.i32(2, int32(body.Len()))
+	h.i32(3, int32(body.Len()))
+	h.structField(5, func() {
+		h.i32(1, int32(n))
+		h.i32(2, encPlain)
+		h.i32(3, encRLE)
+		h.i32(4, encRLE)
+	})
+	h.end()
+	buf.Write(h.buf.Bytes())
+	buf.Write(body.Bytes())
+}
+
+// bitPackedLevels encodes 0/1 definition levels as a single bit-packed run
+// of the RLE/bit-packing hybrid encoding (bit width 1).
+func bitPackedLevels(present []bool) []byte {
+	groups := (len(present) + 7) / 8
+	var out bytes.Buffer
+	var hdr [binary.MaxVarintLen64]byte
+	out.Write(hdr[:binary.PutUvarint(hdr[:], uint64(groups)<<1|1)])
+	packed := make([]byte, groups)
+	for i, p := range present {
+		if p {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	out.Write(packed)
+	return out.Bytes()
+}
@@ -0,0 +1,95 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+/* minimal Thrift compact-protocol encoder, enough for Parquet metadata */
+
+const (
+	tI32    = 5
+	tI64    = 6
+	tBinary = 8
+	tList   = 9
+	tStruct = 12
+)
+
+type tw struct {
+	buf  bytes.Buffer
+	last []int16 // last field id per open struct
+}
+
+func (w *tw) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func zigzag(v int64) uint64 { return uint64((v << 1) ^ (v >> 63)) }
+
+func (w *tw) begin() { w.last = append(w.last, 0) }
+func (w *tw) end() {
+	w.buf.WriteByte(0) // STOP
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *tw) field(id int16, typ byte) {
+	top := &w.last[len(w.last)-1]
+	if d := id - *top; d > 0 && d <= 15 {
+		w.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(zigzag(int64(id)))
+	}
+	*top = id
+}
+
+func (w *tw) i32(id int16, v int32) { w.field(id, tI32); w.varint(zigzag(int64(v))) }
+func (w *tw) i64(id int16, v int64) { w.field(id, tI64); w.varint(zigzag(v)) }
+func (w *tw) str(id int16, s string) {
+	w.field(id, tBinary)
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *tw) listHeader(id int16, elem byte, n int) {
+	w.field(id, tList)
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		w.buf.WriteByte(0xF0 | elem)
+		w.varint(uint64(n))
+	}
+}
+
+func (w *tw) structField(id int16, body func()) {
+	w.field(id, tStruct)
+	w.begin()
+	body()
+	w.end()
+}
+
+// structElems writes a list<struct> field.
+func (w *tw) structElems(id int16, n int, elem func(i int)) {
+	w.listHeader(id, tStruct, n)
+	for i := 0; i < n; i++ {
+		w.begin()
+		elem(i)
+		w.end()
+	}
+}
+
+func (w *tw) i32List(id int16, vs ...int32) {
+	w.listHeader(id, tI32, len(vs))
+	for _, v := range vs {
+		w.varint(zigzag(int64(v)))
+	}
+}
+
+func (w *tw) strList(id int16, vs ...string) {
+	w.listHeader(id, tBinary, len(vs))
+	for _, v := range vs {
+		w.varint(uint64(len(v)))
+		w.buf.WriteString(v)
+	}
+}
@@ -0,0 +1,530 @@
+package pdftable
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// PDF objects as parsed: name, []byte for strings, float64 for numbers,
+// bool, nil for null, array, dict, ref, *stream, and keyword for the
+// operators of content streams.
+type (
+	name    string
+	keyword string
+	array   []any
+	dict    map[name]any
+	ref     struct{ num, gen int }
+)
+
+type stream struct {
+	dict dict
+	raw  []byte // as stored, before its filters
+}
+
+// lexer reads PDF syntax from b.
+type lexer struct {
+	b []byte
+	i int
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelim(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (l *lexer) skipSpace() {
+	for l.i < len(l.b) {
+		switch c := l.b[l.i]; {
+		case isSpace(c):
+			l.i++
+		case c == '%':
+			for l.i < len(l.b) && l.b[l.i] != '\n' && l.b[l.i] != '\r' {
+				l.i++
+			}
+		default:
+			return
+		}
+	}
+}
+
+var errEOF = errors.New("unexpected end of data")
+
+// token returns the next simple value, or a keyword for delimiters such as
+// "[" and "<<" and for bare words.
+func (l *lexer) token() (any, error) {
+	l.skipSpace()
+	if l.i >= len(l.b) {
+		return nil, io.EOF
+	}
+	c := l.b[l.i]
+	switch {
+	case c == '(':
+		return l.literal()
+	case c == '<' && l.i+1 < len(l.b) && l.b[l.i+1] == '<':
+		l.i += 2
+		return keyword("<<"), nil
+	case c == '>' && l.i+1 < len(l.b) && l.b[l.i+1] == '>':
+		l.i += 2
+		return keyword(">>"), nil
+	case c == '<':
+		return l.hexString()
+	case c == '/':
+		return l.name(), nil
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		l.i++
+		return keyword(c), nil
+	}
+	start := l.i
+	for l.i < len(l.b) && !isSpace(l.b[l.i]) && !isDelim(l.b[l.i]) {
+		l.i++
+	}
+	if l.i == start { // a stray ) or >
+		l.i++
+		return keyword(l.b[start:l.i]), nil
+	}
+	w := string(l.b[start:l.i])
+	if f, err := strconv.ParseFloat(w, 64); err == nil && (w[0] < 'A' || w[0] == '.') {
+		return f, nil
+	}
+	switch w {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return keyword(w), nil
+}
+
+func (l *lexer) name() name {
+	l.i++ // '/'
+	var b []byte
+	for l.i < len(l.b) && !isSpace(l.b[l.i]) && !isDelim(l.b[l.i]) {
+		if l.b[l.i] == '#' && l.i+2 < len(l.b) {
+			if v, err := hex.DecodeString(string(l.b[l.i+1 : l.i+3])); err == nil {
+				b = append(b, v[0])
+				l.i += 3
+				continue
+			}
+		}
+		b = append(b, l.b[l.i])
+		l.i++
+	}
+	return name(b)
+}
+
+func (l *lexer) literal() ([]byte, error) {
+	l.i++ // '('
+	var out []byte
+	depth := 1
+	for l.i < len(l.b) {
+		c := l.b[l.i]
+		l.i++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return out, nil
+			}
+		case '\\':
+			if l.i >= len(l.b) {
+				return nil, errEOF
+			}
+			e := l.b[l.i]
+			l.i++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.i < len(l.b) && l.b[l.i] == '\n' {
+					l.i++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for n := 1; n < 3 && l.i < len(l.b) && l.b[l.i] >= '0' && l.b[l.i] <= '7'; n++ {
+						v = v*8 + int(l.b[l.i]-'0')
+						l.i++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return nil, errEOF
+}
+
+func (l *lexer) hexString() ([]byte, error) {
+	l.i++ // '<'
+	var digits []byte
+	for l.i < len(l.b) && l.b[l.i] != '>' {
+		if !isSpace(l.b[l.i]) {
+			digits = append(digits, l.b[l.i])
+		}
+		l.i++
+	}
+	if l.i >= len(l.b) {
+		return nil, errEOF
+	}
+	l.i++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	return hex.DecodeString(string(digits))
+}
+
+// object reads one value, arrays and dictionaries whole and "n g R" as a
+// ref. Keywords are returned as such, for content streams.
+func (l *lexer) object() (any, error) {
+	t, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case keyword("["):
+		var a array
+		for {
+			l.skipSpace()
+			if l.i < len(l.b) && l.b[l.i] == ']' {
+				l.i++
+				return a, nil
+			}
+			v, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+	case keyword("<<"):
+		d := dict{}
+		for {
+			k, err := l.token()
+			if err != nil {
+				return nil, err
+			}
+			if k == keyword(">>") {
+				return d, nil
+			}
+			n, ok := k.(name)
+			if !ok {
+				return nil, fmt.Errorf("dictionary key %v is not a name", k)
+			}
+			v, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			d[n] = v
+		}
+	}
+	if f, ok := t.(float64); ok && f == float64(int(f)) {
+		// maybe "n g R"
+		save := l.i
+		if g, err := l.token(); err == nil {
+			if gf, ok := g.(float64); ok {
+				if r, err := l.token(); err == nil && r == keyword("R") {
+					return ref{int(f), int(gf)}, nil
+				}
+			}
+		}
+		l.i = save
+	}
+	return t, nil
+}
+
+// document is every object of a PDF file, found by scanning for
+// "n g obj" rather than trusting the cross-reference table, which
+// operator exports get wrong often enough.
+type document struct {
+	objs map[int]any
+}
+
+var objStart = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+var errEncrypted = errors.New("encrypted PDFs are not read")
+
+func parse(data []byte) (*document, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \r\n\t"), []byte("%PDF-")) {
+		return nil, errors.New("not a PDF file")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return nil, errEncrypted
+	}
+	d := &document{objs: map[int]any{}}
+	skip := 0 // end of the last stream; its data may happen to read "n g obj"
+	for _, m := range objStart.FindAllSubmatchIndex(data, -1) {
+		if m[0] < skip {
+			continue
+		}
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		l := &lexer{b: data, i: m[1]}
+		v, err := l.object()
+		if err != nil {
+			continue
+		}
+		if dv, ok := v.(dict); ok {
+			if s, ok := d.streamAt(l, dv); ok {
+				v, skip = s, l.i
+			}
+		}
+		d.objs[num] = v // later revisions come later in the file
+	}
+	// objects kept compressed in object streams, where not also stored
+	// in the open
+	for _, v := range d.objs {
+		if s, ok := v.(*stream); ok && s.dict["Type"] == name("ObjStm") {
+			d.unpack(s)
+		}
+	}
+	return d, nil
+}
+
+// streamAt reads the stream data following dictionary dv, if any.
+func (d *document) streamAt(l *lexer, dv dict) (*stream, bool) {
+	save := l.i
+	l.skipSpace()
+	if !bytes.HasPrefix(l.b[l.i:], []byte("stream")) {
+		l.i = save
+		return nil, false
+	}
+	i := l.i + len("stream")
+	if i < len(l.b) && l.b[i] == '\r' {
+		i++
+	}
+	if i < len(l.b) && l.b[i] == '\n' {
+		i++
+	}
+	if n, ok := dv["Length"].(float64); ok {
+		end := i + int(n)
+		if end <= len(l.b) && end >= i {
+			rest := bytes.TrimLeft(l.b[end:min(end+16, len(l.b))], " \r\n\t")
+			if bytes.HasPrefix(rest, []byte("endstream")) {
+				l.i = end
+				return &stream{dict: dv, raw: l.b[i:end]}, true
+			}
+		}
+	}
+	// /Length given by reference or wrong: the data runs to endstream
+	end := bytes.Index(l.b[i:], []byte("endstream"))
+	if end < 0 {
+		return nil, false
+	}
+	l.i = i + end
+	raw := l.b[i : i+end]
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	return &stream{dict: dv, raw: raw}, true
+}
+
+func (d *document) unpack(s *stream) {
+	data, err := d.decode(s)
+	if err != nil {
+		return
+	}
+	n, _ := d.resolve(s.dict["N"]).(float64)
+	first, _ := d.resolve(s.dict["First"]).(float64)
+	if int(first) > len(data) {
+		return
+	}
+	l := &lexer{b: data[:int(first)]}
+	for k := 0; k < int(n); k++ {
+		num, err1 := l.token()
+		off, err2 := l.token()
+		nf, ok1 := num.(float64)
+		of, ok2 := off.(float64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			return
+		}
+		if _, ok := d.objs[int(nf)]; ok {
+			continue
+		}
+		ol := &lexer{b: data, i: int(first) + int(of)}
+		if v, err := ol.object(); err == nil {
+			d.objs[int(nf)] = v
+		}
+	}
+}
+
+// resolve follows refs to the object they name.
+func (d *document) resolve(v any) any {
+	for n := 0; n < 32; n++ {
+		r, ok := v.(ref)
+		if !ok {
+			return v
+		}
+		v = d.objs[r.num]
+	}
+	return nil
+}
+
+func (d *document) dict(v any) dict {
+	switch v := d.resolve(v).(type) {
+	case dict:
+		return v
+	case *stream:
+		return v.dict
+	}
+	return nil
+}
+
+func (d *document) array(v any) array {
+	a, _ := d.resolve(v).(array)
+	return a
+}
+
+func (d *document) number(v any, def float64) float64 {
+	if f, ok := d.resolve(v).(float64); ok {
+		return f
+	}
+	return def
+}
+
+// decode returns the data of s with its filters undone.
+func (d *document) decode(s *stream) ([]byte, error) {
+	data := s.raw
+	var filters array
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case name:
+		filters = array{f}
+	case array:
+		filters = f
+	}
+	parms := d.resolve(s.dict["DecodeParms"])
+	for i, f := range filters {
+		var p dict
+		if a, ok := parms.(array); ok && i < len(a) {
+			p = d.dict(a[i])
+		} else {
+			p = d.dict(parms)
+		}
+		var err error
+		switch d.resolve(f) {
+		case name("FlateDecode"), name("Fl"):
+			data, err = inflate(data)
+			if err == nil && d.number(p["Predictor"], 1) >= 10 {
+				data, err = unpredict(data, int(d.number(p["Columns"], 1)))
+			}
+		case name("ASCII85Decode"), name("A85"):
+			data, err = unascii85(data)
+		case name("ASCIIHexDecode"), name("AHx"):
+			data, err = unhex(data)
+		default:
+			return nil, fmt.Errorf("stream filter %v is not supported", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func inflate(b []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		// a few writers leave the zlib header out
+		return io.ReadAll(flate.NewReader(bytes.NewReader(b)))
+	}
+	out, err := io.ReadAll(r)
+	if err != nil && len(out) > 0 {
+		// truncated or missing checksum: keep what inflated
+		return out, nil
+	}
+	return out, err
+}
+
+// unpredict undoes the PNG row predictors Flate data may be stored with.
+func unpredict(b []byte, columns int) ([]byte, error) {
+	row := columns + 1
+	if columns < 1 || len(b)%row != 0 {
+		return nil, errors.New("bad predictor data")
+	}
+	out := make([]byte, 0, len(b)/row*columns)
+	prev := make([]byte, columns)
+	for i := 0; i < len(b); i += row {
+		cur := append([]byte(nil), b[i+1:i+row]...)
+		for j := range cur {
+			var left, up, ul byte
+			if j > 0 {
+				left, ul = cur[j-1], prev[j-1]
+			}
+			up = prev[j]
+			switch b[i] {
+			case 1:
+				cur[j] += left
+			case 2:
+				cur[j] += up
+			case 3:
+				cur[j] += byte((int(left) + int(up)) / 2)
+			case 4:
+				cur[j] += paeth(left, up, ul)
+			}
+		}
+		out = append(out, cur...)
+		prev = cur
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func unhex(b []byte) ([]byte, error) {
+	if i := bytes.IndexByte(b, '>'); i >= 0 {
+		b = b[:i]
+	}
+	l := &lexer{b: append(append([]byte("<"), b...), '>')}
+	return l.hexString()
+}
+
+func unascii85(b []byte) ([]byte, error) {
+	b = bytes.TrimSpace(b)
+	b = bytes.TrimPrefix(b, []byte("<~"))
+	if i := bytes.Index(b, []byte("~>")); i >= 0 {
+		b = b[:i]
+	}
+	out := make([]byte, len(b))
+	n, _, err := ascii85.Decode(out, b, true)
+	return out[:n], err
+}
@@ -0,0 +1,398 @@
+// Package pdftable reads the table of a PDF export back into rows of
+// cells, the way the export reads once saved as CSV, for operators that
+// send CDRs as PDF print-outs. PDF keeps no table, only text placed on the
+// page, so the rows and columns are rebuilt from where the text sits:
+//
+//   - characters on one baseline make a line, split into pieces where
+//     the gap between them is wider than a word space;
+//   - the first line of three or more pieces holding a long number is
+//     the first record, and the lines of pieces just above it the header;
+//   - columns are the spans the header, or enough records, cover, and
+//     each piece goes to the column it overlaps most.
+//
+// Lines above the header are returned as rows of their pieces, so a
+// target number given in the banner is still found. Lines on every page,
+// such as a title or "Page 2 of 5", and the header where a page repeats
+// it, are dropped. A record wrapped onto a second line is joined back.
+//
+// The reading is a guess where the layout is unclear, and each cell
+// guessed is reported as a Doubt: a piece straddling two columns, a
+// wrapped line joined back, or characters the PDF gives no text for.
+//
+// Only the text the PDF holds is read, including the hidden text layer
+// OCR software adds to scanned pages. Pages that are images alone need
+// OCR first; Read returns ErrNoText for them. Encrypted PDFs are not read.
+package pdftable
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrNoText reports a PDF with no text to read, such as scanned pages
+// without an OCR text layer.
+var ErrNoText = errors.New("the PDF holds no text; scanned pages need OCR first")
+
+// Is reports whether f starts like a PDF file.
+func Is(f io.ReaderAt) bool {
+	b := make([]byte, 5)
+	n, _ := f.ReadAt(b, 0)
+	return string(b[:n]) == "%PDF-"
+}
+
+// Table is a PDF export read back into rows. Every row is as wide as
+// the widest, blank cells being "".
+type Table struct {
+	Rows   [][]string
+	Doubts []Doubt // cells read with low confidence
+}
+
+// Doubt is a cell of a Table that may not read as the PDF shows it.
+type Doubt struct {
+	Page, Row, Column int // Row and Column count Table.Rows from 1
+	Text              string
+	Why               string
+}
+
+func (d Doubt) String() string {
+	return fmt.Sprintf("page %d, row %d, column %d %q: %s", d.Page, d.Row, d.Column, d.Text, d.Why)
+}
+
+// Read reads the table of the PDF file r, size bytes long.
+func Read(r io.ReaderAt, size int64) (*Table, error) {
+	data := make([]byte, size)
+	if n, err := r.ReadAt(data, 0); n < len(data) {
+		return nil, err
+	}
+	d, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	pages := d.pages()
+	if len(pages) == 0 {
+		return nil, errors.New("no pages found in the PDF")
+	}
+	var ls []line
+	for i, p := range pages {
+		ls = append(ls, lines(d.glyphs(p), i+1)...)
+	}
+	if len(ls) == 0 {
+		return nil, ErrNoText
+	}
+	return layout(dropRepeats(ls, len(pages)))
+}
+
+// piece is text on a line with no more than a word space inside it.
+type piece struct {
+	x0, x1 float64
+	text   string
+}
+
+type line struct {
+	page    int
+	y, size float64
+	pieces  []piece
+}
+
+func (l line) texts() []string {
+	out := make([]string, len(l.pieces))
+	for i, p := range l.pieces {
+		out[i] = p.text
+	}
+	return out
+}
+
+func (l line) key() string { return strings.Join(l.texts(), "\t") }
+
+// lines groups the glyphs of a page by baseline, top to bottom.
+func lines(gs []glyph, page int) []line {
+	gs = slices.DeleteFunc(gs, func(g glyph) bool { return strings.TrimSpace(g.text) == "" })
+	slices.SortStableFunc(gs, func(a, b glyph) int { return cmpFloat(b.y, a.y) })
+	var out []line
+	for i := 0; i < len(gs); {
+		j := i + 1
+		for j < len(gs) && gs[i].y-gs[j].y <= 0.35*gs[i].size {
+			j++
+		}
+		row := gs[i:j]
+		slices.SortStableFunc(row, func(a, b glyph) int { return cmpFloat(a.x0, b.x0) })
+		l := line{page: page, y: gs[i].y}
+		var text strings.Builder
+		var prev glyph
+		for k, g := range row {
+			l.size = math.Max(l.size, g.size)
+			if k > 0 && g.text == prev.text && math.Abs(g.x0-prev.x0) < 0.2*g.size {
+				continue // printed twice over, for bold
+			}
+			gap := g.x0 - prev.x1
+			switch {
+			case k == 0:
+			case gap > math.Max(1.5*prev.space, 0.3*prev.size):
+				l.pieces[len(l.pieces)-1].text = text.String()
+				text.Reset()
+			case gap > 0.3*prev.space:
+				text.WriteByte(' ')
+			}
+			if k == 0 || text.Len() == 0 {
+				l.pieces = append(l.pieces, piece{x0: g.x0})
+			}
+			text.WriteString(g.text)
+			l.pieces[len(l.pieces)-1].x1 = g.x1
+			prev = g
+		}
+		l.pieces[len(l.pieces)-1].text = text.String()
+		out = append(out, l)
+		i = j
+	}
+	return out
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+var digits = regexp.MustCompile(`\d+`)
+
+// dropRepeats drops the one-piece lines found on every page, numbers
+// aside: titles, and footers such as "Page 2 of 5".
+func dropRepeats(ls []line, pages int) []line {
+	if pages < 2 {
+		return ls
+	}
+	on := map[string]map[int]bool{}
+	key := func(l line) string { return strings.TrimSpace(digits.ReplaceAllString(l.pieces[0].text, "")) }
+	for _, l := range ls {
+		if len(l.pieces) == 1 {
+			if on[key(l)] == nil {
+				on[key(l)] = map[int]bool{}
+			}
+			on[key(l)][l.page] = true
+		}
+	}
+	return slices.DeleteFunc(ls, func(l line) bool { return len(l.pieces) == 1 && len(on[key(l)]) == pages })
+}
+
+var longNumber = regexp.MustCompile(`\d{6}`)
+
+// record reports whether l looks like a record of the table.
+func record(l line) bool {
+	return len(l.pieces) >= 3 && longNumber.MatchString(l.key())
+}
+
+// layout rebuilds the rows of a document's lines.
+func layout(ls []line) (*Table, error) {
+	first := slices.IndexFunc(ls, record)
+	if first < 0 {
+		return nil, errors.New("no table found in the PDF")
+	}
+	h := first
+	for h > 0 && first-h < 4 {
+		l, below := ls[h-1], ls[h]
+		if l.page != below.page || len(l.pieces) < 2 || longNumber.MatchString(l.key()) ||
+			l.y-below.y > 2.5*math.Max(l.size, below.size) {
+			break
+		}
+		h--
+	}
+	t := &Table{}
+	var pages []int           // of each row
+	seen := map[string]bool{} // banner and header lines, to drop where pages repeat them
+	add := func(row []string, page int, doubts []straddle) {
+		t.Rows, pages = append(t.Rows, row), append(pages, page)
+		for _, d := range doubts {
+			t.doubt(page, len(t.Rows)-1, d.column, d.why)
+		}
+	}
+	for _, l := range ls[:h] {
+		add(l.texts(), l.page, nil)
+		seen[l.key()] = true
+	}
+	bounds := columns(ls[h:first], ls[first:])
+	if first > h {
+		row := make([]string, len(bounds)+1)
+		var doubts []straddle
+		for _, l := range ls[h:first] {
+			cells, ds := assign(l, bounds)
+			for c, text := range cells {
+				row[c] = join(row[c], text)
+			}
+			doubts = append(doubts, ds...)
+			seen[l.key()] = true
+		}
+		add(row, ls[h].page, doubts)
+	}
+	var prev line
+	last := -1 // row of the last record, while the next line may continue it
+	for _, l := range ls[first:] {
+		if seen[l.key()] {
+			last = -1
+			continue
+		}
+		cells, doubts := assign(l, bounds)
+		filled := 0
+		for _, c := range cells {
+			if c != "" {
+				filled++
+			}
+		}
+		if last >= 0 && l.page == prev.page && prev.y-l.y <= 1.6*math.Max(l.size, prev.size) &&
+			cells[0] == "" && filled <= len(cells)/2 {
+			for c, text := range cells {
+				if text != "" {
+					t.Rows[last][c] = join(t.Rows[last][c], text)
+					t.doubt(l.page, last, c, "joined with the line above")
+				}
+			}
+			for _, d := range doubts {
+				t.doubt(l.page, last, d.column, d.why)
+			}
+			prev = l
+			continue
+		}
+		if len(l.pieces) == 1 && !record(l) {
+			add([]string{l.pieces[0].text}, l.page, nil) // a note or footer
+			last = -1
+			continue
+		}
+		add(cells, l.page, doubts)
+		last, prev = len(t.Rows)-1, l
+	}
+	width := 0
+	for _, row := range t.Rows {
+		width = max(width, len(row))
+	}
+	for r, row := range t.Rows {
+		t.Rows[r] = append(row, make([]string, width-len(row))...)
+		for c, text := range row {
+			if strings.Contains(text, unmapped) {
+				t.doubt(pages[r], r, c, "characters the PDF gives no text for")
+			}
+		}
+	}
+	return t, nil
+}
+
+// join appends text to a cell, with a space unless it continues a number
+// or a path broken over two lines.
+func join(cell, text string) string {
+	switch {
+	case cell == "":
+		return text
+	case text == "":
+		return cell
+	case strings.HasSuffix(cell, "/") || strings.HasSuffix(cell, "-") ||
+		isDigit(cell[len(cell)-1]) && isDigit(text[0]):
+		return cell + text
+	}
+	return cell + " " + text
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// doubt records row r, column c (0-based) as read with low confidence.
+func (t *Table) doubt(page, r, c int, why string) {
+	t.Doubts = append(t.Doubts, Doubt{Page: page, Row: r + 1, Column: c + 1, Text: t.Rows[r][c], Why: why})
+}
+
+// columns returns the boundaries between the table's columns: the middle
+// of each gap between the spans the header lines, or enough of the
+// records, cover with text.
+func columns(header, body []line) []float64 {
+	const bin = 0.5 // points
+	lo, hi := math.Inf(1), math.Inf(-1)
+	var ls []line
+	for _, l := range append(slices.Clip(header), body...) {
+		if len(l.pieces) < 2 {
+			continue
+		}
+		ls = append(ls, l)
+		lo = math.Min(lo, l.pieces[0].x0)
+		hi = math.Max(hi, l.pieces[len(l.pieces)-1].x1)
+	}
+	if len(ls) == 0 {
+		return nil
+	}
+	n := int((hi-lo)/bin) + 1
+	covered := make([]int, n)
+	var records int
+	for i, l := range ls {
+		weight := 1
+		if i < len(header) {
+			weight = n // a header cell is a column on its own
+		} else {
+			records++
+		}
+		for _, p := range l.pieces {
+			for b := int((p.x0 - lo) / bin); b < n && float64(b)*bin+lo < p.x1; b++ {
+				covered[b] += weight
+			}
+		}
+	}
+	need := max(2, records/10)
+	if records < 2 {
+		need = 1
+	}
+	var bounds []float64
+	gap := -1 // first bin of the current gap
+	for b, c := range covered {
+		switch {
+		case c < need && gap < 0:
+			gap = b
+		case c >= need && gap >= 0:
+			bounds = append(bounds, lo+bin*float64(gap+b)/2)
+			gap = -1
+		case c >= need:
+			gap = -1
+		}
+	}
+	return bounds
+}
+
+// straddle is a piece of a line overlapping a second column.
+type straddle struct {
+	column int
+	why    string
+}
+
+// assign cuts l into the columns bounds divides, joining pieces that
+// fall in one column, and returns the cells and the pieces straddling
+// two columns.
+func assign(l line, bounds []float64) ([]string, []straddle) {
+	cells := make([]string, len(bounds)+1)
+	var doubts []straddle
+	for _, p := range l.pieces {
+		over := make([]float64, len(cells))
+		best := 0
+		for c := range cells {
+			from, to := math.Inf(-1), math.Inf(1)
+			if c > 0 {
+				from = bounds[c-1]
+			}
+			if c < len(bounds) {
+				to = bounds[c]
+			}
+			over[c] = math.Min(to, p.x1) - math.Max(from, p.x0)
+			if over[c] > over[best] {
+				best = c
+			}
+		}
+		cells[best] = join(cells[best], p.text)
+		for c := range cells {
+			if c != best && over[c] > 0.25*(p.x1-p.x0) {
+				doubts = append(doubts, straddle{best, fmt.Sprintf("spans columns %d and %d", min(best, c)+1, max(best, c)+1)})
+			}
+		}
+	}
+	return cells, doubts
+}
@@ -0,0 +1,583 @@
+package pdftable
+
+import (
+	"bytes"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// font turns the strings a font shows into text and glyph widths.
+type font struct {
+	bytes  int                // code length: 1 for simple fonts, 2 for most composite ones
+	text   map[uint32]string  // code → text, from ToUnicode or the encoding
+	widths map[uint32]float64 // in thousandths of an em
+	dw     float64            // width of codes widths does not list
+	space  float64            // width of a word space
+}
+
+const unmapped = "�"
+
+func (f *font) decode(code uint32) string {
+	if t, ok := f.text[code]; ok {
+		return t
+	}
+	if f.bytes == 1 && code >= 0x20 && code < 0x7F {
+		return string(rune(code))
+	}
+	return unmapped
+}
+
+func (f *font) width(code uint32) float64 {
+	if w, ok := f.widths[code]; ok {
+		return w
+	}
+	return f.dw
+}
+
+func (d *document) font(v any) *font {
+	fd := d.dict(v)
+	f := &font{bytes: 1, text: map[uint32]string{}, widths: map[uint32]float64{}, dw: 500}
+	base, _ := d.resolve(fd["BaseFont"]).(name)
+	if strings.Contains(string(base), "Courier") {
+		f.dw = 600
+	}
+	if d.resolve(fd["Subtype"]) == name("Type0") {
+		f.bytes, f.dw = 2, 1000
+		if desc := d.array(fd["DescendantFonts"]); len(desc) > 0 {
+			cid := d.dict(desc[0])
+			f.dw = d.number(cid["DW"], 1000)
+			d.cidWidths(f, d.array(cid["W"]))
+		}
+	} else {
+		d.simpleEncoding(f, fd["Encoding"])
+		first := d.number(fd["FirstChar"], 0)
+		for i, w := range d.array(fd["Widths"]) {
+			f.widths[uint32(first)+uint32(i)] = d.number(w, f.dw)
+		}
+	}
+	if s, ok := d.resolve(fd["ToUnicode"]).(*stream); ok {
+		if data, err := d.decode(s); err == nil {
+			if n := parseCMap(data, f.text); n > 0 {
+				f.bytes = n
+			}
+		}
+	}
+	f.space = 250
+	for code, t := range f.text {
+		if t == " " {
+			f.space = f.width(code)
+			break
+		}
+	}
+	if w, ok := f.widths[32]; ok && f.bytes == 1 {
+		f.space = w
+	} else if f.dw == 600 && f.bytes == 1 {
+		f.space = 600
+	}
+	return f
+}
+
+// cidWidths reads a CID font's W array: "c [w1 w2 …]" and "c1 c2 w".
+func (d *document) cidWidths(f *font, w array) {
+	for i := 0; i < len(w); {
+		c := d.number(w[i], -1)
+		if c < 0 || i+1 >= len(w) {
+			return
+		}
+		if list, ok := d.resolve(w[i+1]).(array); ok {
+			for j, v := range list {
+				f.widths[uint32(c)+uint32(j)] = d.number(v, f.dw)
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		last, width := d.number(w[i+1], c), d.number(w[i+2], f.dw)
+		for k := c; k <= last && k-c < 65536; k++ {
+			f.widths[uint32(k)] = width
+		}
+		i += 3
+	}
+}
+
+// simpleEncoding fills f.text from a simple font's encoding: the
+// Windows code page for bytes above ASCII, and a Differences array of
+// glyph names over it.
+func (d *document) simpleEncoding(f *font, enc any) {
+	encName, _ := d.resolve(enc).(name)
+	ed := d.dict(enc)
+	if b, ok := d.resolve(ed["BaseEncoding"]).(name); ok {
+		encName = b
+	}
+	if encName == "WinAnsiEncoding" || encName == "" {
+		for c := 0xA0; c <= 0xFF; c++ {
+			f.text[uint32(c)] = string(rune(c))
+		}
+		for c, r := range cp1252 {
+			f.text[c] = string(r)
+		}
+	}
+	code := uint32(0)
+	for _, v := range d.array(ed["Differences"]) {
+		switch v := d.resolve(v).(type) {
+		case float64:
+			code = uint32(v)
+		case name:
+			if t, ok := glyphText(string(v)); ok {
+				f.text[code] = t
+			} else {
+				f.text[code] = unmapped
+			}
+			code++
+		}
+	}
+}
+
+var cp1252 = map[uint32]rune{
+	0x80: '€', 0x82: '‚', 0x84: '„', 0x85: '…', 0x91: '‘', 0x92: '’',
+	0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$",
+	"percent": "%", "ampersand": "&", "quotesingle": "'", "quoteright": "’", "quoteleft": "‘",
+	"parenleft": "(", "parenright": ")", "asterisk": "*", "plus": "+", "comma": ",",
+	"hyphen": "-", "minus": "-", "period": ".", "slash": "/", "colon": ":", "semicolon": ";",
+	"less": "<", "equal": "=", "greater": ">", "question": "?", "at": "@",
+	"bracketleft": "[", "backslash": "\\", "bracketright": "]", "asciicircum": "^",
+	"underscore": "_", "grave": "`", "braceleft": "{", "bar": "|", "braceright": "}",
+	"asciitilde": "~", "endash": "–", "emdash": "—", "bullet": "•", "degree": "°",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+}
+
+var uniName = regexp.MustCompile(`^(?:uni((?:[0-9A-F]{4})+)|u([0-9A-F]{4,6}))$`)
+
+// glyphText returns the text of a glyph name as the Adobe glyph list
+// spells the common ones.
+func glyphText(g string) (string, bool) {
+	if i := strings.IndexByte(g, '.'); i > 0 {
+		g = g[:i] // variants such as "one.tf"
+	}
+	if len(g) == 1 && (g[0] >= 'A' && g[0] <= 'Z' || g[0] >= 'a' && g[0] <= 'z') {
+		return g, true
+	}
+	if t, ok := glyphNames[g]; ok {
+		return t, true
+	}
+	if m := uniName.FindStringSubmatch(g); m != nil {
+		var b strings.Builder
+		h := m[1] + m[2]
+		step := 4
+		if m[2] != "" {
+			step = len(h)
+		}
+		for i := 0; i+step <= len(h); i += step {
+			n, _ := strconv.ParseUint(h[i:i+step], 16, 32)
+			b.WriteRune(rune(n))
+		}
+		return b.String(), true
+	}
+	return "", false
+}
+
+// parseCMap adds the bfchar and bfrange mappings of a ToUnicode CMap to
+// text and returns the code length its codespace gives, 0 if none.
+func parseCMap(data []byte, text map[uint32]string) int {
+	l := &lexer{b: data}
+	n := 0
+	var ops []any
+	for {
+		t, err := l.object()
+		if err != nil {
+			return n
+		}
+		k, ok := t.(keyword)
+		if !ok {
+			ops = append(ops, t)
+			continue
+		}
+		switch k {
+		case "endcodespacerange":
+			if len(ops) > 0 {
+				if b, ok := ops[0].([]byte); ok {
+					n = len(b)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(ops); i += 2 {
+				src, _ := ops[i].([]byte)
+				if dst, ok := ops[i+1].([]byte); ok && len(src) > 0 {
+					text[code(src)] = utf16Text(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(ops); i += 3 {
+				lo, _ := ops[i].([]byte)
+				hi, _ := ops[i+1].([]byte)
+				if len(lo) == 0 || len(hi) == 0 {
+					continue
+				}
+				from, to := code(lo), code(hi)
+				switch dst := ops[i+2].(type) {
+				case []byte:
+					u := utf16.Decode(utf16BE(dst))
+					for c := from; c <= to && c-from < 65536 && len(u) > 0; c++ {
+						r := append([]rune(nil), u...)
+						r[len(r)-1] += rune(c - from)
+						text[c] = string(r)
+					}
+				case array:
+					for j, v := range dst {
+						if b, ok := v.([]byte); ok && from+uint32(j) <= to {
+							text[from+uint32(j)] = utf16Text(b)
+						}
+					}
+				}
+			}
+		}
+		ops = ops[:0]
+	}
+}
+
+func code(b []byte) uint32 {
+	var c uint32
+	for _, x := range b {
+		c = c<<8 | uint32(x)
+	}
+	return c
+}
+
+func utf16BE(b []byte) []uint16 {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return u
+}
+
+func utf16Text(b []byte) string { return string(utf16.Decode(utf16BE(b))) }
+
+// matrix is a PDF transformation [a b c d e f].
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m followed by n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4], m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// glyph is one shown character, placed on the page as displayed: x grows
+// to the right and y upwards.
+type glyph struct {
+	x0, x1, y float64
+	size      float64 // font height
+	space     float64 // width of the font's word space
+	text      string
+}
+
+type gstate struct {
+	ctm                         matrix
+	font                        *font
+	size, tc, tw, th, tl, yrise float64
+}
+
+// interp runs content streams, collecting the glyphs they show.
+type interp struct {
+	d       *document
+	display func(x, y float64) (float64, float64)
+	fonts   map[ref]*font
+	glyphs  []glyph
+}
+
+var inlineImageEnd = regexp.MustCompile(`\sEI(\s|$)`)
+
+func (in *interp) run(content []byte, res dict, gs gstate, depth int) {
+	fonts := in.d.dict(res["Font"])
+	xobjs := in.d.dict(res["XObject"])
+	var (
+		stack    []gstate
+		tm, tlm  = identity, identity
+		operands []any
+	)
+	num := func(i int) float64 {
+		if i < len(operands) {
+			f, _ := operands[i].(float64)
+			return f
+		}
+		return 0
+	}
+	l := &lexer{b: content}
+	for {
+		t, err := l.object()
+		if err != nil {
+			return
+		}
+		op, ok := t.(keyword)
+		if !ok {
+			operands = append(operands, t)
+			continue
+		}
+		switch op {
+		case "q":
+			stack = append(stack, gs)
+		case "Q":
+			if len(stack) > 0 {
+				gs, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			}
+		case "cm":
+			gs.ctm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}.mul(gs.ctm)
+		case "BT":
+			tm, tlm = identity, identity
+		case "Tf":
+			if len(operands) >= 2 {
+				gs.font, gs.size = in.font(fonts[nameOf(operands[0])]), num(1)
+			}
+		case "Tc":
+			gs.tc = num(0)
+		case "Tw":
+			gs.tw = num(0)
+		case "Tz":
+			gs.th = num(0) / 100
+		case "TL":
+			gs.tl = num(0)
+		case "Ts":
+			gs.yrise = num(0)
+		case "Td", "TD":
+			if op == "TD" {
+				gs.tl = -num(1)
+			}
+			tlm = matrix{1, 0, 0, 1, num(0), num(1)}.mul(tlm)
+			tm = tlm
+		case "Tm":
+			tlm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}
+			tm = tlm
+		case "T*", "'", "\"":
+			if op == "\"" {
+				gs.tw, gs.tc = num(0), num(1)
+			}
+			tlm = matrix{1, 0, 0, 1, 0, -gs.tl}.mul(tlm)
+			tm = tlm
+			if op != "T*" && len(operands) > 0 {
+				s, _ := operands[len(operands)-1].([]byte)
+				tm = in.show(s, tm, gs)
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				s, _ := operands[0].([]byte)
+				tm = in.show(s, tm, gs)
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				a, _ := operands[0].(array)
+				for _, v := range a {
+					switch v := v.(type) {
+					case []byte:
+						tm = in.show(v, tm, gs)
+					case float64:
+						tm = matrix{1, 0, 0, 1, -v / 1000 * gs.size * gs.th, 0}.mul(tm)
+					}
+				}
+			}
+		case "Do":
+			x, ok := in.d.resolve(xobjs[nameOf(num0(operands))]).(*stream)
+			if !ok || depth > 8 || x.dict["Subtype"] != name("Form") {
+				break
+			}
+			data, err := in.d.decode(x)
+			if err != nil {
+				break
+			}
+			inner := gs
+			if m := in.d.array(x.dict["Matrix"]); len(m) == 6 {
+				var fm matrix
+				for i := range fm {
+					fm[i] = in.d.number(m[i], 0)
+				}
+				inner.ctm = fm.mul(gs.ctm)
+			}
+			r := in.d.dict(x.dict["Resources"])
+			if r == nil {
+				r = res
+			}
+			in.run(data, r, inner, depth+1)
+		case "ID":
+			// inline image data, up to EI
+			if m := inlineImageEnd.FindIndex(content[l.i:]); m != nil {
+				l.i += m[1]
+			} else {
+				return
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func num0(a []any) any {
+	if len(a) == 0 {
+		return nil
+	}
+	return a[0]
+}
+
+func nameOf(v any) name {
+	n, _ := v.(name)
+	return n
+}
+
+// font returns the font v names, reading each shared font once.
+func (in *interp) font(v any) *font {
+	r, shared := v.(ref)
+	if f, ok := in.fonts[r]; ok && shared {
+		return f
+	}
+	f := in.d.font(v)
+	if shared {
+		in.fonts[r] = f
+	}
+	return f
+}
+
+// show places the codes of s and returns the text matrix after them.
+func (in *interp) show(s []byte, tm matrix, gs gstate) matrix {
+	f := gs.font
+	if f == nil {
+		f = in.font(nil)
+	}
+	for i := 0; i+f.bytes <= len(s); i += f.bytes {
+		c := code(s[i : i+f.bytes])
+		w0 := f.width(c) / 1000
+		trm := matrix{gs.size * gs.th, 0, 0, gs.size, 0, gs.yrise}.mul(tm).mul(gs.ctm)
+		x0, y0 := in.display(trm.apply(0, 0))
+		x1, _ := in.display(trm.apply(w0, 0))
+		size := math.Hypot(trm[2], trm[3])
+		in.glyphs = append(in.glyphs, glyph{
+			x0: math.Min(x0, x1), x1: math.Max(x0, x1), y: y0, size: size,
+			space: f.space / 1000 * math.Hypot(trm[0], trm[1]), text: f.decode(c),
+		})
+		tx := w0*gs.size + gs.tc
+		if f.bytes == 1 && c == 32 {
+			tx += gs.tw
+		}
+		tm = matrix{1, 0, 0, 1, tx * gs.th, 0}.mul(tm)
+	}
+	return tm
+}
+
+// page is a page of the document with what it inherits from its parents.
+type page struct {
+	dict   dict
+	res    dict
+	box    [4]float64
+	rotate int
+}
+
+// pages returns the document's pages in order, from its page tree or,
+// without one, every page object in object order.
+func (d *document) pages() []page {
+	nums := slices.Sorted(maps.Keys(d.objs))
+	var root dict // of the latest revision
+	for _, num := range nums {
+		if dv := d.dict(d.objs[num]); dv["Type"] == name("Catalog") && d.dict(dv["Pages"]) != nil {
+			root = dv
+		}
+	}
+	var out []page
+	seen := map[ref]bool{}
+	var walk func(v any, inh page, depth int)
+	walk = func(v any, inh page, depth int) {
+		if r, ok := v.(ref); ok {
+			if seen[r] {
+				return
+			}
+			seen[r] = true
+		}
+		n := d.dict(v)
+		if n == nil || depth > 64 {
+			return
+		}
+		if r := d.dict(n["Resources"]); r != nil {
+			inh.res = r
+		}
+		if b := d.array(n["MediaBox"]); len(b) == 4 {
+			for i := range inh.box {
+				inh.box[i] = d.number(b[i], 0)
+			}
+		}
+		if r, ok := d.resolve(n["Rotate"]).(float64); ok {
+			inh.rotate = ((int(r) % 360) + 360) % 360
+		}
+		if kids := d.array(n["Kids"]); kids != nil || n["Type"] == name("Pages") {
+			for _, k := range kids {
+				walk(k, inh, depth+1)
+			}
+			return
+		}
+		inh.dict = n
+		out = append(out, inh)
+	}
+	def := page{box: [4]float64{0, 0, 612, 792}}
+	if root != nil {
+		walk(root["Pages"], def, 0)
+	}
+	if len(out) == 0 {
+		for _, num := range nums {
+			if dv := d.dict(d.objs[num]); dv["Type"] == name("Page") {
+				walk(d.objs[num], def, 0)
+			}
+		}
+	}
+	return out
+}
+
+// glyphs returns the characters p shows, in display space.
+func (d *document) glyphs(p page) []glyph {
+	var content []byte
+	var parts array
+	switch c := d.resolve(p.dict["Contents"]).(type) {
+	case *stream:
+		parts = array{c}
+	case array:
+		parts = c
+	}
+	for _, part := range parts {
+		if s, ok := d.resolve(part).(*stream); ok {
+			if data, err := d.decode(s); err == nil {
+				content = append(append(content, data...), '\n')
+			}
+		}
+	}
+	x0, y0 := p.box[0], p.box[1]
+	w, h := p.box[2]-x0, p.box[3]-y0
+	in := &interp{d: d, fonts: map[ref]*font{}}
+	in.display = func(x, y float64) (float64, float64) {
+		x, y = x-x0, y-y0
+		switch p.rotate {
+		case 90:
+			return y, w - x
+		case 180:
+			return w - x, h - y
+		case 270:
+			return h - y, x
+		}
+		return x, y
+	}
+	in.run(bytes.TrimSpace(content), p.res, gstate{ctm: identity, th: 1}, 0)
+	return in.glyphs
+}
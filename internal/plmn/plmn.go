@@ -0,0 +1,112 @@
+// Package plmn names the network a roaming record was served by, from the
+// MCC/MNC or TADIG partner code operators put in their roaming columns.
+package plmn
+
+import (
+	"embed"
+	"encoding/csv"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+)
+
+/* embedded default table; CDR_PLMN_FILE overrides it */
+//go:embed data/plmn.csv
+var dataFS embed.FS
+
+type network struct{ operator, country string }
+
+var table refdata.Table[map[string]network]
+
+var (
+	// MCC then MNC, run together or apart: 40493, 404-93, MCC 404 MNC 93
+	plmnCode = regexp.MustCompile(`^(?i:mcc)?\D*(\d{3})\D{0,6}?(\d{2,3})$`)
+	tadig    = regexp.MustCompile(`^[A-Z]{5}$`)
+)
+
+func init() { refdata.Load("", "roaming networks", reload) }
+
+// reload reads the table; on error the current table stays.
+func reload() error {
+	var (
+		f      fs.File
+		err    error
+		source = "embedded"
+	)
+	if p := os.Getenv("CDR_PLMN_FILE"); p != "" {
+		f, err = os.Open(p)
+		source = p
+	} else {
+		f, err = dataFS.Open("data/plmn.csv")
+	}
+	if err != nil {
+		return err
+	}
+	f = refdata.Track(f, source)
+	defer f.Close()
+	table.Set(load(f))
+	return nil
+}
+
+func load(f io.Reader) map[string]network {
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	_, _ = r.Read() // header
+	out := map[string]network{}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(rec) < 3 {
+			continue
+		}
+		if k := key(rec[0]); k != "" {
+			out[k] = network{strings.TrimSpace(rec[1]), strings.TrimSpace(rec[2])}
+		}
+	}
+	return out
+}
+
+// key returns the table key of a code as written in a table or an export:
+// the PLMN digits, or an uppercase TADIG code; "" when it is neither.
+func key(code string) string {
+	code = strings.ToUpper(strings.Trim(code, "'\" "))
+	if tadig.MatchString(code) {
+		return code
+	}
+	if m := plmnCode.FindStringSubmatch(strings.ReplaceAll(code, "MNC", "")); m != nil {
+		return m[1] + m[2]
+	}
+	return ""
+}
+
+// Lookup returns the operator and country of the network code names.
+func Lookup(code string) (operator, country string, ok bool) {
+	k := key(code)
+	if k == "" {
+		return "", "", false
+	}
+	t := table.Get()
+	n, ok := t[k]
+	if !ok && len(k) == 6 && k[3] == '0' {
+		n, ok = t[k[:3]+k[4:]] // a two-digit MNC written with three
+	}
+	return n.operator, n.country, ok
+}
+
+// Decode returns roaming with a network code it holds spelt out as
+// "Operator, Country (code)", or unchanged when it holds none the table
+// knows, such as a circle name.
+func Decode(roaming string) string {
+	op, country, ok := Lookup(roaming)
+	if !ok {
+		return roaming
+	}
+	return op + ", " + country + " (" + strings.Trim(roaming, "'\" ") + ")"
+}
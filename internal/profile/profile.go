@@ -0,0 +1,187 @@
+// Package profile cuts copies of the CSV reports down to the columns an
+// output profile whitelists, such as the court copy, which leaves out
+// identifiers departmental policy keeps in-house. The reports themselves
+// stay whole as the internal full copy; a profile is chosen per download.
+package profile
+
+import (
+	"bufio"
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+// Full is the profile of the reports as stored, every column kept.
+const Full = "full"
+
+/* embedded profiles; CDR_PROFILES_FILE overrides them */
+//go:embed data/profiles.csv
+var dataFS embed.FS
+
+var profiles refdata.Table[map[string]map[string]bool] // profile → columns kept
+
+func init() { refdata.Load("", "output profiles", load) }
+
+// load reads the profiles; on error the current ones stay.
+func load() error {
+	var (
+		f      fs.File
+		err    error
+		source = "embedded"
+	)
+	if p := os.Getenv("CDR_PROFILES_FILE"); p != "" {
+		f, err = os.Open(p)
+		source = p
+	} else {
+		f, err = dataFS.Open("data/profiles.csv")
+	}
+	if err != nil {
+		return err
+	}
+	f = refdata.Track(f, source)
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	_, _ = r.Read() // header
+	m := map[string]map[string]bool{}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(rec) < 2 {
+			continue
+		}
+		name, column := strings.ToLower(strings.TrimSpace(rec[0])), strings.TrimSpace(rec[1])
+		if name == Full {
+			line, _ := r.FieldPos(0)
+			return fmt.Errorf("line %d: profile %q keeps every column and cannot be listed", line, Full)
+		}
+		if m[name] == nil {
+			m[name] = map[string]bool{}
+		}
+		m[name][column] = true
+	}
+	profiles.Set(m)
+	return nil
+}
+
+// Names returns the profiles a download may ask for, Full first.
+func Names() []string {
+	var out []string
+	for name := range profiles.Get() {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return append([]string{Full}, out...)
+}
+
+// Parse normalizes a profile parameter. Empty means Full.
+func Parse(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == Full {
+		return Full, nil
+	}
+	if _, ok := profiles.Get()[s]; !ok {
+		return "", fmt.Errorf("unknown profile %q (have %s)", s, strings.Join(Names(), ", "))
+	}
+	return s, nil
+}
+
+// Applies reports whether a copy of the file name can be cut to a
+// profile: CSV reports can, other files cannot.
+func Applies(name string) bool { return filepath.Ext(name) == ".csv" }
+
+// CopyName is the download name of the copy of name under profile.
+func CopyName(name, profile string) string {
+	if profile == Full {
+		return name
+	}
+	return strings.TrimSuffix(name, ".csv") + "_" + profile + ".csv"
+}
+
+// Copy writes the CSV report read from r to w with only the columns
+// profile keeps, in their order. Headers match in any report language; the
+// '#' header block is copied as it is.
+func Copy(w io.Writer, r io.Reader, profile string) error {
+	if profile == Full {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	keep := profiles.Get()[profile]
+	if keep == nil {
+		return fmt.Errorf("unknown profile %q", profile)
+	}
+	allowed := map[string]bool{}
+	for c := range keep {
+		for _, l := range canon.Locales() {
+			allowed[canon.Translate(l, c)] = true
+		}
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		if b, err := br.Peek(1); err != nil || b[0] != '#' {
+			break
+		}
+		line, err := br.ReadString('\n')
+		if _, werr := io.WriteString(w, line); werr != nil {
+			return werr
+		}
+		if err != nil {
+			return nil
+		}
+	}
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var cols []int
+	for i, h := range header {
+		if allowed[h] {
+			cols = append(cols, i)
+		}
+	}
+	cw := safecsv.NewWriter(w)
+	pick := func(rec []string) []string {
+		out := make([]string, len(cols))
+		for j, i := range cols {
+			if i < len(rec) {
+				out[j] = rec[i]
+			}
+		}
+		return out
+	}
+	cw.Write(pick(header))
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		cw.Write(pick(rec))
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,250 @@
+// Package pseudo rewrites generated reports with consistent pseudonyms in
+// place of MSISDNs, IMEIs and IMSIs so they can be shared outside the lab.
+package pseudo
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/evidence"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+// keySuffix ends the name of the key file Files writes, before its
+// extension.
+const keySuffix = "_pseudonym_key"
+
+/* identifier columns and the pseudonym prefix used for each */
+var kinds = map[string]string{
+	"CdrNo":       "MSISDN",
+	"B Party":     "MSISDN",
+	"CallForward": "MSISDN",
+	"IMEI":        "IMEI",
+	"IMSI":        "IMSI",
+}
+
+// key returns the HMAC key: CDR_PSEUDONYM_KEY keeps pseudonyms stable across
+// jobs, otherwise a random per-job key is used.
+func key() []byte {
+	if k := os.Getenv("CDR_PSEUDONYM_KEY"); k != "" {
+		return []byte(k)
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}
+
+type mapper struct {
+	mac  []byte
+	fwd  map[string]string // original → pseudonym
+	kind map[string]string // pseudonym → kind
+}
+
+func (m *mapper) get(kind, v string) string {
+	v = strings.TrimSpace(v)
+	if v == "" || v == "-" || v == "(blank)" || v == "Total" {
+		return v
+	}
+	if p, ok := m.fwd[v]; ok {
+		return p
+	}
+	h := hmac.New(sha256.New, m.mac)
+	h.Write([]byte(v))
+	p := kind + "-" + strings.ToUpper(hex.EncodeToString(h.Sum(nil))[:10])
+	m.fwd[v] = p
+	m.kind[p] = kind
+	return p
+}
+
+// Files pseudonymizes every CSV in paths, replacing cdr in file names as
+// well, removes the originals and writes a key file mapping pseudonyms back
+// to the real identifiers. It returns the new paths, key file last.
+func Files(paths []string, cdr string) ([]string, error) {
+	m := &mapper{mac: key(), fwd: map[string]string{}, kind: map[string]string{}}
+	pcdr := m.get("MSISDN", cdr)
+
+	tables := make([][][]string, len(paths))
+	for i, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		all, err := r.ReadAll()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		tables[i] = all
+		// first pass: learn every identifier so free text can be scrubbed too
+		if len(all) > 0 {
+			for c, h := range all[0] {
+				if kind, ok := kinds[h]; ok {
+					for _, row := range all[1:] {
+						if c < len(row) {
+							m.get(kind, row[c])
+						}
+					}
+				}
+			}
+		}
+	}
+
+	pairs := make([]string, 0, 2*len(m.fwd))
+	origs := make([]string, 0, len(m.fwd))
+	for o := range m.fwd {
+		origs = append(origs, o)
+	}
+	sort.Slice(origs, func(i, j int) bool { return len(origs[i]) > len(origs[j]) })
+	for _, o := range origs {
+		if len(o) >= 6 { // short codes would mangle unrelated text
+			pairs = append(pairs, o, m.fwd[o])
+		}
+	}
+	scrub := strings.NewReplacer(pairs...)
+
+	var out []string
+	for i, p := range paths {
+		all := tables[i]
+		if len(all) > 0 {
+			for _, row := range all[1:] {
+				for c := range row {
+					kind, ok := "", false
+					if c < len(all[0]) {
+						kind, ok = kinds[all[0][c]]
+					}
+					if ok {
+						row[c] = m.get(kind, row[c])
+					} else {
+						row[c] = scrub.Replace(row[c])
+					}
+				}
+			}
+		}
+		dst := filepath.Join(filepath.Dir(p), strings.ReplaceAll(filepath.Base(p), cdr, pcdr))
+		if err := writeCSV(dst, all); err != nil {
+			return nil, err
+		}
+		if dst != p {
+			os.Remove(p)
+		}
+		out = append(out, dst)
+	}
+
+	keyRows := [][]string{{"Pseudonym", "Kind", "Original"}}
+	for _, o := range origs {
+		keyRows = append(keyRows, []string{m.fwd[o], m.kind[m.fwd[o]], o})
+	}
+	sort.Slice(keyRows[1:], func(i, j int) bool { return keyRows[i+1][0] < keyRows[j+1][0] })
+	keyPath := filepath.Join(filepath.Dir(paths[0]), pcdr+keySuffix+".csv")
+	if err := writeCSV(keyPath, keyRows); err != nil {
+		return nil, err
+	}
+	return append(out, keyPath), nil
+}
+
+// stem returns a file name up to its first dot, without the version
+// evidence mode gives it.
+func stem(path string) string {
+	name, _ := evidence.Unversioned(filepath.Base(path))
+	s, _, _ := strings.Cut(name, ".")
+	return s
+}
+
+// IsKey reports whether path is a key file Files wrote, or its digest:
+// the one file of an anonymized job that must not leave the lab.
+func IsKey(path string) bool { return strings.HasSuffix(stem(path), keySuffix) }
+
+// Target returns the pseudonym Files gave the target number of paths,
+// taken from the key file among them; "" when there is none.
+func Target(paths []string) string {
+	for _, p := range paths {
+		if IsKey(p) {
+			return strings.TrimSuffix(stem(p), keySuffix)
+		}
+	}
+	return ""
+}
+
+// Key returns the key file Files wrote among paths, not its digest; ""
+// when there is none.
+func Key(paths []string) string {
+	for _, p := range paths {
+		if IsKey(p) && filepath.Ext(p) == ".csv" {
+			return p
+		}
+	}
+	return ""
+}
+
+// Reveal undoes Files for the CSV at path: it rewrites it with the
+// originals that key, a key file Files wrote, maps pseudonyms back to.
+func Reveal(path string, key io.Reader) error {
+	r := csv.NewReader(key)
+	r.Comment = '#' // the header block a stamped key starts with
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return errors.New("empty pseudonym key")
+	}
+	var pairs []string
+	for _, row := range rows[1:] {
+		if len(row) >= 3 && row[0] != "" {
+			pairs = append(pairs, row[0], row[2])
+		}
+	}
+	back := strings.NewReplacer(pairs...)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	r = csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	all, err := r.ReadAll()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	for _, row := range all {
+		for c := range row {
+			row[c] = back.Replace(row[c])
+		}
+	}
+	return writeCSV(path, all)
+}
+
+// Shareable returns paths without the key files.
+func Shareable(paths []string) []string {
+	var out []string
+	for _, p := range paths {
+		if !IsKey(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func writeCSV(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := safecsv.NewWriter(f)
+	w.WriteAll(rows)
+	return w.Error()
+}
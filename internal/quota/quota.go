@@ -0,0 +1,124 @@
+// Package quota measures the storage each tenant and case uses, and turns
+// new jobs away once a limit is reached so one unit cannot fill the disk
+// for everyone:
+//
+//	CDR_QUOTA_MB       limit per tenant (override per tenant in the tenants file)
+//	CDR_CASE_QUOTA_MB  limit per case (crime number) within a tenant
+//
+// Usage counts the tenant's published reports and its jobs' record
+// snapshots; a file counts towards the case of the newest job listing it.
+// Limits of 0 or unset mean none.
+package quota
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+)
+
+const mb = 1 << 20
+
+// Usage is the storage held by one tenant, in bytes.
+type Usage struct {
+	Total int64
+	Cases map[string]int64 // crime number → bytes; "" for jobs without one
+}
+
+// Measure sums the files in dir, the tenant's output directory, and the
+// record snapshots of its jobs.
+func Measure(dir, tenant string) (Usage, error) {
+	u := Usage{Cases: map[string]int64{}}
+	list, err := jobs.List()
+	if err != nil {
+		return u, err
+	}
+	owner := map[string]string{} // file → crime number
+	for _, j := range list {     // oldest first, so the newest job wins
+		if j.Tenant != tenant {
+			continue
+		}
+		for _, p := range j.Outputs {
+			owner[filepath.Clean(p)] = j.Crime
+		}
+		if st, err := os.Stat(jobs.RecordsPath(j.ID)); err == nil {
+			u.Total += st.Size()
+			u.Cases[j.Crime] += st.Size()
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return u, err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		u.Total += info.Size()
+		if crime, ok := owner[filepath.Join(dir, e.Name())]; ok {
+			u.Cases[crime] += info.Size()
+		}
+	}
+	return u, nil
+}
+
+// Limit returns the tenant's limit in bytes, 0 for none.
+func Limit(id string) int64 {
+	if n, ok := tenant.QuotaMB(id); ok {
+		return n * mb
+	}
+	return envMB("CDR_QUOTA_MB")
+}
+
+// CaseLimit returns the per-case limit in bytes, 0 for none.
+func CaseLimit() int64 { return envMB("CDR_CASE_QUOTA_MB") }
+
+func envMB(name string) int64 {
+	n, err := strconv.ParseInt(os.Getenv(name), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n * mb
+}
+
+// ExceededError reports a limit a new job would go over.
+type ExceededError struct {
+	Scope       string // "unit-a", "case FIR-12"
+	Used, Limit int64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("storage quota exceeded for %s: %.1f MB used of %.1f MB; delete outputs or purge old cases to continue",
+		e.Scope, float64(e.Used)/mb, float64(e.Limit)/mb)
+}
+
+// Check returns an *ExceededError when the tenant, or the case crime
+// within it, is at or over its limit.
+func Check(dir, tenant, crime string) error {
+	limit, caseLimit := Limit(tenant), CaseLimit()
+	if limit == 0 && (caseLimit == 0 || crime == "") {
+		return nil
+	}
+	u, err := Measure(dir, tenant)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && u.Total >= limit {
+		scope := tenant
+		if scope == "" {
+			scope = "this deployment"
+		}
+		return &ExceededError{scope, u.Total, limit}
+	}
+	if caseLimit > 0 && crime != "" && u.Cases[crime] >= caseLimit {
+		return &ExceededError{"case " + crime, u.Cases[crime], caseLimit}
+	}
+	return nil
+}
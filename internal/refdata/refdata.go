@@ -0,0 +1,266 @@
+// Package refdata locates and reloads the reference tables (cells, LRN,
+// rules, service numbers, validation profiles) that packages read at
+// startup. TSP tables may come from an external directory with the
+// embedded copies as fallback. A table that fails to load leaves the
+// service running without it and is reported as a problem. Tables are
+// held in a Table, replaced whole; Reload re-runs the loaders alongside
+// running jobs and swaps the new tables in together once no job is using
+// them, so a job always sees one consistent version. Each loaded table
+// has a version, taken from the contents read through Open or Track,
+// which reports record.
+package refdata
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	mu        sync.RWMutex // read-held by jobs, write-held by Reload's swap
+	reloadMu  sync.Mutex   // one Reload at a time
+	regMu     sync.Mutex
+	reloaders = map[string]func() error{}
+	problems  = map[string]problem{} // table → why it is not loaded
+
+	loadMu   sync.Mutex // held while a loader runs
+	read     string     // version of the file the running loader read
+	verMu    sync.Mutex
+	versions = map[string]version{} // table → version of its contents
+
+	stageMu sync.Mutex
+	staging bool     // a Reload is running its loaders
+	staged  []func() // what they loaded, swapped in when they are done
+)
+
+// Table holds one reference table. Readers take the contents with Get
+// and the table's loader replaces them whole with Set, so a reader never
+// sees a table half loaded.
+type Table[T any] struct{ v atomic.Pointer[T] }
+
+// Get returns the table's contents: the zero T until it is first loaded.
+func (t *Table[T]) Get() T {
+	if p := t.v.Load(); p != nil {
+		return *p
+	}
+	var zero T
+	return zero
+}
+
+// Set replaces the table's contents. Within Reload they take effect with
+// the other reloaded tables', once no job is using the tables.
+func (t *Table[T]) Set(v T) { publish(func() { t.v.Store(&v) }) }
+
+// publish applies a loader's result: now, or at the end of a Reload.
+func publish(fn func()) {
+	stageMu.Lock()
+	if staging {
+		staged = append(staged, fn)
+		stageMu.Unlock()
+		return
+	}
+	stageMu.Unlock()
+	fn()
+}
+
+type version struct{ scope, v string }
+
+type problem struct {
+	scope string
+	err   error
+}
+
+/* table names are "<scope> <name>", or just name for shared tables */
+func key(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + " " + name
+}
+
+// Load runs fn to load table name, whose scope is a TSP or "" for tables
+// shared by all. A failure is logged and recorded as a problem instead of
+// stopping the service; the table stays empty and the enrichment it feeds
+// is skipped. fn is kept for Reload and must leave the previous contents
+// in place when it fails.
+func Load(scope, name string, fn func() error) {
+	k := key(scope, name)
+	regMu.Lock()
+	defer regMu.Unlock()
+	if err := run(scope, k, fn); err != nil {
+		log.Printf("warning: %s not loaded, continuing without it: %v", k, err)
+		problems[k] = problem{scope, err}
+	}
+	reloaders[k] = func() error {
+		err := run(scope, k, fn)
+		if err == nil {
+			publish(func() {
+				regMu.Lock()
+				delete(problems, k)
+				regMu.Unlock()
+			})
+		}
+		return err
+	}
+}
+
+// run calls the loader fn of table k and, when it succeeds, records the
+// version of what it read.
+func run(scope, k string, fn func() error) error {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	read = ""
+	err := fn()
+	if v := read; err == nil && v != "" {
+		publish(func() {
+			verMu.Lock()
+			versions[k] = version{scope, v}
+			verMu.Unlock()
+		})
+	}
+	return err
+}
+
+// Problems returns "table: error" for every table that failed to load,
+// limited to the shared tables and those of scope when scope is not "".
+func Problems(scope string) []string {
+	regMu.Lock()
+	defer regMu.Unlock()
+	var out []string
+	for k, p := range problems {
+		if scope == "" || p.scope == "" || p.scope == scope {
+			out = append(out, k+": "+p.err.Error())
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Use marks the tables as in use until the returned func is called.
+func Use() func() {
+	mu.RLock()
+	return mu.RUnlock
+}
+
+// Reload runs every registered reload func, then waits for running jobs
+// to finish with the tables and swaps in those reloaded. It returns the
+// names reloaded and the errors of those that failed, by name.
+func Reload() (ok []string, failed map[string]error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	regMu.Lock()
+	fns := make(map[string]func() error, len(reloaders))
+	names := make([]string, 0, len(reloaders))
+	for n, fn := range reloaders {
+		fns[n] = fn
+		names = append(names, n)
+	}
+	regMu.Unlock()
+	sort.Strings(names)
+
+	stageMu.Lock()
+	staging = true
+	stageMu.Unlock()
+	failed = map[string]error{}
+	for _, n := range names {
+		if err := fns[n](); err != nil {
+			failed[n] = err
+			continue
+		}
+		ok = append(ok, n)
+	}
+	stageMu.Lock()
+	swap := staged
+	staged, staging = nil, false
+	stageMu.Unlock()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, fn := range swap {
+		fn()
+	}
+	return ok, failed
+}
+
+// Dir returns the external reference data directory (CDR_DATA_DIR), or ""
+// when only the embedded tables are used.
+func Dir() string { return os.Getenv("CDR_DATA_DIR") }
+
+// Open returns a TSP's reference table. With CDR_DATA_DIR set,
+// <dir>/<tsp>/<file> and then <dir>/<file> take precedence over the copy
+// embedded at path, so one flat directory can serve every TSP and a
+// per-TSP subdirectory can override it.
+func Open(tsp string, embedded fs.FS, path string) (fs.File, error) {
+	if dir := Dir(); dir != "" {
+		name := filepath.Base(path)
+		for _, p := range []string{filepath.Join(dir, tsp, name), filepath.Join(dir, name)} {
+			f, err := os.Open(p)
+			if err == nil {
+				log.Printf("%s: loading %s", tsp, p)
+				return Track(f, p), nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+	f, err := embedded.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return Track(f, "embedded"), nil
+}
+
+// Track wraps a table file opened by a loader without Open, so the table
+// is versioned by what the loader reads from it. source says where the
+// file came from: a path, or "embedded".
+func Track(f fs.File, source string) fs.File {
+	return &tracked{File: f, h: sha256.New(), source: source}
+}
+
+type tracked struct {
+	fs.File
+	h      hash.Hash
+	source string
+}
+
+func (t *tracked) Read(p []byte) (int, error) {
+	n, err := t.File.Read(p)
+	t.h.Write(p[:n])
+	return n, err
+}
+
+// Close notes the version of the contents read for the running loader,
+// after those of the other files it read, if any.
+func (t *tracked) Close() error {
+	v := fmt.Sprintf("%x (%s)", t.h.Sum(nil)[:6], t.source)
+	if read != "" {
+		v = read + " + " + v
+	}
+	read = v
+	return t.File.Close()
+}
+
+// Versions returns "table: version" for every loaded table, limited like
+// Problems. A version is the start of the SHA-256 of the table's contents
+// and where they came from.
+func Versions(scope string) []string {
+	verMu.Lock()
+	defer verMu.Unlock()
+	var out []string
+	for k, v := range versions {
+		if scope == "" || v.scope == "" || v.scope == scope {
+			out = append(out, k+": "+v.v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,319 @@
+// Package rules tags normalized CDR rows that match configurable
+// suspicious-pattern rules and writes a findings report.
+//
+// The rules are a CSV table, one rule per row, rather than YAML: like the
+// cell DBs, LRN tables and class rules it is reference data that refdata
+// versions and reloads, analysts keep it in the spreadsheet tools they
+// keep those in, and reading YAML would take the module's first
+// dependency outside the standard library.
+package rules
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+/* embedded default rule table; CDR_RULES_FILE overrides it */
+//go:embed data/rules.csv
+var dataFS embed.FS
+
+// Rule is one row of the rules table.
+//
+//	night_calls  – more than Threshold voice calls to the same B party
+//	               with a time of day in [From, To)
+//	imei_change  – IMEI differs from the previous record within Window of
+//	               a row already flagged by an earlier rule
+//	cell_change  – First and Last Cell ID of a voice call differ: the
+//	               target moved during it; calls that lasted, and lasted at
+//	               least Threshold seconds
+type Rule struct {
+	Name, Kind string
+	Threshold  int
+	From, To   time.Duration // offset from midnight
+	Window     time.Duration
+}
+
+var active refdata.Table[[]Rule]
+
+func init() { refdata.Load("", "rules", load) }
+
+// load reads the rule table into active; on error the current rules stay.
+func load() error {
+	var (
+		f      fs.File
+		err    error
+		source = "embedded"
+	)
+	if p := os.Getenv("CDR_RULES_FILE"); p != "" {
+		f, err = os.Open(p)
+		source = p
+	} else {
+		f, err = dataFS.Open("data/rules.csv")
+	}
+	if err != nil {
+		return err
+	}
+	f = refdata.Track(f, source)
+	defer f.Close()
+	rs, err := Load(f)
+	if err != nil {
+		return err
+	}
+	active.Set(rs)
+	return nil
+}
+
+// Load parses a rules table (name,kind,threshold,from,to,window).
+func Load(f io.Reader) ([]Rule, error) {
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	get := func(rec []string, k string) string {
+		if i, ok := col[k]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+	var out []Rule
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ru := Rule{Name: get(rec, "name"), Kind: strings.ToLower(get(rec, "kind"))}
+		if ru.Name == "" || strings.HasPrefix(ru.Name, "#") {
+			continue
+		}
+		if v := get(rec, "threshold"); v != "" {
+			if ru.Threshold, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("rules line %d: threshold: %w", line, err)
+			}
+		}
+		if ru.From, err = clock(get(rec, "from")); err != nil {
+			return nil, fmt.Errorf("rules line %d: from: %w", line, err)
+		}
+		if ru.To, err = clock(get(rec, "to")); err != nil {
+			return nil, fmt.Errorf("rules line %d: to: %w", line, err)
+		}
+		if v := get(rec, "window"); v != "" {
+			if ru.Window, err = time.ParseDuration(v); err != nil {
+				return nil, fmt.Errorf("rules line %d: window: %w", line, err)
+			}
+		}
+		switch ru.Kind {
+		case "night_calls", "imei_change", "cell_change":
+		default:
+			return nil, fmt.Errorf("rules line %d: unknown kind %q", line, ru.Kind)
+		}
+		out = append(out, ru)
+	}
+	return out, nil
+}
+
+func clock(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+/* Finding is one rule hit, written to the findings report. */
+type Finding struct {
+	Rule, BParty, Date, Time, Detail string
+}
+
+// Apply evaluates the rules over rows (canonical layout described by col)
+// and appends matching rule names to the "Flags" column.
+func Apply(rows [][]string, col map[string]int, rules []Rule) []Finding {
+	fi, ok := col["Flags"]
+	if !ok {
+		return nil
+	}
+	type rec struct {
+		i     int
+		at    time.Time
+		clock bool // the time of day parsed, not just the date
+	}
+	var timed []rec
+	for i, row := range rows {
+		t := canon.Get(row, col, "Time")
+		if at, ok := canon.ParseDateTime(canon.Get(row, col, "Date"), t); ok {
+			timed = append(timed, rec{i, at, canon.HasClock(t)})
+		}
+	}
+	sort.SliceStable(timed, func(a, b int) bool { return timed[a].at.Before(timed[b].at) })
+
+	var found []Finding
+	flag := func(i int, ru Rule, detail string) {
+		row := rows[i]
+		for _, f := range strings.Split(row[fi], ";") {
+			if f == ru.Name {
+				return
+			}
+		}
+		if row[fi] == "" {
+			row[fi] = ru.Name
+		} else {
+			row[fi] += ";" + ru.Name
+		}
+		found = append(found, Finding{
+			Rule: ru.Name, BParty: canon.Get(row, col, "B Party"),
+			Date: canon.Get(row, col, "Date"), Time: canon.Get(row, col, "Time"),
+			Detail: detail,
+		})
+	}
+
+	for _, ru := range rules {
+		switch ru.Kind {
+		case "night_calls":
+			byParty := map[string][]int{}
+			for _, t := range timed {
+				// a row without a time of day would count as midnight
+				if !t.clock || !voice(rows[t.i], col) {
+					continue
+				}
+				tod := t.at.Sub(t.at.Truncate(24 * time.Hour))
+				if inWindow(tod, ru.From, ru.To) {
+					b := canon.Get(rows[t.i], col, "B Party")
+					byParty[b] = append(byParty[b], t.i)
+				}
+			}
+			parties := make([]string, 0, len(byParty))
+			for b := range byParty {
+				parties = append(parties, b)
+			}
+			sort.Strings(parties) // findings in a stable order
+			for _, b := range parties {
+				idx := byParty[b]
+				if b == "" || len(idx) <= ru.Threshold {
+					continue
+				}
+				for _, i := range idx {
+					flag(i, ru, fmt.Sprintf("%d calls with %s in window", len(idx), b))
+				}
+			}
+		case "imei_change":
+			var flagged []time.Time
+			for _, t := range timed {
+				if rows[t.i][fi] != "" {
+					flagged = append(flagged, t.at)
+				}
+			}
+			prev := ""
+			for _, t := range timed {
+				imei := canon.Get(rows[t.i], col, "IMEI")
+				if imei == "" {
+					continue
+				}
+				if prev != "" && imei != prev && near(t.at, flagged, ru.Window) {
+					flag(t.i, ru, fmt.Sprintf("IMEI %s -> %s", prev, imei))
+				}
+				prev = imei
+			}
+		case "cell_change":
+			for i, row := range rows {
+				first, last := canon.Get(row, col, "First Cell ID"), canon.Get(row, col, "Last Cell ID")
+				if !voice(row, col) || first == "" || last == "" || first == last {
+					continue
+				}
+				if d, _ := strconv.Atoi(canon.Get(row, col, "Duration")); d <= 0 || d < ru.Threshold {
+					continue
+				}
+				flag(i, ru, fmt.Sprintf("cell %s -> %s", first, last))
+			}
+		}
+	}
+	return found
+}
+
+// voice reports whether row is a call: neither an SMS by the record class
+// rules nor a record of a service number.
+func voice(row []string, col map[string]int) bool {
+	return !canon.Classify(row, col).SMS && canon.Get(row, col, "Service Number") != "Yes"
+}
+
+func inWindow(tod, from, to time.Duration) bool {
+	if from <= to {
+		return tod >= from && tod < to
+	}
+	return tod >= from || tod < to // window wraps midnight
+}
+
+func near(at time.Time, marks []time.Time, win time.Duration) bool {
+	for _, m := range marks {
+		if d := at.Sub(m); d <= win && d >= -win {
+			return true
+		}
+	}
+	return false
+}
+
+// AnnotateFile applies the loaded rules to the normalized report at path,
+// rewriting it in place with the Flags column filled, and writes the
+// findings report to findingsPath.
+func AnnotateFile(path, findingsPath, cdr string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	all, err := csv.NewReader(in).ReadAll()
+	in.Close()
+	if err != nil {
+		return err
+	}
+	if len(all) == 0 {
+		return fmt.Errorf("%s: empty report", path)
+	}
+	header, rows := all[0], all[1:]
+	found := Apply(rows, canon.Index(header), active.Get())
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := safecsv.NewWriter(out)
+	w.WriteAll(all)
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	fout, err := os.Create(findingsPath)
+	if err != nil {
+		return err
+	}
+	defer fout.Close()
+	fw := safecsv.NewWriter(fout)
+	fw.Write([]string{"CdrNo", "Rule", "B Party", "Date", "Time", "Detail"})
+	for _, f := range found {
+		fw.Write([]string{cdr, f.Rule, f.BParty, f.Date, f.Time, f.Detail})
+	}
+	fw.Flush()
+	return fw.Error()
+}
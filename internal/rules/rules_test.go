@@ -0,0 +1,46 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+)
+
+// TestVoiceOnly checks that SMS, service-number records and calls that
+// never connected neither count towards night_calls nor trip cell_change.
+func TestVoiceOnly(t *testing.T) {
+	header := canon.Header()
+	col := canon.Index(header)
+	row := func(bparty, tm, dur, callType, typ, service, first, last string) []string {
+		r := make([]string, len(header))
+		for k, v := range map[string]string{
+			"B Party": bparty, "Date": "01/03/2025", "Time": tm, "Duration": dur,
+			"Call Type": callType, "Type": typ, "Service Number": service,
+			"First Cell ID": first, "Last Cell ID": last,
+		} {
+			r[col[k]] = v
+		}
+		return r
+	}
+	rows := [][]string{
+		row("9876500002", "01:00:00", "60", "IN", "Voice", "", "A", "B"),  // 0: call, moved
+		row("9876500002", "01:10:00", "0", "IN", "SMS", "", "A", "B"),     // 1: SMS
+		row("BP-BSNLIN", "01:20:00", "0", "IN", "SMS", "Yes", "A", "B"),   // 2: service SMS
+		row("9876500003", "01:30:00", "0", "OUT", "Voice", "", "A", "B"),  // 3: never connected
+		row("9876500002", "01:40:00", "30", "OUT", "Voice", "", "A", "A"), // 4: call, stayed
+	}
+	found := Apply(rows, col, []Rule{
+		{Name: "NIGHT", Kind: "night_calls", Threshold: 1, To: 4 * time.Hour},
+		{Name: "MOVED", Kind: "cell_change"},
+	})
+	want := map[int]string{0: "NIGHT;MOVED", 4: "NIGHT"}
+	for i, r := range rows {
+		if got := r[col["Flags"]]; got != want[i] {
+			t.Errorf("row %d flags = %q, want %q", i, got, want[i])
+		}
+	}
+	if len(found) != 3 {
+		t.Errorf("%d findings, want 3: %v", len(found), found)
+	}
+}
@@ -0,0 +1,56 @@
+// Package safecsv wraps encoding/csv so that every report cell is
+// neutralised against spreadsheet formula injection before it is written.
+package safecsv
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// Writer is a csv.Writer whose Write and WriteAll escape formula cells.
+type Writer struct {
+	*csv.Writer
+}
+
+func NewWriter(w io.Writer) *Writer { return &Writer{csv.NewWriter(w)} }
+
+func (w *Writer) Write(rec []string) error {
+	out := make([]string, len(rec))
+	for i, v := range rec {
+		out[i] = Escape(v)
+	}
+	return w.Writer.Write(out)
+}
+
+func (w *Writer) WriteAll(recs [][]string) error {
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Escape prefixes a quote to values Excel/LibreOffice would evaluate as a
+// formula (leading '=', '+', '-', '@', tab or CR). Plain numbers such as
+// "-12.5" and a lone "-" are left alone.
+func Escape(v string) string {
+	if len(v) == 0 {
+		return v
+	}
+	switch v[0] {
+	case '=', '@', '\t', '\r':
+		return "'" + v
+	case '+', '-':
+		if len(v) == 1 {
+			return v
+		}
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return v
+		}
+		return "'" + v
+	}
+	return v
+}
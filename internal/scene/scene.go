@@ -0,0 +1,97 @@
+// Package scene measures how far from the scene of crime the target was:
+// it adds the distance of each record's first cell from the scene to the
+// report and lists the records within a radius of it on their own.
+package scene
+
+import (
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+// Column is the header of the distance column, placed after the first
+// cell's coordinates.
+const Column = "Distance from scene (km)"
+
+// Radius is the radius in km of the near-scene report when an upload
+// gives none: CDR_SCENE_RADIUS_KM, else 2.
+func Radius() float64 {
+	if r, err := canon.ParseRadius(os.Getenv("CDR_SCENE_RADIUS_KM")); err == nil && r > 0 {
+		return r
+	}
+	return 2
+}
+
+// Write adds the distance column to the report at reportPath, measured
+// from scene ("lat,long"), blank for records whose first cell has no
+// coordinates, and writes the records within radius km, nearest first,
+// to <prefix>_near_scene_reports.csv beside it. It returns that report's
+// path. A radius of 0 is Radius().
+func Write(reportPath, scene string, radius float64) (string, error) {
+	lat, lon, ok := canon.ParseLatLong(scene)
+	if !ok {
+		return "", nil
+	}
+	if radius <= 0 {
+		radius = Radius()
+	}
+	header, rows, err := canon.ReadReport(reportPath)
+	if err != nil {
+		return "", err
+	}
+	col := canon.Index(header)
+	at := len(header)
+	if i, ok := col["Lat-Long-Azimuth (First CellID)"]; ok {
+		at = i + 1
+	}
+
+	type near struct {
+		km  float64
+		row []string
+	}
+	var within []near
+	out := [][]string{slices.Insert(slices.Clone(header), at, Column)}
+	for _, row := range rows {
+		km, d := "", -1.0
+		if clat, clon, ok := canon.ParseLatLong(canon.Get(row, col, "Lat-Long-Azimuth (First CellID)")); ok {
+			d = canon.Distance(lat, lon, clat, clon)
+			km = strconv.FormatFloat(d, 'f', 2, 64)
+		}
+		for len(row) < at {
+			row = append(row, "")
+		}
+		row = slices.Insert(row, at, km)
+		if d >= 0 && d <= radius {
+			within = append(within, near{d, row})
+		}
+		out = append(out, row)
+	}
+	if err := write(reportPath, out); err != nil {
+		return "", err
+	}
+
+	sort.SliceStable(within, func(i, j int) bool { return within[i].km < within[j].km })
+	report := [][]string{out[0]}
+	for _, n := range within {
+		report = append(report, n.row)
+	}
+	path := strings.TrimSuffix(reportPath, "_reports.csv") + "_near_scene_reports.csv"
+	return path, write(path, report)
+}
+
+func write(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := safecsv.NewWriter(f).WriteAll(rows); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,120 @@
+// Package servicenum recognises telemarketer, OTP sender and customer-care
+// numbers so they can be tagged or kept out of the contact summaries.
+package servicenum
+
+import (
+	"embed"
+	"encoding/csv"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+)
+
+/* embedded default list; CDR_SERVICE_NUMBERS_FILE overrides it */
+//go:embed data/service_numbers.csv
+var dataFS embed.FS
+
+type entry struct {
+	exact, prefix string
+	re            *regexp.Regexp
+	category      string
+}
+
+var list refdata.Table[[]entry]
+
+func init() { refdata.Load("", "service numbers", reload) }
+
+// reload reads the list into list; on error the current list stays.
+func reload() error {
+	var (
+		f      fs.File
+		err    error
+		source = "embedded"
+	)
+	if p := os.Getenv("CDR_SERVICE_NUMBERS_FILE"); p != "" {
+		f, err = os.Open(p)
+		source = p
+	} else {
+		f, err = dataFS.Open("data/service_numbers.csv")
+	}
+	if err != nil {
+		return err
+	}
+	f = refdata.Track(f, source)
+	defer f.Close()
+	list.Set(load(f))
+	return nil
+}
+
+func load(f io.Reader) []entry {
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	_, _ = r.Read() // header
+	var out []entry
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(rec) == 0 {
+			continue
+		}
+		p := strings.TrimSpace(rec[0])
+		if p == "" {
+			continue
+		}
+		e := entry{category: "Service"}
+		if len(rec) > 1 && strings.TrimSpace(rec[1]) != "" {
+			e.category = strings.TrimSpace(rec[1])
+		}
+		switch {
+		case strings.HasPrefix(p, "re:"):
+			re, err := regexp.Compile(p[3:])
+			if err != nil {
+				log.Printf("warning: bad service number pattern %q: %v", p, err)
+				continue
+			}
+			e.re = re
+		case strings.HasSuffix(p, "*"):
+			e.prefix = strings.TrimSuffix(p, "*")
+		default:
+			e.exact = p
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// Category returns the list category for number, or "" when it is not a
+// service number.
+func Category(number string) string {
+	raw := strings.Trim(number, "'\" ")
+	d := canon.Last10(raw)
+	for _, e := range list.Get() {
+		switch {
+		case e.re != nil:
+			if e.re.MatchString(raw) {
+				return e.category
+			}
+		case e.prefix != "":
+			if d != "" && strings.HasPrefix(d, e.prefix) {
+				return e.category
+			}
+		default:
+			if d == e.exact {
+				return e.category
+			}
+		}
+	}
+	return ""
+}
+
+// IsService reports whether number is on the service-number list.
+func IsService(number string) bool { return Category(number) != "" }
@@ -0,0 +1,126 @@
+// Package smsclass sorts A2P SMS, the messages businesses and government
+// send from sender IDs, into classes such as Bank, OTP, Promo and
+// Government, so the contact summaries can set the bulk of them aside.
+package smsclass
+
+import (
+	"embed"
+	"encoding/csv"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+)
+
+/* embedded default table; CDR_SMS_CLASSES_FILE overrides it */
+//go:embed data/sms_classes.csv
+var dataFS embed.FS
+
+// Other is the class of A2P senders the table does not place.
+const Other = "Other"
+
+type entry struct {
+	exact, prefix string
+	re            *regexp.Regexp
+	class         string
+}
+
+var list refdata.Table[[]entry]
+
+// sender IDs: operator/circle prefix, DLT header, optional DLT category
+var senderID = regexp.MustCompile(`^[A-Z]{2}-([A-Z0-9]{3,})(-[PSTG])?$`)
+
+func init() { refdata.Load("", "sms classes", reload) }
+
+// reload reads the table into list; on error the current table stays.
+func reload() error {
+	var (
+		f      fs.File
+		err    error
+		source = "embedded"
+	)
+	if p := os.Getenv("CDR_SMS_CLASSES_FILE"); p != "" {
+		f, err = os.Open(p)
+		source = p
+	} else {
+		f, err = dataFS.Open("data/sms_classes.csv")
+	}
+	if err != nil {
+		return err
+	}
+	f = refdata.Track(f, source)
+	defer f.Close()
+	list.Set(load(f))
+	return nil
+}
+
+func load(f io.Reader) []entry {
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	_, _ = r.Read() // header
+	var out []entry
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(rec) < 2 {
+			continue
+		}
+		p, class := strings.TrimSpace(rec[0]), strings.TrimSpace(rec[1])
+		if p == "" || class == "" {
+			continue
+		}
+		e := entry{class: class}
+		switch {
+		case strings.HasPrefix(p, "re:"):
+			re, err := regexp.Compile(p[3:])
+			if err != nil {
+				log.Printf("warning: bad SMS class pattern %q: %v", p, err)
+				continue
+			}
+			e.re = re
+		case strings.HasSuffix(p, "*"):
+			e.prefix = strings.ToUpper(strings.TrimSuffix(p, "*"))
+		default:
+			e.exact = strings.ToUpper(p)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// Of returns the class of a record with the given call type and other
+// party, or "" when it is not A2P SMS: one from a sender ID, or one the
+// operator types A2P.
+func Of(callType, party string) string {
+	sender := strings.ToUpper(strings.Trim(party, "'\" "))
+	header := ""
+	if m := senderID.FindStringSubmatch(sender); m != nil {
+		header = m[1]
+	} else if !strings.Contains(strings.ToUpper(callType), "A2P") {
+		return ""
+	}
+	for _, e := range list.Get() {
+		switch {
+		case e.re != nil:
+			if e.re.MatchString(sender) {
+				return e.class
+			}
+		case e.prefix != "":
+			if header != "" && strings.HasPrefix(header, e.prefix) {
+				return e.class
+			}
+		default:
+			if header == e.exact || sender == e.exact {
+				return e.class
+			}
+		}
+	}
+	return Other
+}
@@ -0,0 +1,188 @@
+// Package stats aggregates the job records per TSP, for the lab to report
+// its workload and the quality of each operator's exports over time:
+// files processed, rows per file, processing time and how much of the
+// records the reference tables enriched.
+//
+// Jobs recorded before rows and lookups were kept count towards the files
+// and times only.
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+)
+
+// Bucket is the length of the periods a TSP's figures are broken into.
+type Bucket string
+
+const (
+	Day   Bucket = "day"
+	Week  Bucket = "week"
+	Month Bucket = "month"
+)
+
+// ParseBucket reads a bucket name; "" is Month.
+func ParseBucket(s string) (Bucket, error) {
+	switch b := Bucket(s); b {
+	case "":
+		return Month, nil
+	case Day, Week, Month:
+		return b, nil
+	}
+	return "", fmt.Errorf("unknown period %q: want day, week or month", s)
+}
+
+// label names the period t falls in: 2024-03-07, 2024-W10 or 2024-03.
+func (b Bucket) label(t time.Time) string {
+	switch b {
+	case Day:
+		return t.Format("2006-01-02")
+	case Week:
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	}
+	return t.Format("2006-01")
+}
+
+// Figures are the aggregates of a set of jobs.
+type Figures struct {
+	Processed  int                `json:"processed"`
+	Failed     int                `json:"failed"`
+	Cancelled  int                `json:"cancelled"`
+	Rows       int                `json:"rows"`
+	AvgRows    float64            `json:"avg_rows"`
+	AvgSeconds float64            `json:"avg_seconds"`          // from a worker taking the job up to its end
+	Enrichment map[string]float64 `json:"enrichment,omitempty"` // lookup → share of rows enriched, 0 to 1
+
+	counted int // processed jobs that recorded their rows
+	seconds float64
+	timed   int
+	lookups map[string]jobs.Lookup
+}
+
+// Period is the figures of one day, week or month.
+type Period struct {
+	Period string `json:"period"`
+	Figures
+}
+
+// TSP is the figures of one operator, overall and per period, oldest
+// first.
+type TSP struct {
+	TSP string `json:"tsp"`
+	Figures
+	Periods []Period `json:"periods"`
+}
+
+// Filter picks the jobs aggregated. Zero fields pick every job.
+type Filter struct {
+	Tenants  []string // nil for every tenant
+	From, To time.Time
+}
+
+// ErrRange reports a Filter ending before it starts.
+var ErrRange = errors.New("period ends before it starts")
+
+// Of aggregates the finished jobs of list that f picks, per TSP in name
+// order.
+func Of(list []*jobs.Job, f Filter, b Bucket) ([]TSP, error) {
+	if !f.From.IsZero() && !f.To.IsZero() && f.To.Before(f.From) {
+		return nil, ErrRange
+	}
+	tenants := map[string]bool{}
+	for _, t := range f.Tenants {
+		tenants[t] = true
+	}
+	byTSP := map[string]*TSP{}
+	periods := map[string]map[string]*Period{}
+	for _, j := range list {
+		if j.Status == "" || (f.Tenants != nil && !tenants[j.Tenant]) {
+			continue
+		}
+		if (!f.From.IsZero() && j.Created.Before(f.From)) || (!f.To.IsZero() && !j.Created.Before(f.To)) {
+			continue
+		}
+		t := byTSP[j.TSP]
+		if t == nil {
+			t = &TSP{TSP: j.TSP}
+			byTSP[j.TSP], periods[j.TSP] = t, map[string]*Period{}
+		}
+		label := b.label(j.Created)
+		p := periods[j.TSP][label]
+		if p == nil {
+			p = &Period{Period: label}
+			periods[j.TSP][label] = p
+		}
+		t.add(j)
+		p.add(j)
+	}
+
+	out := make([]TSP, 0, len(byTSP))
+	for name, t := range byTSP {
+		t.finish()
+		for _, p := range periods[name] {
+			p.finish()
+			t.Periods = append(t.Periods, *p)
+		}
+		sort.Slice(t.Periods, func(a, b int) bool { return t.Periods[a].Period < t.Periods[b].Period })
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].TSP < out[b].TSP })
+	return out, nil
+}
+
+func (f *Figures) add(j *jobs.Job) {
+	switch j.Status {
+	case "failed":
+		f.Failed++
+		return
+	case "cancelled":
+		f.Cancelled++
+		return
+	}
+	f.Processed++
+	start := j.Started
+	if start.IsZero() {
+		start = j.Created
+	}
+	if !j.Finished.IsZero() {
+		f.seconds += j.Finished.Sub(start).Seconds()
+		f.timed++
+	}
+	if j.Lookups == nil {
+		return // recorded before rows were kept, or summary only
+	}
+	f.counted++
+	f.Rows += j.Rows
+	if f.lookups == nil {
+		f.lookups = map[string]jobs.Lookup{}
+	}
+	for name, l := range j.Lookups {
+		sum := f.lookups[name]
+		sum.Total += l.Total
+		sum.Found += l.Found
+		f.lookups[name] = sum
+	}
+}
+
+func (f *Figures) finish() {
+	if f.counted > 0 {
+		f.AvgRows = float64(f.Rows) / float64(f.counted)
+	}
+	if f.timed > 0 {
+		f.AvgSeconds = f.seconds / float64(f.timed)
+	}
+	for name, l := range f.lookups {
+		if l.Total == 0 {
+			continue
+		}
+		if f.Enrichment == nil {
+			f.Enrichment = map[string]float64{}
+		}
+		f.Enrichment[name] = float64(l.Found) / float64(l.Total)
+	}
+}
@@ -0,0 +1,566 @@
+// Package summary aggregates rows in the canonical layout into the
+// per-B-party summary, max calls, max duration, max stay and SMS category
+// reports. The summary keeps call durations apart by direction: a party
+// who only takes long calls from the target is not one who places them.
+// Calls of zero duration or a missed call type count as missed calls.
+package summary
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+)
+
+const stamp = "2006-01-02 15:04:05"
+
+type party struct {
+	BParty, SDR, Provider, Type   string
+	TotalCalls, OutCalls, InCalls int
+	OutSMS, InSMS, OtherCalls     int
+	RoamCalls, RoamSMS            int
+	TotalDuration                 float64
+	OutDuration, InDuration       durations // of calls only, by who placed them
+	CallDurations                 []float64 // of every call, for the average and median
+	Missed, MissedOut, MissedIn   int
+	Days, CellIds, Imeis, Imsis   map[string]struct{}
+	Active                        map[string]struct{} // calendar days with contact, however the dates are written
+	First, Last                   span
+}
+
+// durations sums the durations of one direction of calls with a party.
+type durations struct {
+	Calls      int
+	Total, Max float64
+}
+
+func (d *durations) add(v float64) {
+	d.Calls++
+	d.Total += v
+	d.Max = max(d.Max, v)
+}
+
+// average is the mean call duration, "0" with no calls.
+func (d durations) average() string {
+	if d.Calls == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%.0f", d.Total/float64(d.Calls))
+}
+
+// average is the mean of vs, "0" when empty.
+func average(vs []float64) string {
+	if len(vs) == 0 {
+		return "0"
+	}
+	var sum float64
+	for _, v := range vs {
+		sum += v
+	}
+	return fmt.Sprintf("%.0f", sum/float64(len(vs)))
+}
+
+// median is the middle of vs, "0" when empty; vs is sorted in place.
+func median(vs []float64) string {
+	if len(vs) == 0 {
+		return "0"
+	}
+	sort.Float64s(vs)
+	m := vs[len(vs)/2]
+	if len(vs)%2 == 0 {
+		m = (vs[len(vs)/2-1] + m) / 2
+	}
+	return fmt.Sprintf("%.0f", m)
+}
+
+// missedTypes are call types operators give calls that were not
+// answered, whatever duration the row states.
+var missedTypes = []string{"MISSED", "UNANSWERED", "NO_ANSWER", "NOANSWER"}
+
+// missed reports whether a call went unanswered: a missed call type, or
+// a duration of zero. Suspects signal with rings they never mean to be
+// picked up.
+func missed(callType, duration string) bool {
+	ct := strings.ToUpper(callType)
+	for _, t := range missedTypes {
+		if strings.Contains(ct, t) {
+			return true
+		}
+	}
+	d, err := strconv.ParseFloat(duration, 64)
+	return err == nil && d == 0
+}
+
+type cell struct {
+	CellID, Addr, Lat, Lon, Azimuth, Roaming string
+	TotalCalls                               int
+	Hours                                    [24]int // calls by hour of day, of rows with a readable time
+	First, Last                              span
+}
+
+// fix is one record placing the target at a tower.
+type fix struct {
+	At                            span
+	CellID, Addr, Lat, Lon, Event string
+}
+
+// handover is a call that began on one tower and ended on another: the
+// target moved during it.
+type handover struct {
+	At                               span
+	BParty, Event, Duration          string
+	First, FirstAddr, Last, LastAddr string
+}
+
+type smsClass struct {
+	Name        string
+	Messages    int
+	Senders     map[string]struct{}
+	First, Last span
+}
+
+// span keeps both the raw text and the parsed time so rows whose date does
+// not parse still order sensibly (by text) among themselves.
+type span struct {
+	raw string
+	t   time.Time
+}
+
+func (s span) before(o span) bool {
+	if !s.t.IsZero() && !o.t.IsZero() {
+		return s.t.Before(o.t)
+	}
+	return s.raw < o.raw
+}
+
+func (s span) String() string {
+	if !s.t.IsZero() {
+		return s.t.Format(stamp)
+	}
+	return s.raw
+}
+
+// Builder accumulates canonical rows for one target number.
+type Builder struct {
+	CDR            string
+	ExcludeService bool // skip rows with a service number B party
+
+	operator  string // the target's, as the rows give it
+	circle    string
+	parties   map[string]*party
+	cells     map[string]*cell
+	classes   map[string]*smsClass
+	fixes     []fix
+	handovers []handover
+}
+
+// New returns an empty Builder for cdr.
+func New(cdr string, excludeService bool) *Builder {
+	return &Builder{CDR: cdr, ExcludeService: excludeService,
+		parties: map[string]*party{}, cells: map[string]*cell{}, classes: map[string]*smsClass{}}
+}
+
+// Add folds one canonical row (layout described by col) into the totals.
+func (b *Builder) Add(row []string, col map[string]int) {
+	get := func(name string) string { return canon.Get(row, col, name) }
+	if b.operator == "" {
+		b.operator = get("Operator")
+	}
+	if b.circle == "" {
+		b.circle = get("Circle")
+	}
+	at := span{raw: strings.TrimSpace(get("Date") + " " + get("Time"))}
+	at.t, _ = canon.ParseDateTime(get("Date"), get("Time"))
+
+	// A2P SMS are mostly service senders; count them before those are left out
+	if name := get("SMS Category"); name != "" {
+		c, ok := b.classes[name]
+		if !ok {
+			c = &smsClass{Name: name, Senders: map[string]struct{}{}}
+			b.classes[name] = c
+		}
+		c.Messages++
+		c.Senders[strings.ToUpper(get("B Party"))] = struct{}{}
+		widen(&c.First, &c.Last, at)
+	}
+	if b.ExcludeService && get("Service Number") == "Yes" {
+		return
+	}
+	key := canon.Party(get("B Party"))
+	if key == "" {
+		key = "(blank)"
+	}
+	a, ok := b.parties[key]
+	if !ok {
+		a = &party{
+			BParty: key, SDR: get("B Party Operator"), Provider: get("B Party Provider"), Type: get("Type"),
+			Days: map[string]struct{}{}, CellIds: map[string]struct{}{},
+			Imeis: map[string]struct{}{}, Imsis: map[string]struct{}{}, Active: map[string]struct{}{},
+		}
+		b.parties[key] = a
+	}
+	// one party may be written several ways, not all rows carrying the LRN
+	if a.SDR == "" {
+		a.SDR = get("B Party Operator")
+	}
+	if a.Provider == "" {
+		a.Provider = get("B Party Provider")
+	}
+
+	// SMS or call, made or received and roaming or not as the record
+	// class rules tell, alike for every TSP
+	ct := get("Call Type")
+	class := canon.Classify(row, col)
+	sms := class.SMS
+	a.TotalCalls++
+	switch {
+	case !sms && class.Direction == canon.Caller:
+		a.OutCalls++
+	case !sms && class.Direction == canon.Callee:
+		a.InCalls++
+	case sms && class.Direction == canon.Caller:
+		a.OutSMS++
+	case sms:
+		a.InSMS++
+	default:
+		a.OtherCalls++
+	}
+	if class.Roaming {
+		if sms {
+			a.RoamSMS++
+		} else {
+			a.RoamCalls++
+		}
+	}
+	if !sms && missed(ct, get("Duration")) {
+		a.Missed++
+		switch class.Direction {
+		case canon.Caller:
+			a.MissedOut++
+		case canon.Callee:
+			a.MissedIn++
+		}
+	}
+	if d, err := strconv.ParseFloat(get("Duration"), 64); err == nil {
+		a.TotalDuration += d
+		if !sms {
+			a.CallDurations = append(a.CallDurations, d)
+			switch class.Direction {
+			case canon.Caller:
+				a.OutDuration.add(d)
+			case canon.Callee:
+				a.InDuration.add(d)
+			}
+		}
+	}
+	a.Days[get("Date")] = struct{}{}
+	first, last := get("First Cell ID"), get("Last Cell ID")
+	for _, id := range []string{first, last} {
+		if id != "" {
+			a.CellIds[id] = struct{}{}
+		}
+	}
+	if v := get("IMEI"); v != "" {
+		a.Imeis[v] = struct{}{}
+	}
+	if v := get("IMSI"); v != "" {
+		a.Imsis[v] = struct{}{}
+	}
+
+	widen(&a.First, &a.Last, at)
+	if !at.t.IsZero() {
+		a.Active[at.t.Format("2006-01-02")] = struct{}{}
+	} else if d := get("Date"); d != "" {
+		a.Active[d] = struct{}{}
+	}
+
+	if !sms && first != "" && last != "" && first != last {
+		b.handovers = append(b.handovers, handover{
+			At: at, BParty: get("B Party"), Event: ct, Duration: get("Duration"),
+			First: first, FirstAddr: get("First Cell ID Address"), Last: last, LastAddr: get("Last Cell ID Address"),
+		})
+	}
+	if first == "" {
+		return
+	}
+	f := fix{At: at, CellID: first, Addr: get("First Cell ID Address"), Event: ct}
+	if parts := strings.Split(get("Lat-Long-Azimuth (First CellID)"), ","); len(parts) >= 2 {
+		f.Lat, f.Lon = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	}
+	b.fixes = append(b.fixes, f)
+	c, ok := b.cells[first]
+	if !ok {
+		c = &cell{CellID: first, Addr: get("First Cell ID Address"), Roaming: get("Roaming")}
+		parts := strings.Split(get("Lat-Long-Azimuth (First CellID)"), ",")
+		if len(parts) >= 2 {
+			c.Lat, c.Lon = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		}
+		if len(parts) == 3 {
+			c.Azimuth = strings.TrimSpace(parts[2])
+		}
+		b.cells[first] = c
+	}
+	c.TotalCalls++
+	if !at.t.IsZero() {
+		c.Hours[at.t.Hour()]++
+	}
+	widen(&c.First, &c.Last, at)
+}
+
+// spanDays counts the calendar days from a's first contact to its last,
+// both included; "" when either date is unreadable.
+func spanDays(a *party) string {
+	if a.First.t.IsZero() || a.Last.t.IsZero() {
+		return ""
+	}
+	day := func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC) }
+	return strconv.Itoa(int(day(a.Last.t).Sub(day(a.First.t)).Hours()/24) + 1)
+}
+
+// perDay is a's calls per active day, "" when no row had a date.
+func perDay(a *party) string {
+	if len(a.Active) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", float64(a.TotalCalls)/float64(len(a.Active)))
+}
+
+func widen(first, last *span, at span) {
+	if first.raw == "" || at.before(*first) {
+		*first = at
+	}
+	if last.raw == "" || last.before(at) {
+		*last = at
+	}
+}
+
+// Write writes <prefix>_summary_reports.csv, _max_calls_, _max_duration_,
+// _max_stay_, _sms_categories_, _tower_hours_, _location_timeline_ and
+// _handover_ reports and returns their paths in that order.
+func (b *Builder) Write(prefix string) ([]string, error) {
+	ps := make([]*party, 0, len(b.parties))
+	for _, p := range b.parties {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].BParty < ps[j].BParty })
+
+	var (
+		summary [][]string
+		total   int
+	)
+	summary = append(summary, []string{
+		"CdrNo", "Home Operator", "Home Circle", "B Party", "B Party SDR", "Provider", "Type",
+		"Total Calls", "Out Calls", "In Calls", "Out Sms", "In Sms",
+		"Other Calls", "Roam Calls", "Roam Sms", "Total Duration",
+		"Out Duration", "Avg Out Duration", "Max Out Duration",
+		"In Duration", "Avg In Duration", "Max In Duration",
+		"Avg Call Duration", "Median Call Duration", "Missed Calls", "Missed Out", "Missed In",
+		"Total Days", "Total CellIds", "Total Imei", "Total Imsi",
+		"First Call", "Last Call",
+		"Active Days", "Span Days", "Calls per Active Day",
+	})
+	for _, a := range ps {
+		total += a.TotalCalls
+		summary = append(summary, []string{
+			b.CDR, b.operator, b.circle, a.BParty, a.SDR, a.Provider, a.Type,
+			strconv.Itoa(a.TotalCalls), strconv.Itoa(a.OutCalls), strconv.Itoa(a.InCalls),
+			strconv.Itoa(a.OutSMS), strconv.Itoa(a.InSMS), strconv.Itoa(a.OtherCalls),
+			strconv.Itoa(a.RoamCalls), strconv.Itoa(a.RoamSMS),
+			fmt.Sprintf("%.0f", a.TotalDuration),
+			fmt.Sprintf("%.0f", a.OutDuration.Total), a.OutDuration.average(), fmt.Sprintf("%.0f", a.OutDuration.Max),
+			fmt.Sprintf("%.0f", a.InDuration.Total), a.InDuration.average(), fmt.Sprintf("%.0f", a.InDuration.Max),
+			average(a.CallDurations), median(a.CallDurations),
+			strconv.Itoa(a.Missed), strconv.Itoa(a.MissedOut), strconv.Itoa(a.MissedIn),
+			strconv.Itoa(len(a.Days)), strconv.Itoa(len(a.CellIds)),
+			strconv.Itoa(len(a.Imeis)), strconv.Itoa(len(a.Imsis)),
+			a.First.String(), a.Last.String(),
+			strconv.Itoa(len(a.Active)), spanDays(a),
+			perDay(a),
+		})
+	}
+
+	provider := func(a *party) string {
+		if a.Provider == "" {
+			return "Unknown"
+		}
+		return a.Provider
+	}
+	sort.SliceStable(ps, func(i, j int) bool { return ps[i].TotalCalls > ps[j].TotalCalls })
+	calls := [][]string{
+		{"CdrNo", "B Party", "B Party SDR", "Total Calls", "Provider"},
+		{"Total", b.CDR, "", strconv.Itoa(total), ""},
+	}
+	for _, a := range ps {
+		calls = append(calls, []string{b.CDR, a.BParty, "", strconv.Itoa(a.TotalCalls), provider(a)})
+	}
+	sort.SliceStable(ps, func(i, j int) bool { return ps[i].TotalDuration > ps[j].TotalDuration })
+	durations := [][]string{{"CdrNo", "B Party", "B Party SDR", "Total Duration", "Provider"}}
+	for _, a := range ps {
+		durations = append(durations, []string{b.CDR, a.BParty, "", fmt.Sprintf("%.0f", a.TotalDuration), provider(a)})
+	}
+
+	cs := make([]*cell, 0, len(b.cells))
+	for _, c := range b.cells {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].TotalCalls != cs[j].TotalCalls {
+			return cs[i].TotalCalls > cs[j].TotalCalls
+		}
+		return cs[i].CellID < cs[j].CellID
+	})
+	or := func(s, def string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	}
+	stay := [][]string{{
+		"CdrNo", "Cell ID", "Total Calls", "Tower Address", "Latitude", "Longitude", "Azimuth", "Roaming", "First Call", "Last Call",
+	}}
+	for _, c := range cs {
+		stay = append(stay, []string{
+			b.CDR, c.CellID, strconv.Itoa(c.TotalCalls), or(c.Addr, "Unknown"),
+			or(c.Lat, "0"), or(c.Lon, "0"), or(c.Azimuth, "0"), or(c.Roaming, "Unknown"),
+			c.First.String(), c.Last.String(),
+		})
+	}
+
+	// towers by hour of day, in the order of max stay: where the target
+	// works its shifts and where it spends the night
+	hours := [][]string{{"CdrNo", "Cell ID", "Tower Address"}}
+	for h := 0; h < 24; h++ {
+		hours[0] = append(hours[0], fmt.Sprintf("%02d", h))
+	}
+	hours[0] = append(hours[0], "Total Calls")
+	for _, c := range cs {
+		row := []string{b.CDR, c.CellID, or(c.Addr, "Unknown")}
+		for _, n := range c.Hours {
+			row = append(row, strconv.Itoa(n))
+		}
+		hours = append(hours, append(row, strconv.Itoa(c.TotalCalls)))
+	}
+
+	// the movement log, oldest first, to print as an annexure on its own;
+	// the speed from the last located record backs or refutes a claim to
+	// have been elsewhere
+	sort.SliceStable(b.fixes, func(i, j int) bool { return b.fixes[i].At.before(b.fixes[j].At) })
+	timeline := [][]string{{
+		"CdrNo", "Date Time", "Cell ID", "Tower Address", "Latitude", "Longitude", "Event",
+		"Km from Previous", "Minutes from Previous", "Speed (km/h)",
+	}}
+	var prev *fix
+	for i := range b.fixes {
+		f := &b.fixes[i]
+		km, minutes, speed := "", "", ""
+		lat, lon, ok := canon.ParseLatLong(f.Lat + "," + f.Lon)
+		if ok && !f.At.t.IsZero() {
+			if prev != nil {
+				plat, plon, _ := canon.ParseLatLong(prev.Lat + "," + prev.Lon)
+				d, dt := canon.Distance(plat, plon, lat, lon), f.At.t.Sub(prev.At.t).Hours()
+				km, minutes = fmt.Sprintf("%.2f", d), fmt.Sprintf("%.0f", dt*60)
+				switch {
+				case dt > 0:
+					speed = fmt.Sprintf("%.1f", d/dt)
+				case d == 0:
+					speed = "0.0"
+				}
+			}
+			prev = f
+		}
+		timeline = append(timeline, []string{
+			b.CDR, f.At.String(), f.CellID, or(f.Addr, "Unknown"), or(f.Lat, "0"), or(f.Lon, "0"), f.Event,
+			km, minutes, speed,
+		})
+	}
+
+	// calls the target moved during, both towers placed: the last cell's
+	// coordinates are known when another record began on it
+	sort.SliceStable(b.handovers, func(i, j int) bool { return b.handovers[i].At.before(b.handovers[j].At) })
+	moves := [][]string{{
+		"CdrNo", "Date Time", "B Party", "Call Type", "Duration",
+		"First Cell ID", "First Tower Address", "First Latitude", "First Longitude",
+		"Last Cell ID", "Last Tower Address", "Last Latitude", "Last Longitude", "Km Moved",
+	}}
+	for _, h := range b.handovers {
+		var flat, flon, llat, llon string
+		if c := b.cells[h.First]; c != nil {
+			flat, flon = c.Lat, c.Lon
+		}
+		if c := b.cells[h.Last]; c != nil {
+			llat, llon = c.Lat, c.Lon
+			if h.LastAddr == "" {
+				h.LastAddr = c.Addr
+			}
+		}
+		km := ""
+		if lat1, lon1, ok := canon.ParseLatLong(flat + "," + flon); ok {
+			if lat2, lon2, ok := canon.ParseLatLong(llat + "," + llon); ok {
+				km = fmt.Sprintf("%.2f", canon.Distance(lat1, lon1, lat2, lon2))
+			}
+		}
+		moves = append(moves, []string{
+			b.CDR, h.At.String(), h.BParty, h.Event, h.Duration,
+			h.First, or(h.FirstAddr, "Unknown"), flat, flon,
+			h.Last, or(h.LastAddr, "Unknown"), llat, llon, km,
+		})
+	}
+
+	ks := make([]*smsClass, 0, len(b.classes))
+	for _, c := range b.classes {
+		ks = append(ks, c)
+	}
+	sort.Slice(ks, func(i, j int) bool {
+		if ks[i].Messages != ks[j].Messages {
+			return ks[i].Messages > ks[j].Messages
+		}
+		return ks[i].Name < ks[j].Name
+	})
+	classes := [][]string{{"CdrNo", "SMS Category", "Messages", "Senders", "First SMS", "Last SMS"}}
+	for _, c := range ks {
+		classes = append(classes, []string{
+			b.CDR, c.Name, strconv.Itoa(c.Messages), strconv.Itoa(len(c.Senders)),
+			c.First.String(), c.Last.String(),
+		})
+	}
+
+	var out []string
+	for _, f := range []struct {
+		name string
+		rows [][]string
+	}{
+		{"_summary_reports.csv", summary},
+		{"_max_calls_reports.csv", calls},
+		{"_max_duration_reports.csv", durations},
+		{"_max_stay_reports.csv", stay},
+		{"_sms_categories_reports.csv", classes},
+		{"_tower_hours_reports.csv", hours},
+		{"_location_timeline_reports.csv", timeline},
+		{"_handover_reports.csv", moves},
+	} {
+		p := prefix + f.name
+		if err := writeCSV(p, f.rows); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func writeCSV(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := safecsv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
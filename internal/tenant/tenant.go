@@ -0,0 +1,194 @@
+// Package tenant lets several police units share one deployment while each
+// sees only its own jobs, reports and case data.
+//
+// Tenants are enabled by CDR_TENANTS_FILE, a table of API keys:
+//
+//	key,tenant,role,quota_mb
+//	3f9c…,cyber-indore,,2048
+//	77ab…,hq,admin,
+//
+// Every API request then has to present a key in X-API-Key (or as
+// Authorization: Bearer <key>). Only admin keys may use /admin/ routes.
+// Behind a proxy that authenticates users itself, CDR_TENANT_HEADER names
+// a header the proxy sets to the tenant instead; admin routes then need
+// the tenant named by CDR_ADMIN_TENANT.
+//
+// quota_mb overrides CDR_QUOTA_MB for the tenant (see quota).
+//
+// Without either variable the service has a single, unnamed tenant ("")
+// and requests are not authenticated.
+package tenant
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type entry struct {
+	key, tenant string
+	admin       bool
+	quotaMB     int64
+}
+
+var (
+	keys   []entry
+	header = os.Getenv("CDR_TENANT_HEADER")
+)
+
+// valid tenant IDs double as directory names
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+func init() {
+	p := os.Getenv("CDR_TENANTS_FILE")
+	if p == "" {
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		log.Fatalf("tenants: %v", err)
+	}
+	defer f.Close()
+	if keys, err = load(f); err != nil {
+		log.Fatalf("tenants: %s: %v", p, err)
+	}
+	if len(keys) == 0 {
+		log.Fatalf("tenants: %s has no keys", p)
+	}
+}
+
+func load(f io.Reader) ([]entry, error) {
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	if _, err := r.Read(); err != nil { // header
+		return nil, err
+	}
+	var out []entry
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) < 2 {
+			continue
+		}
+		e := entry{key: strings.TrimSpace(rec[0]), tenant: strings.TrimSpace(rec[1])}
+		if len(rec) > 2 {
+			e.admin = strings.EqualFold(strings.TrimSpace(rec[2]), "admin")
+		}
+		if len(rec) > 3 && strings.TrimSpace(rec[3]) != "" {
+			if e.quotaMB, err = strconv.ParseInt(strings.TrimSpace(rec[3]), 10, 64); err != nil || e.quotaMB < 0 {
+				return nil, fmt.Errorf("bad quota_mb in row %q", strings.Join(rec, ","))
+			}
+		}
+		if e.key == "" || !Valid(e.tenant) {
+			return nil, fmt.Errorf("bad row %q", strings.Join(rec, ","))
+		}
+		out = append(out, e)
+	}
+}
+
+// Enabled reports whether requests are scoped to tenants.
+func Enabled() bool { return len(keys) > 0 || header != "" }
+
+// Valid reports whether id can name a tenant.
+func Valid(id string) bool { return validID.MatchString(id) }
+
+// FromRequest authenticates r, returning its tenant and whether it is an
+// admin. ok is false when tenants are enabled and r has no valid
+// credentials.
+func FromRequest(r *http.Request) (id string, admin, ok bool) {
+	if !Enabled() {
+		return "", true, true
+	}
+	if header != "" {
+		id = strings.TrimSpace(r.Header.Get(header))
+		return id, id != "" && id == os.Getenv("CDR_ADMIN_TENANT"), Valid(id)
+	}
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if key == "" {
+		return "", false, false
+	}
+	for _, e := range keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(e.key)) == 1 {
+			return e.tenant, e.admin, true
+		}
+	}
+	return "", false, false
+}
+
+// QuotaMB returns the storage limit set for tenant id in the tenants
+// file, and whether one is set.
+func QuotaMB(id string) (int64, bool) {
+	for _, e := range keys {
+		if e.tenant == id && e.quotaMB > 0 {
+			return e.quotaMB, true
+		}
+	}
+	return 0, false
+}
+
+type ctxKey struct{}
+
+type caller struct {
+	id    string
+	admin bool
+}
+
+// Of returns the tenant Middleware attached to r.
+func Of(r *http.Request) string {
+	c, _ := r.Context().Value(ctxKey{}).(caller)
+	return c.id
+}
+
+// Admin reports whether r was made with an admin key, or tenants are
+// disabled.
+func Admin(r *http.Request) bool {
+	if !Enabled() {
+		return true
+	}
+	c, _ := r.Context().Value(ctxKey{}).(caller)
+	return c.admin
+}
+
+// Middleware authenticates every request to next except those under the
+// public path prefixes, and attaches the tenant for Of.
+func Middleware(next http.Handler, public ...string) http.Handler {
+	if !Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range public {
+			if strings.HasPrefix(r.URL.Path, p) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		id, admin, ok := FromRequest(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cdr-filter"`)
+			http.Error(w, "missing or unknown API key", http.StatusUnauthorized)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/admin/") && !admin {
+			http.Error(w, "admin key required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, caller{id, admin})))
+	})
+}
@@ -0,0 +1,138 @@
+package upload
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/archive"
+	"github.com/jalad-shrimali/cdr-filter/internal/clamav"
+	"github.com/jalad-shrimali/cdr-filter/internal/pdftable"
+	"github.com/jalad-shrimali/cdr-filter/internal/workbook"
+)
+
+// ErrTooLarge marks an upload over the size cap.
+var ErrTooLarge = fmt.Errorf("%w: file too large", ErrRejected)
+
+// MaxBytes returns the upload size cap: CDR_UPLOAD_MAX_MB megabytes,
+// default 512.
+func MaxBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("CDR_UPLOAD_MAX_MB"), 10, 64); err == nil && v > 0 {
+		return v << 20
+	}
+	return 512 << 20
+}
+
+func tooLarge() error {
+	return fmt.Errorf("%w: the limit is %d MB", ErrTooLarge, MaxBytes()>>20)
+}
+
+// Check makes sure a stored upload holds what its extension says, so a
+// renamed executable or image is refused before any parser reads it, and
+// has a ClamAV daemon scan it when one is configured (see package clamav).
+// A scan that cannot be made refuses the file too.
+func Check(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := sniff(f, strings.ToLower(filepath.Ext(path))); err != nil {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	addr := clamav.Addr()
+	if addr == "" {
+		return nil
+	}
+	err = clamav.Scan(addr, f)
+	var infected *clamav.Infected
+	if errors.As(err, &infected) {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	return err
+}
+
+// sniff checks the first bytes of f against the extension it came with.
+func sniff(f *os.File, ext string) error {
+	switch ext {
+	case ".pdf":
+		if !pdftable.Is(f) {
+			return errors.New("not a PDF file")
+		}
+		return nil
+	case ".xlsx", ".xls":
+		if !workbook.Is(f) {
+			return errors.New("not an Excel workbook")
+		}
+		return checkXLSX(f)
+	}
+	if archive.Is(ext) {
+		if !archive.Sniff(ext, f) {
+			return fmt.Errorf("not a %s archive", strings.TrimPrefix(ext, "."))
+		}
+		return nil
+	}
+	// .csv and .txt: workbooks saved under a .csv name are read as such
+	if workbook.Is(f) {
+		return checkXLSX(f)
+	}
+	head := make([]byte, 64<<10)
+	n, _ := f.ReadAt(head, 0)
+	head = head[:n]
+	if bytes.HasPrefix(head, []byte{0xFF, 0xFE}) || bytes.HasPrefix(head, []byte{0xFE, 0xFF}) {
+		return errors.New("UTF-16 text; save the export as a UTF-8 or ANSI CSV")
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return errors.New("binary content, not a text export")
+	}
+	return nil
+}
+
+// checkXLSX makes sure a ZIP is an Excel workbook rather than any other
+// archive; an .xls passes as it is.
+func checkXLSX(f *os.File) error {
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, st.Size())
+	if err == zip.ErrFormat {
+		return nil // the binary .xls format
+	}
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		if strings.HasPrefix(zf.Name, "xl/") {
+			return nil
+		}
+	}
+	return errors.New("a ZIP archive, not an Excel workbook")
+}
+
+// Status maps a Store or Check error to an HTTP status code.
+func Status(err error) int {
+	switch {
+	case errors.Is(err, ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrRejected):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// copyCapped copies r to w, failing with ErrTooLarge past MaxBytes.
+func copyCapped(w io.Writer, r io.Reader) error {
+	n, err := io.Copy(w, io.LimitReader(r, MaxBytes()+1))
+	if err == nil && n > MaxBytes() {
+		return tooLarge()
+	}
+	return err
+}
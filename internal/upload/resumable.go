@@ -0,0 +1,280 @@
+package upload
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+   Resumable uploads follow the core of the tus 1.0 protocol plus its
+   "creation" extension, so stock tus clients work:
+
+     POST  /files        Upload-Length, Upload-Metadata → 201, Location
+     HEAD  /files/{id}   → Upload-Offset, Upload-Length
+     PATCH /files/{id}   Upload-Offset + application/offset+octet-stream
+
+   Upload-Metadata carries filename plus the usual form fields (tsp_type,
+   crime_number, …). Chunks are appended to uploads/<id>/<name>.part; the
+   PATCH that completes the file hands it to the complete callback, whose
+   response is returned to the client. An upload left unfinished for
+   CDR_RESUMABLE_TTL (24h by default) is removed, at startup and whenever
+   another one begins.
+*/
+
+const tusVersion = "1.0.0"
+
+type pending struct {
+	Name   string     `json:"name"`
+	Length int64      `json:"length"`
+	Meta   url.Values `json:"meta"`
+}
+
+var tusLocks sync.Map // id → *sync.Mutex
+
+// RegisterResumable adds the /files routes to mux. complete receives the
+// completing request, the stored path (as returned by Store) and the
+// upload metadata.
+func RegisterResumable(mux *http.ServeMux, complete func(w http.ResponseWriter, r *http.Request, path string, meta url.Values)) {
+	sweep()
+	mux.HandleFunc("OPTIONS /files", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", "creation")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /files", tusCreate)
+	mux.HandleFunc("HEAD /files/{id}", tusHead)
+	mux.HandleFunc("PATCH /files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		tusPatch(w, r, complete)
+	})
+}
+
+func tusCreate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "missing or invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if length > MaxBytes() {
+		http.Error(w, tooLarge().Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	meta, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	safe := SafeName(meta.Get("filename"))
+	if ext := strings.ToLower(filepath.Ext(safe)); !allowedExt[ext] {
+		http.Error(w, fmt.Sprintf("%v: file type %q not accepted", ErrRejected, ext), http.StatusBadRequest)
+		return
+	}
+	sweep()
+	id := NewID()
+	dir := filepath.Join(Dir, id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p := &pending{Name: safe, Length: length, Meta: meta}
+	b, _ := json.Marshal(p)
+	if err := os.WriteFile(filepath.Join(dir, ".tus.json"), b, 0o600); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, safe+".part"), nil, 0o600); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// relative, so it resolves under whichever prefix the client used
+	w.Header().Set("Location", "files/"+id)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func tusHead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+	id := r.PathValue("id")
+	p, off, err := loadPending(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(off, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(p.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+func tusPatch(w http.ResponseWriter, r *http.Request, complete func(http.ResponseWriter, *http.Request, string, url.Values)) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	id := r.PathValue("id")
+	m, _ := tusLocks.LoadOrStore(id, new(sync.Mutex))
+	mu := m.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+
+	p, off, err := loadPending(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	want, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || want != off {
+		http.Error(w, fmt.Sprintf("Upload-Offset must be %d", off), http.StatusConflict)
+		return
+	}
+	part := filepath.Join(Dir, id, p.Name+".part")
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	n, cerr := io.Copy(f, io.LimitReader(r.Body, p.Length-off))
+	if err := f.Close(); cerr == nil {
+		cerr = err
+	}
+	off += n
+	w.Header().Set("Upload-Offset", strconv.FormatInt(off, 10))
+	if cerr != nil {
+		// bytes already written stay; the client resumes from the new offset
+		http.Error(w, cerr.Error(), http.StatusInternalServerError)
+		return
+	}
+	if off < p.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	dst := filepath.Join(Dir, id, p.Name)
+	if err := os.Rename(part, dst); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	os.Remove(filepath.Join(Dir, id, ".tus.json"))
+	tusLocks.Delete(id)
+	if err := Check(dst); err != nil {
+		os.RemoveAll(filepath.Join(Dir, id))
+		http.Error(w, err.Error(), Status(err))
+		return
+	}
+	complete(w, r, dst, p.Meta)
+}
+
+// ResumableTTL is how long an unfinished resumable upload is kept since
+// its last chunk (CDR_RESUMABLE_TTL, 24h by default).
+func ResumableTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CDR_RESUMABLE_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 24 * time.Hour
+}
+
+// sweep removes the unfinished uploads older than ResumableTTL, logging
+// a failure instead of failing the request that started it.
+func sweep() {
+	if n, err := SweepPartial(time.Now().Add(-ResumableTTL())); err != nil {
+		log.Printf("upload: removing abandoned uploads: %v", err)
+	} else if n > 0 {
+		log.Printf("upload: removed %d abandoned resumable uploads", n)
+	}
+}
+
+// SweepPartial removes the unfinished resumable uploads not written to
+// since before, but for any receiving a chunk now, and returns how many
+// it removed.
+func SweepPartial(before time.Time) (int, error) {
+	entries, err := os.ReadDir(Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		id := e.Name()
+		p, _, err := loadPending(id)
+		if err != nil {
+			continue // finished, or not a resumable upload
+		}
+		last := time.Time{}
+		for _, f := range []string{".tus.json", p.Name + ".part"} {
+			if fi, err := os.Stat(filepath.Join(Dir, id, f)); err == nil && fi.ModTime().After(last) {
+				last = fi.ModTime()
+			}
+		}
+		if !last.Before(before) {
+			continue
+		}
+		m, _ := tusLocks.LoadOrStore(id, new(sync.Mutex))
+		mu := m.(*sync.Mutex)
+		if !mu.TryLock() {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(Dir, id))
+		tusLocks.Delete(id)
+		mu.Unlock()
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// loadPending returns the state of an unfinished upload and its offset.
+func loadPending(id string) (*pending, int64, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, 0, errors.New("unknown upload")
+	}
+	b, err := os.ReadFile(filepath.Join(Dir, id, ".tus.json"))
+	if err != nil {
+		return nil, 0, errors.New("unknown upload")
+	}
+	p := &pending{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, 0, err
+	}
+	fi, err := os.Stat(filepath.Join(Dir, id, p.Name+".part"))
+	if err != nil {
+		return nil, 0, err
+	}
+	return p, fi.Size(), nil
+}
+
+// parseMetadata decodes "key base64value,key2 base64value2".
+func parseMetadata(h string) (url.Values, error) {
+	v := url.Values{}
+	for _, pair := range strings.Split(h, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, enc, _ := strings.Cut(pair, " ")
+		b, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, fmt.Errorf("Upload-Metadata %q: %v", k, err)
+		}
+		v.Set(k, string(b))
+	}
+	return v, nil
+}
@@ -0,0 +1,59 @@
+package upload
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSweepPartial checks that only resumable uploads left unfinished
+// past the cut-off are removed: fresh ones and finished uploads stay.
+func TestSweepPartial(t *testing.T) {
+	t.Chdir(t.TempDir())
+	old := time.Now().Add(-48 * time.Hour)
+	mk := func(id string, unfinished bool, mod time.Time) {
+		t.Helper()
+		dir := filepath.Join(Dir, id)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		files := []string{"cdr.csv"}
+		if unfinished {
+			b, _ := json.Marshal(pending{Name: "cdr.csv", Length: 10})
+			if err := os.WriteFile(filepath.Join(dir, ".tus.json"), b, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			files = []string{".tus.json", "cdr.csv.part"}
+		}
+		for _, f := range files {
+			p := filepath.Join(dir, f)
+			if f != ".tus.json" {
+				if err := os.WriteFile(p, []byte("12345"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Chtimes(p, mod, mod); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	mk("abandoned", true, old)
+	mk("active", true, time.Now())
+	mk("finished", false, old)
+
+	n, err := SweepPartial(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("removed %d uploads, want 1", n)
+	}
+	for id, want := range map[string]bool{"abandoned": false, "active": true, "finished": true} {
+		_, err := os.Stat(filepath.Join(Dir, id))
+		if got := err == nil; got != want {
+			t.Errorf("%s kept = %v, want %v", id, got, want)
+		}
+	}
+}
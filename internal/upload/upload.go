@@ -0,0 +1,105 @@
+// Package upload stores incoming CDR files under generated IDs so client
+// supplied file names can never escape the uploads directory. Files over
+// the size cap, or whose content is not what their extension says, are
+// refused (see Check).
+package upload
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Dir is where uploads are stored, one sub-directory per upload ID.
+const Dir = "uploads"
+
+// ErrRejected marks client errors (bad name, extension or file type).
+var ErrRejected = errors.New("upload rejected")
+
+// accepted file extensions: exports, and the archives package archive
+// reads them from (.tar.gz and .csv.gz end in .gz)
+var allowedExt = map[string]bool{
+	".csv": true, ".xlsx": true, ".xls": true, ".txt": true, ".pdf": true,
+	".zip": true, ".tar": true, ".gz": true, ".tgz": true, ".bz2": true, ".tbz2": true, ".tbz": true,
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._ -]+`)
+
+// SafeName reduces a client file name to its base name with only
+// conservative characters left.
+func SafeName(name string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	name = filepath.Base(filepath.Clean("/" + name))
+	name = unsafeChars.ReplaceAllString(name, "_")
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name == "" || name == "/" {
+		return "upload"
+	}
+	return name
+}
+
+// NewID returns a random 16-hex-digit identifier.
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ID returns the upload ID of a path returned by Store.
+func ID(path string) string { return filepath.Base(filepath.Dir(path)) }
+
+// Store writes r to uploads/<id>/<safe name>, checks it and returns that
+// path. A file refused is removed again.
+func Store(r io.Reader, name string) (string, error) {
+	safe := SafeName(name)
+	if ext := strings.ToLower(filepath.Ext(safe)); !allowedExt[ext] {
+		return "", fmt.Errorf("%w: file type %q not accepted", ErrRejected, ext)
+	}
+	dir := filepath.Join(Dir, NewID())
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, safe)
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	err = copyCapped(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = Check(dst)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dst, nil
+}
+
+// Reissue moves a path returned by Store under a new upload ID, for a job
+// run again from the same file, and returns its new path.
+func Reissue(path string) (string, error) {
+	dir := filepath.Join(Dir, NewID())
+	if err := os.Rename(filepath.Dir(path), dir); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// Keep reports whether raw uploads are kept once processed
+// (CDR_KEEP_UPLOADS=1). By default they are removed: the reports and the
+// job's record snapshot are what is delivered and kept. The upload of a
+// failed job is kept either way, to be retried.
+func Keep() bool { return os.Getenv("CDR_KEEP_UPLOADS") == "1" }
+
+// Discard removes a path returned by Store together with its upload
+// directory.
+func Discard(path string) error { return os.RemoveAll(filepath.Dir(path)) }
@@ -0,0 +1,188 @@
+// Package validate checks a normalized report against the mandatory
+// columns of its TSP's profile. In strict mode a failed check rejects the
+// upload with the report instead of returning a mostly-empty result.
+package validate
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+)
+
+/* embedded default profiles; CDR_VALIDATION_FILE overrides them */
+//go:embed data/profiles.csv
+var dataFS embed.FS
+
+type check struct{ tsp, column, kind string }
+
+var profiles refdata.Table[[]check]
+
+func init() { refdata.Load("", "validation profiles", load) }
+
+// load reads the profiles into profiles; on error the current ones stay.
+func load() error {
+	var (
+		f      fs.File
+		err    error
+		source = "embedded"
+	)
+	if p := os.Getenv("CDR_VALIDATION_FILE"); p != "" {
+		f, err = os.Open(p)
+		source = p
+	} else {
+		f, err = dataFS.Open("data/profiles.csv")
+	}
+	if err != nil {
+		return err
+	}
+	f = refdata.Track(f, source)
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	_, _ = r.Read() // header
+	var out []check
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(rec) < 3 {
+			continue
+		}
+		out = append(out, check{
+			strings.ToLower(strings.TrimSpace(rec[0])), strings.TrimSpace(rec[1]),
+			strings.ToLower(strings.TrimSpace(rec[2])),
+		})
+	}
+	profiles.Set(out)
+	return nil
+}
+
+// MaxBad returns the share of rows (percent) allowed to fail in strict
+// mode: CDR_STRICT_MAX_BAD, default 5.
+func MaxBad() float64 {
+	if v, err := strconv.ParseFloat(os.Getenv("CDR_STRICT_MAX_BAD"), 64); err == nil && v >= 0 {
+		return v
+	}
+	return 5
+}
+
+// Report is the outcome of Check. It is also the error returned for a
+// failed strict upload.
+type Report struct {
+	TSP     string
+	Rows    int
+	BadRows int
+	Missing []string       // mandatory columns empty in every row
+	Failed  map[string]int // column → rows failing its check
+	Example map[string]int // column → first failing row (1-based)
+	MaxBad  float64
+}
+
+// OK reports whether the report passes strict mode.
+func (r *Report) OK() bool {
+	return r.Rows > 0 && len(r.Missing) == 0 && r.BadShare() <= r.MaxBad
+}
+
+// BadShare is the percentage of rows failing any check.
+func (r *Report) BadShare() float64 {
+	if r.Rows == 0 {
+		return 100
+	}
+	return 100 * float64(r.BadRows) / float64(r.Rows)
+}
+
+func (r *Report) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "validation failed for %s: ", r.TSP)
+	switch {
+	case r.Rows == 0:
+		b.WriteString("no records parsed")
+	default:
+		fmt.Fprintf(&b, "%d of %d rows (%.1f%%) failed, limit %.1f%%",
+			r.BadRows, r.Rows, r.BadShare(), r.MaxBad)
+	}
+	for _, c := range r.Missing {
+		fmt.Fprintf(&b, "\n  missing column: %s", c)
+	}
+	for _, c := range profileFor(r.TSP) {
+		if n := r.Failed[c.column]; n > 0 && n < r.Rows {
+			fmt.Fprintf(&b, "\n  %s (%s): %d rows, first at row %d", c.column, c.kind, n, r.Example[c.column])
+		}
+	}
+	return b.String()
+}
+
+// profileFor returns the checks for tsp: the "*" rows with any
+// TSP-specific row for the same column taking their place ("optional"
+// drops the column).
+func profileFor(tsp string) []check {
+	var out []check
+	at := map[string]int{}
+	for _, c := range profiles.Get() {
+		if c.tsp != "*" && c.tsp != tsp {
+			continue
+		}
+		if i, ok := at[c.column]; ok {
+			if c.tsp == tsp {
+				out[i] = c
+			}
+			continue
+		}
+		at[c.column] = len(out)
+		out = append(out, c)
+	}
+	kept := out[:0]
+	for _, c := range out {
+		if c.kind != "optional" {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// Check validates the report at path against the profile for tsp.
+func Check(tsp, path string, maxBad float64) (*Report, error) {
+	checks := profileFor(tsp)
+	rep := &Report{TSP: tsp, MaxBad: maxBad, Failed: map[string]int{}, Example: map[string]int{}}
+	err := canon.ScanReport(path, func(header, row []string) error {
+		col := canon.Index(header)
+		rep.Rows++
+		bad := false
+		for _, c := range checks {
+			v := strings.TrimSpace(canon.Get(row, col, c.column))
+			ok := v != ""
+			if ok && c.kind == "datetime" {
+				_, ok = canon.ParseDateTime(v, canon.Get(row, col, "Time"))
+			}
+			if !ok {
+				bad = true
+				if rep.Failed[c.column]++; rep.Failed[c.column] == 1 {
+					rep.Example[c.column] = rep.Rows
+				}
+			}
+		}
+		if bad {
+			rep.BadRows++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range checks {
+		if rep.Rows > 0 && rep.Failed[c.column] == rep.Rows {
+			rep.Missing = append(rep.Missing, c.column)
+		}
+	}
+	return rep, nil
+}
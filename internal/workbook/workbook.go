@@ -0,0 +1,244 @@
+// Package workbook reads one worksheet of an Excel workbook, either the
+// current .xlsx format or the older binary .xls, as rows of cell text, the
+// way the sheet reads once saved as CSV. Operators send CDRs as workbooks
+// more often than not; this spares the manual conversion.
+//
+// Cells formatted as dates or times are written day first
+// (02/01/2006 15:04:05), as Indian operator exports are, and numbers
+// in full, so a 12-digit MSISDN does not turn into 9.19877E+11.
+//
+// Write goes the other way, for the reports delivered as workbooks: plain
+// .xlsx sheets of text and numbers, with links between them and out,
+// protected against editing with a password if one is given.
+package workbook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSheet reports a requested sheet that the workbook does not have.
+var ErrSheet = errors.New("no such sheet")
+
+// maxCols is the number of columns an Excel sheet has, A to XFD.
+const maxCols = 16384
+
+var (
+	xlsxMagic = []byte("PK\x03\x04")
+	xlsMagic  = []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1")
+)
+
+// Is reports whether f starts like a workbook rather than a text export.
+func Is(f io.ReaderAt) bool {
+	b := make([]byte, 8)
+	n, _ := f.ReadAt(b, 0)
+	return bytes.HasPrefix(b[:n], xlsxMagic) || bytes.HasPrefix(b[:n], xlsMagic)
+}
+
+// Reader returns the rows of a worksheet one at a time, as csv.Reader
+// does. Every row is as wide as the widest, blank cells being "".
+type Reader struct {
+	Sheet string // name of the sheet read
+	rows  [][]string
+	lines []int // sheet row number of each of rows
+	line  int   // of the row last read
+}
+
+// Read returns the next row, or io.EOF after the last.
+func (r *Reader) Read() ([]string, error) {
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := r.rows[0]
+	r.rows, r.line, r.lines = r.rows[1:], r.lines[0], r.lines[1:]
+	return row, nil
+}
+
+// FieldPos returns the sheet row, as numbered in Excel, and the 1-based
+// column of field in the row last read, as csv.Reader's FieldPos does
+// for a line of text.
+func (r *Reader) FieldPos(field int) (line, column int) {
+	return r.line, field + 1
+}
+
+// Open reads the sheet named sheet, or the first worksheet when sheet is
+// "", of the workbook f of the given size.
+func Open(f io.ReaderAt, size int64, sheet string) (*Reader, error) {
+	b := make([]byte, 8)
+	n, _ := f.ReadAt(b, 0)
+	switch {
+	case bytes.HasPrefix(b[:n], xlsxMagic):
+		return openXLSX(f, size, sheet)
+	case bytes.HasPrefix(b[:n], xlsMagic):
+		return openXLS(f, size, sheet)
+	}
+	return nil, errors.New("not an Excel workbook")
+}
+
+// pick returns the index of sheet in names, or of the first when sheet is
+// "".
+func pick(names []string, sheet string) (int, error) {
+	if len(names) == 0 {
+		return 0, errors.New("workbook has no worksheets")
+	}
+	if sheet == "" {
+		return 0, nil
+	}
+	for i, n := range names {
+		if strings.EqualFold(strings.TrimSpace(n), strings.TrimSpace(sheet)) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q (have %s)", ErrSheet, sheet, strings.Join(names, ", "))
+}
+
+// grid collects cells by position and lays them out as rows.
+type grid struct {
+	rows  map[int][]string
+	width int
+	first int // number of the sheet's top row: 0 in .xls records, 1 in .xlsx
+}
+
+func (g *grid) set(row, col int, v string) {
+	if v == "" || row < 0 || col < 0 {
+		return
+	}
+	if g.rows == nil {
+		g.rows = map[int][]string{}
+	}
+	r := g.rows[row]
+	for len(r) <= col {
+		r = append(r, "")
+	}
+	r[col] = v
+	g.rows[row] = r
+	if col+1 > g.width {
+		g.width = col + 1
+	}
+}
+
+// reader returns the rows holding any text, top to bottom; a CSV save
+// would keep empty rows inside the used range too, but readers skip
+// those anyway.
+func (g *grid) reader(sheet string) *Reader {
+	nums := make([]int, 0, len(g.rows))
+	for n := range g.rows {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	r := &Reader{Sheet: sheet, rows: make([][]string, len(nums)), lines: make([]int, len(nums))}
+	for i, n := range nums {
+		row := g.rows[n]
+		for len(row) < g.width {
+			row = append(row, "")
+		}
+		r.rows[i], r.lines[i] = row, n-g.first+1
+	}
+	return r
+}
+
+// number formats: the built-in ones that are dates or times, by ID, and
+// custom ones by code
+var builtinDates = map[int]string{
+	14: "d", 15: "d", 16: "d", 17: "d", 18: "t", 19: "t", 20: "t", 21: "t", 22: "dt",
+	45: "t", 46: "e", 47: "t",
+}
+
+var (
+	quoted   = regexp.MustCompile(`"[^"]*"|\\.|_.|\*.`)
+	brackets = regexp.MustCompile(`\[[^\]]*\]`)
+)
+
+// dateKind classifies a custom number format: "d" for a date, "t" for a
+// time of day, "dt" for both, "e" for an elapsed time such as [h]:mm:ss,
+// "" for neither.
+func dateKind(code string) string {
+	code = quoted.ReplaceAllString(code, "")
+	code = strings.ToLower(code)
+	elapsed := strings.Contains(code, "[h") || strings.Contains(code, "[m") || strings.Contains(code, "[s")
+	code = brackets.ReplaceAllString(code, "")
+	if i := strings.IndexByte(code, ';'); i >= 0 {
+		code = code[:i]
+	}
+	if code == "general" || code == "@" {
+		return ""
+	}
+	date := strings.ContainsAny(code, "yd")
+	clock := strings.ContainsAny(code, "hs") || elapsed
+	if !date && !clock && strings.Contains(code, "m") {
+		date = true // mmm yyyy without the year reads as a month
+	}
+	switch {
+	case date && clock:
+		return "dt"
+	case date:
+		return "d"
+	case elapsed:
+		return "e"
+	case clock:
+		return "t"
+	}
+	return ""
+}
+
+// formats maps a cell's style to the kind of date it shows.
+type formats struct {
+	codes    map[int]string // custom number format codes by ID
+	xf       []int          // number format ID by style index
+	date1904 bool
+}
+
+func (f *formats) kind(style int) string {
+	if style < 0 || style >= len(f.xf) {
+		return ""
+	}
+	id := f.xf[style]
+	if k, ok := builtinDates[id]; ok {
+		return k
+	}
+	if code, ok := f.codes[id]; ok {
+		return dateKind(code)
+	}
+	return ""
+}
+
+// number renders a numeric cell of the given style.
+func (f *formats) number(v float64, style int) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return ""
+	}
+	switch k := f.kind(style); k {
+	case "d", "t", "dt", "e":
+		return serialTime(v, f.date1904, k)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// serialTime renders an Excel date serial: days since 30 December 1899,
+// which absorbs Excel's phantom 29 February 1900, or since 1 January 1904
+// in workbooks made on old Macs.
+func serialTime(v float64, date1904 bool, kind string) string {
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	secs := math.Round(v * 86400)
+	t := base.Add(time.Duration(secs) * time.Second)
+	switch kind {
+	case "e":
+		return fmt.Sprintf("%d:%02d:%02d", int(secs)/3600, int(secs)/60%60, int(secs)%60)
+	case "t":
+		return t.Format("15:04:05")
+	case "dt":
+		return t.Format("02/01/2006 15:04:05")
+	}
+	return t.Format("02/01/2006")
+}
@@ -0,0 +1,231 @@
+package workbook
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Cell is one cell of a sheet written by Write: text, a number, or text
+// linking elsewhere.
+type Cell struct {
+	text string
+	num  bool
+	link string // URL, or "#Sheet" for the top of a sheet of the workbook
+}
+
+// Text returns a text cell; numbers such as MSISDNs stay text.
+func Text(s string) Cell { return Cell{text: s} }
+
+// Int returns a number cell.
+func Int(n int) Cell { return Cell{text: strconv.Itoa(n), num: true} }
+
+// Link returns a text cell linking to target: a URL, or "#" and the name
+// of another sheet of the workbook.
+func Link(s, target string) Cell { return Cell{text: s, link: target} }
+
+// Sheet is one worksheet written by Write. Its first row is the header,
+// set in bold.
+type Sheet struct {
+	Name string
+	Rows [][]Cell
+}
+
+// MaxName is the longest sheet name Excel accepts.
+const MaxName = 31
+
+// SheetName makes s a sheet name Excel accepts: without []:*?/\ and no
+// longer than MaxName.
+func SheetName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, s)
+	if r := []rune(s); len(r) > MaxName {
+		s = string(r[:MaxName])
+	}
+	return strings.Trim(s, "'")
+}
+
+// Write writes sheets as an .xlsx workbook to w. Sheet names must be
+// unique, and acceptable to SheetName. A password protects every sheet:
+// it opens read-only and editing needs the password; "" for none. Sheet
+// protection is not encryption: the cells still read without the
+// password, which a workbook encrypted to open would need, and that
+// encryption is not written.
+func Write(w io.Writer, sheets []Sheet, password string) error {
+	z := zip.NewWriter(w)
+	var (
+		types    strings.Builder
+		book     strings.Builder
+		bookRels strings.Builder
+		protect  string
+	)
+	if password != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		protect = protection(password, salt)
+	}
+	for i, s := range sheets {
+		n := i + 1
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&book, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, esc(s.Name), n, n)
+		fmt.Fprintf(&bookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		body, rels := sheetXML(s, protect)
+		if err := put(z, fmt.Sprintf("xl/worksheets/sheet%d.xml", n), body); err != nil {
+			return err
+		}
+		if rels != "" {
+			if err := put(z, fmt.Sprintf("xl/worksheets/_rels/sheet%d.xml.rels", n), rels); err != nil {
+				return err
+			}
+		}
+	}
+	styles := len(sheets) + 1
+	fmt.Fprintf(&bookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, styles)
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + book.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			bookRels.String() + `</Relationships>`},
+		// styles: 0 plain, 1 bold header, 2 link
+		{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="3"><font><sz val="11"/><name val="Calibri"/></font>` +
+			`<font><b/><sz val="11"/><name val="Calibri"/></font>` +
+			`<font><u/><sz val="11"/><color rgb="FF0563C1"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+			`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+			`<xf numFmtId="0" fontId="2" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for _, p := range parts {
+		if err := put(z, p.name, p.body); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// sheetXML returns the worksheet part of s, with the sheetProtection
+// element protect if any, and, when it links out of the workbook, the
+// part's relationships.
+func sheetXML(s Sheet, protect string) (body, rels string) {
+	var b, links, out strings.Builder
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetData>`)
+	external := 0
+	for i, row := range s.Rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, c := range row {
+			ref := colName(j) + strconv.Itoa(i+1)
+			style := 0
+			switch {
+			case i == 0:
+				style = 1
+			case c.link != "":
+				style = 2
+			}
+			switch {
+			case c.num:
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, c.text)
+			default:
+				fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, esc(c.text))
+			}
+			switch {
+			case strings.HasPrefix(c.link, "#"):
+				fmt.Fprintf(&links, `<hyperlink ref="%s" location="'%s'!A1" display="%s"/>`,
+					ref, esc(strings.ReplaceAll(c.link[1:], "'", "''")), esc(c.text))
+			case c.link != "":
+				external++
+				fmt.Fprintf(&links, `<hyperlink ref="%s" r:id="rId%d"/>`, ref, external)
+				fmt.Fprintf(&out, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="%s" TargetMode="External"/>`,
+					external, esc(c.link))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData>` + protect)
+	if links.Len() > 0 {
+		b.WriteString(`<hyperlinks>` + links.String() + `</hyperlinks>`)
+	}
+	b.WriteString(`</worksheet>`)
+	if external > 0 {
+		rels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			out.String() + `</Relationships>`
+	}
+	return b.String(), rels
+}
+
+// spinCount is how many times a protection password's hash is rehashed,
+// Excel's own default.
+const spinCount = 100_000
+
+// protection returns the sheetProtection element for password, hashed as
+// ECMA-376 has it: SHA-512 of salt and the UTF-16LE password, then of the
+// hash and each iteration's little-endian number, spinCount times.
+func protection(password string, salt []byte) string {
+	h := sha512.New()
+	h.Write(salt)
+	for _, u := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(u), byte(u >> 8)})
+	}
+	sum := h.Sum(nil)
+	var n [4]byte
+	for i := range uint32(spinCount) {
+		binary.LittleEndian.PutUint32(n[:], i)
+		h.Reset()
+		h.Write(sum)
+		h.Write(n[:])
+		sum = h.Sum(sum[:0])
+	}
+	return fmt.Sprintf(`<sheetProtection algorithmName="SHA-512" hashValue="%s" saltValue="%s" spinCount="%d" sheet="1" objects="1" scenarios="1"/>`,
+		base64.StdEncoding.EncodeToString(sum), base64.StdEncoding.EncodeToString(salt), spinCount)
+}
+
+// colName returns the letters of the 0-based column i: A, …, Z, AA, ….
+func colName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func esc(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func put(z *zip.Writer, name, body string) error {
+	w, err := z.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, body)
+	return err
+}
@@ -0,0 +1,71 @@
+package workbook
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestProtection checks the password hash against one worked out apart
+// from this package, as ECMA-376 describes it.
+func TestProtection(t *testing.T) {
+	salt := make([]byte, 16)
+	for i := range salt {
+		salt[i] = byte(i)
+	}
+	got := protection("Secret-123", salt)
+	for _, want := range []string{
+		`algorithmName="SHA-512"`,
+		`hashValue="hI/mjXbs4N1ccsq4uvMooVUCN79Sf4iyBPXXLsHLFnPjp5q1eiB8CJZ7iM709h7j+LDhQeUlJCNpDX+rpZpDJQ=="`,
+		`saltValue="AAECAwQFBgcICQoLDA0ODw=="`,
+		`spinCount="100000"`,
+		`sheet="1"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%s\nlacks %s", got, want)
+		}
+	}
+}
+
+// TestWriteProtected checks that every sheet of a workbook written with a
+// password is protected, the element where the schema puts it, and that
+// none is without one.
+func TestWriteProtected(t *testing.T) {
+	sheets := []Sheet{
+		{Name: "Overview", Rows: [][]Cell{{Text("CdrNo")}, {Link("9876500001", "#Calls")}}},
+		{Name: "Calls", Rows: [][]Cell{{Text("B Party"), Text("Calls")}, {Text("9876500002"), Int(3)}}},
+	}
+	for _, password := range []string{"Secret-123", ""} {
+		var b bytes.Buffer
+		if err := Write(&b, sheets, password); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			if !strings.HasPrefix(f.Name, "xl/worksheets/sheet") {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			body := string(data)
+			at := strings.Index(body, "<sheetProtection ")
+			switch {
+			case password == "" && at >= 0:
+				t.Errorf("%s protected without a password", f.Name)
+			case password != "" && at < 0:
+				t.Errorf("%s not protected", f.Name)
+			case password != "" && at != strings.Index(body, "</sheetData>")+len("</sheetData>"):
+				t.Errorf("%s: sheetProtection not right after sheetData:\n%s", f.Name, body)
+			}
+		}
+	}
+}
@@ -0,0 +1,525 @@
+package workbook
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// An .xls file is a compound file, a small FAT file system inside one
+// file, whose "Workbook" stream holds the BIFF8 records of Excel 97-2003.
+
+var errEncrypted = errors.New("workbook is password protected; save an unprotected copy")
+
+const (
+	endOfChain = 0xFFFFFFFE
+	freeSect   = 0xFFFFFFFF
+)
+
+// cfb is an open compound file.
+type cfb struct {
+	data       []byte
+	sectorSize int
+	miniSize   int
+	cutoff     uint32
+	fat        []uint32
+	minifat    []uint32
+	ministream []byte
+	entries    []cfbEntry
+}
+
+type cfbEntry struct {
+	name  string
+	kind  byte // 1 storage, 2 stream, 5 root
+	start uint32
+	size  uint64
+}
+
+func (c *cfb) sector(n uint32) ([]byte, error) {
+	off := (int64(n) + 1) * int64(c.sectorSize)
+	if off < 0 || off+int64(c.sectorSize) > int64(len(c.data)) {
+		return nil, errors.New("xls: sector out of range")
+	}
+	return c.data[off : off+int64(c.sectorSize)], nil
+}
+
+// chain reads the sectors linked from start in table, fetching each
+// with at.
+func chain(start uint32, table []uint32, at func(uint32) ([]byte, error)) ([]byte, error) {
+	var out []byte
+	for n, steps := start, 0; n != endOfChain; steps++ {
+		if int(n) >= len(table) || steps > len(table) {
+			return nil, errors.New("xls: broken sector chain")
+		}
+		b, err := at(n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+		n = table[n]
+	}
+	return out, nil
+}
+
+func openCFB(data []byte) (*cfb, error) {
+	if len(data) < 512 {
+		return nil, errors.New("xls: file too short")
+	}
+	le := binary.LittleEndian
+	c := &cfb{data: data}
+	c.sectorSize = 1 << le.Uint16(data[0x1E:])
+	c.miniSize = 1 << le.Uint16(data[0x20:])
+	if c.sectorSize != 512 && c.sectorSize != 4096 {
+		return nil, fmt.Errorf("xls: unexpected sector size %d", c.sectorSize)
+	}
+	if c.miniSize != 64 {
+		return nil, fmt.Errorf("xls: unexpected mini sector size %d", c.miniSize)
+	}
+	c.cutoff = le.Uint32(data[0x38:])
+
+	// the sectors holding the FAT are listed in the header, then in a
+	// chain of DIFAT sectors for files over about 7 MB
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		if s := le.Uint32(data[0x4C+4*i:]); s != freeSect {
+			fatSectors = append(fatSectors, s)
+		}
+	}
+	perSector := c.sectorSize / 4
+	if n := le.Uint32(data[0x48:]); uint64(n) > uint64(len(data)/c.sectorSize) {
+		return nil, fmt.Errorf("xls: %d DIFAT sectors in a file of %d", n, len(data)/c.sectorSize)
+	}
+	for s, n := le.Uint32(data[0x44:]), le.Uint32(data[0x48:]); n > 0 && s != endOfChain && s != freeSect; n-- {
+		b, err := c.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perSector-1; i++ {
+			if v := le.Uint32(b[4*i:]); v != freeSect {
+				fatSectors = append(fatSectors, v)
+			}
+		}
+		s = le.Uint32(b[4*(perSector-1):])
+	}
+	for _, s := range fatSectors {
+		b, err := c.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perSector; i++ {
+			c.fat = append(c.fat, le.Uint32(b[4*i:]))
+		}
+	}
+
+	dir, err := chain(le.Uint32(data[0x30:]), c.fat, c.sector)
+	if err != nil {
+		return nil, err
+	}
+	for off := 0; off+128 <= len(dir); off += 128 {
+		e := dir[off : off+128]
+		n := int(le.Uint16(e[64:]))
+		if n < 2 || n > 64 {
+			c.entries = append(c.entries, cfbEntry{})
+			continue
+		}
+		u := make([]uint16, n/2-1)
+		for i := range u {
+			u[i] = le.Uint16(e[2*i:])
+		}
+		c.entries = append(c.entries, cfbEntry{
+			name:  string(utf16.Decode(u)),
+			kind:  e[66],
+			start: le.Uint32(e[116:]),
+			size:  le.Uint64(e[120:]) & 0xFFFFFFFF,
+		})
+	}
+	if len(c.entries) == 0 || c.entries[0].kind != 5 {
+		return nil, errors.New("xls: no root entry")
+	}
+
+	// streams under the cutoff live in the mini stream, in 64-byte sectors
+	if s := le.Uint32(data[0x3C:]); s != endOfChain && le.Uint32(data[0x40:]) > 0 {
+		b, err := chain(s, c.fat, c.sector)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+4 <= len(b); i += 4 {
+			c.minifat = append(c.minifat, le.Uint32(b[i:]))
+		}
+		if c.ministream, err = chain(c.entries[0].start, c.fat, c.sector); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// stream returns the contents of the named stream.
+func (c *cfb) stream(name string) ([]byte, bool, error) {
+	for _, e := range c.entries {
+		if e.kind != 2 || !strings.EqualFold(e.name, name) {
+			continue
+		}
+		var b []byte
+		var err error
+		if e.size < uint64(c.cutoff) {
+			b, err = chain(e.start, c.minifat, func(n uint32) ([]byte, error) {
+				off := int(n) * c.miniSize
+				if off+c.miniSize > len(c.ministream) {
+					return nil, errors.New("xls: mini sector out of range")
+				}
+				return c.ministream[off : off+c.miniSize], nil
+			})
+		} else {
+			b, err = chain(e.start, c.fat, c.sector)
+		}
+		if err != nil {
+			return nil, true, err
+		}
+		if uint64(len(b)) < e.size {
+			return nil, true, errors.New("xls: stream shorter than its size")
+		}
+		return b[:e.size], true, nil
+	}
+	return nil, false, nil
+}
+
+// BIFF8 record types read
+const (
+	recFormula    = 0x0006
+	recEOF        = 0x000A
+	recDatemode   = 0x0022
+	recFilepass   = 0x002F
+	recContinue   = 0x003C
+	recBoundsheet = 0x0085
+	recMulRK      = 0x00BD
+	recXF         = 0x00E0
+	recSST        = 0x00FC
+	recLabelSST   = 0x00FD
+	recNumber     = 0x0203
+	recLabel      = 0x0204
+	recBoolErr    = 0x0205
+	recString     = 0x0207
+	recRK         = 0x027E
+	recFormat     = 0x041E
+	recBOF        = 0x0809
+)
+
+type record struct {
+	typ  uint16
+	data []byte
+	cont [][]byte // CONTINUE records following it
+}
+
+// records splits a BIFF stream from off up to the EOF record closing the
+// substream started there.
+func records(b []byte, off int) ([]record, error) {
+	le := binary.LittleEndian
+	var out []record
+	depth := 0
+	for off+4 <= len(b) {
+		typ, n := le.Uint16(b[off:]), int(le.Uint16(b[off+2:]))
+		off += 4
+		if off+n > len(b) {
+			return nil, errors.New("xls: record past end of stream")
+		}
+		data := b[off : off+n]
+		off += n
+		if typ == recContinue && len(out) > 0 {
+			out[len(out)-1].cont = append(out[len(out)-1].cont, data)
+			continue
+		}
+		out = append(out, record{typ: typ, data: data})
+		switch typ {
+		case recBOF:
+			depth++
+		case recEOF:
+			// a chart embedded in a sheet brings its own BOF and EOF
+			if depth--; depth <= 0 {
+				return out, nil
+			}
+		}
+	}
+	return out, nil
+}
+
+// strReader reads the strings of a record split over CONTINUE records:
+// text cut by a record boundary resumes with a fresh 8- or 16-bit flag.
+type strReader struct {
+	segs [][]byte
+	cur  []byte
+}
+
+func (s *strReader) next() bool {
+	if len(s.segs) == 0 {
+		return false
+	}
+	s.cur, s.segs = s.segs[0], s.segs[1:]
+	return true
+}
+
+func (s *strReader) bytes(n int) ([]byte, error) {
+	var out []byte
+	for n > 0 {
+		if len(s.cur) == 0 && !s.next() {
+			return nil, io.ErrUnexpectedEOF
+		}
+		k := min(n, len(s.cur))
+		out = append(out, s.cur[:k]...)
+		s.cur, n = s.cur[k:], n-k
+	}
+	return out, nil
+}
+
+// str reads an XLUnicodeRichExtendedString, or an XLUnicodeString when
+// its flags carry no rich text or phonetic data; cch8 reads the
+// one-byte length of a ShortXLUnicodeString.
+func (s *strReader) str(cch8 bool) (string, error) {
+	var cch int
+	if cch8 {
+		b, err := s.bytes(1)
+		if err != nil {
+			return "", err
+		}
+		cch = int(b[0])
+	} else {
+		b, err := s.bytes(2)
+		if err != nil {
+			return "", err
+		}
+		cch = int(binary.LittleEndian.Uint16(b))
+	}
+	fb, err := s.bytes(1)
+	if err != nil {
+		return "", err
+	}
+	flags := fb[0]
+	var runs, ext int
+	if flags&0x08 != 0 {
+		b, err := s.bytes(2)
+		if err != nil {
+			return "", err
+		}
+		runs = int(binary.LittleEndian.Uint16(b))
+	}
+	if flags&0x04 != 0 {
+		b, err := s.bytes(4)
+		if err != nil {
+			return "", err
+		}
+		ext = int(binary.LittleEndian.Uint32(b))
+	}
+	u := make([]uint16, 0, cch)
+	wide := flags&0x01 != 0
+	for len(u) < cch {
+		if len(s.cur) == 0 {
+			if !s.next() {
+				return "", io.ErrUnexpectedEOF
+			}
+			wide, s.cur = s.cur[0]&0x01 != 0, s.cur[1:]
+		}
+		if wide {
+			if len(s.cur) < 2 {
+				return "", io.ErrUnexpectedEOF
+			}
+			u = append(u, binary.LittleEndian.Uint16(s.cur))
+			s.cur = s.cur[2:]
+		} else {
+			u = append(u, uint16(s.cur[0]))
+			s.cur = s.cur[1:]
+		}
+	}
+	if _, err := s.bytes(4*runs + ext); err != nil {
+		return "", err
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+func recStr(r record, off int, cch8 bool) (string, error) {
+	if off > len(r.data) {
+		return "", io.ErrUnexpectedEOF
+	}
+	s := &strReader{cur: r.data[off:], segs: r.cont}
+	return s.str(cch8)
+}
+
+// rk decodes an RK number: a 30-bit integer or the top of a float64,
+// either possibly scaled by 100.
+func rk(v uint32) float64 {
+	var f float64
+	if v&0x02 != 0 {
+		f = float64(int32(v) >> 2)
+	} else {
+		f = math.Float64frombits(uint64(v&0xFFFFFFFC) << 32)
+	}
+	if v&0x01 != 0 {
+		f /= 100
+	}
+	return f
+}
+
+func openXLS(f io.ReaderAt, size int64, sheet string) (*Reader, error) {
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	c, err := openCFB(data)
+	if err != nil {
+		return nil, err
+	}
+	wbs, ok, err := c.stream("Workbook")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if _, ok, _ := c.stream("EncryptedPackage"); ok {
+			return nil, errEncrypted
+		}
+		if _, ok, _ := c.stream("Book"); ok {
+			return nil, errors.New("xls: Excel 95 workbooks are not supported; save as .xlsx")
+		}
+		return nil, errors.New("xls: no workbook stream")
+	}
+
+	globals, err := records(wbs, 0)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	fm := formats{codes: map[int]string{}}
+	var sst []string
+	var names []string
+	var offsets []int
+	for _, r := range globals {
+		switch r.typ {
+		case recFilepass:
+			return nil, errEncrypted
+		case recDatemode:
+			fm.date1904 = len(r.data) >= 2 && le.Uint16(r.data) == 1
+		case recFormat:
+			if len(r.data) >= 2 {
+				if code, err := recStr(r, 2, false); err == nil {
+					fm.codes[int(le.Uint16(r.data))] = code
+				}
+			}
+		case recXF:
+			if len(r.data) >= 4 {
+				fm.xf = append(fm.xf, int(le.Uint16(r.data[2:])))
+			}
+		case recBoundsheet:
+			// worksheets only: not charts, macros or VB modules
+			if len(r.data) < 8 || r.data[5] != 0 {
+				continue
+			}
+			name, err := recStr(r, 6, true)
+			if err != nil {
+				return nil, fmt.Errorf("xls: sheet name: %w", err)
+			}
+			names = append(names, name)
+			offsets = append(offsets, int(le.Uint32(r.data)))
+		case recSST:
+			if len(r.data) < 8 {
+				continue
+			}
+			n := int(le.Uint32(r.data[4:]))
+			s := &strReader{cur: r.data[8:], segs: r.cont}
+			sst = make([]string, 0, min(n, 1<<20))
+			for range n {
+				v, err := s.str(false)
+				if err != nil {
+					return nil, fmt.Errorf("xls: shared strings: %w", err)
+				}
+				sst = append(sst, v)
+			}
+		}
+	}
+	i, err := pick(names, sheet)
+	if err != nil {
+		return nil, err
+	}
+	if offsets[i] >= len(wbs) {
+		return nil, errors.New("xls: sheet offset out of range")
+	}
+	recs, err := records(wbs, offsets[i])
+	if err != nil {
+		return nil, err
+	}
+
+	var g grid
+	cell := func(d []byte) (int, int, int) {
+		return int(le.Uint16(d)), int(le.Uint16(d[2:])), int(le.Uint16(d[4:]))
+	}
+	formulaAt := [2]int{-1, -1} // cell awaiting its string result
+	for _, r := range recs {
+		d := r.data
+		switch r.typ {
+		case recLabelSST:
+			if len(d) >= 10 {
+				row, col, _ := cell(d)
+				k := int(le.Uint32(d[6:]))
+				if k >= len(sst) {
+					return nil, fmt.Errorf("xls: cell %d,%d: no shared string %d of %d", row+1, col+1, k, len(sst))
+				}
+				g.set(row, col, sst[k])
+			}
+		case recLabel:
+			if len(d) >= 8 {
+				row, col, _ := cell(d)
+				if v, err := recStr(r, 6, false); err == nil {
+					g.set(row, col, v)
+				}
+			}
+		case recNumber:
+			if len(d) >= 14 {
+				row, col, xf := cell(d)
+				g.set(row, col, fm.number(math.Float64frombits(le.Uint64(d[6:])), xf))
+			}
+		case recRK:
+			if len(d) >= 10 {
+				row, col, xf := cell(d)
+				g.set(row, col, fm.number(rk(le.Uint32(d[6:])), xf))
+			}
+		case recMulRK:
+			if len(d) >= 6 {
+				row, col := int(le.Uint16(d)), int(le.Uint16(d[2:]))
+				for p := 4; p+6 <= len(d)-2; p, col = p+6, col+1 {
+					g.set(row, col, fm.number(rk(le.Uint32(d[p+2:])), int(le.Uint16(d[p:]))))
+				}
+			}
+		case recBoolErr:
+			if len(d) >= 8 && d[7] == 0 {
+				row, col, _ := cell(d)
+				g.set(row, col, map[bool]string{true: "TRUE", false: "FALSE"}[d[6] != 0])
+			}
+		case recFormula:
+			// the cached result: a float64, or a tag for a string that
+			// follows in a STRING record, a boolean or an error
+			if len(d) < 14 {
+				continue
+			}
+			row, col, xf := cell(d)
+			res := d[6:14]
+			if le.Uint16(res[6:]) != 0xFFFF {
+				g.set(row, col, fm.number(math.Float64frombits(le.Uint64(res)), xf))
+				continue
+			}
+			switch res[0] {
+			case 0:
+				formulaAt = [2]int{row, col}
+			case 1:
+				g.set(row, col, map[bool]string{true: "TRUE", false: "FALSE"}[res[2] != 0])
+			}
+		case recString:
+			if formulaAt[0] >= 0 {
+				if v, err := recStr(r, 0, false); err == nil {
+					g.set(formulaAt[0], formulaAt[1], v)
+				}
+				formulaAt = [2]int{-1, -1}
+			}
+		}
+	}
+	return g.reader(names[i]), nil
+}
@@ -0,0 +1,69 @@
+package workbook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestOpenXLSMalformed checks that a damaged .xls is refused with an
+// error rather than read in part, or left to panic.
+func TestOpenXLSMalformed(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/vi_xls.xls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit := func(fn func(b []byte)) []byte {
+		b := bytes.Clone(data)
+		fn(b)
+		return b
+	}
+	// the first LABELSST cell record, and its shared string index
+	labelSST := bytes.Index(data, []byte{0xFD, 0x00, 0x0A, 0x00})
+	if labelSST < 0 {
+		t.Fatal("fixture has no LABELSST record")
+	}
+	type tc struct {
+		name string
+		data []byte
+		want string
+	}
+	cases := []tc{
+		{"header only", data[:256], "file too short"},
+		{"bad shared string index", edit(func(b []byte) {
+			binary.LittleEndian.PutUint32(b[labelSST+4+6:], 9999)
+		}), "no shared string 9999 of"},
+		{"mini sector size", edit(func(b []byte) { b[0x20] = 63 }), "unexpected mini sector size"},
+		{"sector size", edit(func(b []byte) { b[0x1E] = 63 }), "unexpected sector size"},
+		{"DIFAT count", edit(func(b []byte) {
+			binary.LittleEndian.PutUint32(b[0x44:], 1)
+			binary.LittleEndian.PutUint32(b[0x48:], 0xFFFFFFF0)
+		}), "DIFAT sectors"},
+		{"directory chain loop", edit(func(b []byte) {
+			dir := binary.LittleEndian.Uint32(b[0x30:])
+			fat := binary.LittleEndian.Uint32(b[0x4C:])
+			binary.LittleEndian.PutUint32(b[512*(int(fat)+1)+4*int(dir):], dir)
+		}), "broken sector chain"},
+	}
+	// cut anywhere past the header, the sectors the workbook stream needs
+	// are missing
+	for _, n := range []int{512, 1024, len(data) / 2, len(data) - 512} {
+		cases = append(cases, tc{"truncated", data[:n], "xls:"})
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := Open(bytes.NewReader(tc.data), int64(len(tc.data)), "")
+			if err == nil {
+				t.Fatalf("read %d rows, want an error", len(r.rows))
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+	if _, err := Open(bytes.NewReader(data), int64(len(data)), ""); err != nil {
+		t.Errorf("fixture: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package workbook
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parts of an .xlsx package, as far as reading cell text goes
+
+type xWorkbook struct {
+	Pr struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xRels struct {
+	Rels []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	XFs []struct {
+		NumFmt int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+// rich text: plain <t>, or runs of <r><t>
+type xText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	b.WriteString(t.T)
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  int    `xml:"s,attr"`
+	V      string `xml:"v"`
+	Inline xText  `xml:"is"`
+}
+
+type xRow struct {
+	N     int     `xml:"r,attr"`
+	Cells []xCell `xml:"c"`
+}
+
+func openXLSX(f io.ReaderAt, size int64, sheet string) (*Reader, error) {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: %w", err)
+	}
+	files := map[string]*zip.File{}
+	for _, zf := range zr.File {
+		files[strings.TrimPrefix(zf.Name, "/")] = zf
+	}
+	decode := func(name string, v any) error {
+		zf, ok := files[name]
+		if !ok {
+			return fmt.Errorf("xlsx: missing %s", name)
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return xml.NewDecoder(rc).Decode(v)
+	}
+
+	var wb xWorkbook
+	if err := decode("xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(wb.Sheets))
+	for i, s := range wb.Sheets {
+		names[i] = s.Name
+	}
+	i, err := pick(names, sheet)
+	if err != nil {
+		return nil, err
+	}
+	var rels xRels
+	if err := decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	var target string
+	for _, r := range rels.Rels {
+		if r.ID == wb.Sheets[i].RID {
+			target = r.Target
+		}
+	}
+	if target == "" {
+		return nil, fmt.Errorf("xlsx: sheet %q has no part", names[i])
+	}
+	if strings.HasPrefix(target, "/") {
+		target = target[1:]
+	} else {
+		target = path.Join("xl", target)
+	}
+
+	fm := formats{codes: map[int]string{}, date1904: wb.Pr.Date1904 == "1" || wb.Pr.Date1904 == "true"}
+	var st xStyles
+	if _, ok := files["xl/styles.xml"]; ok {
+		if err := decode("xl/styles.xml", &st); err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range st.NumFmts {
+		fm.codes[n.ID] = n.Code
+	}
+	for _, x := range st.XFs {
+		fm.xf = append(fm.xf, x.NumFmt)
+	}
+
+	var shared []string
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			SI []xText `xml:"si"`
+		}
+		if err := decode("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+		shared = make([]string, len(sst.SI))
+		for i, si := range sst.SI {
+			shared[i] = si.String()
+		}
+	}
+
+	zf, ok := files[target]
+	if !ok {
+		return nil, fmt.Errorf("xlsx: missing %s", target)
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// a sheet can hold a hundred thousand rows; decode it a row at a time
+	g := grid{first: 1}
+	d := xml.NewDecoder(rc)
+	next := 1
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("xlsx: %s: %w", target, err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "row" {
+			continue
+		}
+		var row xRow
+		if err := d.DecodeElement(&row, &se); err != nil {
+			return nil, fmt.Errorf("xlsx: %s: %w", target, err)
+		}
+		if row.N == 0 {
+			row.N = next
+		}
+		next = row.N + 1
+		col := 0
+		for _, c := range row.Cells {
+			if c.Ref != "" {
+				if n, ok := column(c.Ref); ok {
+					col = n
+				}
+			}
+			if col >= maxCols {
+				return nil, fmt.Errorf("xlsx: %s: cell %s is past column XFD", target, c.Ref)
+			}
+			v, err := cellText(c, shared, &fm)
+			if err != nil {
+				return nil, fmt.Errorf("xlsx: %s: cell %s: %w", target, c.Ref, err)
+			}
+			g.set(row.N, col, v)
+			col++
+		}
+	}
+	return g.reader(names[i]), nil
+}
+
+// column returns the 0-based column of a cell reference such as "AB12",
+// or maxCols for one past the last column Excel has.
+func column(ref string) (int, bool) {
+	n := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		if n = n*26 + int(ref[i]-'A'+1); n > maxCols {
+			n = maxCols + 1
+		}
+	}
+	return n - 1, i > 0
+}
+
+func cellText(c xCell, shared []string, fm *formats) (string, error) {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(strings.TrimSpace(c.V))
+		if err != nil || i < 0 || i >= len(shared) {
+			return "", fmt.Errorf("no shared string %q of %d", c.V, len(shared))
+		}
+		return shared[i], nil
+	case "inlineStr":
+		return c.Inline.String(), nil
+	case "str", "e":
+		return c.V, nil
+	case "b":
+		if c.V == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case "d":
+		if t, err := time.Parse("2006-01-02T15:04:05", strings.TrimSuffix(c.V, "Z")); err == nil {
+			return t.Format("02/01/2006 15:04:05"), nil
+		}
+		return c.V, nil
+	}
+	if c.V == "" {
+		return "", nil
+	}
+	v, err := strconv.ParseFloat(c.V, 64)
+	if err != nil {
+		return c.V, nil
+	}
+	return fm.number(v, c.Style), nil
+}
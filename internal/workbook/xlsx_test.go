@@ -0,0 +1,102 @@
+package workbook
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// rezip rewrites the fixture workbook with each part named in edit
+// replaced by what edit returns for it, or dropped if that is nil.
+func rezip(t *testing.T, edit map[string]func([]byte) []byte) []byte {
+	t.Helper()
+	data, err := os.ReadFile("../../testdata/vi_xlsx.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		part, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fn, ok := edit[f.Name]; ok {
+			if part = fn(part); part == nil {
+				continue
+			}
+		}
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(part)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// TestOpenXLSXMalformed checks that a damaged .xlsx is refused with an
+// error rather than read in part, or left to panic.
+func TestOpenXLSXMalformed(t *testing.T) {
+	const sheet = "xl/worksheets/sheet1.xml"
+	replace := func(old, new string) func([]byte) []byte {
+		return func(b []byte) []byte { return []byte(strings.Replace(string(b), old, new, 1)) }
+	}
+	whole := rezip(t, nil)
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"truncated file", whole[:len(whole)/2], "xlsx: zip"},
+		{"truncated sheet", rezip(t, map[string]func([]byte) []byte{
+			sheet: func(b []byte) []byte { return b[:len(b)/2] },
+		}), "unexpected EOF"},
+		{"truncated shared strings", rezip(t, map[string]func([]byte) []byte{
+			"xl/sharedStrings.xml": func(b []byte) []byte { return b[:len(b)/2] },
+		}), "unexpected EOF"},
+		{"bad shared string index", rezip(t, map[string]func([]byte) []byte{
+			sheet: replace(`<c r="A2" t="s"><v>1</v>`, `<c r="A2" t="s"><v>9999</v>`),
+		}), `cell A2: no shared string "9999" of 52`},
+		{"negative shared string index", rezip(t, map[string]func([]byte) []byte{
+			sheet: replace(`<c r="A2" t="s"><v>1</v>`, `<c r="A2" t="s"><v>-1</v>`),
+		}), `no shared string "-1"`},
+		{"no shared strings", rezip(t, map[string]func([]byte) []byte{
+			"xl/sharedStrings.xml": func([]byte) []byte { return nil },
+		}), `cell A1: no shared string "0" of 0`},
+		{"past column XFD", rezip(t, map[string]func([]byte) []byte{
+			sheet: replace(`<c r="A2" t="s">`, `<c r="ZZZZZZZZZZZZZZ2" t="s">`),
+		}), "past column XFD"},
+		{"missing sheet part", rezip(t, map[string]func([]byte) []byte{
+			sheet: func([]byte) []byte { return nil },
+		}), "xlsx: missing " + sheet},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := Open(bytes.NewReader(tc.data), int64(len(tc.data)), "")
+			if err == nil {
+				t.Fatalf("read %d rows, want an error", len(r.rows))
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+	if _, err := Open(bytes.NewReader(whole), int64(len(whole)), ""); err != nil {
+		t.Errorf("fixture: %v", err)
+	}
+}
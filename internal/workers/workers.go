@@ -0,0 +1,195 @@
+// Package workers bounds how many CDR jobs are processed at once, across
+// uploads and all automatic ingestion sources.
+//
+// The pool size is CDR_WORKERS, defaulting to the number of CPUs. When
+// CDR_JOB_MEMORY_MB estimates the peak memory of one job, the size is
+// further capped so that many jobs fit in the machine's total memory.
+//
+// Jobs waiting for a slot are served by priority: urgent ones (24-hour
+// cases) first, then normal uploads, then bulk work such as reprocessing
+// a whole case's history; each priority in the order it arrived. A job
+// already running is never interrupted.
+package workers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority orders the jobs waiting for a slot.
+type Priority int
+
+const (
+	Bulk Priority = iota
+	Normal
+	Urgent
+)
+
+var priorities = [...]string{Bulk: "bulk", Normal: "normal", Urgent: "urgent"}
+
+func (p Priority) String() string { return priorities[p] }
+
+// ParsePriority reads a priority by name; "" is Normal.
+func ParsePriority(s string) (Priority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return Normal, nil
+	}
+	if i := slices.Index(priorities[:], s); i >= 0 {
+		return Priority(i), nil
+	}
+	return Normal, fmt.Errorf("%q is not urgent, normal or bulk", s)
+}
+
+// waiter is a job queued for a slot; ready is closed once it has one.
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+var (
+	size = configured()
+
+	mu      sync.Mutex
+	busy    int
+	queues  [len(priorities)][]*waiter // oldest first
+	running [len(priorities)]int
+	started [len(priorities)]int64
+	waited  [len(priorities)]time.Duration
+)
+
+// Size returns the pool size.
+func Size() int { return size }
+
+func configured() int {
+	n := runtime.NumCPU()
+	if v, err := strconv.Atoi(os.Getenv("CDR_WORKERS")); err == nil && v > 0 {
+		n = v
+	}
+	if per, err := strconv.Atoi(os.Getenv("CDR_JOB_MEMORY_MB")); err == nil && per > 0 {
+		if total := memTotalMB(); total > 0 {
+			n = min(n, max(1, total/per))
+		}
+	}
+	return n
+}
+
+// Acquire blocks until a worker slot is free for a job of priority p and
+// returns its release func, or gives up with ctx's error when ctx is done
+// first.
+func Acquire(ctx context.Context, p Priority) (func(), error) {
+	start := time.Now()
+	mu.Lock()
+	if busy < size && !queued() {
+		busy++
+		mu.Unlock()
+	} else {
+		w := &waiter{ready: make(chan struct{})}
+		queues[p] = append(queues[p], w)
+		mu.Unlock()
+		select {
+		case <-w.ready:
+		case <-ctx.Done():
+			mu.Lock()
+			if w.granted {
+				// handed a slot as ctx ended; pass it on
+				mu.Unlock()
+				free()
+			} else {
+				queues[p] = slices.DeleteFunc(queues[p], func(q *waiter) bool { return q == w })
+				mu.Unlock()
+			}
+			return nil, ctx.Err()
+		}
+	}
+	wait := time.Since(start)
+	if wait > time.Second {
+		log.Printf("workers: %s job waited %s for a free slot", p, wait.Round(time.Second))
+	}
+	mu.Lock()
+	running[p]++
+	started[p]++
+	waited[p] += wait
+	mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mu.Lock()
+			running[p]--
+			mu.Unlock()
+			free()
+		})
+	}, nil
+}
+
+func queued() bool {
+	for _, q := range queues {
+		if len(q) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// free hands a released slot to the first job of the highest priority
+// waiting, or returns it to the pool.
+func free() {
+	mu.Lock()
+	defer mu.Unlock()
+	for p := len(queues) - 1; p >= 0; p-- {
+		if len(queues[p]) > 0 {
+			w := queues[p][0]
+			queues[p] = queues[p][1:]
+			w.granted = true
+			close(w.ready)
+			return
+		}
+	}
+	busy--
+}
+
+// Stat is the pool's state and history for one priority.
+type Stat struct {
+	Priority Priority
+	Waiting  int           // jobs queued for a slot
+	Running  int           // jobs holding one
+	Started  int64         // jobs given a slot since start
+	Waited   time.Duration // time those jobs spent queued, in all
+}
+
+// Stats returns a Stat per priority, most urgent first.
+func Stats() []Stat {
+	mu.Lock()
+	defer mu.Unlock()
+	var out []Stat
+	for p := len(queues) - 1; p >= 0; p-- {
+		out = append(out, Stat{Priority(p), len(queues[p]), running[p], started[p], waited[p]})
+	}
+	return out
+}
+
+/* MemTotal from /proc/meminfo, 0 where unavailable */
+func memTotalMB() int {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if rest, ok := strings.CutPrefix(sc.Text(), "MemTotal:"); ok {
+			kb, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(rest), " kB"))
+			return kb / 1024
+		}
+	}
+	return 0
+}
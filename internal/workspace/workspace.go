@@ -0,0 +1,61 @@
+// Package workspace gives each job a private directory for the files it
+// writes while it runs. Only the finished reports are moved out, so a
+// failed or rejected job leaves nothing behind in the output directory.
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir holds the job workspaces, one sub-directory per running job.
+const Dir = "work"
+
+// New creates an empty workspace for job id.
+func New(id string) (string, error) {
+	if err := os.MkdirAll(Dir, 0o755); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(Dir, id+"-")
+}
+
+// Publish moves the files among paths that lie in ws to dst and returns
+// paths with those entries updated; other paths are returned unchanged.
+func Publish(ws, dst string, paths []string) ([]string, error) {
+	return publish(ws, dst, paths, os.Rename)
+}
+
+// PublishOnce is Publish for write-once outputs: it fails with
+// os.ErrExist rather than replace a file dst already has.
+func PublishOnce(ws, dst string, paths []string) ([]string, error) {
+	return publish(ws, dst, paths, func(from, to string) error {
+		if err := os.Link(from, to); err != nil {
+			return err
+		}
+		return os.Remove(from)
+	})
+}
+
+func publish(ws, dst string, paths []string, move func(from, to string) error) ([]string, error) {
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return nil, err
+	}
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = p
+		if rel, err := filepath.Rel(ws, p); err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		to := filepath.Join(dst, filepath.Base(p))
+		if err := move(p, to); err != nil {
+			return nil, err
+		}
+		out[i] = to
+	}
+	return out, nil
+}
+
+// Clean removes the workspaces left by jobs that were interrupted, e.g. by
+// a restart. Call it before any job starts.
+func Clean() error { return os.RemoveAll(Dir) }
@@ -1,31 +1,29 @@
 package jio
 
 import (
+	"context"
 	"embed"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
-	"sort"
 	"strings"
-	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/celldb"
+	"github.com/jalad-shrimali/cdr-filter/internal/enrich"
+	"github.com/jalad-shrimali/cdr-filter/internal/pseudo"
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+	"github.com/jalad-shrimali/cdr-filter/internal/summary"
 )
 
 /* ── canonical 26-column header for filtered output ───────── */
-var targetHeader = []string{
-	"CdrNo", "B Party", "Date", "Time", "Duration", "Call Type",
-	"First Cell ID", "First Cell ID Address", "Last Cell ID", "Last Cell ID Address",
-	"IMEI", "IMSI", "Roaming",
-	"Main City(First CellID)", "Sub City (First CellID)", "Lat-Long-Azimuth (First CellID)",
-	"Crime", "Circle", "Operator", "LRN",
-	"CallForward", "B Party Provider", "B Party Circle", "B Party Operator",
-	"Type", "IMEI Manufacturer",
-}
+var targetHeader = canon.Header()
 
 /* ── helpers ── */
 var (
@@ -35,7 +33,7 @@ var (
 
 func norm(s string) string { return spaceRE.ReplaceAllString(strings.ToLower(strings.TrimSpace(s)), " ") }
 func digits(s string) string { return nonDigit.ReplaceAllString(s, "") }
-func last10(s string) string { d := digits(s); if len(d) > 10 { return d[len(d)-10:] }; return d }
+func last10(s string) string { return canon.Last10(s) }
 func cleanCGI(s string) string { return digits(s) }
 
 /* column index helpers */
@@ -51,6 +49,43 @@ func colIdxAny(header []string, keys ...string) int {
 }
 func colIdx(header []string, key string) int { return colIdxAny(header, key) }
 
+/* ── source columns (normalized names) feeding each canonical column ── */
+var sourceColumns = map[string][]string{
+	"B Party":       {"calling party telephone number", "called party telephone number"}, // whichever is not the target
+	"Date":          {"call date"},
+	"Time":          {"call time"},
+	"Duration":      {"dur(s)", "duration(sec)", "call duration"},
+	"Call Type":     {"call type"},
+	"First Cell ID": {"first cgi", "first cell id"},
+	"Last Cell ID":  {"last cgi", "last cell id"},
+	"B Party Cell ID": {"b party cgi", "b party cell id"},
+	"Connection Type": {"connection type", "subscriber type"},
+	"IMEI":          {"imei"},
+	"IMSI":          {"imsi"},
+	"Roaming":       {"roaming circle name"},
+	"LRN":           {"lrn called no", "lrn no", "lrn"},
+	"CallForward":   {"call forward", "call fwd no", "call fow no"},
+}
+
+/* export layouts: the current one with "Calling/Called Party Telephone
+   Number" and cell IDs, and the older one with short party headers and
+   CGIs; B Party lists the calling header first, then the called one */
+var formats = []canon.Format{
+	{Name: "v2", Match: []string{"calling party telephone number", "called party telephone number", "first cell id", "last cell id"}},
+	{Name: "v1", Match: []string{"calling number", "called number", "first cgi", "last cgi"},
+		Columns: map[string][]string{
+			"B Party": {"calling number", "called number"},
+			"Roaming": {"roaming circle"},
+		}},
+}
+
+// SourceColumns lists, per canonical column, the Jio export headers it is
+// read from, across all export layouts.
+func SourceColumns() map[string][]string { return canon.AllSources(sourceColumns, formats) }
+
+/* operator name as spelled in the LRN table */
+const operator = "RELIANCE JIO"
+
 /* ── banner CDR number extractor ── */
 var jioCdrRE = regexp.MustCompile(`(?i)input value[^0-9]*([0-9]{8,15})`)
 func extractCdrNumber(line string) string {
@@ -67,26 +102,37 @@ type CellInfo struct{ Addr, Sub, Main, LatLonAz string }
 type LRNInfo struct{ Provider, Circle, Operator string }
 
 var (
-	cellDB = map[string]map[string]CellInfo{}
-	lrnDB  = map[string]LRNInfo{}
+	cellDB refdata.Table[map[string]map[string]CellInfo] // tsp → cell id → info
+	lrnDB  refdata.Table[map[string]LRNInfo]
 )
 
+/* a missing or unreadable table disables its enrichment instead of stopping
+   the service; refdata reports it and reloads it on request */
 func init() {
-	if err := loadCells("jio", "data/jio_cells.csv"); err != nil && !errors.Is(err, os.ErrNotExist) {
-		panic(fmt.Errorf("loadCells jio failed: %w", err))
-	}
-	if err := loadLRN("data/LRN.csv"); err != nil && !errors.Is(err, os.ErrNotExist) {
-		// Just warn, LRN missing won't crash
-		fmt.Printf("Warning: LRN.csv not loaded: %v\n", err)
-	}
+	refdata.Load("jio", "cells", func() error { return loadCells("jio", "data/jio_cells.csv") })
+	refdata.Load("jio", "LRN", func() error { return loadLRN("data/LRN.csv") })
 }
 
-/* loadCells loads cell DB from CSV */
+/* loadCells loads cell DB from every copy of the CSV, merged by celldb */
 func loadCells(tsp, path string) error {
-	f, err := dataFS.Open(path)
+	srcs, err := celldb.Open("jio", dataFS, path)
 	if err != nil { return err }
-	defer f.Close()
+	for _, s := range srcs { defer s.Close() }
+	m := celldb.New(tsp)
+	db := map[string]CellInfo{}
+	for _, s := range srcs {
+		if err := readCells(s, s.Name, m, db); err != nil { return err }
+	}
+	m.Done()
+	all := maps.Clone(cellDB.Get())
+	if all == nil { all = map[string]map[string]CellInfo{} }
+	all[tsp] = db
+	cellDB.Set(all)
+	return nil
+}
 
+/* readCells adds the cells of one copy of the cell DB to db */
+func readCells(f io.Reader, name string, m *celldb.Merge, db map[string]CellInfo) error {
 	r := csv.NewReader(f)
 	header, err := r.Read()
 	if err != nil { return err }
@@ -107,8 +153,7 @@ func loadCells(tsp, path string) error {
 	iLon := col("longitude", "lon", "long")
 	iAz := col("azimuth", "azm", "az")
 
-	if iID == -1 { return fmt.Errorf("no CGI column in %s", path) }
-	cellDB[tsp] = map[string]CellInfo{}
+	if iID == -1 { return fmt.Errorf("no CGI column in %s", name) }
 
 	for {
 		rec, err := r.Read()
@@ -122,15 +167,17 @@ func loadCells(tsp, path string) error {
 			Main:     pick(rec, iMain),
 			LatLonAz: buildLat(rec, iLat, iLon, iAz),
 		}
-		cellDB[tsp][rawID] = info
-		cellDB[tsp][digits(rawID)] = info
+		if m.Add(name, digits(rawID), info.LatLonAz, info.Addr) {
+			db[rawID] = info
+			db[digits(rawID)] = info
+		}
 	}
 	return nil
 }
 
 /* loadLRN loads LRN DB */
 func loadLRN(path string) error {
-	f, err := dataFS.Open(path)
+	f, err := refdata.Open("jio", dataFS, path)
 	if err != nil { return err }
 	defer f.Close()
 	r := csv.NewReader(f)
@@ -144,6 +191,7 @@ func loadLRN(path string) error {
 		return fmt.Errorf("LRN.csv missing LRN/TSP columns")
 	}
 
+	db := map[string]LRNInfo{}
 	for {
 		rec, err := r.Read()
 		if err == io.EOF { break }
@@ -151,12 +199,13 @@ func loadLRN(path string) error {
 
 		key := digits(rec[idxLRN])
 		if key == "" { continue }
-		lrnDB[key] = LRNInfo{
+		db[key] = LRNInfo{
 			Provider: pick(rec, idxTSP),
 			Circle:   pick(rec, idxCircle),
 			Operator: pick(rec, idxTSP), // fallback operator = provider
 		}
 	}
+	lrnDB.Set(db)
 	return nil
 }
 
@@ -173,103 +222,79 @@ func buildLat(rec []string, iLat, iLon, iAz int) string {
 	return lat + ", " + lon
 }
 
+// Towers returns the cells of the Jio cell DB that have a location, each once
+// (the DB keeps a cell under its CGI as given and its digits).
+func Towers() []canon.Tower {
+	var out []canon.Tower
+	for id, info := range cellDB.Get()["jio"] {
+		if id != digits(id) { continue }
+		if t, ok := canon.NewTower(id, info.LatLonAz, info.Addr, info.Main); ok { out = append(out, t) }
+	}
+	return out
+}
+
 func findCell(tsp, id string) (CellInfo, bool) {
-	db := cellDB[tsp]
+	db := cellDB.Get()[tsp]
 	if info, ok := db[id]; ok { return info, true }
 	if info, ok := db[digits(id)]; ok { return info, true }
 	return CellInfo{}, false
 }
 
-/* saveUploaded saves uploaded file */
-func saveUploaded(r io.Reader, dst string) error {
-	f, err := os.Create(dst)
-	if err != nil { return err }
-	defer f.Close()
-	_, err = io.Copy(f, r)
-	return err
-}
-
-/* --- main handler --- */
-func UploadAndNormalizeCSV(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "POST only", 405)
-		return
-	}
-	if strings.ToLower(r.FormValue("tsp_type")) != "jio" {
-		http.Error(w, "Only Jio supported", 400)
-		return
-	}
-	crime := r.FormValue("crime_number")
-
-	fh, hdr, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, err.Error(), 400)
-		return
-	}
-	defer fh.Close()
-
-	os.MkdirAll("uploads", 0o755)
-	os.MkdirAll("filtered", 0o755)
-
-	src := filepath.Join("uploads", hdr.Filename)
-	if err := saveUploaded(fh, src); err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-
-	filtered, summary, maxCalls, maxDuration, maxStay, err := normJio(src, crime)
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-
-	fmt.Fprintf(w, "/download/%s\n/download/%s\n/download/%s\n/download/%s\n/download/%s\n",
-		filepath.Base(filtered), filepath.Base(summary), filepath.Base(maxCalls), filepath.Base(maxDuration), filepath.Base(maxStay))
-}
-
 /* Core normalization + summaries + max reports */
-func normJio(src, crime string) (string, string, string, string, string, error) {
+// Normalize converts a Jio CDR export at src into the canonical reports.
+// It stops with ctx's error once ctx is done.
+func Normalize(ctx context.Context, src string, opt canon.Options) (canon.Result, error) {
 	in, err := os.Open(src)
-	if err != nil { return "", "", "", "", "", err }
+	if err != nil { return canon.Result{}, err }
 	defer in.Close()
-	r := csv.NewReader(in)
+	r := canon.SkipLines("jio", csv.NewReader(in))
 
 	/* 1. Find header and CDR */
 	var header []string
-	var cdr string
-	var iFirst, iLast, iCalling, iCalled, iInput int = -1, -1, -1, -1, -1
+	var cdr, homeCircle string
+	var format canon.Format
+	cdr = opt.CDR // given by hand on a retry; the banner's otherwise
+	var iInput int = -1
 	for {
 		rec, err := r.Read()
 		if err == io.EOF {
-			return "", "", "", "", "", errors.New("no header found")
+			return canon.Result{}, errors.New("no header found")
 		}
 		if err != nil { continue }
 		if cdr == "" {
 			cdr = extractCdrNumber(strings.Join(rec, " "))
 		}
+		// banner line "Circle:,'MADHYA PRADESH'" gives the subscriber's home circle
+		if len(rec) > 1 && norm(rec[0]) == "circle:" {
+			homeCircle = strings.Trim(rec[1], "'\" ")
+		}
 		for i, h := range rec {
-			switch norm(h) {
-			case "first cgi", "first cell id":
-				iFirst = i
-			case "last cgi", "last cell id":
-				iLast = i
-			case "calling party telephone number":
-				iCalling = i
-			case "called party telephone number":
-				iCalled = i
-			}
 			if strings.Contains(strings.ToLower(h), "input value") {
 				iInput = i
 			}
 		}
-		if iFirst != -1 && iLast != -1 {
-			header = rec
+		if f, ok := opt.Mapping.Detect(formats, rec); ok {
+			header, format = rec, f
+			r.Header(rec)
 			break
 		}
 	}
+	source := format.Source(sourceColumns)
+	srcIdx := func(header []string, canonical string) int { return colIdxAny(header, source[canonical]...) }
+	iFirst, iLast := srcIdx(header, "First Cell ID"), srcIdx(header, "Last Cell ID")
+	iBCell := srcIdx(header, "B Party Cell ID") // few exports give the B party's cell
+	// one B Party column when mapped by hand
+	parties := source["B Party"]
+	iCalling, iCalled := colIdx(header, parties[0]), colIdx(header, parties[len(parties)-1])
+	if iFirst == -1 || iLast == -1 || iCalling == -1 {
+		return canon.Result{}, errors.New("missing columns: cell IDs and B Party are needed")
+	}
+	clock := canon.ClockFor("jio", format)
 	var firstRec []string
+	var firstLine int
 	if cdr == "" && iInput != -1 {
 		firstRec, _ = r.Read()
+		firstLine = canon.Line(r, firstRec)
 		if len(firstRec) > iInput {
 			if m := regexp.MustCompile(`\d{8,15}`).FindString(firstRec[iInput]); m != "" {
 				cdr = m
@@ -277,46 +302,23 @@ func normJio(src, crime string) (string, string, string, string, string, error)
 		}
 	}
 	if cdr == "" {
-		return "", "", "", "", "", errors.New("CDR not found")
+		return canon.Result{}, errors.New("CDR not found")
 	}
 	cdr10 := last10(cdr)
 
 	/* Setup filtered report */
-	filteredPath := filepath.Join("filtered", cdr+"_reports.csv")
+	filteredPath := filepath.Join(opt.Dir, cdr+"_reports.csv")
 	fout, _ := os.Create(filteredPath)
 	defer fout.Close()
-	fw := csv.NewWriter(fout)
-	_ = fw.Write(targetHeader)
+	fw := safecsv.NewWriter(fout)
+	raw := canon.RawColumns(header, source, opt)
+	_ = fw.Write(raw.Header(targetHeader))
 	col := map[string]int{}
 	for i, h := range targetHeader { col[h] = i }
+	var dedup canon.Dedup
 	blank := make([]string, len(targetHeader))
 
-	/* Summary map: key = B Party */
-	type agg struct {
-		BParty, SDR, Provider, Type           string
-		TotalCalls, OutCalls, InCalls         int
-		OutSMS, InSMS, OtherCalls             int
-		RoamCalls, RoamSMS                    int
-		TotalDuration                         float64
-		Days, CellIds, Imeis, Imsis           map[string]struct{}
-		FirstCall, LastCall                   string
-	}
-	summary := map[string]*agg{}
-	timeLayout := "2006-01-02 15:04:05"
-	parseDT := func(d, t string) string {
-		dt := strings.TrimSpace(d) + " " + strings.TrimSpace(t)
-		if _, e := time.Parse(timeLayout, dt); e == nil {
-			return dt
-		}
-		return dt
-	}
-
-	/* Max stay: keyed by cell ID */
-	type maxStayAgg struct {
-		CellID, Addr, Lat, Lon, Azimuth, Roaming, FirstCall, LastCall string
-		TotalCalls                                                   int
-	}
-	maxStay := map[string]*maxStayAgg{}
+	sum := summary.New(cdr, opt.ExcludeService)
 
 	/* Copy helper */
 	cp := func(rec []string, src int, dst string, row []string) {
@@ -326,7 +328,7 @@ func normJio(src, crime string) (string, string, string, string, string, error)
 	}
 
 	/* Write one filtered row and update summaries */
-	writeRow := func(rec []string) {
+	writeRow := func(rec []string, line int) {
 		if len(rec) == 0 {
 			return
 		}
@@ -334,17 +336,13 @@ func normJio(src, crime string) (string, string, string, string, string, error)
 		row[col["CdrNo"]] = cdr
 
 		// Basic copies
-		cp(rec, colIdx(header, "call date"), "Date", row)
-		cp(rec, colIdx(header, "call time"), "Time", row)
-		cp(rec, colIdxAny(header, "dur(s)", "duration(sec)", "call duration"), "Duration", row)
-		cp(rec, colIdx(header, "imei"), "IMEI", row)
-		cp(rec, colIdx(header, "imsi"), "IMSI", row)
-		cp(rec, colIdxAny(header, "lrn called no", "lrn no", "lrn"), "LRN", row)
-		cp(rec, colIdxAny(header, "call forward", "call fwd no", "call fow no"), "CallForward", row)
-		cp(rec, colIdx(header, "roaming circle name"), "Roaming", row)
+		for _, c := range []string{"Date", "Time", "Duration", "IMEI", "IMSI", "LRN", "CallForward", "Roaming", "Connection Type"} {
+			cp(rec, srcIdx(header, c), c, row)
+		}
+		clock.Apply(row, col)
 
 		// Call Type logic
-		ctIdx := colIdx(header, "call type")
+		ctIdx := srcIdx(header, "Call Type")
 		ct := ""
 		if ctIdx >= 0 && ctIdx < len(rec) {
 			ct = strings.ToUpper(strings.Trim(rec[ctIdx], "'\" "))
@@ -352,25 +350,31 @@ func normJio(src, crime string) (string, string, string, string, string, error)
 		switch ct {
 		case "A_IN", "CALL_IN":
 			row[col["Call Type"]] = "CALL_IN"
-			row[col["Type"]] = "Phone"
+			row[col["Type"]] = "Voice"
 		case "A_OUT", "CALL_OUT":
 			row[col["Call Type"]] = "CALL_OUT"
-			row[col["Type"]] = "Phone"
+			row[col["Type"]] = "Voice"
 		case "A2P_SMSIN", "P2P_SMSIN":
 			row[col["Call Type"]] = ct
 			row[col["Type"]] = "SMS"
 		default:
 			row[col["Call Type"]] = ct
 		}
-		row[col["Crime"]] = crime
+		row[col["Crime"]] = opt.Crime
+
+		// A party is always the Jio subscriber; circle from the banner,
+		// else the number series' (see enrich)
+		row[col["Operator"]] = operator
+		row[col["Circle"]] = homeCircle
 
 		// First and Last Cell IDs
 		firstID := cleanCGI(rec[iFirst])
 		lastID := cleanCGI(rec[iLast])
 		row[col["First Cell ID"]] = firstID
 		row[col["Last Cell ID"]] = lastID
-		enrich(row, col, firstID, true)
-		enrich(row, col, lastID, false)
+		if iBCell != -1 && iBCell < len(rec) {
+			row[col["B Party Cell ID"]] = cleanCGI(rec[iBCell])
+		}
 
 		// B Party logic
 		callRaw := strings.Trim(rec[iCalling], "'\" ")
@@ -378,6 +382,16 @@ func normJio(src, crime string) (string, string, string, string, string, error)
 		callDigits := last10(callRaw)
 		calledDigits := last10(calledRaw)
 
+		// the party fields say which side the target was on even where
+		// the call type does not, e.g. on forwarded and roaming legs
+		switch {
+		case callDigits == cdr10:
+			row[col["Direction"]] = canon.Caller
+		case calledDigits == cdr10:
+			row[col["Direction"]] = canon.Callee
+		default:
+			row[col["Direction"]] = canon.DirectionOf(row[col["Call Type"]])
+		}
 		switch {
 		case callDigits == cdr10 && calledRaw != "":
 			row[col["B Party"]] = calledRaw
@@ -390,131 +404,27 @@ func normJio(src, crime string) (string, string, string, string, string, error)
 				row[col["B Party"]] = callRaw
 			}
 		}
-		bKey := row[col["B Party"]]
-		if bKey == "" {
-			bKey = "(blank)"
-		}
-
-		// Provider info via LRN
-		lrnDigits := digits(row[col["LRN"]])
-		if info, ok := lrnDB[lrnDigits]; ok {
-			row[col["B Party Provider"]] = info.Provider
-			row[col["B Party Circle"]] = info.Circle
-			row[col["B Party Operator"]] = info.Operator
-		} else {
-			// fallback: if blank, fill as Unknown
-			if row[col["B Party Provider"]] == "" {
-				row[col["B Party Provider"]] = "Unknown"
-			}
-		}
+		// Cell addresses, and provider info via LRN
+		Enrichers.Apply(row, col, opt.Skip)
 
 		// Write filtered row
-		fw.Write(row)
-
-		// Update summary aggregator
-		a, ok := summary[bKey]
-		if !ok {
-			a = &agg{
-				BParty: bKey,
-				SDR: row[col["B Party Operator"]],
-				Provider: row[col["B Party Provider"]],
-				Type: row[col["Type"]],
-				Days: make(map[string]struct{}),
-				CellIds: make(map[string]struct{}),
-				Imeis: make(map[string]struct{}),
-				Imsis: make(map[string]struct{}),
-			}
-			summary[bKey] = a
-		}
-
-		a.TotalCalls++
-		switch row[col["Call Type"]] {
-		case "CALL_OUT": a.OutCalls++
-		case "CALL_IN": a.InCalls++
-		default:
-			if strings.Contains(row[col["Call Type"]], "SMS") {
-				if strings.HasSuffix(row[col["Call Type"]], "OUT") {
-					a.OutSMS++
-				} else {
-					a.InSMS++
-				}
-			} else {
-				a.OtherCalls++
-			}
-		}
-		if row[col["Roaming"]] != "" {
-			if strings.Contains(row[col["Call Type"]], "SMS") {
-				a.RoamSMS++
-			} else {
-				a.RoamCalls++
-			}
-		}
-
-		if dur, e := strconv.ParseFloat(row[col["Duration"]], 64); e == nil {
-			a.TotalDuration += dur
-		}
-
-		a.Days[row[col["Date"]]] = struct{}{}
-		if firstID != "" {
-			a.CellIds[firstID] = struct{}{}
-		}
-		if lastID != "" {
-			a.CellIds[lastID] = struct{}{}
-		}
-		if v := row[col["IMEI"]]; v != "" {
-			a.Imeis[v] = struct{}{}
-		}
-		if v := row[col["IMSI"]]; v != "" {
-			a.Imsis[v] = struct{}{}
-		}
-
-		dt := parseDT(row[col["Date"]], row[col["Time"]])
-		if a.FirstCall == "" || dt < a.FirstCall {
-			a.FirstCall = dt
-		}
-		if a.LastCall == "" || dt > a.LastCall {
-			a.LastCall = dt
+		if dedup.Seen(row, col) {
+			return
 		}
 
-		// Update maxStay aggregator for first cell
-		if firstID != "" {
-			ms, ok := maxStay[firstID]
-			if !ok {
-				ms = &maxStayAgg{
-					CellID: firstID,
-					Addr:   row[col["First Cell ID Address"]],
-					Lat:    "",
-					Lon:    "",
-					Azimuth: "",
-					Roaming: row[col["Roaming"]],
-					FirstCall: dt,
-					LastCall:  dt,
-					TotalCalls: 1,
-				}
-				// parse lat/lon/azimuth
-				if llaz := row[col["Lat-Long-Azimuth (First CellID)"]]; llaz != "" {
-					parts := strings.Split(llaz, ",")
-					if len(parts) >= 2 {
-						ms.Lat = strings.TrimSpace(parts[0])
-						ms.Lon = strings.TrimSpace(parts[1])
-					}
-					if len(parts) == 3 {
-						ms.Azimuth = strings.TrimSpace(parts[2])
-					}
-				}
-				maxStay[firstID] = ms
-			} else {
-				ms.TotalCalls++
-				if dt < ms.FirstCall { ms.FirstCall = dt }
-				if dt > ms.LastCall { ms.LastCall = dt }
-			}
+		if !opt.SummaryOnly {
+			fw.Write(raw.Append(row, rec, line))
 		}
+		sum.Add(row, col)
 	}
 
 	if len(firstRec) > 0 {
-		writeRow(firstRec)
+		writeRow(firstRec, firstLine)
 	}
 	for {
+		if err := ctx.Err(); err != nil {
+			return canon.Result{}, err
+		}
 		rec, err := r.Read()
 		if err == io.EOF {
 			break
@@ -522,138 +432,66 @@ func normJio(src, crime string) (string, string, string, string, string, error)
 		if err != nil || len(rec) == 0 {
 			continue
 		}
-		writeRow(rec)
+		writeRow(rec, canon.Line(r, rec))
 	}
 	fw.Flush()
 
-	// Write multi-party summary
-	summaryPath := filepath.Join("filtered", cdr+"_summary_reports.csv")
-	sout, _ := os.Create(summaryPath)
-	defer sout.Close()
-	sw := csv.NewWriter(sout)
-
-	sw.Write([]string{
-		"CdrNo", "B Party", "B Party SDR", "Provider", "Type",
-		"Total Calls", "Out Calls", "In Calls", "Out Sms", "In Sms",
-		"Other Calls", "Roam Calls", "Roam Sms", "Total Duration",
-		"Total Days", "Total CellIds", "Total Imei", "Total Imsi",
-		"First Call", "Last Call",
-	})
-
-	for _, a := range summary {
-		sw.Write([]string{
-			cdr, a.BParty, a.SDR, a.Provider, a.Type,
-			strconv.Itoa(a.TotalCalls), strconv.Itoa(a.OutCalls), strconv.Itoa(a.InCalls),
-			strconv.Itoa(a.OutSMS), strconv.Itoa(a.InSMS), strconv.Itoa(a.OtherCalls),
-			strconv.Itoa(a.RoamCalls), strconv.Itoa(a.RoamSMS),
-			fmt.Sprintf("%.0f", a.TotalDuration),
-			strconv.Itoa(len(a.Days)), strconv.Itoa(len(a.CellIds)),
-			strconv.Itoa(len(a.Imeis)), strconv.Itoa(len(a.Imsis)),
-			a.FirstCall, a.LastCall,
-		})
+	// Tag rows matching the suspicious-pattern rules
+	findings, err := enrich.Rules(filteredPath, filepath.Join(opt.Dir, cdr+"_findings_reports.csv"), cdr, opt)
+	if err != nil {
+		return canon.Result{}, err
 	}
-	sw.Flush()
-
-	// Write max calls report
-	maxCallsPath := filepath.Join("filtered", cdr+"_max_calls_reports.csv")
-	mcF, _ := os.Create(maxCallsPath)
-	defer mcF.Close()
-	mcw := csv.NewWriter(mcF)
-
-	mcw.Write([]string{"CdrNo", "B Party", "B Party SDR", "Total Calls", "Provider"})
 
-	// Also compute total calls across all parties for summary row
-	totalCalls := 0
-	for _, a := range summary {
-		totalCalls += a.TotalCalls
+	// Summary, max calls, max duration and max stay reports
+	reports, err := sum.Write(filepath.Join(opt.Dir, cdr))
+	if err != nil {
+		return canon.Result{}, err
 	}
-	// Write total row with B Party as CDR (like your sample)
-	mcw.Write([]string{"Total", cdr, "", strconv.Itoa(totalCalls), ""})
 
-	// Sort by total calls desc (optional)
-	type kv struct {
-		Key string
-		Val *agg
-	}
-	var sorted []kv
-	for k, v := range summary {
-		sorted = append(sorted, kv{k, v})
+	res := canon.Result{
+		CDR:     cdr,
+		Outputs: append(append([]string{filteredPath}, reports...), findings...),
+		Duplicates: dedup.Removed,
+		Skipped:    r.Skipped,
+		Declared:   r.Declared,
+		Format:     format.Name,
+		Clock:      clock,
 	}
-	// Sort descending
-	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Val.TotalCalls > sorted[j].Val.TotalCalls })
-
-	for _, kvp := range sorted {
-		provider := kvp.Val.Provider
-		if provider == "" {
-			provider = "Unknown"
+	if opt.Anonymize {
+		if res.Outputs, err = pseudo.Files(res.Outputs, cdr); err != nil {
+			return canon.Result{}, err
 		}
-		mcw.Write([]string{cdr, kvp.Key, "", strconv.Itoa(kvp.Val.TotalCalls), provider})
 	}
-	mcw.Flush()
-
-	// Write max duration report
-	maxDurationPath := filepath.Join("filtered", cdr+"_max_duration_reports.csv")
-	mdF, _ := os.Create(maxDurationPath)
-	defer mdF.Close()
-	mdw := csv.NewWriter(mdF)
-
-	mdw.Write([]string{"CdrNo", "B Party", "B Party SDR", "Total Duration", "Provider"})
+	return res, nil
+}
 
-	// Sort by total duration desc
-	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Val.TotalDuration > sorted[j].Val.TotalDuration })
+// Enrichers is the enrichment Normalize runs on each row, this TSP's
+// cell and LRN lookups among the shared steps; it is run again over
+// stored records once the tables are updated.
+var Enrichers = enrich.Pipeline("jio", enrichCells, enrichLRN)
 
-	for _, kvp := range sorted {
-		provider := kvp.Val.Provider
-		if provider == "" {
-			provider = "Unknown"
-		}
-		mdw.Write([]string{
-			cdr, kvp.Key, "", fmt.Sprintf("%.0f", kvp.Val.TotalDuration), provider,
-		})
-	}
-	mdw.Flush()
-
-	// Write max stay report
-	maxStayPath := filepath.Join("filtered", cdr+"_max_stay_reports.csv")
-	msF, _ := os.Create(maxStayPath)
-	defer msF.Close()
-	msw := csv.NewWriter(msF)
-	msw.Write([]string{
-		"CdrNo", "Cell ID", "Total Calls", "Tower Address", "Latitude", "Longitude", "Azimuth", "Roaming", "First Call", "Last Call",
-	})
-
-	for _, ms := range maxStay {
-		addr := ms.Addr
-		if addr == "" {
-			addr = "Unknown"
-		}
-		roaming := ms.Roaming
-		if roaming == "" {
-			roaming = "Unknown"
-		}
-		lat := ms.Lat
-		if lat == "" {
-			lat = "0"
-		}
-		lon := ms.Lon
-		if lon == "" {
-			lon = "0"
-		}
-		az := ms.Azimuth
-		if az == "" {
-			az = "0"
-		}
-		msw.Write([]string{
-			cdr, ms.CellID, strconv.Itoa(ms.TotalCalls), addr, lat, lon, az, roaming, ms.FirstCall, ms.LastCall,
-		})
+func enrichCells(row []string, col map[string]int) {
+	enrichCell(row, col, row[col["First Cell ID"]], true)
+	enrichCell(row, col, row[col["Last Cell ID"]], false)
+	if info, ok := findCell("jio", row[col["B Party Cell ID"]]); ok {
+		row[col["B Party Cell ID Address"]] = info.Addr
 	}
-	msw.Flush()
+}
 
-	return filteredPath, summaryPath, maxCallsPath, maxDurationPath, maxStayPath, nil
+/* provider info via LRN */
+func enrichLRN(row []string, col map[string]int) {
+	if info, ok := lrnDB.Get()[digits(row[col["LRN"]])]; ok {
+		row[col["B Party Provider"]] = info.Provider
+		row[col["B Party Circle"]] = info.Circle
+		row[col["B Party Operator"]] = info.Operator
+	} else if row[col["B Party Provider"]] == "" {
+		// fallback: if blank, fill as Unknown
+		row[col["B Party Provider"]] = "Unknown"
+	}
 }
 
 /* enrich cell address fields */
-func enrich(row []string, col map[string]int, id string, first bool) {
+func enrichCell(row []string, col map[string]int, id string, first bool) {
 	if info, ok := findCell("jio", id); ok {
 		if first {
 			row[col["First Cell ID Address"]] = info.Addr
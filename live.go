@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/audit"
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/dlink"
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/live"
+	"github.com/jalad-shrimali/cdr-filter/internal/mailer"
+	"github.com/jalad-shrimali/cdr-filter/internal/notify"
+	"github.com/jalad-shrimali/cdr-filter/internal/pseudo"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+)
+
+// PUT /cases/{id}/live: flag the case live, so files the ingest sources
+// deliver for its targets extend its consolidated reports and are sent to
+// its subscribers. targets (comma-separated numbers) defaults to every
+// number the case has been processed for; email lists the subscribers.
+// Flagging a live case again replaces its targets and subscribers.
+func liveHandler(w http.ResponseWriter, r *http.Request) {
+	caseID, t := r.PathValue("id"), tenant.Of(r)
+	c := live.Case{Tenant: t, Crime: caseID, Since: time.Now()}
+	for _, n := range strings.Split(r.FormValue("targets"), ",") {
+		n, err := canon.ParseCDR(n)
+		if err != nil {
+			http.Error(w, "targets: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if n != "" {
+			c.Targets = append(c.Targets, n)
+		}
+	}
+	if err := checkEmail(r.FormValue("email")); err != nil {
+		http.Error(w, "email: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.Subscribers, _ = mailer.ParseAddresses(r.FormValue("email"))
+	if len(c.Targets) == 0 && len(caseNumbers(t, caseID)) == 0 {
+		http.Error(w, "no processed CDRs for this case; name its targets", http.StatusUnprocessableEntity)
+		return
+	}
+	if old, err := live.Get(t, caseID); err == nil {
+		c.Since = old.Since
+	}
+	if err := live.Set(c); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	detail := "live"
+	if len(c.Targets) > 0 {
+		detail += " for " + strings.Join(c.Targets, ", ")
+	}
+	if err := audit.Record(audit.Event{Action: "live", Tenant: t, Crime: caseID, Detail: detail}); err != nil {
+		log.Printf("audit: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// GET /cases/{id}/live: the case's live flag, 404 when it has none.
+func liveStatusHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := live.Get(tenant.Of(r), r.PathValue("id"))
+	if errors.Is(err, live.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// DELETE /cases/{id}/live: stop following the case.
+func unliveHandler(w http.ResponseWriter, r *http.Request) {
+	caseID, t := r.PathValue("id"), tenant.Of(r)
+	err := live.Remove(t, caseID)
+	if errors.Is(err, live.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := audit.Record(audit.Event{Action: "live", Tenant: t, Crime: caseID, Detail: "no longer live"}); err != nil {
+		log.Printf("audit: %v", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// caseNumbers lists the numbers the case has finished jobs for.
+func caseNumbers(t, caseID string) []string {
+	list, err := jobs.List()
+	if err != nil {
+		log.Printf("jobs: %v", err)
+	}
+	var out []string
+	for _, j := range list {
+		if j.Tenant == t && j.Crime == caseID && j.Status == "done" && j.CDR != "" {
+			out = append(out, j.CDR)
+		}
+	}
+	return out
+}
+
+// liveCases returns the live cases of tenant following number.
+func liveCases(t, number string) []live.Case {
+	cases, err := live.List(t)
+	if err != nil {
+		log.Printf("live: %v", err)
+	}
+	var out []live.Case
+	for _, c := range cases {
+		if c.Follows(number, func() []string { return caseNumbers(t, c.Crime) }) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// notifyLive tells a live case's subscribers, and the chat channels, that
+// job has extended its consolidated reports, files.
+func notifyLive(job *jobs.Job, c live.Case, files []string) {
+	var b strings.Builder
+	target, _ := shareable(job.CDR, job.Outputs)
+	fmt.Fprintf(&b, "Live case %s: new CDR for %s (%s) ingested; consolidated reports regenerated", c.Crime, target, job.TSP)
+	var reports []string
+	for _, p := range pseudo.Shareable(files) {
+		if filepath.Ext(p) != ".sha256" {
+			reports = append(reports, p)
+			fmt.Fprintf(&b, "\n%s", dlink.URL(dlink.Name(p)))
+		}
+	}
+	if notify.Enabled() {
+		if err := notify.Send(b.String()); err != nil {
+			log.Printf("notify: live case %s: %v", c.Crime, err)
+		}
+	}
+	if len(c.Subscribers) == 0 || !mailer.Enabled() {
+		return
+	}
+	detail := "live case update sent to " + strings.Join(c.Subscribers, ", ")
+	if err := mailer.Send(c.Subscribers, "Live case "+c.Crime+": new CDR for "+target, reports); err != nil {
+		log.Printf("mail: live case %s: %v", c.Crime, err)
+		detail = "live case update to " + strings.Join(c.Subscribers, ", ") + " failed: " + err.Error()
+	}
+	if err := audit.Record(audit.Event{
+		Action: "mail", Tenant: job.Tenant, TSP: job.TSP, CDR: job.CDR, Crime: c.Crime, Detail: detail,
+	}); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
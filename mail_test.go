@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/pseudo"
+)
+
+// fakeSMTP accepts one message on a local port and sends its DATA on the
+// returned channel.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	got := make(chan string, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		reply := func(s string) { io.WriteString(c, s+"\r\n") }
+		reply("220 test")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 test")
+			case cmd == "DATA":
+				reply("354 go on")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				got <- data.String()
+				reply("250 ok")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), got
+}
+
+// TestMailAnonymized checks that mailing an anonymized job's reports, with
+// attachments on, gives away neither the target number nor the key file
+// mapping the pseudonyms back.
+func TestMailAnonymized(t *testing.T) {
+	t.Chdir(t.TempDir())
+	addr, got := fakeSMTP(t)
+	t.Setenv("CDR_SMTP_ADDR", addr)
+	t.Setenv("CDR_SMTP_FROM", "cdr@example.org")
+	t.Setenv("CDR_MAIL_ATTACH", "1")
+
+	const real = "9876500001"
+	os.MkdirAll("filtered", 0o755)
+	report := filepath.Join("filtered", real+"_reports.csv")
+	if err := os.WriteFile(report, []byte("CdrNo,B Party,IMEI\n"+real+",9876500002,861101974991742\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outputs, err := pseudo.Files([]string{report}, real)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailReports(&jobs.Job{ID: "j1", CDR: real, Crime: "FIR-1", Outputs: outputs}, []string{"io@example.org"})
+
+	msg, err := mail.ReadMessage(strings.NewReader(<-got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if want := pseudo.Target(outputs); !strings.Contains(subject, want) {
+		t.Errorf("subject %q does not name the pseudonym %s", subject, want)
+	}
+	// everything mailed, headers and decoded parts alike
+	var all bytes.Buffer
+	for k, v := range msg.Header {
+		all.WriteString(k + ": " + strings.Join(v, ", ") + "\n")
+	}
+	all.WriteString(subject + "\n")
+	_, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range p.Header {
+			all.WriteString(k + ": " + strings.Join(v, ", ") + "\n")
+		}
+		var body io.Reader = p
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			body = base64.NewDecoder(base64.StdEncoding, p)
+		}
+		io.Copy(&all, body)
+	}
+	for _, leak := range []string{real, "_pseudonym_key"} {
+		if strings.Contains(all.String(), leak) {
+			t.Errorf("mail contains %q:\n%s", leak, all.String())
+		}
+	}
+}
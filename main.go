@@ -1,40 +1,784 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"maps"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/jalad-shrimali/cdr-filter/vi"
-	"github.com/jalad-shrimali/cdr-filter/bsnl"
-	"github.com/jalad-shrimali/cdr-filter/jio"
-	"github.com/jalad-shrimali/cdr-filter/airtel"
+	"github.com/jalad-shrimali/cdr-filter/internal/archive"
+	"github.com/jalad-shrimali/cdr-filter/internal/atrest"
+	"github.com/jalad-shrimali/cdr-filter/internal/audit"
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/cors"
+	"github.com/jalad-shrimali/cdr-filter/internal/diff"
+	"github.com/jalad-shrimali/cdr-filter/internal/dlink"
+	"github.com/jalad-shrimali/cdr-filter/internal/evidence"
+	"github.com/jalad-shrimali/cdr-filter/internal/ingest"
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/live"
+	"github.com/jalad-shrimali/cdr-filter/internal/mailer"
+	"github.com/jalad-shrimali/cdr-filter/internal/maltego"
+	"github.com/jalad-shrimali/cdr-filter/internal/pseudo"
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+	"github.com/jalad-shrimali/cdr-filter/internal/upload"
+	"github.com/jalad-shrimali/cdr-filter/internal/workers"
+	"github.com/jalad-shrimali/cdr-filter/internal/workspace"
 )
 
 // central dispatcher
 func uploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	// the cap plus room for the form fields, before any of it is parsed
+	r.Body = http.MaxBytesReader(w, r.Body, upload.MaxBytes()+1<<20)
+	var tooBig *http.MaxBytesError
+	if errors.As(r.ParseMultipartForm(32<<20), &tooBig) {
+		http.Error(w, upload.ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
 	tsp := strings.ToLower(r.FormValue("tsp_type"))
-	switch tsp {
-	case "jio":
-		jio.UploadAndNormalizeCSV(w, r)
-	case "vi":
-		vi.UploadAndNormalizeCSV(w, r)
-	case "bsnl":
-		bsnl.UploadAndNormalizeCSV(w, r)
-	case "airtel":
-		airtel.UploadAndNormalizeCSV(w, r)
-	default:
+	if _, ok := normalizers[tsp]; !ok {
+		http.Error(w, "unknown or missing tsp_type", http.StatusBadRequest)
+		return
+	}
+	if err := checkOptions(tsp, r.Form); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mapping, err := mappingFile(r, tsp)
+	if err != nil {
+		http.Error(w, "mapping: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opt := canon.OptionsFromRequest(r)
+	opt.Tenant = tenant.Of(r)
+	// map fields win over the mapping file
+	opt.Mapping = mapping.Merge(opt.Mapping)
+
+	// a retried request with the same Idempotency-Key gets the original
+	// job's response instead of a second job
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" {
+		defer jobs.LockKey(key)()
+		if job, err := jobs.ByKey(key); err == nil && job.Status == "done" && job.Tenant == opt.Tenant {
+			if job.TSP != tsp {
+				http.Error(w, "Idempotency-Key reused for a different request", http.StatusUnprocessableEntity)
+				return
+			}
+			list := keyed(key, opt.Tenant)
+			for _, j := range list {
+				w.Header().Add("X-Job-ID", j.ID)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			job = batch(list)
+			setCoverage(w, job)
+			writeLinks(w, r, job)
+			return
+		}
+	}
+
+	fh, hdr, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer fh.Close()
+
+	src, err := upload.Store(fh, hdr.Filename)
+	if err != nil {
+		http.Error(w, err.Error(), upload.Status(err))
+		return
+	}
+
+	list, err := processStored(r.Context(), tsp, src, key, opt)
+	for _, j := range list {
+		w.Header().Add("X-Job-ID", j.ID)
+	}
+	job := batch(list)
+	setCoverage(w, job)
+	if err != nil {
+		http.Error(w, err.Error(), processStatus(err))
+		return
+	}
+
+	writeLinks(w, r, job)
+}
+
+/* completion of a resumable upload: same processing as /upload */
+func resumableDone(w http.ResponseWriter, r *http.Request, src string, meta url.Values) {
+	tsp := strings.ToLower(meta.Get("tsp_type"))
+	if _, ok := normalizers[tsp]; !ok {
 		http.Error(w, "unknown or missing tsp_type", http.StatusBadRequest)
+		return
+	}
+	if err := checkOptions(tsp, meta); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opt := canon.OptionsFromValues(meta)
+	opt.Tenant = tenant.Of(r)
+	list, err := processStored(r.Context(), tsp, src, "", opt)
+	for _, j := range list {
+		w.Header().Add("X-Job-ID", j.ID)
+	}
+	job := batch(list)
+	setCoverage(w, job)
+	if err != nil {
+		http.Error(w, err.Error(), processStatus(err))
+		return
+	}
+	writeLinks(w, r, job)
+}
+
+/* the job of a stored upload; an archive is unpacked as the watch folder
+   unpacks one, each file in it stored and processed as an upload of its
+   own, and fails if any of them does */
+func processStored(ctx context.Context, tsp, src, key string, opt canon.Options) ([]*jobs.Job, error) {
+	if !archive.Is(src) {
+		job, err := process(ctx, tsp, src, key, opt)
+		return []*jobs.Job{job}, err
+	}
+	if !upload.Keep() {
+		defer upload.Discard(src)
+	}
+	var list []*jobs.Job
+	_, err := ingest.Unpacking(func(tsp, p string) ([]string, error) {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		member, err := upload.Store(f, filepath.Base(p))
+		if err != nil {
+			return nil, err
+		}
+		job, err := process(ctx, tsp, member, key, opt)
+		list = append(list, job)
+		return job.Outputs, err
+	})(tsp, src)
+	return list, err
+}
+
+/* batch makes one job of the jobs of an upload for its response: one job,
+   or one for each file of an archive */
+func batch(list []*jobs.Job) *jobs.Job {
+	if len(list) == 1 {
+		return list[0]
+	}
+	b := &jobs.Job{SHA256: map[string]string{}}
+	for _, j := range list {
+		for _, p := range j.Outputs {
+			if !slices.Contains(b.Outputs, p) { // a file sent twice
+				b.Outputs = append(b.Outputs, p)
+			}
+		}
+		b.Coverage = append(b.Coverage, j.Coverage...)
+		maps.Copy(b.SHA256, j.SHA256)
+	}
+	return b
+}
+
+/* keyed returns tenant's done jobs made with the Idempotency-Key key */
+func keyed(key, tenant string) []*jobs.Job {
+	list, err := jobs.List()
+	if err != nil {
+		log.Printf("jobs: %v", err)
+	}
+	var out []*jobs.Job
+	for _, j := range list {
+		if j.Key == key && j.Tenant == tenant && j.Status == "done" {
+			out = append(out, j)
+		}
+	}
+	return out
+}
+
+/* the share of rows each reference table enriched, e.g.
+   "cell lookups: 38 of 40 rows (95%); LRN matches: …" */
+func setCoverage(w http.ResponseWriter, job *jobs.Job) {
+	if len(job.Coverage) > 0 {
+		w.Header().Set("X-Enrichment-Coverage", strings.Join(job.Coverage, "; "))
 	}
 }
 
+/* the option fields of an upload form or its metadata must parse */
+func checkOptions(tsp string, v url.Values) error {
+	if _, err := canon.ParseColumns(v.Get("columns")); err != nil {
+		return fmt.Errorf("columns: %w", err)
+	}
+	if _, err := canon.ParseSkip(v.Get("skip")); err != nil {
+		return fmt.Errorf("skip: %w", err)
+	}
+	if _, err := canon.ParseLocale(v.Get("locale")); err != nil {
+		return err
+	}
+	if err := checkEmail(v.Get("email")); err != nil {
+		return fmt.Errorf("email: %w", err)
+	}
+	if _, err := canon.ParseCDR(v.Get("cdr")); err != nil {
+		return fmt.Errorf("cdr: %w", err)
+	}
+	if _, err := canon.ParseScene(v.Get("scene")); err != nil {
+		return fmt.Errorf("scene: %w", err)
+	}
+	if _, err := canon.ParseRadius(v.Get("scene_radius")); err != nil {
+		return fmt.Errorf("scene_radius: %w", err)
+	}
+	if _, err := workers.ParsePriority(v.Get("priority")); err != nil {
+		return fmt.Errorf("priority: %w", err)
+	}
+	m, err := canon.ParseMapping(v["map"])
+	if err == nil {
+		err = checkMapping(tsp, m)
+	}
+	if err != nil {
+		return fmt.Errorf("map: %w", err)
+	}
+	return nil
+}
+
+/* a mapping names only columns read from tsp's exports */
+func checkMapping(tsp string, m canon.Mapping) error {
+	read := sourceColumns[tsp]()
+	for _, c := range slices.Sorted(maps.Keys(m)) {
+		if _, ok := read[c]; !ok {
+			return fmt.Errorf("%s is not read from %s exports", c, tsp)
+		}
+	}
+	return nil
+}
+
+/* the mapping file sent with a form, if any: one-off export headers for
+   canonical columns, e.g. of a CDR another tool has already reworked */
+func mappingFile(r *http.Request, tsp string) (canon.Mapping, error) {
+	f, _, err := r.FormFile("mapping")
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := canon.ReadMapping(f)
+	if err == nil {
+		err = checkMapping(tsp, m)
+	}
+	return m, err
+}
+
+/* recipients must parse, and mailing needs a relay */
+func checkEmail(list string) error {
+	to, err := mailer.ParseAddresses(list)
+	if err == nil && len(to) > 0 && !mailer.Enabled() {
+		err = errors.New("email delivery is not configured")
+	}
+	return err
+}
+
+/* one download link per line, or with Accept: application/json a list of
+   {name, url, sha256, profiles}, profiles giving the links to the copies
+   of a CSV report cut to each output profile, such as the court copy */
+func writeLinks(w http.ResponseWriter, r *http.Request, job *jobs.Job) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		type link struct {
+			Name     string            `json:"name"`
+			URL      string            `json:"url"`
+			SHA256   string            `json:"sha256,omitempty"`
+			Profiles map[string]string `json:"profiles,omitempty"`
+		}
+		links := []link{}
+		for _, p := range job.Outputs {
+			name := filepath.Base(p)
+			links = append(links, link{name, dlink.Path(dlink.Name(p)), job.SHA256[name], copyLinks(dlink.Name(p))})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(links)
+		return
+	}
+	for _, p := range job.Outputs {
+		fmt.Fprintln(w, dlink.Path(dlink.Name(p)))
+	}
+}
+
+/* automatic ingestion: store the fetched file like an upload, then process */
+func ingestFile(tsp, path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src, err := upload.Store(f, filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	job, err := process(serverCtx, tsp, src, "", canon.Options{Tenant: os.Getenv("CDR_INGEST_TENANT"), Ingested: true})
+	// the outputs are mailed back: never the key of an anonymized job
+	return pseudo.Shareable(job.Outputs), err
+}
+
+/* loadJob returns job id if it belongs to r's tenant */
+func loadJob(r *http.Request, id string) (*jobs.Job, error) {
+	job, err := jobs.Load(id)
+	if err == nil && job.Tenant != tenant.Of(r) {
+		return nil, jobs.ErrNotFound
+	}
+	return job, err
+}
+
+/* DELETE /cdr/{number} and /cases/{id}: remove everything stored for it;
+   refused in evidence mode, whose reports are write-once */
+func purgeHandler(w http.ResponseWriter, r *http.Request) {
+	number, caseID, t := r.PathValue("number"), r.PathValue("id"), tenant.Of(r)
+	if evidence.Enabled() {
+		http.Error(w, evidence.ErrWriteOnce.Error(), http.StatusConflict)
+		return
+	}
+	if r.PathValue("number") != "" {
+		n, err := canon.ParseCDR(number)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		number = n
+	}
+	events, err := audit.Events()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var files []string
+	for _, e := range events {
+		if e.Action != "process" || e.Tenant != t {
+			continue
+		}
+		if (number != "" && e.CDR == number) || (caseID != "" && e.Crime == caseID) {
+			files = append(files, e.Upload)
+			files = append(files, e.Outputs...)
+		}
+	}
+	list, _ := jobs.List()
+	for _, j := range list {
+		if j.Tenant != t {
+			continue
+		}
+		if (number != "" && j.CDR == number) || (caseID != "" && j.Crime == caseID) {
+			files = append(files, j.Upload, filepath.Join(jobs.Dir, j.ID+".json"), jobs.RecordsPath(j.ID))
+			files = append(files, j.Outputs...)
+		}
+	}
+	if number != "" {
+		entries, _ := os.ReadDir(outputDir(t))
+		for _, e := range entries {
+			if !e.IsDir() && strings.HasPrefix(e.Name(), number+"_") {
+				files = append(files, filepath.Join(outputDir(t), e.Name()))
+			}
+		}
+	}
+
+	/* a purged case stops being followed */
+	if caseID != "" {
+		if err := live.Remove(t, caseID); err != nil && !errors.Is(err, live.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	removed := []string{}
+	seen := map[string]bool{}
+	for _, f := range files {
+		if f == "" || seen[f] {
+			continue
+		}
+		seen[f] = true
+		if err := os.Remove(f); err == nil {
+			removed = append(removed, f)
+		}
+		// per-upload directories are left empty once their file is gone
+		if dir := filepath.Dir(f); filepath.Dir(dir) == upload.Dir {
+			os.Remove(dir)
+		}
+	}
+
+	if err := audit.Record(audit.Event{
+		Action: "purge", Tenant: t, CDR: number, Crime: caseID, Outputs: removed,
+		Detail: fmt.Sprintf("%d files removed", len(removed)),
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"removed": removed})
+}
+
+/* GET /jobs/{id}/records.ndjson: one JSON object per normalized row */
+func recordsHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := loadJob(r, r.PathValue("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if job.Status != "done" || jobs.Records(job) == "" {
+		http.Error(w, "job has no records", http.StatusConflict)
+		return
+	}
+
+	columns := job.Columns
+	if spec := r.URL.Query().Get("columns"); spec != "" {
+		if columns, err = canon.ParseColumns(spec); err != nil {
+			http.Error(w, "columns: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	var (
+		names, keys []string
+		col         map[string]int
+	)
+	n := 0
+	err = canon.ScanReport(jobs.Records(job), func(header, row []string) error {
+		if keys == nil {
+			col, names = canon.Index(header), header
+			if len(columns) > 0 {
+				names = columns
+			}
+			for _, h := range names {
+				keys = append(keys, canon.FieldName(h))
+			}
+		}
+		obj := make(map[string]string, len(keys))
+		for i, v := range canon.Select(row, col, names) {
+			obj[keys[i]] = v
+		}
+		if n++; n%500 == 0 && flusher != nil {
+			flusher.Flush()
+		}
+		return enc.Encode(obj)
+	})
+	if err != nil {
+		log.Printf("records %s: %v", job.ID, err)
+	}
+}
+
+/* GET /jobs/{id}/diff[?against={id}]: what changed since the previous
+   version of this CDR (default: the last job for the same number) */
+func diffHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := loadJob(r, r.PathValue("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if job.Status != "done" || jobs.Records(job) == "" {
+		http.Error(w, "job has no records", http.StatusConflict)
+		return
+	}
+
+	var prev *jobs.Job
+	if id := r.URL.Query().Get("against"); id != "" {
+		if prev, err = loadJob(r, id); err != nil {
+			http.Error(w, "against: "+err.Error(), http.StatusNotFound)
+			return
+		}
+	} else {
+		list, _ := jobs.List()
+		for _, j := range list {
+			if j.ID != job.ID && j.Status == "done" && !j.Summary && j.Tenant == job.Tenant && j.CDR == job.CDR && j.TSP == job.TSP && j.Created.Before(job.Created) {
+				prev = j
+			}
+		}
+		if prev == nil {
+			http.Error(w, "no earlier job for this number", http.StatusNotFound)
+			return
+		}
+	}
+
+	if jobs.Records(prev) == "" {
+		http.Error(w, "against: job has no records", http.StatusConflict)
+		return
+	}
+	res, err := diff.Reports(jobs.Records(prev), jobs.Records(job))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := audit.Record(audit.Event{
+		Action: "diff", Tenant: job.Tenant, TSP: job.TSP, CDR: job.CDR, Crime: job.Crime,
+		Detail: fmt.Sprintf("job %s against %s: %d added, %d removed, %d changed",
+			job.ID, prev.ID, res.Added, res.Removed, res.Changed),
+	}); err != nil {
+		log.Printf("audit: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s_diff_%s_%s.csv"`, job.CDR, prev.ID, job.ID))
+	cw := safecsv.NewWriter(w)
+	cw.WriteAll([][]string{
+		{"# CDR", job.CDR},
+		{"# Previous job", prev.ID, prev.Created.Format(time.RFC3339)},
+		{"# Current job", job.ID, job.Created.Format(time.RFC3339)},
+		{"# Added", strconv.Itoa(res.Added)},
+		{"# Removed", strconv.Itoa(res.Removed)},
+		{"# Changed", strconv.Itoa(res.Changed)},
+		{"# Unchanged", strconv.Itoa(res.Matched)},
+	})
+	cw.Write(append(append([]string{"Change"}, diff.KeyColumns()...), "Field", "Previous", "Current"))
+	for _, c := range res.Changes {
+		cw.Write(append(append([]string{c.Kind}, c.Key...), c.Field, c.Old, c.New))
+	}
+	cw.Flush()
+}
+
+/* POST /jobs/{id}/cancel, DELETE /jobs/{id}: stop a running job; it
+   publishes nothing, its partial outputs are removed and its upload is
+   answered as cancelled. The cancellation is audited once the job stops */
+func cancelHandler(w http.ResponseWriter, r *http.Request) {
+	id, t := r.PathValue("id"), tenant.Of(r)
+	if !jobs.Cancel(id, t) {
+		http.Error(w, "no running job "+id, http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+/* GET /schema: canonical columns and per-TSP source mappings */
+func schemaHandler(w http.ResponseWriter, r *http.Request) {
+	sources := map[string]map[string][]string{}
+	for tsp, fn := range sourceColumns {
+		sources[tsp] = fn()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"columns": canon.Schema,
+		"sources": sources,
+		"locales": canon.Locales(),
+	})
+}
+
+/* POST /admin/reload: re-read cell, LRN, rules, service-number and
+   validation tables without a restart */
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	ok, failed := refdata.Reload()
+	errs := map[string]string{}
+	for name, err := range failed {
+		errs[name] = err.Error()
+		log.Printf("reload %s: %v", name, err)
+	}
+	if err := audit.Record(audit.Event{
+		Action: "reload",
+		Detail: fmt.Sprintf("%d reloaded, %d failed", len(ok), len(failed)),
+	}); err != nil {
+		log.Printf("audit: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(failed) > 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(map[string]any{"reloaded": ok, "failed": errs})
+}
+
+/* GET /healthz: "degraded" while any reference table is not loaded; the
+   service still answers, so the status stays 200 */
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	problems := refdata.Problems("")
+	status := "ok"
+	if len(problems) > 0 {
+		status = "degraded"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "problems": problems})
+}
+
+/* /download/<name>: a signed link opens on its own; otherwise, with
+   tenants, the caller must be the tenant whose directory holds the file */
+func downloadGuard(files http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		switch {
+		case dlink.Enabled() && r.URL.Query().Has("sig"):
+			if err := dlink.Check(r, name); err != nil {
+				http.Error(w, err.Error(), dlink.Status(err))
+				return
+			}
+		case tenant.Enabled():
+			t, _, ok := tenant.FromRequest(r)
+			if !ok {
+				http.Error(w, "missing or unknown API key", http.StatusUnauthorized)
+				return
+			}
+			if dir, _, _ := strings.Cut(name, "/"); dir != t {
+				http.NotFound(w, r)
+				return
+			}
+		case dlink.Enabled():
+			http.Error(w, dlink.ErrInvalid.Error(), http.StatusForbidden)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+/* API routes are served under apiPrefix; the unversioned paths of earlier
+   releases keep working through legacy */
+const apiPrefix = "/v1"
+
+/* legacy serves an unversioned API path as its /v1/ route, marking the
+   response deprecated and naming the successor, so scripts written against
+   the old paths keep working while they move over */
+func legacy(api http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", apiPrefix, r.URL.Path))
+		api.ServeHTTP(w, r)
+	})
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "gen" {
+		genCommand(os.Args[2:])
+		return
+	}
+	// workspaces of jobs cut off by the last shutdown
+	if err := workspace.Clean(); err != nil {
+		log.Printf("workspace: %v", err)
+	}
 	http.HandleFunc("/upload", uploadHandler)
+	http.HandleFunc("DELETE /cdr/{number}", purgeHandler)
+	http.HandleFunc("DELETE /cases/{id}", purgeHandler)
+	http.HandleFunc("POST /cases/{id}/reprocess", reprocessHandler)
+	http.HandleFunc("PUT /cases/{id}/live", liveHandler)
+	http.HandleFunc("GET /cases/{id}/live", liveStatusHandler)
+	http.HandleFunc("DELETE /cases/{id}/live", unliveHandler)
+	http.HandleFunc("GET /jobs/{id}/records.ndjson", recordsHandler)
+	http.HandleFunc("GET /jobs/{id}/diff", diffHandler)
+	http.HandleFunc("POST /jobs/{id}/cancel", cancelHandler)
+	http.HandleFunc("DELETE /jobs/{id}", cancelHandler)
+	http.HandleFunc("POST /jobs/{id}/retry", retryHandler)
+	http.HandleFunc("GET /schema", schemaHandler)
+	http.HandleFunc("GET /towers", towersHandler)
+	http.HandleFunc("GET /cells/conflicts", cellConflictsHandler)
+	http.HandleFunc("POST /admin/reload", reloadHandler)
+	http.HandleFunc("GET /healthz", healthHandler)
+	http.HandleFunc("GET /outputs", outputsHandler)
+	http.HandleFunc("GET /cases/{id}/outputs", outputsHandler)
+	http.HandleFunc("GET /cases/{id}/workbook", workbookHandler)
+	http.HandleFunc("GET /cases/{id}/versions", versionsHandler)
+	http.HandleFunc("GET /compare", compareHandler)
+	http.HandleFunc("DELETE /outputs/{name}", deleteOutputHandler)
+	http.HandleFunc("GET /metrics", metricsHandler)
+	http.HandleFunc("GET /stats", statsHandler)
+	http.HandleFunc("GET /gen", genHandler)
+	upload.RegisterResumable(http.DefaultServeMux, resumableDone)
+	maltego.Register(http.DefaultServeMux)
 
 	http.Handle("/download/",
 		http.StripPrefix("/download/",
-			http.FileServer(http.Dir("filtered"))))
+			downloadGuard(profiled("filtered", atrest.FileServer("filtered")))))
 
+	if dir := ingest.Dir(); dir != "" {
+		go ingest.Watch(dir, ingest.Interval(), []string{"airtel", "bsnl", "jio", "vi"}, ingest.Unpacking(ingestFile))
+		log.Printf("Watching %s for dropped CDRs", dir)
+	}
+
+	if p := ingest.SFTPFile(); p != "" {
+		f, err := os.Open(p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sources, err := ingest.LoadSources(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go ingest.Pull(sources, ingest.SFTPInterval(), ingest.Unpacking(ingestFile))
+		log.Printf("Pulling CDRs from %d SFTP source(s)", len(sources))
+	}
+
+	mc, err := ingest.MailFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if mc != nil {
+		go mc.Poll(ingestFile)
+		log.Printf("Polling mailbox %s for CDR attachments", mc.URL)
+	}
+
+	log.Printf("Processing up to %d jobs at once", workers.Size())
+	if evidence.Enabled() {
+		log.Printf("Evidence mode: reports are write-once and versioned in %s", evidence.Index)
+	}
 	log.Println("Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	if tenant.Enabled() && !dlink.Enabled() {
+		log.Printf("tenants enabled without CDR_LINK_TTL: downloads need the API key header")
+	}
+	api := tenant.Middleware(http.DefaultServeMux, "/healthz", "/download/")
+	root := http.NewServeMux()
+	root.Handle(apiPrefix+"/", http.StripPrefix(apiPrefix, api))
+	// links already handed out and probes are not part of the versioned API
+	root.Handle("/download/", api)
+	root.Handle("GET /healthz", api)
+	root.Handle("GET /metrics", api)
+	root.Handle("/", legacy(api))
+	srv := &http.Server{
+		Addr:        ":8080",
+		Handler:     cors.Middleware(root),
+		BaseContext: func(net.Listener) context.Context { return serverCtx },
+	}
+	// on SIGINT or SIGTERM, cancel running jobs and let their requests
+	// answer before exiting
+	stopped := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		log.Printf("shutting down: cancelling running jobs")
+		shutdown(errShutdown)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+		close(stopped)
+	}()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-stopped
 }
+
+// serverCtx is done once the server shuts down, with errShutdown as the
+// cause; requests, and so their jobs, and ingestion jobs run within it.
+var (
+	serverCtx, shutdown = context.WithCancelCause(context.Background())
+	errShutdown         = errors.New("server shutting down")
+)
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/quota"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+	"github.com/jalad-shrimali/cdr-filter/internal/workers"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// GET /metrics: storage gauges in the Prometheus text format, and the
+// worker queue by priority. Admins see the storage of every tenant that
+// has jobs; other callers only their own.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	tenants := []string{tenant.Of(r)}
+	if tenant.Enabled() && tenant.Admin(r) {
+		list, _ := jobs.List()
+		for _, j := range list {
+			if !slices.Contains(tenants, j.Tenant) {
+				tenants = append(tenants, j.Tenant)
+			}
+		}
+		sort.Strings(tenants)
+	}
+
+	var used, limits, cases strings.Builder
+	for _, t := range tenants {
+		u, err := quota.Measure(outputDir(t), t)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		lt := labelEscaper.Replace(t)
+		fmt.Fprintf(&used, "cdr_storage_bytes{tenant=\"%s\"} %d\n", lt, u.Total)
+		if l := quota.Limit(t); l > 0 {
+			fmt.Fprintf(&limits, "cdr_storage_quota_bytes{tenant=\"%s\"} %d\n", lt, l)
+		}
+		names := make([]string, 0, len(u.Cases))
+		for c := range u.Cases {
+			names = append(names, c)
+		}
+		sort.Strings(names)
+		for _, c := range names {
+			fmt.Fprintf(&cases, "cdr_case_storage_bytes{tenant=\"%s\",case=\"%s\"} %d\n",
+				lt, labelEscaper.Replace(c), u.Cases[c])
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, "# HELP cdr_storage_bytes Bytes of reports and job records held by a tenant.\n")
+	fmt.Fprint(w, "# TYPE cdr_storage_bytes gauge\n", used.String())
+	fmt.Fprint(w, "# HELP cdr_storage_quota_bytes Storage limit of a tenant; absent when unlimited.\n")
+	fmt.Fprint(w, "# TYPE cdr_storage_quota_bytes gauge\n", limits.String())
+	if l := quota.CaseLimit(); l > 0 {
+		fmt.Fprint(w, "# HELP cdr_case_storage_quota_bytes Storage limit of each case.\n")
+		fmt.Fprintf(w, "# TYPE cdr_case_storage_quota_bytes gauge\ncdr_case_storage_quota_bytes %d\n", l)
+	}
+	fmt.Fprint(w, "# HELP cdr_case_storage_bytes Bytes held per case (crime number).\n")
+	fmt.Fprint(w, "# TYPE cdr_case_storage_bytes gauge\n", cases.String())
+	writeWorkerMetrics(w)
+}
+
+// writeWorkerMetrics writes the worker queue's gauges and counters, one
+// series per priority.
+func writeWorkerMetrics(w io.Writer) {
+	var waiting, running, started, waited strings.Builder
+	for _, s := range workers.Stats() {
+		fmt.Fprintf(&waiting, "cdr_jobs_waiting{priority=\"%s\"} %d\n", s.Priority, s.Waiting)
+		fmt.Fprintf(&running, "cdr_jobs_running{priority=\"%s\"} %d\n", s.Priority, s.Running)
+		fmt.Fprintf(&started, "cdr_jobs_started_total{priority=\"%s\"} %d\n", s.Priority, s.Started)
+		fmt.Fprintf(&waited, "cdr_job_wait_seconds_total{priority=\"%s\"} %.3f\n", s.Priority, s.Waited.Seconds())
+	}
+	fmt.Fprint(w, "# HELP cdr_jobs_waiting Jobs queued for a worker slot.\n")
+	fmt.Fprint(w, "# TYPE cdr_jobs_waiting gauge\n", waiting.String())
+	fmt.Fprint(w, "# HELP cdr_jobs_running Jobs holding a worker slot.\n")
+	fmt.Fprint(w, "# TYPE cdr_jobs_running gauge\n", running.String())
+	fmt.Fprint(w, "# HELP cdr_jobs_started_total Jobs given a worker slot since the server started.\n")
+	fmt.Fprint(w, "# TYPE cdr_jobs_started_total counter\n", started.String())
+	fmt.Fprint(w, "# HELP cdr_job_wait_seconds_total Time those jobs spent queued for a slot.\n")
+	fmt.Fprint(w, "# TYPE cdr_job_wait_seconds_total counter\n", waited.String())
+}
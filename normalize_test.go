@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// TestNormalizeGolden checks the TSP normalizers against golden files.
+// Each fixture in testdata/, one per TSP export layout, is a small
+// synthetic CDR (made with "cdr-filter gen", no real subscriber data)
+// whose canonical outputs are kept under testdata/golden/<fixture>/.
+// After an intended change to a format mapping, rewrite them with
+//
+//	go test -run TestNormalizeGolden -update
+//
+// and review the diff of testdata/golden like any other change.
+func TestNormalizeGolden(t *testing.T) {
+	for _, tc := range []struct{ file, tsp, format string }{
+		{"airtel.csv", "airtel", "v2"},
+		{"airtel_v1.csv", "airtel", "v1"},
+		{"airtel_enterprise.csv", "airtel", "enterprise"},
+		{"bsnl.csv", "bsnl", ""},
+		{"bsnl_fixed.txt", "bsnl", ""},
+		{"jio.csv", "jio", "v2"},
+		{"jio_v1.csv", "jio", "v1"},
+		{"jio_pdf.pdf", "jio", "v2"},
+		{"vi.csv", "vi", ""},
+		{"vi_xlsx.xlsx", "vi", ""},
+		{"vi_xls.xls", "vi", ""},
+	} {
+		name := strings.TrimSuffix(tc.file, filepath.Ext(tc.file))
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join("testdata", tc.file)
+			if filepath.Ext(src) == ".pdf" { // read back into a CSV first, as run does
+				var err error
+				if src, _, err = fromPDF(src, t.TempDir()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			res, err := normalizers[tc.tsp](context.Background(), src, canon.Options{Crime: "FIR-TEST", Dir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.CDR != "9876500001" {
+				t.Errorf("CDR = %q, want 9876500001", res.CDR)
+			}
+			if res.Format != tc.format {
+				t.Errorf("Format = %q, want %q", res.Format, tc.format)
+			}
+
+			// every fixture row has a date and time; a blank column means
+			// the TSP's header went unrecognised
+			if err := filled(filepath.Join(dir, res.CDR+"_reports.csv"), "Date", "Time"); err != nil {
+				t.Error(err)
+			}
+
+			golden := filepath.Join("testdata", "golden", name)
+			if *update {
+				if err := os.RemoveAll(golden); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.MkdirAll(golden, 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var got []string
+			for _, p := range res.Outputs {
+				name := filepath.Base(p)
+				got = append(got, name)
+				data, err := os.ReadFile(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if *update {
+					if err := os.WriteFile(filepath.Join(golden, name), data, 0o644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				want, err := os.ReadFile(filepath.Join(golden, name))
+				if err != nil {
+					t.Errorf("%s: unexpected output (%v)", name, err)
+					continue
+				}
+				if line, g, w := firstDiff(data, want); line > 0 {
+					t.Errorf("%s differs from golden at line %d:\n got: %s\nwant: %s", name, line, g, w)
+				}
+			}
+
+			entries, err := os.ReadDir(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				if !slices.Contains(got, e.Name()) {
+					t.Errorf("%s: golden output not produced", e.Name())
+				}
+			}
+		})
+	}
+}
+
+// filled returns an error for the first row of the CSV at path that
+// leaves one of cols blank.
+func filled(path string, cols ...string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("%s: no header", path)
+	}
+	for _, c := range cols {
+		i := slices.Index(rows[0], c)
+		if i < 0 {
+			return fmt.Errorf("%s: no %s column", path, c)
+		}
+		for n, row := range rows[1:] {
+			if i >= len(row) || strings.TrimSpace(row[i]) == "" {
+				return fmt.Errorf("%s: row %d has no %s", filepath.Base(path), n+1, c)
+			}
+		}
+	}
+	return nil
+}
+
+// firstDiff returns the 1-based number and contents of the first line
+// where got and want differ, or 0 when they are equal.
+func firstDiff(got, want []byte) (int, string, string) {
+	if bytes.Equal(got, want) {
+		return 0, "", ""
+	}
+	g := strings.Split(string(got), "\n")
+	w := strings.Split(string(want), "\n")
+	for i := 0; ; i++ {
+		var gl, wl string
+		if i < len(g) {
+			gl = g[i]
+		}
+		if i < len(w) {
+			wl = w[i]
+		}
+		if gl != wl || i >= len(g) || i >= len(w) {
+			return i + 1, gl, wl
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/audit"
+	"github.com/jalad-shrimali/cdr-filter/internal/dlink"
+	"github.com/jalad-shrimali/cdr-filter/internal/evidence"
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/quota"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+)
+
+// artifact is one generated file in an output directory, attributed to the newest
+// job that produced it. Files no job record claims (e.g. written before
+// jobs were recorded) are listed without CDR, TSP or job.
+type artifact struct {
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	CDR     string    `json:"cdr,omitempty"`
+	TSP     string    `json:"tsp,omitempty"`
+	Crime   string    `json:"crime,omitempty"`
+	Job     string    `json:"job,omitempty"`
+	SHA256  string    `json:"sha256,omitempty"`
+	// links to the copies cut to each output profile, for CSV reports
+	Profiles map[string]string `json:"profiles,omitempty"`
+}
+
+// artifacts lists the output directory dir, newest first.
+func artifacts(dir string) ([]artifact, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []artifact{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	owner := map[string]*jobs.Job{}
+	list, _ := jobs.List()
+	for _, j := range list { // oldest first, so the newest job wins
+		for _, p := range j.Outputs {
+			if filepath.Dir(p) == dir {
+				owner[filepath.Base(p)] = j
+			}
+		}
+	}
+
+	out := []artifact{}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		name := dlink.Name(filepath.Join(dir, e.Name()))
+		a := artifact{
+			Name: e.Name(), URL: dlink.Path(name), Profiles: copyLinks(name),
+			Size: info.Size(), Created: info.ModTime(),
+		}
+		if j := owner[e.Name()]; j != nil {
+			a.CDR, a.TSP, a.Crime, a.Job = j.CDR, j.TSP, j.Crime, j.ID
+			a.SHA256 = j.SHA256[e.Name()]
+		}
+		out = append(out, a)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out, nil
+}
+
+// GET /outputs[?cdr=&tsp=] and GET /cases/{id}/outputs: generated files
+// with size, time and the CDR, TSP and job they belong to. X-Storage-Used
+// and X-Storage-Quota give the bytes the tenant (or case) uses and may use.
+func outputsHandler(w http.ResponseWriter, r *http.Request) {
+	t := tenant.Of(r)
+	all, err := artifacts(outputDir(t))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// storage used and allowed, for the tenant or the case listed
+	if u, err := quota.Measure(outputDir(t), t); err == nil {
+		used, limit := u.Total, quota.Limit(t)
+		if crime := r.PathValue("id"); crime != "" {
+			used, limit = u.Cases[crime], quota.CaseLimit()
+		}
+		w.Header().Set("X-Storage-Used", strconv.FormatInt(used, 10))
+		if limit > 0 {
+			w.Header().Set("X-Storage-Quota", strconv.FormatInt(limit, 10))
+		}
+	}
+	q := r.URL.Query()
+	cdr, tsp, crime := q.Get("cdr"), strings.ToLower(q.Get("tsp")), r.PathValue("id")
+	list := slices.DeleteFunc(all, func(a artifact) bool {
+		return (cdr != "" && a.CDR != cdr) || (tsp != "" && a.TSP != tsp) || (crime != "" && a.Crime != crime)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// DELETE /outputs/{name}: remove one generated file and drop it from the
+// job records that list it; refused in evidence mode.
+func deleteOutputHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" || filepath.Base(name) != name || strings.HasPrefix(name, ".") {
+		http.NotFound(w, r)
+		return
+	}
+	if evidence.Enabled() {
+		http.Error(w, evidence.ErrWriteOnce.Error(), http.StatusConflict)
+		return
+	}
+	t := tenant.Of(r)
+	p := filepath.Join(outputDir(t), name)
+	if err := os.Remove(p); errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var cdr, tsp, crime string
+	list, _ := jobs.List()
+	for _, j := range list {
+		if !slices.Contains(j.Outputs, p) {
+			continue
+		}
+		cdr, tsp, crime = j.CDR, j.TSP, j.Crime
+		j.Outputs = slices.DeleteFunc(j.Outputs, func(o string) bool { return o == p })
+		if err := jobs.Save(j); err != nil {
+			log.Printf("jobs: %v", err)
+		}
+	}
+
+	if err := audit.Record(audit.Event{
+		Action: "delete", Tenant: t, TSP: tsp, CDR: cdr, Crime: crime, Outputs: []string{p},
+		Detail: fmt.Sprintf("removed %s", name),
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
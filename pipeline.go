@@ -0,0 +1,623 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/airtel"
+	"github.com/jalad-shrimali/cdr-filter/bsnl"
+	"github.com/jalad-shrimali/cdr-filter/internal/archive"
+	"github.com/jalad-shrimali/cdr-filter/internal/atrest"
+	"github.com/jalad-shrimali/cdr-filter/internal/audit"
+	"github.com/jalad-shrimali/cdr-filter/internal/branding"
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/checksum"
+	"github.com/jalad-shrimali/cdr-filter/internal/consolidate"
+	"github.com/jalad-shrimali/cdr-filter/internal/dlink"
+	"github.com/jalad-shrimali/cdr-filter/internal/essink"
+	"github.com/jalad-shrimali/cdr-filter/internal/evidence"
+	"github.com/jalad-shrimali/cdr-filter/internal/gpx"
+	"github.com/jalad-shrimali/cdr-filter/internal/heatmap"
+	"github.com/jalad-shrimali/cdr-filter/internal/history"
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/linkchart"
+	"github.com/jalad-shrimali/cdr-filter/internal/live"
+	"github.com/jalad-shrimali/cdr-filter/internal/mailer"
+	"github.com/jalad-shrimali/cdr-filter/internal/notify"
+	"github.com/jalad-shrimali/cdr-filter/internal/parquet"
+	"github.com/jalad-shrimali/cdr-filter/internal/pdftable"
+	"github.com/jalad-shrimali/cdr-filter/internal/pseudo"
+	"github.com/jalad-shrimali/cdr-filter/internal/quota"
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+	"github.com/jalad-shrimali/cdr-filter/internal/scene"
+	"github.com/jalad-shrimali/cdr-filter/internal/upload"
+	"github.com/jalad-shrimali/cdr-filter/internal/validate"
+	"github.com/jalad-shrimali/cdr-filter/internal/workbook"
+	"github.com/jalad-shrimali/cdr-filter/internal/workers"
+	"github.com/jalad-shrimali/cdr-filter/internal/workspace"
+	"github.com/jalad-shrimali/cdr-filter/jio"
+	"github.com/jalad-shrimali/cdr-filter/vi"
+)
+
+/* tsp_type → normalizer */
+var normalizers = map[string]func(context.Context, string, canon.Options) (canon.Result, error){
+	"jio":    jio.Normalize,
+	"vi":     vi.Normalize,
+	"bsnl":   bsnl.Normalize,
+	"airtel": airtel.Normalize,
+}
+
+/* tsp_types whose normalizer reads Excel workbooks as well as CSV */
+var readsWorkbooks = map[string]bool{"vi": true}
+
+/* tsp_types whose normalizer reads fixed-width .txt exports as well */
+var readsFixedWidth = map[string]bool{"bsnl": true}
+
+/* tsp_type → canonical column → source headers, for GET /schema */
+var sourceColumns = map[string]func() map[string][]string{
+	"jio":    jio.SourceColumns,
+	"vi":     vi.SourceColumns,
+	"bsnl":   bsnl.SourceColumns,
+	"airtel": airtel.SourceColumns,
+}
+
+/* tsp_type → located cells of its cell DB, for GET /towers */
+var towers = map[string]func() []canon.Tower{
+	"jio":    jio.Towers,
+	"vi":     vi.Towers,
+	"bsnl":   bsnl.Towers,
+	"airtel": airtel.Towers,
+}
+
+// process runs one stored upload through normalization and the shared
+// post-processing steps, persisting the job record either way. key is the
+// client's Idempotency-Key, if any. The job is cancelled when ctx is done
+// or POST /jobs/{id}/cancel asks, and then publishes nothing.
+func process(ctx context.Context, tsp, src, key string, opt canon.Options) (*jobs.Job, error) {
+	return run(ctx, tsp, src, key, opt, normalizers[tsp])
+}
+
+// run is process with the step producing the normalizer's reports given,
+// so stored records can be taken through the same steps as an upload.
+func run(ctx context.Context, tsp, src, key string, opt canon.Options, normalize func(context.Context, string, canon.Options) (canon.Result, error)) (*jobs.Job, error) {
+	job := &jobs.Job{
+		ID: upload.ID(src), TSP: tsp, Tenant: opt.Tenant, Key: key, Crime: opt.Crime,
+		Officer: opt.Officer, FIR: opt.FIR, Unit: opt.Unit, Remarks: opt.Remarks,
+		Upload: src, Columns: opt.Columns, Locale: opt.Locale, Summary: opt.SummaryOnly, Overrides: opt.Overrides(),
+		Settings: opt.Settings(), Created: time.Now(),
+	}
+	if normalize == nil {
+		return job, fmt.Errorf("unknown tsp_type %q", tsp)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	defer jobs.Start(job.ID, opt.Tenant, cancel)()
+	// the raw upload is only needed while the job runs, or to retry it
+	// once it failed
+	if !upload.Keep() {
+		defer func() {
+			if job.Status != "failed" {
+				upload.Discard(src)
+			}
+		}()
+	}
+	if !readsWorkbooks[tsp] && isWorkbook(src) {
+		return job, fail(ctx, job, fmt.Errorf("%w: %s CDRs are read as CSV, not Excel workbooks", upload.ErrRejected, tsp))
+	}
+	if !readsFixedWidth[tsp] && strings.EqualFold(filepath.Ext(src), ".txt") {
+		return job, fail(ctx, job, fmt.Errorf("%w: %s CDRs are read as CSV, not fixed-width text", upload.ErrRejected, tsp))
+	}
+	out := outputDir(opt.Tenant)
+	if err := quota.Check(out, opt.Tenant, opt.Crime); err != nil {
+		return job, fail(ctx, job, err)
+	}
+	priority, _ := workers.ParsePriority(opt.Priority)
+	job.Priority = priority.String()
+	release, err := workers.Acquire(ctx, priority)
+	if err != nil {
+		return job, fail(ctx, job, err)
+	}
+	defer release()
+	job.Started = time.Now()
+	defer refdata.Use()()
+	// enrichment from a table that failed to load is skipped; say so in
+	// the reports rather than deliver them silently incomplete
+	opt.Warnings = refdata.Problems(tsp)
+	if len(opt.Skip) > 0 {
+		opt.Warnings = append(opt.Warnings, "enrichment skipped: "+strings.Join(opt.Skip, ", "))
+	}
+	job.Warnings = opt.Warnings
+	for _, w := range opt.Warnings {
+		log.Printf("job %s: warning: %s", job.ID, w)
+	}
+	// what produced the reports, so ones made months apart can be told apart
+	opt.Versions = append([]string{
+		"tool: " + canon.ToolVersion(),
+		"mapping: " + canon.MappingVersion(sourceColumns[tsp]()),
+	}, refdata.Versions(tsp)...)
+	job.Versions = opt.Versions
+	// everything is written to the job's own workspace; the reports are
+	// moved to filtered/ once complete and the rest is removed with it
+	ws, err := workspace.New(job.ID)
+	if err != nil {
+		return job, fail(ctx, job, err)
+	}
+	defer os.RemoveAll(ws)
+	opt.Dir = ws
+	os.MkdirAll(out, 0o755)
+	// a PDF export is read back into a CSV in the workspace first; the
+	// cells only guessed at are logged for whoever checks the report
+	in := src
+	if isPDF(src) {
+		var doubts []string
+		if in, doubts, err = fromPDF(src, ws); err != nil {
+			return job, fail(ctx, job, fmt.Errorf("%w: %v", upload.ErrRejected, err))
+		}
+		for _, d := range doubts {
+			log.Printf("job %s: pdf: %s", job.ID, d)
+		}
+		if len(doubts) > 0 {
+			w := fmt.Sprintf("PDF cells read with low confidence: %d; see the processing log", len(doubts))
+			log.Printf("job %s: warning: %s", job.ID, w)
+			opt.Warnings = append(opt.Warnings, w)
+			job.Warnings = opt.Warnings
+		}
+	}
+
+	res, err := normalize(ctx, in, opt)
+	// after the tool and mapping: the layout read and the zone of the times
+	var stamped []string
+	if res.Format != "" {
+		stamped = append(stamped, "format: "+tsp+" "+res.Format)
+	}
+	if in != src {
+		stamped = append(stamped, "source: PDF table")
+	}
+	if z := res.Clock.String(); z != "" {
+		stamped = append(stamped, "time zone: "+z)
+	}
+	if len(stamped) > 0 {
+		opt.Versions = slices.Insert(opt.Versions, 2, stamped...)
+		job.Versions = opt.Versions
+	}
+	// whose number it is: the operator processed and the circle the
+	// export or the number series gives, for the header of every report
+	if err == nil {
+		opt.Home = canon.HomeOf(res.CDR, tsp)
+		var circle string
+		if circle, err = canon.CircleOf(res.Outputs[0]); circle != "" {
+			opt.Home.Circle = circle
+		}
+	}
+	// a quick look delivers the summaries alone; the steps below that read
+	// the full report are skipped with it
+	full := !opt.SummaryOnly
+	if err == nil && !full {
+		res.Outputs = res.Outputs[1:]
+	}
+	// the normalizer's own reports are the ones delivered with translated
+	// headers; link charts and the consolidated report stay in English for
+	// imports and later appends
+	reports := slices.Clone(res.Outputs)
+	if err == nil && full {
+		var rep *validate.Report
+		if rep, err = validate.Check(tsp, res.Outputs[0], validate.MaxBad()); err == nil && !rep.OK() {
+			if opt.Strict {
+				err = rep
+			} else {
+				log.Printf("job %s: %v", job.ID, rep)
+			}
+		}
+	}
+	// how much of the report the tables enriched, before columns are cut
+	if err == nil && full {
+		var cov canon.Coverage
+		if cov, err = canon.CoverageOf(res.Outputs[0]); err == nil {
+			opt.Coverage = cov.Lines()
+			job.Coverage = opt.Coverage
+			job.Rows = cov.Rows
+			job.Lookups = map[string]jobs.Lookup{
+				"cell": {Total: cov.Cells, Found: cov.CellsFound},
+				"lrn":  {Total: cov.LRNs, Found: cov.LRNsFound},
+				"tac":  {Total: cov.IMEIs, Found: cov.IMEIsFound},
+			}
+		}
+	}
+	if err == nil && full {
+		var links []string
+		if links, err = linkchart.Write(res.Outputs[0]); err == nil {
+			res.Outputs = append(res.Outputs, links...)
+		}
+	}
+	if err == nil && full {
+		var heat []string
+		if heat, err = heatmap.Write(res.Outputs[0], opt.Heatmap); err == nil {
+			res.Outputs = append(res.Outputs, heat...)
+		}
+	}
+	if err == nil && full {
+		var track string
+		if track, err = gpx.Write(res.Outputs[0]); err == nil {
+			res.Outputs = append(res.Outputs, track)
+		}
+	}
+	if err == nil && full && opt.Append {
+		var merged []string
+		if merged, err = consolidate.Append(res.Outputs[0], out, ws, opt.Crime, opt.ExcludeService); err == nil {
+			res.Outputs = append(res.Outputs, merged...)
+		}
+	}
+	// files the ingest sources deliver for a live case's targets extend
+	// its consolidated reports as append_case would
+	var regenerated []live.Case
+	merged := map[string][]string{}
+	if err == nil && full && opt.Ingested {
+		for _, c := range liveCases(opt.Tenant, res.CDR) {
+			if opt.Append && c.Crime == opt.Crime {
+				continue
+			}
+			var files []string
+			if files, err = consolidate.Append(res.Outputs[0], out, ws, c.Crime, opt.ExcludeService); err != nil {
+				err = fmt.Errorf("live case %s: %w", c.Crime, err)
+				break
+			}
+			res.Outputs = append(res.Outputs, files...)
+			regenerated, merged[c.Crime] = append(regenerated, c), files
+		}
+	}
+	var snap string
+	if err == nil && full {
+		snap, err = jobs.Snapshot(job.ID, res.Outputs[0])
+	}
+	// the consolidated report keeps every column for later appends; only
+	// the delivered main report is cut down
+	if err == nil && full {
+		err = canon.Project(res.Outputs[0], opt.Columns)
+	}
+	if err == nil && full && opt.Scene != "" {
+		var near string
+		if near, err = scene.Write(res.Outputs[0], opt.Scene, opt.SceneRadius); err == nil {
+			res.Outputs = append(res.Outputs, near)
+			reports = append(reports, near)
+		}
+	}
+	if err == nil && full && opt.Parquet {
+		var pq string
+		if pq, err = parquet.WriteReport(res.Outputs[0]); err == nil {
+			res.Outputs = append(res.Outputs, pq)
+		}
+	}
+	if err == nil {
+		err = canon.Localize(opt.Locale, reports...)
+	}
+	// an anonymized job's header and cover name the target by its
+	// pseudonym, like its file names
+	target := res.CDR
+	if p := pseudo.Target(res.Outputs); opt.Anonymize && p != "" {
+		target = p
+	}
+	if err == nil {
+		err = canon.Stamp(opt, target, tsp, res.Outputs...)
+	}
+	// in evidence mode a number processed again gets a new version of its
+	// files beside the old; named before the cover and digests name them
+	if err == nil && evidence.Enabled() {
+		var versioned []string
+		if versioned, err = evidence.Version(out, res.Outputs); err == nil {
+			remap(merged, res.Outputs, versioned)
+			res.Outputs = versioned
+		}
+	}
+	if err == nil && branding.HasCover() {
+		cover := filepath.Join(ws, target+"_cover.html")
+		if err = branding.WriteCover(cover, opt.Fields(target, tsp), res.Outputs); err == nil {
+			res.Outputs = append(res.Outputs, cover)
+		}
+	}
+	// digests are of the finished files as delivered, i.e. before sealing
+	var sums map[string]string
+	if err == nil {
+		var files []string
+		if files, sums, err = checksum.Write(res.Outputs); err == nil {
+			res.Outputs = append(res.Outputs, files...)
+		}
+	}
+	// sealed in the workspace, so no output reaches filtered/ unsealed
+	if err == nil {
+		sealed := res.Outputs
+		if snap != "" {
+			sealed = append(sealed, snap)
+		}
+		err = atrest.Seal(sealed...)
+	}
+	// a job cancelled meanwhile leaves nothing behind in filtered/
+	if err == nil {
+		err = ctx.Err()
+	}
+	// the reports replaced are kept with the job that made them
+	if err == nil {
+		err = history.Archive(out, res.Outputs)
+	}
+	if err == nil {
+		publish := workspace.Publish
+		if evidence.Enabled() {
+			publish = workspace.PublishOnce
+		}
+		var published []string
+		if published, err = publish(ws, out, res.Outputs); err == nil {
+			remap(merged, res.Outputs, published)
+			res.Outputs = published
+		}
+	}
+	// a kept upload is sealed only once the job is done: a failed job's
+	// stays readable to be retried
+	if err == nil && upload.Keep() {
+		err = atrest.Seal(src)
+	}
+	if err == nil && evidence.Enabled() {
+		err = evidence.Lock(res.CDR, job.ID, res.Outputs, sums)
+	}
+	if err != nil {
+		// a job that delivered nothing keeps no records either
+		if snap != "" {
+			os.Remove(snap)
+		}
+		return job, fail(ctx, job, err)
+	}
+	job.Finished = time.Now()
+	job.Status, job.CDR, job.Outputs, job.Dupes = "done", res.CDR, res.Outputs, res.Duplicates
+	job.SHA256 = sums
+	var details []string
+	if res.Duplicates > 0 {
+		details = append(details, fmt.Sprintf("removed %d duplicate rows", res.Duplicates))
+	}
+	if res.Skipped > 0 {
+		details = append(details, fmt.Sprintf("skipped %d banner, footer, separator or repeated header lines", res.Skipped))
+	}
+	// the count an export states is of its rows as sent, repeats included
+	if read := job.Rows + res.Duplicates; full && res.Declared > 0 && read != res.Declared {
+		details = append(details, fmt.Sprintf("export states %d records but %d were read", res.Declared, read))
+	}
+	if res.Clock.Converts() {
+		details = append(details, fmt.Sprintf("times converted from %s to %s", res.Clock.From, res.Clock.To))
+	}
+	if !full {
+		details = append(details, "summary only")
+	}
+	for _, c := range regenerated {
+		details = append(details, "extended live case "+c.Crime)
+	}
+	detail := strings.Join(details, "; ")
+	for _, d := range details {
+		log.Printf("job %s: %s", job.ID, d)
+	}
+	if err := jobs.Save(job); err != nil {
+		log.Printf("jobs: %v", err)
+	}
+	if essink.Enabled() && snap != "" {
+		go func() {
+			if err := essink.Index(job.ID, tsp, opt.Crime, snap); err != nil {
+				log.Printf("essink: job %s: %v", job.ID, err)
+			}
+		}()
+	}
+	if err := audit.Record(audit.Event{
+		Action: "process", Tenant: opt.Tenant, TSP: tsp, CDR: res.CDR, Crime: opt.Crime,
+		Upload: src, Outputs: res.Outputs, Detail: detail,
+	}); err != nil {
+		log.Printf("audit: %v", err)
+	}
+	if len(opt.Email) > 0 {
+		go mailReports(job, opt.Email)
+	}
+	if notify.Enabled() {
+		go notifyJob(job)
+	}
+	for _, c := range regenerated {
+		if err := audit.Record(audit.Event{
+			Action: "regenerate", Tenant: opt.Tenant, TSP: tsp, CDR: res.CDR, Crime: c.Crime,
+			Outputs: merged[c.Crime], Detail: "live case extended by job " + job.ID,
+		}); err != nil {
+			log.Printf("audit: %v", err)
+		}
+		go notifyLive(job, c, merged[c.Crime])
+	}
+	return job, nil
+}
+
+// fail records job as failed with err, or as cancelled with the cause
+// when ctx is done, saves it and notifies, and returns the error the job
+// ended with.
+func fail(ctx context.Context, job *jobs.Job, err error) error {
+	job.Finished = time.Now()
+	job.Status, job.Error = "failed", err.Error()
+	if ctx.Err() != nil {
+		err = context.Cause(ctx)
+		job.Status, job.Error = "cancelled", err.Error()
+		log.Printf("job %s: cancelled: %v", job.ID, err)
+		if aerr := audit.Record(audit.Event{
+			Action: "cancel", Tenant: job.Tenant, TSP: job.TSP, Crime: job.Crime,
+			Upload: job.Upload, Detail: "job " + job.ID + ": " + err.Error(),
+		}); aerr != nil {
+			log.Printf("audit: %v", aerr)
+		}
+	}
+	if serr := jobs.Save(job); serr != nil {
+		log.Printf("jobs: %v", serr)
+	}
+	if notify.Enabled() {
+		go notifyJob(job)
+	}
+	return err
+}
+
+// notifyJob posts job's outcome and report links to the chat channels.
+// Checksum files are left out of the message; the reports are linked.
+func notifyJob(job *jobs.Job) {
+	var b strings.Builder
+	target, outputs := shareable(job.CDR, job.Outputs)
+	if target == "" {
+		target = filepath.Base(job.Upload)
+	}
+	fmt.Fprintf(&b, "CDR %s (%s", target, job.TSP)
+	if job.Crime != "" {
+		fmt.Fprintf(&b, ", %s", job.Crime)
+	}
+	fmt.Fprintf(&b, "): %s in %s", job.Status, job.Finished.Sub(job.Created).Round(time.Second))
+	if job.Error != "" {
+		fmt.Fprintf(&b, "\n%s", job.Error)
+	}
+	for _, w := range job.Warnings {
+		fmt.Fprintf(&b, "\nwarning: %s", w)
+	}
+	for _, p := range outputs {
+		if filepath.Ext(p) != ".sha256" {
+			fmt.Fprintf(&b, "\n%s", dlink.URL(dlink.Name(p)))
+		}
+	}
+	if err := notify.Send(b.String()); err != nil {
+		log.Printf("notify: job %s: %v", job.ID, err)
+	}
+}
+
+// mailReports sends job's reports to the upload's recipients and records
+// the delivery, or its failure, in the audit log.
+func mailReports(job *jobs.Job, to []string) {
+	target, outputs := shareable(job.CDR, job.Outputs)
+	subject := "CDR reports for " + target
+	if job.Crime != "" {
+		subject += " (" + job.Crime + ")"
+	}
+	detail := "sent to " + strings.Join(to, ", ")
+	if err := mailer.Send(to, subject, outputs); err != nil {
+		log.Printf("mail: job %s: %v", job.ID, err)
+		detail = "to " + strings.Join(to, ", ") + " failed: " + err.Error()
+	}
+	if err := audit.Record(audit.Event{
+		Action: "mail", Tenant: job.Tenant, TSP: job.TSP, CDR: job.CDR, Crime: job.Crime, Detail: detail,
+	}); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
+
+// shareable returns the number to name a job's reports by and the files
+// to link or attach when they leave the portal by mail or chat: for an
+// anonymized job the pseudonym of cdr, and never the key file that maps
+// pseudonyms back.
+func shareable(cdr string, outputs []string) (string, []string) {
+	if p := pseudo.Target(outputs); p != "" {
+		return p, pseudo.Shareable(outputs)
+	}
+	return cdr, outputs
+}
+
+// remap points the paths of files in m that were moved, from[i] to to[i],
+// at where they are now.
+func remap(m map[string][]string, from, to []string) {
+	moved := map[string]string{}
+	for i, p := range from {
+		moved[p] = to[i]
+	}
+	for _, files := range m {
+		for i, p := range files {
+			if q, ok := moved[p]; ok {
+				files[i] = q
+			}
+		}
+	}
+}
+
+// outputDir is where a tenant's reports are published: filtered/ itself
+// without tenants, otherwise the tenant's own sub-directory.
+func outputDir(tenant string) string { return filepath.Join("filtered", tenant) }
+
+// statusCancelled answers for a job cancelled before it finished: nginx's
+// 499 Client Closed Request, there being no standard code for it.
+const statusCancelled = 499
+
+// processStatus maps a process error to an HTTP status code.
+func processStatus(err error) int {
+	if errors.Is(err, upload.ErrRejected) || errors.Is(err, workbook.ErrSheet) ||
+		errors.Is(err, archive.ErrNested) || errors.Is(err, archive.ErrUnsupported) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, archive.ErrLimit) {
+		return http.StatusRequestEntityTooLarge
+	}
+	var rep *validate.Report
+	if errors.As(err, &rep) {
+		return http.StatusUnprocessableEntity
+	}
+	var over *quota.ExceededError
+	if errors.As(err, &over) {
+		return http.StatusInsufficientStorage
+	}
+	if errors.Is(err, errShutdown) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, jobs.ErrCancelled) || errors.Is(err, context.Canceled) {
+		return statusCancelled
+	}
+	return http.StatusInternalServerError
+}
+
+func isPDF(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return pdftable.Is(f)
+}
+
+// fromPDF writes the table of the PDF export at path to a CSV of the same
+// name under dir, and returns its path and the cells read with low
+// confidence.
+func fromPDF(path, dir string) (string, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	t, err := pdftable.Read(f, st.Size())
+	if err != nil {
+		return "", nil, err
+	}
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	out, err := os.Create(filepath.Join(dir, base+".csv"))
+	if err != nil {
+		return "", nil, err
+	}
+	w := csv.NewWriter(out)
+	w.WriteAll(t.Rows)
+	if err := errors.Join(w.Error(), out.Close()); err != nil {
+		return "", nil, err
+	}
+	doubts := make([]string, len(t.Doubts))
+	for i, d := range t.Doubts {
+		doubts[i] = d.String()
+	}
+	return out.Name(), doubts, nil
+}
+
+func isWorkbook(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return workbook.Is(f)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/airtel"
+	"github.com/jalad-shrimali/cdr-filter/bsnl"
+	"github.com/jalad-shrimali/cdr-filter/internal/atrest"
+	"github.com/jalad-shrimali/cdr-filter/internal/audit"
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/enrich"
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/pseudo"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+	"github.com/jalad-shrimali/cdr-filter/internal/summary"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+	"github.com/jalad-shrimali/cdr-filter/internal/upload"
+	"github.com/jalad-shrimali/cdr-filter/internal/workers"
+	"github.com/jalad-shrimali/cdr-filter/jio"
+	"github.com/jalad-shrimali/cdr-filter/vi"
+)
+
+// tsp_type → the TSP's per-row enrichment of a canonical row
+var enrichers = map[string]canon.Pipeline{
+	"jio":    jio.Enrichers,
+	"vi":     vi.Enrichers,
+	"bsnl":   bsnl.Enrichers,
+	"airtel": airtel.Enrichers,
+}
+
+// POST /cases/{id}/reprocess: run the newest job of every number in the
+// case again from its stored records, with the reference tables as now
+// loaded; the original uploads are not needed. The jobs queue as bulk
+// work behind uploads unless priority says otherwise.
+func reprocessHandler(w http.ResponseWriter, r *http.Request) {
+	caseID, t := r.PathValue("id"), tenant.Of(r)
+	priority := workers.Bulk
+	if p := r.FormValue("priority"); p != "" {
+		var err error
+		if priority, err = workers.ParsePriority(p); err != nil {
+			http.Error(w, "priority: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	list, err := jobs.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var (
+		keys   []string
+		latest = map[string]*jobs.Job{} // tsp and number → newest done job
+	)
+	for _, j := range list {
+		if j.Tenant != t || j.Crime != caseID || j.Status != "done" || j.Summary || j.CDR == "" {
+			continue
+		}
+		k := j.TSP + " " + j.CDR
+		if _, ok := latest[k]; !ok {
+			keys = append(keys, k)
+		}
+		latest[k] = j
+	}
+	if len(keys) == 0 {
+		http.Error(w, "no processed CDRs for this case", http.StatusNotFound)
+		return
+	}
+
+	type result struct {
+		Job      string   `json:"job"`
+		From     string   `json:"reprocessed_from"`
+		TSP      string   `json:"tsp"`
+		CDR      string   `json:"cdr"`
+		Status   string   `json:"status"`
+		Error    string   `json:"error,omitempty"`
+		Coverage []string `json:"coverage,omitempty"`
+		Outputs  []string `json:"outputs,omitempty"`
+	}
+	results := []result{}
+	failed := 0
+	for _, k := range keys {
+		old := latest[k]
+		job, err := reprocess(r.Context(), old, priority)
+		res := result{From: old.ID, TSP: old.TSP, CDR: old.CDR, Status: "done"}
+		if job != nil {
+			res.Job, res.Coverage = job.ID, job.Coverage
+			for _, p := range job.Outputs {
+				res.Outputs = append(res.Outputs, filepath.Base(p))
+			}
+		}
+		if err != nil {
+			failed++
+			res.Status, res.Error = "failed", err.Error()
+			log.Printf("reprocess %s: job %s: %v", caseID, old.ID, err)
+		}
+		results = append(results, res)
+	}
+	if err := audit.Record(audit.Event{
+		Action: "reprocess", Tenant: t, Crime: caseID,
+		Detail: fmt.Sprintf("%d reprocessed, %d failed", len(keys)-failed, failed),
+	}); err != nil {
+		log.Printf("audit: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if failed > 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(results)
+}
+
+// reprocess runs old's stored records through enrichment and the shared
+// post-processing steps again as a new job with old's case details and
+// settings.
+func reprocess(ctx context.Context, old *jobs.Job, priority workers.Priority) (*jobs.Job, error) {
+	pipe, ok := enrichers[old.TSP]
+	if !ok {
+		return nil, fmt.Errorf("unknown tsp_type %q", old.TSP)
+	}
+	records := jobs.Records(old)
+	if records == "" {
+		return nil, fmt.Errorf("job %s has no stored records", old.ID)
+	}
+	in, err := atrest.Open(records)
+	if err != nil {
+		return nil, err
+	}
+	src, err := upload.Store(in, old.CDR+"_records.csv")
+	in.Close()
+	if err != nil {
+		return nil, err
+	}
+	opt, err := settings(old)
+	if err != nil {
+		return nil, err
+	}
+	opt.Priority = priority.String()
+	if opt.Anonymize {
+		// the records hold pseudonyms, which no reference table knows
+		if err := reveal(src, old); err != nil {
+			return nil, fmt.Errorf("job %s: %w", old.ID, err)
+		}
+	}
+	job, err := run(ctx, old.TSP, src, "", opt, reenrich(old.CDR, pipe))
+	job.From = old.ID
+	if serr := jobs.Save(job); serr != nil {
+		log.Printf("jobs: %v", serr)
+	}
+	return job, err
+}
+
+// settings returns the options old ran with: its case details and the
+// form fields it recorded, read as the upload form is.
+func settings(old *jobs.Job) (canon.Options, error) {
+	v := url.Values{}
+	for _, s := range old.Settings {
+		k, val, _ := strings.Cut(s, "=")
+		v.Add(k, val)
+	}
+	if err := checkOptions(old.TSP, v); err != nil {
+		return canon.Options{}, fmt.Errorf("job %s settings: %w", old.ID, err)
+	}
+	opt := canon.OptionsFromValues(v)
+	opt.Crime, opt.Officer, opt.FIR, opt.Unit, opt.Remarks = old.Crime, old.Officer, old.FIR, old.Unit, old.Remarks
+	// jobs from before settings were recorded kept these two alone
+	opt.Columns, opt.Locale = old.Columns, old.Locale
+	opt.Tenant = old.Tenant
+	opt.Sheet = "" // the stored records are a CSV, not the workbook
+	return opt, nil
+}
+
+// reveal puts the identifiers back into the records at src of old, an
+// anonymized job, with the key file among its outputs.
+func reveal(src string, old *jobs.Job) error {
+	p := pseudo.Key(old.Outputs)
+	if p == "" {
+		return errors.New("anonymized, but its pseudonym key is gone")
+	}
+	key, err := atrest.Open(p)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	return pseudo.Reveal(src, key)
+}
+
+// reenrich returns the first step for a job's stored records: it lays them
+// out in the current canonical columns, fills the enrichment again and
+// writes the reports a normalizer writes. Duplicates went with the first
+// run and times are already in the output zone.
+func reenrich(cdr string, pipe canon.Pipeline) func(context.Context, string, canon.Options) (canon.Result, error) {
+	return func(ctx context.Context, src string, opt canon.Options) (canon.Result, error) {
+		// raw columns the first run kept stay after the canonical ones
+		stored, err := canon.ReadHeader(src)
+		if err != nil {
+			return canon.Result{}, err
+		}
+		header := append(canon.Header(), canon.RawHeaders(stored)...)
+		col := canon.Index(header)
+		filteredPath := filepath.Join(opt.Dir, cdr+"_reports.csv")
+		out, err := os.Create(filteredPath)
+		if err != nil {
+			return canon.Result{}, err
+		}
+		defer out.Close()
+		w := safecsv.NewWriter(out)
+		_ = w.Write(header)
+		sum := summary.New(cdr, opt.ExcludeService)
+
+		var from map[string]int
+		err = canon.ScanReport(src, func(h, rec []string) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if from == nil {
+				from = canon.Index(h)
+			}
+			row := canon.Select(rec, from, header)
+			row[col["Flags"]] = "" // the rules run again below
+			pipe.Apply(row, col, opt.Skip)
+			sum.Add(row, col)
+			return w.Write(row)
+		})
+		if err != nil {
+			return canon.Result{}, err
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return canon.Result{}, err
+		}
+
+		findings, err := enrich.Rules(filteredPath, filepath.Join(opt.Dir, cdr+"_findings_reports.csv"), cdr, opt)
+		if err != nil {
+			return canon.Result{}, err
+		}
+		reports, err := sum.Write(filepath.Join(opt.Dir, cdr))
+		if err != nil {
+			return canon.Result{}, err
+		}
+		res := canon.Result{
+			CDR:     cdr,
+			Outputs: append(append([]string{filteredPath}, reports...), findings...),
+		}
+		if opt.Anonymize {
+			if res.Outputs, err = pseudo.Files(res.Outputs, cdr); err != nil {
+				return canon.Result{}, err
+			}
+		}
+		return res, nil
+	}
+}
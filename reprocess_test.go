@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/pseudo"
+	"github.com/jalad-shrimali/cdr-filter/internal/upload"
+	"github.com/jalad-shrimali/cdr-filter/internal/workers"
+)
+
+// TestReprocessAnonymized checks that reprocessing an anonymized job runs
+// with the settings of the first run and pseudonymizes the real numbers
+// again, not the pseudonyms the stored records hold.
+func TestReprocessAnonymized(t *testing.T) {
+	fixture, err := filepath.Abs(filepath.Join("testdata", "jio.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	in, err := os.Open(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := upload.Store(in, "jio.csv")
+	in.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := canon.OptionsFromValues(url.Values{
+		"crime_number": {"FIR-1"}, "anonymize": {"true"}, "exclude_service": {"true"},
+		"keep_raw": {"true"}, "source_row": {"true"}, "skip": {"roaming"}, "scene": {"22.7196,75.8577"},
+	})
+	old, err := process(context.Background(), "jio", src, "", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := reprocess(context.Background(), old, workers.Bulk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(job.Settings, old.Settings) {
+		t.Errorf("settings = %q, want %q", job.Settings, old.Settings)
+	}
+	const real = "9876500001"
+	for _, p := range job.Outputs {
+		if strings.Contains(filepath.Base(p), real) {
+			t.Errorf("output %s names the target", filepath.Base(p))
+		}
+	}
+	report, err := os.ReadFile(job.Outputs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(report), real) {
+		t.Errorf("%s holds the target number", filepath.Base(job.Outputs[0]))
+	}
+
+	// the new key maps back to real identifiers, not to the first run's
+	// pseudonyms
+	key := pseudo.Key(job.Outputs)
+	if key == "" {
+		t.Fatal("no pseudonym key among the outputs")
+	}
+	f, err := os.Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	rows, err := r.ReadAll()
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var originals []string
+	for _, row := range rows[1:] {
+		originals = append(originals, row[2])
+		if kind := row[1]; strings.HasPrefix(row[2], kind+"-") {
+			t.Errorf("key maps %s to the pseudonym %s", row[0], row[2])
+		}
+	}
+	if !slices.Contains(originals, real) {
+		t.Errorf("key does not map back to %s", real)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/audit"
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/upload"
+)
+
+// POST /jobs/{id}/retry: run a failed job's stored upload again with what
+// was found wrong given by hand, e.g. cdr=9876543210 when the number could
+// not be found, map="Date=Dt of Call" or a mapping file for headers no
+// layout knows, or another tsp_type, instead of uploading the export
+// again. The form takes an upload's fields; case details left out are the
+// failed job's.
+func retryHandler(w http.ResponseWriter, r *http.Request) {
+	old, err := loadJob(r, r.PathValue("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if old.Status != "failed" {
+		http.Error(w, "only failed jobs are retried", http.StatusConflict)
+		return
+	}
+	if _, err := os.Stat(old.Upload); err != nil {
+		http.Error(w, "the job's upload is no longer stored", http.StatusGone)
+		return
+	}
+	tsp := strings.ToLower(r.FormValue("tsp_type"))
+	if tsp == "" {
+		tsp = old.TSP
+	}
+	if _, ok := normalizers[tsp]; !ok {
+		http.Error(w, "unknown tsp_type", http.StatusBadRequest)
+		return
+	}
+	if err := checkOptions(tsp, r.Form); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mapping, err := mappingFile(r, tsp)
+	if err != nil {
+		http.Error(w, "mapping: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opt := canon.OptionsFromRequest(r)
+	opt.Tenant = old.Tenant
+	opt.Mapping = mapping.Merge(opt.Mapping)
+	retain(&opt.Crime, old.Crime)
+	retain(&opt.Officer, old.Officer)
+	retain(&opt.FIR, old.FIR)
+	retain(&opt.Unit, old.Unit)
+	retain(&opt.Remarks, old.Remarks)
+	retain(&opt.Locale, old.Locale)
+	retain(&opt.Priority, old.Priority)
+	if opt.Columns == nil {
+		opt.Columns = old.Columns
+	}
+
+	// the new job takes the upload over; a second retry of the same
+	// failed job finds it gone
+	src, err := upload.Reissue(old.Upload)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "the job's upload is no longer stored", http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	job, err := process(r.Context(), tsp, src, "", opt)
+	if job.Status == "" { // rejected before it ran, e.g. over quota
+		http.Error(w, err.Error(), processStatus(err))
+		return
+	}
+	job.Retried = old.ID
+	if serr := jobs.Save(job); serr != nil {
+		log.Printf("jobs: %v", serr)
+	}
+	detail := "job " + old.ID + " as " + job.ID + ": " + job.Status
+	if len(job.Overrides) > 0 {
+		detail += " with " + strings.Join(job.Overrides, ", ")
+	}
+	if aerr := audit.Record(audit.Event{
+		Action: "retry", Tenant: opt.Tenant, TSP: tsp, CDR: job.CDR, Crime: opt.Crime, Detail: detail,
+	}); aerr != nil {
+		log.Printf("audit: %v", aerr)
+	}
+	w.Header().Set("X-Job-ID", job.ID)
+	setCoverage(w, job)
+	if err != nil {
+		http.Error(w, err.Error(), processStatus(err))
+		return
+	}
+	writeLinks(w, r, job)
+}
+
+// retain sets *field to old when the retry form left it empty.
+func retain(field *string, old string) {
+	if *field == "" {
+		*field = old
+	}
+}
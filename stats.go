@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/stats"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+)
+
+// GET /stats[?period=day|week|month&from=&to=&tenant=]: per TSP, the files
+// processed, failed and cancelled, average rows and processing time, and
+// the share of rows each reference table enriched, overall and per period
+// (month by default). from and to are dates, both included. Admins see
+// every tenant's jobs, or one tenant's with tenant=; other callers only
+// their own.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	bucket, err := stats.ParseBucket(q.Get("period"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var f stats.Filter
+	if v := q.Get("from"); v != "" {
+		if f.From, err = time.ParseInLocation(time.DateOnly, v, time.Local); err != nil {
+			http.Error(w, "from: want YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if f.To, err = time.ParseInLocation(time.DateOnly, v, time.Local); err != nil {
+			http.Error(w, "to: want YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		f.To = f.To.AddDate(0, 0, 1)
+	}
+	switch {
+	case !tenant.Enabled():
+	case tenant.Admin(r) && q.Has("tenant"):
+		f.Tenants = []string{q.Get("tenant")}
+	case !tenant.Admin(r):
+		f.Tenants = []string{tenant.Of(r)}
+	}
+
+	list, err := jobs.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out, err := stats.Of(list, f, bucket)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
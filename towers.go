@@ -0,0 +1,79 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+)
+
+// maxTowers caps the towers one GET /towers answer lists.
+const maxTowers = 5000
+
+// tower is a located cell of a TSP's cell DB.
+type tower struct {
+	TSP string `json:"tsp"`
+	canon.Tower
+}
+
+// GET /towers?bbox=minLon,minLat,maxLon,maxLat[&tsp=][&limit=]: the cells of
+// the loaded cell DBs located inside the box, of every TSP or of tsp, so
+// the web UI can show where the DBs cover an area before an analyst relies
+// on the location columns. count has the cells in the box per TSP; towers
+// lists at most limit of them (5000 at most), truncated saying whether it
+// left some out.
+func towersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	box, err := canon.ParseBBox(q.Get("bbox"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tsps := slices.Sorted(maps.Keys(towers))
+	if t := q.Get("tsp"); t != "" {
+		if _, ok := towers[t]; !ok {
+			http.Error(w, "unknown tsp_type", http.StatusBadRequest)
+			return
+		}
+		tsps = []string{t}
+	}
+	limit := maxTowers
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "limit: want a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxTowers)
+	}
+
+	count := map[string]int{}
+	in := []tower{}
+	for _, tsp := range tsps {
+		count[tsp] = 0
+		for _, t := range towers[tsp]() {
+			if box.Contains(t) {
+				count[tsp]++
+				in = append(in, tower{tsp, t})
+			}
+		}
+	}
+	slices.SortFunc(in, func(a, b tower) int {
+		return cmp.Or(cmp.Compare(a.TSP, b.TSP), cmp.Compare(a.Cell, b.Cell))
+	})
+	truncated := len(in) > limit
+	if truncated {
+		in = in[:limit]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		BBox      canon.BBox     `json:"bbox"`
+		Count     map[string]int `json:"count"`
+		Towers    []tower        `json:"towers"`
+		Truncated bool           `json:"truncated"`
+	}{box, count, in, truncated})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestUploadZip checks that a ZIP sent to /upload is unpacked and each
+// export in it processed as a job of its own, and that a ZIP holding
+// another archive, or a file merely named .zip, is refused.
+func TestUploadZip(t *testing.T) {
+	fixture := func(name string) []byte {
+		b, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	zipOf := func(files map[string][]byte) []byte {
+		var b bytes.Buffer
+		zw := zip.NewWriter(&b)
+		for name, data := range files {
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(data)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return b.Bytes()
+	}
+	jio := fixture("jio.csv")
+	exports := map[string][]byte{"march/jio.csv": jio, "march/jio_v1.csv": fixture("jio_v1.csv")}
+	t.Chdir(t.TempDir())
+
+	for _, tc := range []struct {
+		name   string
+		file   string
+		data   []byte
+		status int
+		jobs   int
+	}{
+		{"exports", "cdrs.zip", zipOf(exports), http.StatusOK, 2},
+		{"nested", "cdrs.zip", zipOf(map[string][]byte{"inner.zip": zipOf(exports)}), http.StatusBadRequest, 0},
+		{"not a zip", "cdrs.zip", jio, http.StatusBadRequest, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			mw.WriteField("tsp_type", "jio")
+			mw.WriteField("crime_number", "FIR-1")
+			fw, err := mw.CreateFormFile("file", tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(tc.data)
+			mw.Close()
+			req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			req.Header.Set("Accept", "application/json")
+			rec := httptest.NewRecorder()
+			uploadHandler(rec, req)
+
+			if rec.Code != tc.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+			if got := len(rec.Header().Values("X-Job-ID")); got != tc.jobs {
+				t.Errorf("%d jobs, want %d", got, tc.jobs)
+			}
+			if kept, _ := filepath.Glob("uploads/*/*.zip"); len(kept) > 0 {
+				t.Errorf("archive kept after processing: %q", kept)
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			var links []struct{ Name string }
+			if err := json.Unmarshal(rec.Body.Bytes(), &links); err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, l := range links {
+				found = found || l.Name == "9876500001_reports.csv"
+			}
+			if !found {
+				t.Errorf("no main report among the links: %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/dlink"
+	"github.com/jalad-shrimali/cdr-filter/internal/evidence"
+	"github.com/jalad-shrimali/cdr-filter/internal/history"
+	"github.com/jalad-shrimali/cdr-filter/internal/jobs"
+	"github.com/jalad-shrimali/cdr-filter/internal/tenant"
+)
+
+// version is one job's delivery of reports for a case.
+type version struct {
+	Job       string        `json:"job"`
+	CDR       string        `json:"cdr,omitempty"`
+	TSP       string        `json:"tsp"`
+	Status    string        `json:"status"`
+	Created   time.Time     `json:"created"`
+	Finished  time.Time     `json:"finished,omitempty"`
+	From      string        `json:"reprocessed_from,omitempty"`
+	Retried   string        `json:"retried_from,omitempty"`
+	Settings  []string      `json:"settings,omitempty"`
+	Overrides []string      `json:"overrides,omitempty"`
+	Versions  []string      `json:"versions,omitempty"` // of the tool, mapping and tables
+	Files     []versionFile `json:"files"`
+}
+
+type versionFile struct {
+	Name    string `json:"name"`
+	URL     string `json:"url,omitempty"` // "" once the file was removed
+	SHA256  string `json:"sha256,omitempty"`
+	Current bool   `json:"current"` // the newest version, not replaced or superseded
+}
+
+// GET /cases/{id}/versions: every delivery of reports for the case,
+// oldest first, with when it was made, the settings and the tool, mapping
+// and table versions it was made with, and links to its files, whether
+// still the current ones or kept as earlier versions.
+func versionsHandler(w http.ResponseWriter, r *http.Request) {
+	caseID, t := r.PathValue("id"), tenant.Of(r)
+	list, err := jobs.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// a file under its own name is the current version of the newest job
+	// listing it
+	newest := map[string]string{}
+	for _, j := range list {
+		for _, p := range j.Outputs {
+			newest[p] = j.ID
+		}
+	}
+	out := []version{}
+	for _, j := range list {
+		if j.Tenant != t || j.Crime != caseID {
+			continue
+		}
+		v := version{
+			Job: j.ID, CDR: j.CDR, TSP: j.TSP, Status: j.Status, Created: j.Created, Finished: j.Finished,
+			From: j.From, Retried: j.Retried, Settings: j.Settings, Overrides: j.Overrides, Versions: j.Versions,
+			Files: []versionFile{},
+		}
+		for _, p := range j.Outputs {
+			name := filepath.Base(p)
+			f := versionFile{Name: name, SHA256: j.SHA256[name]}
+			if _, err := os.Stat(p); err == nil {
+				f.URL = dlink.Path(dlink.Name(p))
+				of, _ := evidence.Unversioned(name)
+				f.Current = newest[p] == j.ID && !strings.Contains(filepath.ToSlash(p), "/"+history.Dir+"/") &&
+					evidence.Latest(filepath.Join(filepath.Dir(p), of)) == p
+			}
+			v.Files = append(v.Files, f)
+		}
+		out = append(out, v)
+	}
+	if len(out) == 0 {
+		http.Error(w, "no reports for this case", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
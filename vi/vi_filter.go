@@ -1,31 +1,30 @@
 package vi
 
 import (
+	"context"
 	"embed"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
-	"net/http"
 	"path/filepath"
 	"regexp"
-	"sort"
-	"strconv"
 	"strings"
-	"time"
+
+	"github.com/jalad-shrimali/cdr-filter/internal/canon"
+	"github.com/jalad-shrimali/cdr-filter/internal/celldb"
+	"github.com/jalad-shrimali/cdr-filter/internal/enrich"
+	"github.com/jalad-shrimali/cdr-filter/internal/pseudo"
+	"github.com/jalad-shrimali/cdr-filter/internal/refdata"
+	"github.com/jalad-shrimali/cdr-filter/internal/safecsv"
+	"github.com/jalad-shrimali/cdr-filter/internal/summary"
+	"github.com/jalad-shrimali/cdr-filter/internal/workbook"
 )
 
 /* canonical 26-column output header */
-var targetHeader = []string{
-	"CdrNo", "B Party", "Date", "Time", "Duration", "Call Type",
-	"First Cell ID", "First Cell ID Address", "Last Cell ID", "Last Cell ID Address",
-	"IMEI", "IMSI", "Roaming",
-	"Main City(First CellID)", "Sub City (First CellID)", "Lat-Long-Azimuth (First CellID)",
-	"Crime", "Circle", "Operator", "LRN",
-	"CallForward", "B Party Provider", "B Party Circle", "B Party Operator",
-	"Type", "IMEI Manufacturer",
-}
+var targetHeader = canon.Header()
 
 /* helpers */
 var (
@@ -36,6 +35,10 @@ func norm(s string) string { return spaceRE.ReplaceAllString(strings.ToLower(str
 func digits(s string) string { return nonDigit.ReplaceAllString(s, "") }
 func cleanCGI(s string) string { return digits(s) }
 
+// ruler reports whether rec is one of the dashed lines VI draws around
+// the header rather than a call.
+func ruler(rec []string) bool { return strings.Trim(strings.Join(rec, ""), "- ") == "" }
+
 /* column index finder */
 func colIdxAny(header []string, keys ...string) int {
 	for _, k := range keys {
@@ -49,6 +52,31 @@ func colIdxAny(header []string, keys ...string) int {
 }
 func colIdx(header []string, key string) int { return colIdxAny(header, key) }
 
+/* source columns feeding each canonical column */
+var sourceColumns = map[string][]string{
+	"Date":                  {"call date"},
+	"Time":                  {"call initiation time"},
+	"Duration":              {"call duration", "duration"},
+	"B Party":               {"b party number", "b party no"},
+	"Call Type":             {"call_type"},
+	"First Cell ID":         {"first cell global id"},
+	"First Cell ID Address": {"first bts location"},
+	"Last Cell ID":          {"last cell global id"},
+	"Last Cell ID Address":  {"last bts location"},
+	"B Party Cell ID":       {"b party cell global id", "b party cell id"},
+	"B Party Cell ID Address": {"b party bts location"},
+	"IMEI":                  {"imei"},
+	"IMSI":                  {"imsi"},
+	"Roaming":               {"roaming network/circle", "roaming network"},
+	"LRN":                   {"lrn- b party number", "lrn b party number"},
+	"Type":                  {"service type"},
+	"Connection Type":       {"connection type", "subscriber type"},
+}
+
+// SourceColumns lists, per canonical column, the VI export headers it is
+// read from.
+func SourceColumns() map[string][]string { return sourceColumns }
+
 /* CDR extractor */
 var msisdnRE = regexp.MustCompile(`(?i)msisdn[^0-9]*([0-9]{8,15})`)
 func extractCdrNumber(line string) string {
@@ -67,23 +95,37 @@ type CellInfo struct{ Addr, Sub, Main, LatLonAz string }
 type LRNInfo struct{ Provider, Circle, Operator string }
 
 var (
-	cellDB = map[string]map[string]CellInfo{}
-	lrnDB  = map[string]LRNInfo{}
+	cellDB refdata.Table[map[string]map[string]CellInfo] // tsp → cell id → info
+	lrnDB  refdata.Table[map[string]LRNInfo]
 )
 
+/* a missing or unreadable table disables its enrichment instead of stopping
+   the service; refdata reports it and reloads it on request */
 func init() {
-	if err := loadCells("vi", "data/vi_cells.csv"); err != nil && !errors.Is(err, os.ErrNotExist) {
-		panic(fmt.Errorf("loadCells vi failed: %w", err))
-	}
-	if err := loadLRN("data/LRN.csv"); err != nil && !errors.Is(err, os.ErrNotExist) {
-		fmt.Printf("Warning: LRN.csv not loaded: %v\n", err)
-	}
+	refdata.Load("vi", "cells", func() error { return loadCells("vi", "data/vi_cells.csv") })
+	refdata.Load("vi", "LRN", func() error { return loadLRN("data/LRN.csv") })
 }
 
+/* loadCells loads cell DB from every copy of the CSV, merged by celldb */
 func loadCells(tsp, path string) error {
-	f, err := dataFS.Open(path)
+	srcs, err := celldb.Open("vi", dataFS, path)
 	if err != nil { return err }
-	defer f.Close()
+	for _, s := range srcs { defer s.Close() }
+	m := celldb.New(tsp)
+	db := map[string]CellInfo{}
+	for _, s := range srcs {
+		if err := readCells(s, s.Name, m, db); err != nil { return err }
+	}
+	m.Done()
+	all := maps.Clone(cellDB.Get())
+	if all == nil { all = map[string]map[string]CellInfo{} }
+	all[tsp] = db
+	cellDB.Set(all)
+	return nil
+}
+
+/* readCells adds the cells of one copy of the cell DB to db */
+func readCells(f io.Reader, name string, m *celldb.Merge, db map[string]CellInfo) error {
 	r := csv.NewReader(f)
 	header, err := r.Read()
 	if err != nil { return err }
@@ -102,8 +144,7 @@ func loadCells(tsp, path string) error {
 	iLat := col("latitude", "lat")
 	iLon := col("longitude", "lon", "long")
 	iAz := col("azimuth", "azm", "az")
-	if iID == -1 { return fmt.Errorf("no CGI column in %s", path) }
-	cellDB[tsp] = map[string]CellInfo{}
+	if iID == -1 { return fmt.Errorf("no CGI column in %s", name) }
 	for {
 		rec, err := r.Read()
 		if err == io.EOF { break }
@@ -116,14 +157,16 @@ func loadCells(tsp, path string) error {
 			Main:     pick(rec, iMain),
 			LatLonAz: buildLat(rec, iLat, iLon, iAz),
 		}
-		cellDB[tsp][cgi] = info
-		cellDB[tsp][digits(cgi)] = info
+		if m.Add(name, digits(cgi), info.LatLonAz, info.Addr) {
+			db[cgi] = info
+			db[digits(cgi)] = info
+		}
 	}
 	return nil
 }
 
 func loadLRN(path string) error {
-	f, err := dataFS.Open(path)
+	f, err := refdata.Open("vi", dataFS, path)
 	if err != nil { return err }
 	defer f.Close()
 	r := csv.NewReader(f)
@@ -133,18 +176,20 @@ func loadLRN(path string) error {
 	iTSP := colIdxAny(header, "tsp", "provider", "tsp-lsa")
 	iCircle := colIdxAny(header, "circle")
 	if iLRN == -1 { return fmt.Errorf("no LRN column in %s", path) }
+	db := map[string]LRNInfo{}
 	for {
 		rec, err := r.Read()
 		if err == io.EOF { break }
 		if err != nil || len(rec) == 0 { continue }
 		lrn := digits(rec[iLRN])
 		if lrn == "" { continue }
-		lrnDB[lrn] = LRNInfo{
+		db[lrn] = LRNInfo{
 			Provider: pick(rec, iTSP),
 			Circle:   pick(rec, iCircle),
 			Operator: pick(rec, iTSP),
 		}
 	}
+	lrnDB.Set(db)
 	return nil
 }
 
@@ -159,56 +204,58 @@ func buildLat(rec []string, iLat, iLon, iAz int) string {
 	if az := pick(rec, iAz); az != "" { return lat + ", " + lon + ", " + az }
 	return lat + ", " + lon
 }
-func findCell(tsp, id string) (CellInfo, bool) {
-	db := cellDB[tsp]
-	if info, ok := db[id]; ok { return info, true }
-	if info, ok := db[digits(id)]; ok { return info, true }
-	return CellInfo{}, false
-}
-
-func saveUploaded(r io.Reader, dst string) error {
-	f, err := os.Create(dst)
-	if err != nil { return err }
-	defer f.Close()
-	_, err = io.Copy(f, r)
-	return err
-}
-
-func UploadAndNormalizeCSV(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "POST only", 405)
-		return
-	}
-	if strings.ToLower(r.FormValue("tsp_type")) != "vi" {
-		http.Error(w, "Only VI supported", 400)
-		return
+// Enrichers is the enrichment Normalize runs on each row, this TSP's
+// cell and LRN lookups among the shared steps; it is run again over
+// stored records once the tables are updated.
+var Enrichers = enrich.Pipeline("vi", enrichCells, enrichLRN)
+
+// enrichCells fills the first cell's details and the B party cell's
+// address; the export's own tower addresses are kept
+func enrichCells(row []string, col map[string]int) {
+	if firstID := row[col["First Cell ID"]]; firstID != "" {
+		if info, ok := findCell("vi", firstID); ok {
+			row[col["Main City(First CellID)"]] = info.Main
+			row[col["Sub City (First CellID)"]] = info.Sub
+			row[col["Lat-Long-Azimuth (First CellID)"]] = info.LatLonAz
+			if row[col["First Cell ID Address"]] == "" {
+				row[col["First Cell ID Address"]] = info.Addr
+			}
+		}
 	}
-	crime := r.FormValue("crime_number")
-
-	fh, hdr, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, err.Error(), 400)
-		return
+	if bID := row[col["B Party Cell ID"]]; bID != "" && row[col["B Party Cell ID Address"]] == "" {
+		if info, ok := findCell("vi", bID); ok {
+			row[col["B Party Cell ID Address"]] = info.Addr
+		}
 	}
-	defer fh.Close()
-
-	os.MkdirAll("uploads", 0o755)
-	os.MkdirAll("filtered", 0o755)
+}
 
-	src := filepath.Join("uploads", hdr.Filename)
-	if err := saveUploaded(fh, src); err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+/* provider/circle/operator from LRN */
+func enrichLRN(row []string, col map[string]int) {
+	if l := digits(row[col["LRN"]]); l != "" {
+		if info, ok := lrnDB.Get()[l]; ok {
+			row[col["B Party Provider"]] = info.Provider
+			row[col["B Party Circle"]] = info.Circle
+			row[col["B Party Operator"]] = info.Operator
+		}
 	}
+}
 
-	filtered, summary, maxCalls, maxDuration, maxStay, err := normVI(src, crime)
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+// Towers returns the cells of the Vi cell DB that have a location, each once
+// (the DB keeps a cell under its CGI as given and its digits).
+func Towers() []canon.Tower {
+	var out []canon.Tower
+	for id, info := range cellDB.Get()["vi"] {
+		if id != digits(id) { continue }
+		if t, ok := canon.NewTower(id, info.LatLonAz, info.Addr, info.Main); ok { out = append(out, t) }
 	}
+	return out
+}
 
-	fmt.Fprintf(w, "/download/%s\n/download/%s\n/download/%s\n/download/%s\n/download/%s\n",
-		filepath.Base(filtered), filepath.Base(summary), filepath.Base(maxCalls), filepath.Base(maxDuration), filepath.Base(maxStay))
+func findCell(tsp, id string) (CellInfo, bool) {
+	db := cellDB.Get()[tsp]
+	if info, ok := db[id]; ok { return info, true }
+	if info, ok := db[digits(id)]; ok { return info, true }
+	return CellInfo{}, false
 }
 
 func last10(s string) string {
@@ -218,84 +265,83 @@ func last10(s string) string {
 	return s[len(s)-10:]
 }
 
-func normVI(src, crime string) (string, string, string, string, string, error) {
+/* rows of the export: the CSV, or the first (or the named) worksheet when
+   VI sends the workbook itself */
+func openRows(in *os.File, sheet string) (interface{ Read() ([]string, error) }, error) {
+	if !workbook.Is(in) { return csv.NewReader(in), nil }
+	st, err := in.Stat()
+	if err != nil { return nil, err }
+	return workbook.Open(in, st.Size(), sheet)
+}
+
+// Normalize converts a VI CDR export at src into the canonical reports.
+// It stops with ctx's error once ctx is done.
+func Normalize(ctx context.Context, src string, opt canon.Options) (canon.Result, error) {
 	in, err := os.Open(src)
-	if err != nil { return "", "", "", "", "", err }
+	if err != nil { return canon.Result{}, err }
 	defer in.Close()
-	r := csv.NewReader(in)
+	rows, err := openRows(in, opt.Sheet)
+	if err != nil { return canon.Result{}, err }
+	r := canon.SkipLines("vi", rows)
 
 	// Find header and CDR
 	var header []string
-	var cdr string
+	cdr := opt.CDR // given by hand on a retry; the banner's otherwise
+	source := opt.Mapping.Source(sourceColumns)
 	for {
 		rec, err := r.Read()
-		if err == io.EOF { return "", "", "", "", "", errors.New("no header found") }
+		if err == io.EOF { return canon.Result{}, errors.New("no header found") }
 		if err != nil { continue }
 		if cdr == "" {
 			cdr = extractCdrNumber(strings.Join(rec, " "))
 		}
-		if colIdx(rec, "call date") != -1 {
+		if colIdxAny(rec, source["Date"]...) != -1 && opt.Mapping.Header(rec) {
 			header = rec
+			r.Header(rec)
 			break
 		}
 	}
 	idxMSISDN := colIdxAny(header, "msisdn", "msisdn no", "msisdn number")
 	firstData, err := r.Read()
-	if err != nil { return "", "", "", "", "", errors.New("header present but no data") }
+	if err != nil { return canon.Result{}, errors.New("header present but no data") }
+	firstLine := canon.Line(r, firstData)
 	if cdr == "" && idxMSISDN != -1 && idxMSISDN < len(firstData) {
 		cdr = digits(firstData[idxMSISDN])
 	}
 	// Removed unused variable cdr10
 
-	idxDate := colIdx(header, "call date")
-	idxTime := colIdx(header, "call initiation time")
-	idxDur := colIdxAny(header, "call duration", "duration")
-	idxBparty := colIdxAny(header, "b party number", "b party no")
-	idxType := colIdx(header, "call_type")
-	idxFirstID := colIdxAny(header, "first cell global id")
-	idxFirstAddr := colIdxAny(header, "first bts location")
-	idxLastID := colIdxAny(header, "last cell global id")
-	idxLastAddr := colIdxAny(header, "last bts location")
-	idxIMEI := colIdx(header, "imei")
-	idxIMSI := colIdx(header, "imsi")
-	idxRoam := colIdxAny(header, "roaming network/circle", "roaming network")
-	idxLRN := colIdxAny(header, "lrn- b party number", "lrn b party number")
-	idxService := colIdx(header, "service type")
-
-	filteredPath := filepath.Join("filtered", cdr+"_reports.csv")
+	srcIdx := func(canonical string) int { return colIdxAny(header, source[canonical]...) }
+	idxDate := srcIdx("Date")
+	idxTime := srcIdx("Time")
+	idxDur := srcIdx("Duration")
+	idxBparty := srcIdx("B Party")
+	idxType := srcIdx("Call Type")
+	idxFirstID := srcIdx("First Cell ID")
+	idxFirstAddr := srcIdx("First Cell ID Address")
+	idxLastID := srcIdx("Last Cell ID")
+	idxLastAddr := srcIdx("Last Cell ID Address")
+	idxBCellID := srcIdx("B Party Cell ID")
+	idxBCellAddr := srcIdx("B Party Cell ID Address")
+	idxIMEI := srcIdx("IMEI")
+	idxIMSI := srcIdx("IMSI")
+	idxRoam := srcIdx("Roaming")
+	idxLRN := srcIdx("LRN")
+	idxService := srcIdx("Type")
+	idxConn := srcIdx("Connection Type")
+
+	filteredPath := filepath.Join(opt.Dir, cdr+"_reports.csv")
 	fout, _ := os.Create(filteredPath)
 	defer fout.Close()
-	fw := csv.NewWriter(fout)
-	_ = fw.Write(targetHeader)
+	fw := safecsv.NewWriter(fout)
+	raw := canon.RawColumns(header, source, opt)
+	_ = fw.Write(raw.Header(targetHeader))
 	col := map[string]int{}
 	for i, h := range targetHeader { col[h] = i }
+	var dedup canon.Dedup
+	clock := canon.ClockFor("vi", canon.Format{})
 	blank := make([]string, len(targetHeader))
 
-	type agg struct {
-		BParty, SDR, Provider, Type           string
-		TotalCalls, OutCalls, InCalls         int
-		OutSMS, InSMS, OtherCalls             int
-		RoamCalls, RoamSMS                    int
-		TotalDuration                         float64
-		Days, CellIds, Imeis, Imsis           map[string]struct{}
-		FirstCall, LastCall                   string
-	}
-	summary := map[string]*agg{}
-
-	type maxStayAgg struct {
-		CellID, Addr, Lat, Lon, Azimuth, Roaming, FirstCall, LastCall string
-		TotalCalls                                                    int
-	}
-	maxStay := map[string]*maxStayAgg{}
-
-	timeLayout := "2006-01-02 15:04:05"
-	parseDT := func(d, t string) string {
-		dt := strings.TrimSpace(d) + " " + strings.TrimSpace(t)
-		if _, e := time.Parse(timeLayout, dt); e == nil {
-			return dt
-		}
-		return dt
-	}
+	sum := summary.New(cdr, opt.ExcludeService)
 
 	cp := func(rec []string, src int, dst string, row []string) {
 		if src >= 0 && src < len(rec) {
@@ -303,239 +349,80 @@ func normVI(src, crime string) (string, string, string, string, string, error) {
 		}
 	}
 
-	writeRow := func(rec []string) {
-		if len(rec) == 0 { return }
+	writeRow := func(rec []string, line int) {
+		if len(rec) == 0 || ruler(rec) { return }
 		row := append([]string(nil), blank...)
 		row[col["CdrNo"]] = cdr
-		row[col["Crime"]] = crime
+		row[col["Crime"]] = opt.Crime
 
 		cp(rec, idxDate, "Date", row)
 		cp(rec, idxTime, "Time", row)
+		clock.Apply(row, col)
 		cp(rec, idxDur, "Duration", row)
 		cp(rec, idxBparty, "B Party", row)
 		cp(rec, idxType, "Call Type", row)
+		row[col["Direction"]] = canon.DirectionOf(row[col["Call Type"]])
 		cp(rec, idxFirstID, "First Cell ID", row)
 		cp(rec, idxFirstAddr, "First Cell ID Address", row)
 		cp(rec, idxLastID, "Last Cell ID", row)
 		cp(rec, idxLastAddr, "Last Cell ID Address", row)
+		cp(rec, idxBCellID, "B Party Cell ID", row)
+		cp(rec, idxBCellAddr, "B Party Cell ID Address", row)
 		cp(rec, idxIMEI, "IMEI", row)
 		cp(rec, idxIMSI, "IMSI", row)
 		cp(rec, idxRoam, "Roaming", row)
 		cp(rec, idxLRN, "LRN", row)
 		cp(rec, idxService, "Type", row)
+		cp(rec, idxConn, "Connection Type", row)
 
-		// enrich cell details
-		if firstID := pick(rec, idxFirstID); firstID != "" {
-			if info, ok := findCell("vi", firstID); ok {
-				row[col["Main City(First CellID)"]] = info.Main
-				row[col["Sub City (First CellID)"]] = info.Sub
-				row[col["Lat-Long-Azimuth (First CellID)"]] = info.LatLonAz
-				if row[col["First Cell ID Address"]] == "" {
-					row[col["First Cell ID Address"]] = info.Addr
-				}
-			}
-		}
-
-		// Provider/circle/operator from LRN
-		if l := digits(pick(rec, idxLRN)); l != "" {
-			if info, ok := lrnDB[l]; ok {
-				row[col["B Party Provider"]] = info.Provider
-				row[col["B Party Circle"]] = info.Circle
-				row[col["B Party Operator"]] = info.Operator
-			}
-		}
+		// enrich cell details; provider/circle/operator from LRN
+		Enrichers.Apply(row, col, opt.Skip)
 
-		fw.Write(row)
-
-		bKey := row[col["B Party"]]
-		if bKey == "" { bKey = "(blank)" }
-		a, ok := summary[bKey]
-		if !ok {
-			a = &agg{
-				BParty: bKey, SDR: row[col["B Party Operator"]],
-				Provider: row[col["B Party Provider"]],
-				Type: row[col["Type"]],
-				Days: map[string]struct{}{}, CellIds: map[string]struct{}{},
-				Imeis: map[string]struct{}{}, Imsis: map[string]struct{}{},
-			}
-			summary[bKey] = a
+		if dedup.Seen(row, col) {
+			return
 		}
 
-		a.TotalCalls++
-		switch row[col["Call Type"]] {
-		case "CALL_OUT": a.OutCalls++
-		case "CALL_IN": a.InCalls++
-		default:
-			if strings.Contains(row[col["Call Type"]], "SMS") {
-				if strings.HasSuffix(row[col["Call Type"]], "OUT") { a.OutSMS++ } else { a.InSMS++ }
-			} else { a.OtherCalls++ }
-		}
-		if row[col["Roaming"]] != "" {
-			if strings.Contains(row[col["Call Type"]], "SMS") { a.RoamSMS++ } else { a.RoamCalls++ }
-		}
-		if dur, err := strconv.ParseFloat(row[col["Duration"]], 64); err == nil {
-			a.TotalDuration += dur
-		}
-		a.Days[row[col["Date"]]] = struct{}{}
-		if firstID := row[col["First Cell ID"]]; firstID != "" { a.CellIds[firstID] = struct{}{} }
-		if lastID := row[col["Last Cell ID"]]; lastID != "" { a.CellIds[lastID] = struct{}{} }
-		if v := row[col["IMEI"]]; v != "" { a.Imeis[v] = struct{}{} }
-		if v := row[col["IMSI"]]; v != "" { a.Imsis[v] = struct{}{} }
-
-		dt := parseDT(row[col["Date"]], row[col["Time"]])
-		if a.FirstCall == "" || dt < a.FirstCall { a.FirstCall = dt }
-		if a.LastCall == "" || dt > a.LastCall { a.LastCall = dt }
-
-		// max stay aggregator for first cell
-		if firstID := row[col["First Cell ID"]]; firstID != "" {
-			ms, ok := maxStay[firstID]
-			if !ok {
-				ms = &maxStayAgg{
-					CellID:    firstID,
-					Addr:      row[col["First Cell ID Address"]],
-					Roaming:   row[col["Roaming"]],
-					FirstCall: dt,
-					LastCall:  dt,
-					TotalCalls: 1,
-				}
-				if llaz := row[col["Lat-Long-Azimuth (First CellID)"]]; llaz != "" {
-					parts := strings.Split(llaz, ",")
-					if len(parts) >= 2 {
-						ms.Lat = strings.TrimSpace(parts[0])
-						ms.Lon = strings.TrimSpace(parts[1])
-					}
-					if len(parts) == 3 {
-						ms.Azimuth = strings.TrimSpace(parts[2])
-					}
-				}
-				maxStay[firstID] = ms
-			} else {
-				ms.TotalCalls++
-				if dt < ms.FirstCall { ms.FirstCall = dt }
-				if dt > ms.LastCall { ms.LastCall = dt }
-			}
+		if !opt.SummaryOnly {
+			fw.Write(raw.Append(row, rec, line))
 		}
+		sum.Add(row, col)
 	}
 
 	// write all rows
-	writeRow(firstData)
+	writeRow(firstData, firstLine)
 	for {
+		if err := ctx.Err(); err != nil { return canon.Result{}, err }
 		rec, err := r.Read()
 		if err == io.EOF { break }
 		if err != nil || len(rec) == 0 { continue }
-		writeRow(rec)
+		writeRow(rec, canon.Line(r, rec))
 	}
 	fw.Flush()
 
-	// Write summary CSV
-	summaryPath := filepath.Join("filtered", cdr+"_summary_reports.csv")
-	sout, _ := os.Create(summaryPath)
-	defer sout.Close()
-	sw := csv.NewWriter(sout)
-	sw.Write([]string{
-		"CdrNo", "B Party", "B Party SDR", "Provider", "Type",
-		"Total Calls", "Out Calls", "In Calls", "Out Sms", "In Sms",
-		"Other Calls", "Roam Calls", "Roam Sms", "Total Duration",
-		"Total Days", "Total CellIds", "Total Imei", "Total Imsi",
-		"First Call", "Last Call",
-	})
-	for _, a := range summary {
-		sw.Write([]string{
-			cdr, a.BParty, a.SDR, a.Provider, a.Type,
-			strconv.Itoa(a.TotalCalls), strconv.Itoa(a.OutCalls), strconv.Itoa(a.InCalls),
-			strconv.Itoa(a.OutSMS), strconv.Itoa(a.InSMS), strconv.Itoa(a.OtherCalls),
-			strconv.Itoa(a.RoamCalls), strconv.Itoa(a.RoamSMS),
-			fmt.Sprintf("%.0f", a.TotalDuration),
-			strconv.Itoa(len(a.Days)), strconv.Itoa(len(a.CellIds)),
-			strconv.Itoa(len(a.Imeis)), strconv.Itoa(len(a.Imsis)),
-			a.FirstCall, a.LastCall,
-		})
-	}
-	sw.Flush()
-
-	// max calls report
-	maxCallsPath := filepath.Join("filtered", cdr+"_max_calls_reports.csv")
-	mcF, _ := os.Create(maxCallsPath)
-	defer mcF.Close()
-	mcw := csv.NewWriter(mcF)
-	mcw.Write([]string{"CdrNo", "B Party", "B Party SDR", "Total Calls", "Provider"})
-
-	totalCalls := 0
-	for _, a := range summary {
-		totalCalls += a.TotalCalls
+	// Tag rows matching the suspicious-pattern rules
+	findings, err := enrich.Rules(filteredPath, filepath.Join(opt.Dir, cdr+"_findings_reports.csv"), cdr, opt)
+	if err != nil {
+		return canon.Result{}, err
 	}
-	mcw.Write([]string{"Total", cdr, "", strconv.Itoa(totalCalls), ""})
 
-	type kv struct {
-		Key string
-		Val *agg
-	}
-	var sorted []kv
-	for k, v := range summary {
-		sorted = append(sorted, kv{k, v})
+	// Summary, max calls, max duration and max stay reports
+	reports, err := sum.Write(filepath.Join(opt.Dir, cdr))
+	if err != nil {
+		return canon.Result{}, err
 	}
-	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Val.TotalCalls > sorted[j].Val.TotalCalls })
 
-	for _, kvp := range sorted {
-		provider := kvp.Val.Provider
-		if provider == "" { provider = "Unknown" }
-		mcw.Write([]string{cdr, kvp.Key, "", strconv.Itoa(kvp.Val.TotalCalls), provider})
+	res := canon.Result{
+		CDR:     cdr,
+		Outputs: append(append([]string{filteredPath}, reports...), findings...),
+		Duplicates: dedup.Removed,
+		Skipped:    r.Skipped,
+		Declared:   r.Declared,
+		Clock:      clock,
 	}
-	mcw.Flush()
-
-	// max duration report
-	maxDurationPath := filepath.Join("filtered", cdr+"_max_duration_reports.csv")
-	mdF, _ := os.Create(maxDurationPath)
-	defer mdF.Close()
-	mdw := csv.NewWriter(mdF)
-	mdw.Write([]string{"CdrNo", "B Party", "B Party SDR", "Total Duration", "Provider"})
-
-	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Val.TotalDuration > sorted[j].Val.TotalDuration })
-
-	for _, kvp := range sorted {
-		provider := kvp.Val.Provider
-		if provider == "" { provider = "Unknown" }
-		mdw.Write([]string{
-			cdr, kvp.Key, "", fmt.Sprintf("%.0f", kvp.Val.TotalDuration), provider,
-		})
-	}
-	mdw.Flush()
-
-	// max stay report
-	maxStayPath := filepath.Join("filtered", cdr+"_max_stay_reports.csv")
-	msF, _ := os.Create(maxStayPath)
-	defer msF.Close()
-	msw := csv.NewWriter(msF)
-	msw.Write([]string{
-		"CdrNo", "Cell ID", "Total Calls", "Tower Address", "Latitude", "Longitude", "Azimuth", "Roaming", "First Call", "Last Call",
-	})
-
-	for _, ms := range maxStay {
-		addr := ms.Addr
-		if addr == "" {
-			addr = "Unknown"
-		}
-		roaming := ms.Roaming
-		if roaming == "" {
-			roaming = "Unknown"
+	if opt.Anonymize {
+		if res.Outputs, err = pseudo.Files(res.Outputs, cdr); err != nil {
+			return canon.Result{}, err
 		}
-		lat := ms.Lat
-		if lat == "" {
-			lat = "0"
-		}
-		lon := ms.Lon
-		if lon == "" {
-			lon = "0"
-		}
-		az := ms.Azimuth
-		if az == "" {
-			az = "0"
-		}
-		msw.Write([]string{
-			cdr, ms.CellID, strconv.Itoa(ms.TotalCalls), addr, lat, lon, az, roaming, ms.FirstCall, ms.LastCall,
-		})
 	}
-	msw.Flush()
-
-	return filteredPath, summaryPath, maxCallsPath, maxDurationPath, maxStayPath, nil
+	return res, nil
 }